@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AIHint marks a position that is interesting for the skirmish AI.
+// AI hints are point (or rectangle) objects with the type 'ai_hint' inside the 'Markers' object layer.
+// The property 'hint' defines the kind of the position, 'priority' (0-255, default 100) its importance.
+type AIHint struct {
+	Type     AIHintType
+	Position Point // in tiles
+	Priority uint8
+}
+
+type AIHintType uint8
+
+const (
+	AIHintType_DefensivePosition AIHintType = 1
+	AIHintType_ExpansionSpot     AIHintType = 2
+	AIHintType_AmbushPoint       AIHintType = 3
+)
+
+// ExtractAIHints reads all AI hints of the map
+func ExtractAIHints(tilemap *TileMap) ([]AIHint, error) {
+	hints := make([]AIHint, 0)
+
+	for _, object := range tilemap.GetMarkers("ai_hint") {
+		var hint AIHint
+
+		hintType, _ := object.Properties.Get("hint")
+		switch strings.ToLower(hintType) {
+		case "defensive":
+			hint.Type = AIHintType_DefensivePosition
+		case "expansion":
+			hint.Type = AIHintType_ExpansionSpot
+		case "ambush":
+			hint.Type = AIHintType_AmbushPoint
+		default:
+			return nil, fmt.Errorf("Invalid AI hint %d (%q): The property 'hint' must be 'defensive', 'expansion' or 'ambush', but is %q", object.Id, object.Name, hintType)
+		}
+
+		priority, err := object.Properties.GetInt("priority", 100)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid AI hint %d (%q): %v", object.Id, object.Name, err)
+		}
+		if priority < 0 || priority > 0xFF {
+			return nil, fmt.Errorf("Invalid AI hint %d (%q): The priority must be within [0, 255], but is %d", object.Id, object.Name, priority)
+		}
+		hint.Priority = uint8(priority)
+
+		hint.Position = tilemap.GetMarkerPosition(object)
+		if hint.Position.X < 0 || hint.Position.Y < 0 || hint.Position.X >= float32(tilemap.Width) || hint.Position.Y >= float32(tilemap.Height) {
+			return nil, fmt.Errorf("Invalid AI hint %d (%q): The position is outside of the map", object.Id, object.Name)
+		}
+		hints = append(hints, hint)
+	}
+	return hints, nil
+}
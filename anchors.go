@@ -0,0 +1,35 @@
+package main
+
+import "fmt"
+
+// ExtractResourceAnchors refines the position of resource points with point objects of the type 'resource_anchor'
+// inside the 'Markers' object layer. An anchor belongs to the resource point whose tile it is placed on (incl. the tile's edges),
+// which allows wall-mounted resource nodes to sit exactly on a diagonal surface.
+func ExtractResourceAnchors(tilemap *TileMap, resources []ResourcePoint) error {
+	for _, object := range tilemap.GetMarkers("resource_anchor") {
+		if object.Index != 0 || object.Width != 0 || object.Height != 0 {
+			return fmt.Errorf("Invalid resource anchor %d (%q): Anchors must be point objects", object.Id, object.Name)
+		}
+		position := tilemap.GetMarkerPosition(object)
+
+		found := false
+		for i := range resources {
+			resource := &resources[i]
+			if position.X < float32(resource.SpawnX) || position.X > float32(resource.SpawnX+1) ||
+				position.Y < float32(resource.SpawnY) || position.Y > float32(resource.SpawnY+1) {
+				continue
+			}
+			if resource.Anchor != nil {
+				return fmt.Errorf("Invalid resource anchor %d (%q): The resource point at %dx%d has multiple anchors", object.Id, object.Name, resource.SpawnX, resource.SpawnY)
+			}
+			anchor := position
+			resource.Anchor = &anchor
+			found = true
+			break
+		}
+		if !found {
+			return fmt.Errorf("Invalid resource anchor %d (%q): There is no resource point at %v, %v", object.Id, object.Name, position.X, position.Y)
+		}
+	}
+	return nil
+}
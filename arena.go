@@ -0,0 +1,411 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// arenaPlayerCount is the number of players (with their nearest base) that are kept in a test arena
+const arenaPlayerCount = 2
+
+// arenaCut describes which part of the source map becomes the arena and which spawn tiles are removed
+type arenaCut struct {
+	X, Y       int           // position of the arena in the source map (in tiles)
+	Width      int           // in tiles
+	Height     int           // in tiles
+	SolidGid   uint32        // environment tile used to seal the edges
+	Cleared    map[int]bool  // spawn tiles (index into the source map) that are removed
+	Kept       map[int]bool  // player slots that are kept
+	LayerGids  [][]uint32    // cropped gids per tile layer, in document order
+	TileWidth  int           // in pixels
+	TileHeight int           // in pixels
+	Players    []arenaPlayer // kept players, nearest first
+}
+
+// arenaPlayer is a player that is kept in the arena
+type arenaPlayer struct {
+	Slot     int
+	Distance int // squared distance (in tiles) between the nearest base and the center
+}
+
+// ExtractArena cuts a sealed, playable mini-map with the given radius (in tiles) around a point of the source map.
+// The outermost ring of the arena is filled with solid environment tiles. Only the players with the nearest bases are kept,
+// spawn tiles of all other players, as well as spawn tiles that would end up inside the sealed ring, are removed.
+// Objects outside of the arena are removed, the remaining ones are moved. The TMX document is otherwise kept as it is.
+func ExtractArena(source []byte, sourceFile string, options DecoderOptions, centerX, centerY, radius int) ([]byte, error) {
+	tilemap, err := LoadTiles(bytes.NewReader(source), sourceFile, options)
+	if err != nil {
+		return nil, err
+	}
+	cut, err := planArena(&tilemap, options, centerX, centerY, radius)
+	if err != nil {
+		return nil, err
+	}
+	for _, player := range cut.Players {
+		log.Infof("Keeping player %d (nearest base %d tiles from the center)", player.Slot, isqrt(player.Distance))
+	}
+	return writeArena(source, cut)
+}
+
+// planArena computes the cropped layers of the arena
+func planArena(tilemap *TileMap, options DecoderOptions, centerX, centerY, radius int) (*arenaCut, error) {
+	if centerX < 0 || centerY < 0 || centerX >= tilemap.Width || centerY >= tilemap.Height {
+		return nil, fmt.Errorf("The center (x=%d, y=%d) is outside of the map (%dx%d)", centerX, centerY, tilemap.Width, tilemap.Height)
+	}
+	if radius < 2 {
+		return nil, fmt.Errorf("Invalid radius %d. The arena needs a radius of at least 2 tiles", radius)
+	}
+	cut := &arenaCut{
+		X:          maxInt(0, centerX-radius),
+		Y:          maxInt(0, centerY-radius),
+		Cleared:    make(map[int]bool),
+		Kept:       make(map[int]bool),
+		TileWidth:  tilemap.Tilewidth,
+		TileHeight: tilemap.Tileheight,
+	}
+	cut.Width = minInt(tilemap.Width, centerX+radius+1) - cut.X
+	cut.Height = minInt(tilemap.Height, centerY+radius+1) - cut.Y
+
+	// The interior is everything except the sealed ring
+	interior := func(x, y int) bool {
+		return x > cut.X && y > cut.Y && x < cut.X+cut.Width-1 && y < cut.Y+cut.Height-1
+	}
+
+	environmentIdx, err := tilemap.GetLayer("environment")
+	if err != nil {
+		return nil, err
+	}
+	spawnIdx, err := tilemap.GetLayer("spawn")
+	if err != nil {
+		return nil, err
+	}
+	cut.SolidGid, err = arenaSolidGid(tilemap, &tilemap.Layers[environmentIdx])
+	if err != nil {
+		return nil, err
+	}
+
+	_, _, players, err := ExtractSpawnInfoFromLayer(tilemap.Width, tilemap.Height, &tilemap.Layers[spawnIdx])
+	if err != nil {
+		return nil, err
+	}
+
+	// Choose the players with the nearest bases
+	var candidates []arenaPlayer
+	for _, player := range players {
+		nearest := -1
+		for _, building := range player.Buildings {
+			if building.Type != BuildingType_Base || !interior(building.SpawnX, building.SpawnY) {
+				continue
+			}
+			dx, dy := building.SpawnX-centerX, building.SpawnY-centerY
+			if distance := dx*dx + dy*dy; nearest < 0 || distance < nearest {
+				nearest = distance
+			}
+		}
+		if nearest >= 0 {
+			candidates = append(candidates, arenaPlayer{player.Slot, nearest})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].Distance < candidates[j].Distance })
+	if len(candidates) < arenaPlayerCount {
+		return nil, fmt.Errorf("The arena contains the bases of %d players, but %d are needed. Increase the radius or choose a different center", len(candidates), arenaPlayerCount)
+	}
+	cut.Players = candidates[:arenaPlayerCount]
+	for _, player := range cut.Players {
+		cut.Kept[player.Slot] = true
+	}
+
+	// Remove spawn tiles of other players and spawn tiles that don't fit into the interior. Buildings consist of multiple tiles (see FootprintPositions).
+	for _, player := range players {
+		for _, building := range player.Buildings {
+			inside := interior(building.SpawnX, building.SpawnY)
+			for _, position := range building.FootprintPositions() {
+				inside = inside && interior(position[0], position[1])
+			}
+			if cut.Kept[player.Slot] && inside {
+				continue
+			}
+			clearBuilding(cut, tilemap.Width, building)
+		}
+		for _, unit := range player.Units {
+			if !cut.Kept[player.Slot] || !interior(unit.SpawnX, unit.SpawnY) {
+				cut.Cleared[unit.SpawnY*tilemap.Width+unit.SpawnX] = true
+			}
+		}
+	}
+	// Turrets that would face the sealed ring can't be converted
+	environment := TileMap{Width: cut.Width, Height: cut.Height, Layers: []TileMapLayer{{Name: "environment"}}}
+	for y := cut.Y; y < cut.Y+cut.Height; y++ {
+		for x := cut.X; x < cut.X+cut.Width; x++ {
+			tile := tilemap.Layers[environmentIdx].Tiles[y*tilemap.Width+x]
+			if !interior(x, y) {
+				tile = Tile{Index: 1}
+			}
+			environment.Layers[0].Tiles = append(environment.Layers[0].Tiles, tile)
+		}
+	}
+	for _, player := range players {
+		for _, building := range player.Buildings {
+			token := building.SpawnY*tilemap.Width + building.SpawnX
+			if building.Type != BuildingType_Turret || !cut.Kept[player.Slot] || cut.Cleared[token] {
+				continue
+			}
+			turret := building
+			turret.SpawnX, turret.SpawnY = building.SpawnX-cut.X, building.SpawnY-cut.Y
+			if err := ValidateTurrets(&environment, []Player{{Slot: player.Slot, Buildings: []Building{turret}}}); err != nil {
+				logTileWarningf(building.SpawnX, building.SpawnY, "Removing the turret of player %d (x=%d, y=%d): It faces the sealed edge of the arena", player.Slot, building.SpawnX, building.SpawnY)
+				clearBuilding(cut, tilemap.Width, building)
+			}
+		}
+	}
+
+	for y := cut.Y; y < cut.Y+cut.Height; y++ {
+		for x := cut.X; x < cut.X+cut.Width; x++ {
+			if !interior(x, y) { // resource points and water drop sources on the ring
+				cut.Cleared[y*tilemap.Width+x] = true
+			}
+		}
+	}
+
+	for l := range tilemap.Layers {
+		layer := &tilemap.Layers[l]
+		if layer.Data.Encoding != "csv" {
+			return nil, fmt.Errorf("Unsupported layer encoding %q (layer=%q). Please use csv", layer.Data.Encoding, layer.Name)
+		}
+		gids, err := layer.Data.decodeGids()
+		if err != nil {
+			return nil, fmt.Errorf("%v (layer=%q)", err, layer.Name)
+		}
+		cropped := make([]uint32, 0, cut.Width*cut.Height)
+		for y := cut.Y; y < cut.Y+cut.Height; y++ {
+			for x := cut.X; x < cut.X+cut.Width; x++ {
+				gid := gids[y*tilemap.Width+x]
+				switch {
+				case l == environmentIdx && !interior(x, y):
+					gid = cut.SolidGid
+				case l == spawnIdx && cut.Cleared[y*tilemap.Width+x]:
+					gid = 0
+				}
+				cropped = append(cropped, gid)
+			}
+		}
+		cut.LayerGids = append(cut.LayerGids, cropped)
+	}
+	return cut, nil
+}
+
+// clearBuilding removes all spawn tiles of the building
+func clearBuilding(cut *arenaCut, width int, building Building) {
+	cut.Cleared[building.SpawnY*width+building.SpawnX] = true
+	for _, position := range building.FootprintPositions() {
+		cut.Cleared[position[1]*width+position[0]] = true
+	}
+}
+
+// arenaSolidGid returns the completely solid environment tile that is used most often (without flips)
+func arenaSolidGid(tilemap *TileMap, environment *TileMapLayer) (uint32, error) {
+	usage := make(map[uint32]int)
+	var best uint32
+	for _, tile := range environment.Tiles {
+		if !tile.IsCompletelySolid() || tile.Flags != 0 || tile.TileSet == nil {
+			continue
+		}
+		gid := tile.TileSet.FirstGid - 1 + tile.Index
+		usage[gid]++
+		if usage[gid] > usage[best] || (usage[gid] == usage[best] && gid < best) {
+			best = gid
+		}
+	}
+	if best != 0 {
+		return best, nil
+	}
+	for _, tileset := range tilemap.Tilesets {
+		if tileset.Type == ENVIRONMENT_TILESET {
+			return tileset.FirstGid, nil
+		}
+	}
+	return 0, fmt.Errorf("The map has no environment tileset")
+}
+
+// writeArena rewrites the TMX document with the cropped layers (see TMXRewriter)
+func writeArena(source []byte, cut *arenaCut) ([]byte, error) {
+	rewriter := NewTMXRewriter(source)
+	layer := -1
+
+	for {
+		token, err := rewriter.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch path := rewriter.Path(); {
+			case path == "map" || path == "map/layer":
+				for i, attr := range t.Attr {
+					switch attr.Name.Local {
+					case "width":
+						t.Attr[i].Value = strconv.Itoa(cut.Width)
+					case "height":
+						t.Attr[i].Value = strconv.Itoa(cut.Height)
+					}
+				}
+				if path == "map/layer" {
+					layer++
+				}
+			case path == "map/properties/property" && arenaDropsProperty(t, cut):
+				if err := rewriter.Remove(); err != nil {
+					return nil, err
+				}
+				continue
+			case path == "map/objectgroup/object":
+				keep, err := cut.moveObject(&t)
+				if err != nil {
+					return nil, err
+				}
+				if !keep {
+					if err := rewriter.Remove(); err != nil {
+						return nil, err
+					}
+					continue
+				}
+			}
+			if err := rewriter.UpdateAttrs(t); err != nil {
+				return nil, err
+			}
+
+		case xml.CharData:
+			if rewriter.Path() == "map/layer/data" && layer >= 0 && layer < len(cut.LayerGids) {
+				rewriter.ReplaceText(formatCSV(cut.LayerGids[layer], cut.Width))
+			}
+		}
+	}
+	return rewriter.Bytes(), nil
+}
+
+// arenaDropsProperty returns true for map properties of players that are not part of the arena ('player<N>_...')
+func arenaDropsProperty(property xml.StartElement, cut *arenaCut) bool {
+	for _, attr := range property.Attr {
+		if attr.Name.Local != "name" {
+			continue
+		}
+		var slot int
+		var suffix string
+		if n, _ := fmt.Sscanf(attr.Value, "player%d_%s", &slot, &suffix); n == 2 {
+			return !cut.Kept[slot]
+		}
+	}
+	return false
+}
+
+// moveObject moves the object into the arena. Returns false if the object is outside of the arena.
+func (cut *arenaCut) moveObject(object *xml.StartElement) (bool, error) {
+	offsetX, offsetY := float64(cut.X*cut.TileWidth), float64(cut.Y*cut.TileHeight)
+	for i, attr := range object.Attr {
+		var offset, size float64
+		switch attr.Name.Local {
+		case "x":
+			offset, size = offsetX, float64(cut.Width*cut.TileWidth)
+		case "y":
+			offset, size = offsetY, float64(cut.Height*cut.TileHeight)
+		default:
+			continue
+		}
+		value, _, err := ParseLocaleFloat(attr.Value)
+		if err != nil {
+			return false, err
+		}
+		moved := float64(value) - offset
+		if moved < 0 || moved > size {
+			return false, nil
+		}
+		object.Attr[i].Value = strconv.FormatFloat(moved, 'f', -1, 32)
+	}
+	return true, nil
+}
+
+// formatCSV writes the gids in the csv format used by Tiled (one line per row)
+func formatCSV(gids []uint32, width int) string {
+	var csv strings.Builder
+	csv.WriteString("\n")
+	for i, gid := range gids {
+		csv.WriteString(strconv.FormatUint(uint64(gid), 10))
+		if i < len(gids)-1 {
+			csv.WriteString(",")
+		}
+		if (i+1)%width == 0 {
+			csv.WriteString("\n")
+		}
+	}
+	return csv.String()
+}
+
+// isqrt returns the integer square root
+func isqrt(value int) int {
+	root := 0
+	for (root+1)*(root+1) <= value {
+		root++
+	}
+	return root
+}
+
+// RunExtractArena writes a test arena that is cut out of a map
+func RunExtractArena(args []string) error {
+	flags := flag.NewFlagSet("extract-arena", flag.ContinueOnError)
+	around := flags.String("around", "", "Center of the arena in tiles: <x>,<y>")
+	radius := flags.Int("radius", 16, "Radius of the arena in tiles")
+	outputFile := flags.String("o", "", "Output file (default: <inputfile>_arena.tmx next to the input file)")
+	legacy := flags.Bool("legacy", false, "Accept maps created with Tiled 0.x and fill in missing information")
+	noBackup := flags.Bool("no-backup", false, "Don't create a timestamped backup if the output file already exists")
+	// Allow the documented form "extract-arena map.tmx -around x,y", Go's flag package stops at the first argument
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		args = append(args[1:len(args):len(args)], args[0])
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 || *around == "" {
+		return fmt.Errorf("Usage: extract-arena <inputfile.tmx> -around <x>,<y> [-radius <tiles>] [-o <output.tmx>] [-no-backup] [-legacy]")
+	}
+	var centerX, centerY int
+	if n, err := fmt.Sscanf(*around, "%d,%d", &centerX, &centerY); n != 2 || err != nil {
+		return fmt.Errorf("Invalid center %q. Expected <x>,<y>", *around)
+	}
+
+	sourceFile := flags.Arg(0)
+	if *outputFile == "" {
+		*outputFile = strings.TrimSuffix(sourceFile, filepath.Ext(sourceFile)) + "_arena.tmx"
+	}
+	source, err := ReadInput(sourceFile)
+	if err != nil {
+		return fmt.Errorf("Failed to read source file '%v': %v", sourceFile, err)
+	}
+
+	options := DecoderOptions{Legacy: *legacy}
+	arena, err := ExtractArena(source, sourceFile, options, centerX, centerY, *radius)
+	if err != nil {
+		return fmt.Errorf("Failed to extract the arena from '%v': %v", sourceFile, err)
+	}
+
+	// Make sure that the result can be converted
+	tilemap, err := LoadTiles(bytes.NewReader(arena), sourceFile, options)
+	if err == nil {
+		_, _, _, err = ExtractSpawnInfo(&tilemap)
+	}
+	if err != nil {
+		return fmt.Errorf("The arena is not playable: %v", err)
+	}
+
+	log.Infof("Writing %dx%d arena around (x=%d, y=%d) to '%s'", tilemap.Width, tilemap.Height, centerX, centerY, *outputFile)
+	return WriteTMXOutput(*outputFile, arena, !*noBackup)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// asciiTileGlyphs are the characters used for the environment tile types. Diagonal tiles look like the corner that is solid.
+var asciiTileGlyphs = map[TileType]byte{
+	COMPLETELY_ACCESSIBLE: ' ',
+	COMPLETELY_SOLID:      '#',
+	SOLID_AT_UPPER_LEFT:   'F',
+	SOLID_AT_UPPER_RIGHT:  '7',
+	SOLID_AT_LOWER_LEFT:   'L',
+	SOLID_AT_LOWER_RIGHT:  'J',
+}
+
+// Spawn markers. Buildings are shown with the player slot (0-7), units with a letter per player slot (a-h).
+const (
+	asciiResourceGlyph  = '$'
+	asciiWaterdropGlyph = '~'
+)
+
+// RenderASCII draws the environment layer of a converted map as ASCII art, one line per tile row.
+// If markers is set, the spawn positions of resource points, water drop sources, buildings and units are drawn on top.
+func RenderASCII(writer io.Writer, encoded *EncodedMap, markers bool) error {
+	if len(encoded.Layers) == 0 {
+		return fmt.Errorf("The map has no environment layer")
+	}
+	environment := encoded.Layers[encoded.EnvironmentLayer]
+	width, height := encoded.Width, encoded.Height
+
+	grid := make([][]byte, height)
+	for y := range grid {
+		grid[y] = make([]byte, width)
+		for x := range grid[y] {
+			i := y*width + x
+			tile := Tile{Index: uint32(environment.Indices[i]), Flags: environment.Flags[i] & 0x07}
+			grid[y][x] = asciiTileGlyphs[tile.GetType()]
+		}
+	}
+
+	if markers {
+		mark := func(x, y int, glyph byte) {
+			if encoded.Flags&EncodingFlag_BottomLeft != 0 { // the layers themselves are always stored top-down
+				y = height - 1 - y
+			}
+			if x >= 0 && y >= 0 && x < width && y < height {
+				grid[y][x] = glyph
+			}
+		}
+		for _, resource := range encoded.Resources {
+			mark(resource.SpawnX, resource.SpawnY, asciiResourceGlyph)
+		}
+		for _, source := range encoded.WaterdropSources {
+			mark(source.SpawnX, source.SpawnY, asciiWaterdropGlyph)
+		}
+		for _, player := range encoded.Players {
+			for _, unit := range player.Units {
+				mark(unit.SpawnX, unit.SpawnY, byte('a'+player.Slot%PlayerSlots))
+			}
+			for _, building := range player.Buildings {
+				mark(building.SpawnX, building.SpawnY, byte('0'+player.Slot%PlayerSlots))
+			}
+		}
+	}
+
+	border := "+" + strings.Repeat("-", width) + "+\n"
+	if _, err := io.WriteString(writer, border); err != nil {
+		return err
+	}
+	for _, row := range grid {
+		if _, err := fmt.Fprintf(writer, "|%s|\n", row); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(writer, border)
+	return err
+}
+
+// RunASCII prints the environment layer of a converted map as ASCII art
+func RunASCII(args []string) error {
+	flags := flag.NewFlagSet("ascii", flag.ContinueOnError)
+	byteOrder := flags.String("byte-order", "le", "Byte order of the file: le (little-endian) or be (big-endian)")
+	noMarkers := flags.Bool("no-markers", false, "Only draw the environment, without spawn markers")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("Usage: ascii [-byte-order le|be] [-no-markers] <map.tilemap>")
+	}
+	order, err := ParseByteOrder(*byteOrder)
+	if err != nil {
+		return err
+	}
+
+	encoded, err := LoadEncodedMap(flags.Arg(0), order)
+	if err != nil {
+		return err
+	}
+	if err := RenderASCII(os.Stdout, encoded, !*noMarkers); err != nil {
+		return err
+	}
+	fmt.Printf("'#' solid, 'F' '7' 'L' 'J' diagonal (solid corner)")
+	if !*noMarkers {
+		fmt.Printf(", '%c' resource point, '%c' water drop source, '0'-'7' building of player slot, 'a'-'h' unit of player slot", asciiResourceGlyph, asciiWaterdropGlyph)
+	}
+	fmt.Printf("\n")
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+)
+
+// MaxBridgeSpan is the maximum number of tiles a bridge can span
+const MaxBridgeSpan = 32
+
+// ValidateBridges checks that every bridge spans a gap and computes its span length.
+// The spawn position of a bridge is its first tile. The bridge extends along the building's right vector.
+// The tile behind the first tile and the tile after the last tile must be solid (anchors),
+// while the tiles of the bridge itself must be empty. At least one tile below the bridge must be empty,
+// otherwise the bridge would lie on the ground.
+func ValidateBridges(tilemap *TileMap, players []Player) error {
+	environmentLayerIdx, err := tilemap.GetLayer("environment")
+	if err != nil {
+		return err
+	}
+	layer := &tilemap.Layers[environmentLayerIdx]
+
+	isSolid := func(x, y int) bool {
+		tile, err := layer.GetTile(x, y, tilemap.Width, tilemap.Height)
+		return err != nil || !tile.IsCompletelyAccessible() // Everything outside of the map is treated as solid
+	}
+
+	for p := range players {
+		for b := range players[p].Buildings {
+			building := &players[p].Buildings[b]
+			if building.Type != BuildingType_Bridge {
+				continue
+			}
+
+			tile := Tile{Flags: building.Flags}
+			rightX, rightY := tile.GetRightVector()
+			upX, upY := tile.GetUpVector()
+			x, y := building.SpawnX, building.SpawnY
+
+			if !isSolid(x-rightX, y-rightY) {
+				return fmt.Errorf("Invalid bridge (player %d, x=%d, y=%d): The bridge has no solid anchor at its start (x=%d, y=%d)", p, x, y, x-rightX, y-rightY)
+			}
+
+			span := 0
+			airBelow := false
+			for ; span <= MaxBridgeSpan; span++ {
+				if isSolid(x+span*rightX, y+span*rightY) {
+					break
+				}
+				if !isSolid(x+span*rightX-upX, y+span*rightY-upY) {
+					airBelow = true
+				}
+			}
+			if span == 0 {
+				return fmt.Errorf("Invalid bridge (player %d, x=%d, y=%d): The bridge is placed inside solid terrain", p, x, y)
+			}
+			if span > MaxBridgeSpan {
+				return fmt.Errorf("Invalid bridge (player %d, x=%d, y=%d): The bridge has no solid anchor at its end within %d tiles", p, x, y, MaxBridgeSpan)
+			}
+			if !airBelow {
+				return fmt.Errorf("Invalid bridge (player %d, x=%d, y=%d): The bridge doesn't span a gap. There is no air below the bridge", p, x, y)
+			}
+			building.SpanLength = span
+		}
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Map packs are zip archives that are downloaded by the game's content downloader. Layout:
+//   index.json              BundleIndex
+//   maps/<id>.tilemap       converted maps
+//   minimaps/<id>.png       optional lobby thumbnails (thumbnail-png output)
+//   metadata/<id>.json      optional metadata (eg. title, author, description), passed through as-is
+//   SHA256SUMS              checksums of all other files ('<sha256 hex>  <path>')
+// The id of a map is its path relative to the manifest, without extension.
+
+// BundleIndexVersion is incremented whenever the archive layout changes
+const BundleIndexVersion = 1
+
+// MetadataExtension replaces the extension of a converted map to get its metadata file ("map.tilemap" -> "map.meta.json")
+const MetadataExtension = ".meta.json"
+
+// BundleIndex lists all maps of a map pack
+type BundleIndex struct {
+	Version int           `json:"version"` // BundleIndexVersion
+	Maps    []BundleEntry `json:"maps"`
+}
+
+// BundleEntry describes a single map of a map pack. Paths are relative to the archive root.
+type BundleEntry struct {
+	Id            string `json:"id"`
+	Map           string `json:"map"`
+	Minimap       string `json:"minimap,omitempty"`
+	Metadata      string `json:"metadata,omitempty"`
+	FormatVersion uint8  `json:"formatVersion"`
+	Size          int    `json:"size"`
+	SHA256        string `json:"sha256"`
+	Players       int    `json:"players"`
+	Resources     int    `json:"resources"`
+}
+
+// RunBundle packs converted maps with their minimaps and metadata into a single map pack
+func RunBundle(args []string) error {
+	flags := flag.NewFlagSet("bundle", flag.ContinueOnError)
+	manifestPath := flags.String("manifest", "", "Manifest of the converted maps (see the -manifest option of the conversion)")
+	outputTarget := flags.String("o", "", "Output archive (zip), object-store URL or '-' for stdout")
+	byteOrder := flags.String("byte-order", "le", "Byte order of the map files: le (little-endian) or be (big-endian)")
+	requireMinimaps := flags.Bool("require-minimaps", false, "Fail if a map has no minimap (<name>"+thumbnailPNGWriter{}.Extension()+")")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *manifestPath == "" || *outputTarget == "" {
+		return fmt.Errorf("Usage: bundle -manifest <manifest.json> -o <pack.zip> [-byte-order le|be] [-require-minimaps] [map.tilemap...]")
+	}
+	order, err := ParseByteOrder(*byteOrder)
+	if err != nil {
+		return err
+	}
+
+	content, err := ioutil.ReadFile(LongPath(*manifestPath))
+	if err != nil {
+		return fmt.Errorf("Failed to read manifest: %v", err)
+	}
+	var manifest MapManifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return fmt.Errorf("Invalid manifest '%s': %v", *manifestPath, err)
+	}
+
+	// Without arguments, all maps of the manifest are bundled
+	entries := manifest.Maps
+	if flags.NArg() > 0 {
+		entries = nil
+		for _, mapFile := range flags.Args() {
+			entry, ok := findManifestEntry(&manifest, manifestRelativePath(*manifestPath, mapFile))
+			if !ok {
+				return fmt.Errorf("'%s' is not part of the manifest '%s'", mapFile, *manifestPath)
+			}
+			entries = append(entries, entry)
+		}
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("The manifest '%s' contains no maps", *manifestPath)
+	}
+
+	files := make(map[string][]byte)
+	index := BundleIndex{Version: BundleIndexVersion}
+	for _, entry := range entries {
+		bundleEntry, err := bundleMap(*manifestPath, entry, order, *requireMinimaps, files)
+		if err != nil {
+			return err
+		}
+		index.Maps = append(index.Maps, bundleEntry)
+	}
+	sort.Slice(index.Maps, func(i, j int) bool { return index.Maps[i].Id < index.Maps[j].Id })
+
+	indexData, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Failed to create index: %v", err)
+	}
+	files["index.json"] = append(indexData, '\n')
+
+	archive, err := writeBundleArchive(files)
+	if err != nil {
+		return fmt.Errorf("Failed to create archive: %v", err)
+	}
+	log.Infof("Bundled %d maps into '%s'", len(index.Maps), *outputTarget)
+	return WriteOutput(*outputTarget, archive)
+}
+
+func findManifestEntry(manifest *MapManifest, file string) (ManifestEntry, bool) {
+	for _, entry := range manifest.Maps {
+		if entry.File == file {
+			return entry, true
+		}
+	}
+	return ManifestEntry{}, false
+}
+
+// bundleMap verifies a converted map against its manifest entry and adds it, its minimap and its metadata to the files
+func bundleMap(manifestPath string, entry ManifestEntry, order binary.ByteOrder, requireMinimap bool, files map[string][]byte) (BundleEntry, error) {
+	if IsRemoteInput(entry.File) {
+		return BundleEntry{}, fmt.Errorf("Remote maps can't be bundled: %s", entry.File)
+	}
+	mapFile := filepath.Join(filepath.Dir(manifestPath), filepath.FromSlash(entry.File))
+	data, err := ioutil.ReadFile(LongPath(mapFile))
+	if err != nil {
+		return BundleEntry{}, fmt.Errorf("Failed to read map file: %v", err)
+	}
+	checksum := sha256.Sum256(data)
+	if len(data) != entry.Size || hex.EncodeToString(checksum[:]) != entry.SHA256 {
+		return BundleEntry{}, fmt.Errorf("'%s' doesn't match its manifest entry. Was the map converted without updating the manifest?", mapFile)
+	}
+	encoded, err := DecodeMap(data, order)
+	if err != nil {
+		return BundleEntry{}, fmt.Errorf("Failed to decode '%s': %v", mapFile, err)
+	}
+	if encoded.Version != entry.FormatVersion {
+		return BundleEntry{}, fmt.Errorf("'%s' has format version %d, but the manifest says %d", mapFile, encoded.Version, entry.FormatVersion)
+	}
+
+	id := strings.TrimSuffix(entry.File, path.Ext(entry.File))
+	if strings.HasPrefix(id, "../") || path.IsAbs(id) {
+		return BundleEntry{}, fmt.Errorf("'%s' is outside of the manifest's directory and can't be bundled", mapFile)
+	}
+	bundleEntry := BundleEntry{
+		Id:            id,
+		Map:           "maps/" + id + ".tilemap",
+		FormatVersion: entry.FormatVersion,
+		Size:          entry.Size,
+		SHA256:        entry.SHA256,
+		Players:       entry.Players,
+		Resources:     entry.Resources,
+	}
+	if _, ok := files[bundleEntry.Map]; ok {
+		return BundleEntry{}, fmt.Errorf("The map id %q is used more than once", id)
+	}
+	files[bundleEntry.Map] = data
+
+	minimapFile := OutputTargetPath(mapFile, thumbnailPNGWriter{})
+	if minimap, err := ioutil.ReadFile(LongPath(minimapFile)); err == nil {
+		bundleEntry.Minimap = "minimaps/" + id + ".png"
+		files[bundleEntry.Minimap] = minimap
+	} else if !os.IsNotExist(err) {
+		return BundleEntry{}, fmt.Errorf("Failed to read minimap: %v", err)
+	} else if requireMinimap {
+		return BundleEntry{}, fmt.Errorf("'%s' has no minimap. Convert it with -outputs thumbnail-png", mapFile)
+	} else {
+		log.Warningf("'%s' has no minimap (%s)", mapFile, minimapFile)
+	}
+
+	metadataFile := strings.TrimSuffix(mapFile, filepath.Ext(mapFile)) + MetadataExtension
+	if metadata, err := ioutil.ReadFile(LongPath(metadataFile)); err == nil {
+		var object map[string]interface{}
+		if err := json.Unmarshal(metadata, &object); err != nil {
+			return BundleEntry{}, fmt.Errorf("Invalid metadata '%s': Expected a JSON object: %v", metadataFile, err)
+		}
+		bundleEntry.Metadata = "metadata/" + id + ".json"
+		files[bundleEntry.Metadata] = metadata
+	} else if !os.IsNotExist(err) {
+		return BundleEntry{}, fmt.Errorf("Failed to read metadata: %v", err)
+	}
+	return bundleEntry, nil
+}
+
+// writeBundleArchive creates a zip archive with the files and their SHA256SUMS.
+// Entries are sorted and have a fixed modification time, so that the same input always results in the same archive.
+func writeBundleArchive(files map[string][]byte) ([]byte, error) {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var checksums bytes.Buffer
+	for _, name := range names {
+		checksum := sha256.Sum256(files[name])
+		fmt.Fprintf(&checksums, "%s  %s\n", hex.EncodeToString(checksum[:]), name)
+	}
+	files["SHA256SUMS"] = checksums.Bytes()
+	names = append(names, "SHA256SUMS")
+
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+	for _, name := range names {
+		writer, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := writer.Write(files[name]); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CameraPath is an authored flyover for the spectator and replay camera.
+// Camera paths are polyline objects with the type 'camera_path' inside the 'Markers' object layer.
+// The property 'dwell' contains the time (in seconds) the camera stays at each point, either as
+// a single value for all points or as a comma-separated list with one value per point.
+type CameraPath struct {
+	Name   string
+	Points []CameraPathPoint
+}
+
+type CameraPathPoint struct {
+	Position Point   // in tiles
+	Dwell    float32 // in seconds
+}
+
+// ExtractCameraPaths reads all spectator camera paths
+func ExtractCameraPaths(tilemap *TileMap) ([]CameraPath, error) {
+	paths := make([]CameraPath, 0)
+
+	for _, object := range tilemap.GetMarkers("camera_path") {
+		points, err := tilemap.GetMarkerPolyline(object)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid camera path: %v", err)
+		}
+		if len(points) < 2 {
+			return nil, fmt.Errorf("Invalid camera path %d (%q): A camera path needs at least 2 points", object.Id, object.Name)
+		}
+
+		dwellTimes := make([]float32, len(points))
+		if dwell, ok := object.Properties.Get("dwell"); ok {
+			values := strings.Split(dwell, ",")
+			if len(values) != 1 && len(values) != len(points) {
+				return nil, fmt.Errorf("Invalid camera path %d (%q): The property 'dwell' must contain a single value or one value per point (%d), but contains %d values", object.Id, object.Name, len(points), len(values))
+			}
+			for i := range dwellTimes {
+				value := values[0]
+				if len(values) > 1 {
+					value = values[i]
+				}
+				f, err := strconv.ParseFloat(strings.TrimSpace(value), 32)
+				if err != nil || f < 0 {
+					return nil, fmt.Errorf("Invalid camera path %d (%q): Invalid dwell time %q", object.Id, object.Name, value)
+				}
+				dwellTimes[i] = float32(f)
+			}
+		}
+
+		path := CameraPath{
+			Name:   object.Name,
+			Points: make([]CameraPathPoint, len(points)),
+		}
+		for i, point := range points {
+			if point.X < 0 || point.Y < 0 || point.X > float32(tilemap.Width) || point.Y > float32(tilemap.Height) {
+				log.Warningf("The camera path %d (%q) leaves the map at point %d", object.Id, object.Name, i)
+			}
+			path.Points[i] = CameraPathPoint{
+				Position: point,
+				Dwell:    dwellTimes[i],
+			}
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Checkpoint is a trigger area that needs to be passed in race mode.
+// Checkpoints are authored as rectangle objects with the type 'checkpoint' inside the 'Markers' object layer.
+// The property 'order' defines the sequence, starting with 1.
+type Checkpoint struct {
+	Order int
+	Area  Rect // in tiles
+}
+
+// ExtractCheckpoints reads all checkpoints and returns them sorted by their order.
+// For race-mode maps (map property 'gamemode' = 'race'), at least two checkpoints are required that can be reached one after another.
+func ExtractCheckpoints(tilemap *TileMap) ([]Checkpoint, error) {
+	checkpoints := make([]Checkpoint, 0)
+
+	for _, object := range tilemap.GetMarkers("checkpoint") {
+		var checkpoint Checkpoint
+		var err error
+
+		if checkpoint.Area, err = tilemap.GetMarkerRect(object); err != nil {
+			return nil, fmt.Errorf("Invalid checkpoint: %v", err)
+		}
+		if _, ok := object.Properties.Get("order"); !ok {
+			return nil, fmt.Errorf("Invalid checkpoint %d (%q): The property 'order' is missing", object.Id, object.Name)
+		}
+		if checkpoint.Order, err = object.Properties.GetInt("order", 0); err != nil {
+			return nil, fmt.Errorf("Invalid checkpoint %d (%q): %v", object.Id, object.Name, err)
+		}
+		checkpoints = append(checkpoints, checkpoint)
+	}
+
+	gamemode, _ := tilemap.Properties.Get("gamemode")
+	isRace := strings.ToLower(gamemode) == "race"
+
+	if len(checkpoints) == 0 && !isRace {
+		return checkpoints, nil
+	}
+	if !isRace {
+		log.Warningf("The map contains %d checkpoints, but is not a race-mode map (map property 'gamemode')", len(checkpoints))
+	}
+	if isRace && len(checkpoints) < 2 {
+		return nil, fmt.Errorf("Invalid race-mode map: Does not contain enough checkpoints. (Needed >=2, Found %d)", len(checkpoints))
+	}
+
+	// Validate the sequence:
+	sort.Slice(checkpoints, func(i, j int) bool {
+		return checkpoints[i].Order < checkpoints[j].Order
+	})
+	for i, checkpoint := range checkpoints {
+		if checkpoint.Order != i+1 {
+			return nil, fmt.Errorf("Invalid checkpoint sequence: Expected checkpoint %d, but found %d. The order must start with 1 and must not contain gaps or duplicates", i+1, checkpoint.Order)
+		}
+	}
+
+	// Validate that every checkpoint can be reached from the previous one:
+	environmentLayerIdx, err := tilemap.GetLayer("environment")
+	if err != nil {
+		return nil, err
+	}
+	regions, err := ComputeRegions(tilemap.Width, tilemap.Height, &tilemap.Layers[environmentLayerIdx])
+	if err != nil {
+		return nil, err
+	}
+	for i := 1; i < len(checkpoints); i++ {
+		prevX, prevY := checkpoints[i-1].Area.CenterTile()
+		x, y := checkpoints[i].Area.CenterTile()
+		if regions.GetRegion(prevX, prevY) == -1 {
+			return nil, fmt.Errorf("Invalid checkpoint %d: The center (x=%d, y=%d) is inside solid terrain", i, prevX, prevY)
+		}
+		if !regions.IsConnected(prevX, prevY, x, y) {
+			return nil, fmt.Errorf("Invalid checkpoint sequence: Checkpoint %d (x=%d, y=%d) can't be reached from checkpoint %d (x=%d, y=%d)", i+1, x, y, i, prevX, prevY)
+		}
+	}
+	return checkpoints, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// UpdateChecksumManifest adds (or replaces) the checksum of the given output file in a SHA256SUMS-style manifest.
+// The manifest contains one line per file: '<sha256 hex>  <path>'. Paths of local files are relative to the manifest,
+// so the manifest can be verified with 'sha256sum -c' inside its directory.
+func UpdateChecksumManifest(manifestPath, target string, data []byte) error {
+	entries := make(map[string]string) // path -> hash
+
+	if content, err := ioutil.ReadFile(LongPath(manifestPath)); err == nil {
+		for i, line := range strings.Split(string(content), "\n") {
+			line = strings.TrimRight(line, "\r")
+			if line == "" {
+				continue
+			}
+			parts := strings.SplitN(line, "  ", 2)
+			if len(parts) != 2 {
+				return fmt.Errorf("Invalid checksum manifest '%s': Unexpected content in line %d", manifestPath, i+1)
+			}
+			entries[parts[1]] = parts[0]
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("Failed to read checksum manifest: %v", err)
+	}
+
+	entries[manifestRelativePath(manifestPath, target)] = sha256Hex(data)
+
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var content strings.Builder
+	for _, name := range names {
+		content.WriteString(entries[name] + "  " + name + "\n")
+	}
+	if err := ioutil.WriteFile(LongPath(manifestPath), []byte(content.String()), 0644); err != nil {
+		return fmt.Errorf("Failed to write checksum manifest: %v", err)
+	}
+	return nil
+}
+
+// manifestRelativePath returns the path of a local file relative to the manifest's directory (with forward slashes).
+// URLs are returned unchanged.
+func manifestRelativePath(manifestPath, target string) string {
+	if target == "-" || IsRemoteInput(target) {
+		return target
+	}
+	manifestDir, _ := filepath.Abs(filepath.Dir(manifestPath))
+	absTarget, _ := filepath.Abs(target)
+	if rel, err := filepath.Rel(manifestDir, absTarget); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return target
+}
+
+// SignChecksumManifest signs the manifest with an ed25519 private key (PEM encoded, PKCS #8)
+// and stores the base64 encoded signature next to it ('<manifest>.sig').
+func SignChecksumManifest(manifestPath, keyPath string) error {
+	keyData, err := ioutil.ReadFile(LongPath(keyPath))
+	if err != nil {
+		return fmt.Errorf("Failed to read signing key: %v", err)
+	}
+	block, _ := pem.Decode(keyData)
+	if block == nil {
+		return fmt.Errorf("Invalid signing key '%s': Not PEM encoded", keyPath)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("Invalid signing key '%s': %v", keyPath, err)
+	}
+	signer, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return fmt.Errorf("Invalid signing key '%s': Only ed25519 keys are supported", keyPath)
+	}
+
+	manifest, err := ioutil.ReadFile(LongPath(manifestPath))
+	if err != nil {
+		return fmt.Errorf("Failed to read checksum manifest: %v", err)
+	}
+	signature, err := signer.Sign(rand.Reader, manifest, crypto.Hash(0))
+	if err != nil {
+		return fmt.Errorf("Failed to sign checksum manifest: %v", err)
+	}
+	return ioutil.WriteFile(LongPath(manifestPath+".sig"), []byte(base64.StdEncoding.EncodeToString(signature)+"\n"), 0644)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// CollisionPreviewTileSize is the size of a tile in the collision preview (in pixels)
+const CollisionPreviewTileSize = 8
+
+// collisionPreviewColors are the stroke colors of the border directions
+var collisionPreviewColors = []struct {
+	name  string
+	color string
+}{
+	{"left", "#e6194b"},
+	{"right", "#3cb44b"},
+	{"up", "#4363d8"},
+	{"down", "#f58231"},
+	{"up-left", "#911eb4"},
+	{"up-right", "#42d4f4"},
+	{"down-left", "#f032e6"},
+	{"down-right", "#9a6324"},
+}
+
+// RenderCollisionSVG draws the solid tiles of the layer and the computed borders as SVG, so that ComputeBorderOfLayer
+// can be verified visually. Every border line is drawn as an arrow in its direction, with the solid side on its right.
+// Coordinates are in tiles (top-left origin).
+func RenderCollisionSVG(width, height int, layer *TileMapLayer, borders SortedBorderLines) []byte {
+	var svg bytes.Buffer
+	fmt.Fprintf(&svg, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %d %d\">\n", width*CollisionPreviewTileSize, height*CollisionPreviewTileSize, width, height)
+	svg.WriteString("<defs>\n")
+	for _, direction := range collisionPreviewColors {
+		fmt.Fprintf(&svg, "<marker id=\"arrow-%s\" viewBox=\"0 0 10 10\" refX=\"10\" refY=\"5\" markerWidth=\"6\" markerHeight=\"6\" orient=\"auto\"><path d=\"M0,0 L10,5 L0,10 z\" fill=\"%s\"/></marker>\n", direction.name, direction.color)
+	}
+	svg.WriteString("</defs>\n")
+	fmt.Fprintf(&svg, "<rect width=\"%d\" height=\"%d\" fill=\"#ffffff\"/>\n", width, height)
+
+	// Solid terrain. Diagonal tiles are drawn as the triangle that is solid.
+	svg.WriteString("<g fill=\"#b0b0b0\">\n")
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			tile, err := layer.GetTile(x, y, width, height)
+			if err != nil {
+				continue
+			}
+			switch tile.GetType() {
+			case COMPLETELY_SOLID:
+				fmt.Fprintf(&svg, "<rect x=\"%d\" y=\"%d\" width=\"1\" height=\"1\"/>\n", x, y)
+			case SOLID_AT_UPPER_LEFT:
+				fmt.Fprintf(&svg, "<polygon points=\"%d,%d %d,%d %d,%d\"/>\n", x, y, x+1, y, x, y+1)
+			case SOLID_AT_UPPER_RIGHT:
+				fmt.Fprintf(&svg, "<polygon points=\"%d,%d %d,%d %d,%d\"/>\n", x, y, x+1, y, x+1, y+1)
+			case SOLID_AT_LOWER_LEFT:
+				fmt.Fprintf(&svg, "<polygon points=\"%d,%d %d,%d %d,%d\"/>\n", x, y, x+1, y+1, x, y+1)
+			case SOLID_AT_LOWER_RIGHT:
+				fmt.Fprintf(&svg, "<polygon points=\"%d,%d %d,%d %d,%d\"/>\n", x+1, y, x+1, y+1, x, y+1)
+			}
+		}
+	}
+	svg.WriteString("</g>\n")
+
+	// Direction of each border set (dx, dy per tile of length), in the order of collisionPreviewColors
+	sets := []struct {
+		lines  []BorderLine
+		dx, dy int
+	}{
+		{borders.Left, -1, 0},
+		{borders.Right, 1, 0},
+		{borders.Up, 0, -1},
+		{borders.Down, 0, 1},
+		{borders.UpLeft, -1, -1},
+		{borders.UpRight, 1, -1},
+		{borders.DownLeft, -1, 1},
+		{borders.DownRight, 1, 1},
+	}
+	for i, set := range sets {
+		direction := collisionPreviewColors[i]
+		fmt.Fprintf(&svg, "<g stroke=\"%s\" stroke-width=\"0.1\" marker-end=\"url(#arrow-%s)\">\n", direction.color, direction.name)
+		for _, line := range set.lines {
+			endX, endY := line.StartX+set.dx*line.Length, line.StartY+set.dy*line.Length
+			fmt.Fprintf(&svg, "<line x1=\"%d\" y1=\"%d\" x2=\"%d\" y2=\"%d\"/>\n", line.StartX, line.StartY, endX, endY)
+		}
+		svg.WriteString("</g>\n")
+	}
+	svg.WriteString("</svg>\n")
+	return svg.Bytes()
+}
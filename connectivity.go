@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+)
+
+// ConnectivityGraph is a coarse navigation graph for the AI. The nodes are the regions of the environment layer (see ComputeRegions),
+// the edges are connectors that lead from one position to another (within the same or into another region).
+type ConnectivityGraph struct {
+	Regions    [][]BorderLine // the horizontal runs of tiles of each region. StartY is the tile row
+	Connectors []Connector
+}
+
+// Connector is a special way of moving between two positions
+type Connector struct {
+	Type          ConnectorType
+	From          Point // in tiles
+	To            Point // in tiles
+	FromRegion    int
+	ToRegion      int
+	Bidirectional bool
+}
+
+type ConnectorType uint8
+
+const (
+	ConnectorType_Ladder     ConnectorType = 1
+	ConnectorType_Teleporter ConnectorType = 2
+	ConnectorType_Bridge     ConnectorType = 3
+)
+
+// ComputeConnectivityGraph computes the regions of the map and collects all connectors.
+// Ladders are vertical rectangle objects with the type 'ladder' inside the 'Markers' object layer. They connect their bottom and top tile.
+// Teleporters are objects with the type 'teleporter' inside the 'Markers' object layer. The property 'target' contains the name
+// of the teleporter they lead to. Teleporters only work in one direction, unless the target leads back.
+// Bridges connect their first and last tile.
+func ComputeConnectivityGraph(tilemap *TileMap, players []Player) (ConnectivityGraph, error) {
+	var graph ConnectivityGraph
+
+	environmentLayerIdx, err := tilemap.GetLayer("environment")
+	if err != nil {
+		return graph, err
+	}
+	regions, err := ComputeRegions(tilemap.Width, tilemap.Height, &tilemap.Layers[environmentLayerIdx])
+	if err != nil {
+		return graph, err
+	}
+
+	graph.Regions = make([][]BorderLine, regions.Count)
+	for y := 0; y < tilemap.Height; y++ {
+		for x := 0; x < tilemap.Width; x++ {
+			if region := regions.GetRegion(x, y); region != -1 {
+				graph.Regions[region] = extendLine(graph.Regions[region], x, y)
+			}
+		}
+	}
+
+	connect := func(connectorType ConnectorType, from, to Point, bidirectional bool) error {
+		connector := Connector{
+			Type:          connectorType,
+			From:          from,
+			To:            to,
+			FromRegion:    regions.GetRegion(int(from.X), int(from.Y)),
+			ToRegion:      regions.GetRegion(int(to.X), int(to.Y)),
+			Bidirectional: bidirectional,
+		}
+		if connector.FromRegion == -1 {
+			return fmt.Errorf("The start (x=%d, y=%d) is inside solid terrain", int(from.X), int(from.Y))
+		}
+		if connector.ToRegion == -1 {
+			return fmt.Errorf("The end (x=%d, y=%d) is inside solid terrain", int(to.X), int(to.Y))
+		}
+		graph.Connectors = append(graph.Connectors, connector)
+		return nil
+	}
+
+	for _, object := range tilemap.GetMarkers("ladder") {
+		rect, err := tilemap.GetMarkerRect(object)
+		if err != nil {
+			return graph, fmt.Errorf("Invalid ladder: %v", err)
+		}
+		if rect.Height < 1 {
+			return graph, fmt.Errorf("Invalid ladder %d (%q): The ladder must be at least one tile high", object.Id, object.Name)
+		}
+		centerX := rect.X + rect.Width/2
+		bottom := Point{centerX, rect.Y + rect.Height - 0.5}
+		top := Point{centerX, rect.Y + 0.5}
+		if err := connect(ConnectorType_Ladder, bottom, top, true); err != nil {
+			return graph, fmt.Errorf("Invalid ladder %d (%q): %v", object.Id, object.Name, err)
+		}
+	}
+
+	teleporters := tilemap.GetMarkers("teleporter")
+	for _, object := range teleporters {
+		targetName, ok := object.Properties.Get("target")
+		if !ok || targetName == "" {
+			return graph, fmt.Errorf("Invalid teleporter %d (%q): The property 'target' is missing", object.Id, object.Name)
+		}
+		var target *TileMapObject
+		for _, other := range teleporters {
+			if other.Name != targetName {
+				continue
+			}
+			if target != nil {
+				return graph, fmt.Errorf("Invalid teleporter %d (%q): There are multiple teleporters with the name %q", object.Id, object.Name, targetName)
+			}
+			target = other
+		}
+		if target == nil {
+			return graph, fmt.Errorf("Invalid teleporter %d (%q): The target teleporter %q doesn't exist", object.Id, object.Name, targetName)
+		}
+		if target == object {
+			return graph, fmt.Errorf("Invalid teleporter %d (%q): The teleporter leads to itself", object.Id, object.Name)
+		}
+		if err := connect(ConnectorType_Teleporter, tilemap.GetMarkerPosition(object), tilemap.GetMarkerPosition(target), false); err != nil {
+			return graph, fmt.Errorf("Invalid teleporter %d (%q): %v", object.Id, object.Name, err)
+		}
+	}
+
+	for p, player := range players {
+		for _, building := range player.Buildings {
+			if building.Type != BuildingType_Bridge {
+				continue
+			}
+			tile := Tile{Flags: building.Flags}
+			rightX, rightY := tile.GetRightVector()
+			lastX, lastY := building.SpawnX+(building.SpanLength-1)*rightX, building.SpawnY+(building.SpanLength-1)*rightY
+			from := Point{float32(building.SpawnX) + 0.5, float32(building.SpawnY) + 0.5}
+			to := Point{float32(lastX) + 0.5, float32(lastY) + 0.5}
+			if err := connect(ConnectorType_Bridge, from, to, true); err != nil {
+				return graph, fmt.Errorf("Invalid bridge (player %d, x=%d, y=%d): %v", p, building.SpawnX, building.SpawnY, err)
+			}
+		}
+	}
+	return graph, nil
+}
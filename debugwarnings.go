@@ -0,0 +1,23 @@
+package main
+
+// DebugWarning is a conversion warning that is embedded into the output, so that the game can display it in-game (see -debug-warnings)
+type DebugWarning struct {
+	Message string
+	X       int // tile of the warning, -1 if the warning has no position
+	Y       int
+}
+
+// DebugWarningsToBottomLeftOrigin converts the positions of the warnings into a bottom-left origin (see ToBottomLeftOrigin)
+func DebugWarningsToBottomLeftOrigin(height int, warnings []DebugWarning) []DebugWarning {
+	if warnings == nil {
+		return nil // warnings are not embedded
+	}
+	flipped := make([]DebugWarning, len(warnings))
+	for i, warning := range warnings {
+		flipped[i] = warning
+		if warning.Y >= 0 {
+			flipped[i].Y = height - 1 - warning.Y
+		}
+	}
+	return flipped
+}
@@ -1,11 +1,21 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
 	"encoding/xml"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"os"
 	"strconv"
 	"strings"
+	"unicode"
+
+	"github.com/klauspost/compress/zstd"
 )
 
 type TileMap struct {
@@ -17,15 +27,53 @@ type TileMap struct {
 	Tilewidth   int    `xml:"tilewidth,attr"`
 	Tileheight  int    `xml:"tileheight,attr"`
 
+	Properties   Properties           `xml:"properties>property"`
 	Tilesets     []TileSet            `xml:"tileset"`
 	Layers       []TileMapLayer       `xml:"layer"`
 	ObjectLayers []TileMapObjectLayer `xml:"objectgroup"`
+	ImageLayers  []TileMapImageLayer  `xml:"imagelayer"`
+
+	UnsupportedLayers []UnsupportedLayer `xml:",any"` // all other elements (groups, ...). See checkUnsupportedLayers
 
 	// Will be extracter after loading:
 	BackgroundObjectLayer *TileMapObjectLayer `xml:"-"`
 	ForegroundObjectLayer *TileMapObjectLayer `xml:"-"`
+	MarkerObjectLayer     *TileMapObjectLayer `xml:"-"`
+
+	// Will be extracted during conversion:
+	Environment EnvironmentSettings `xml:"-"`
+	Victory     VictoryConditions   `xml:"-"`
+	Hazards     []Hazard            `xml:"-"`
+	WindField   WindField           `xml:"-"`
+	Checkpoints []Checkpoint        `xml:"-"`
+	CameraPaths []CameraPath        `xml:"-"`
+	AIHints     []AIHint            `xml:"-"`
+	Squads      []Squad             `xml:"-"`
+	Obstacles   []Obstacle          `xml:"-"`
+	NoBuild     []Rect              `xml:"-"` // in tiles
+	Water       []WaterVolume       `xml:"-"`
+	Navigation  ConnectivityGraph   `xml:"-"`
+	TileFlags   TileFlags           `xml:"-"`
+	Thumbnail   Thumbnail           `xml:"-"`
+	RenderPass  []RenderPass        `xml:"-"` // per layer, in Tiled order
+	Offsets     []LayerOffset       `xml:"-"` // per layer, in Tiled order
+	Images      []ImageLayer        `xml:"-"` // visible image layers, in Tiled order
+
+	FlyingBorders  *SortedBorderLines  `xml:"-"` // nil if flying units use the same borders as ground units
+	DynamicBorders []SortedBorderLines `xml:"-"` // one entry per obstacle. nil if dynamic borders are disabled
+	DebugWarnings  []DebugWarning      `xml:"-"` // nil if warnings are not embedded
 }
 
+// Property is a single custom property that was defined in Tiled (on the map, a layer or an object)
+type Property struct {
+	Name  string `xml:"name,attr"`
+	Type  string `xml:"type,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// Properties is a list of custom properties
+type Properties []Property
+
 const (
 	FlippedHorizontallyTiledFlag uint32 = 0x80000000
 	FlippedVerticallyTiledFlag   uint32 = 0x40000000
@@ -42,19 +90,88 @@ const (
 )
 
 type TileSet struct {
-	Type       TileSetType `xml:"-"`
-	FirstGid   uint32      `xml:"firstgid,attr"`
-	Name       string      `xml:"name,attr"`
-	TileWidth  int         `xml:"tilewidth,attr"`
-	TileHeight int         `xml:"tileheight,attr"`
-	TileCount  uint32      `xml:"tilecount,attr"`
-	Columns    int         `xml:"columns,attr"`
+	Type       TileSetType   `xml:"-"`
+	FirstGid   uint32        `xml:"firstgid,attr"`
+	Name       string        `xml:"name,attr"`
+	Source     string        `xml:"source,attr"` // external tileset (.tsx)
+	TileWidth  int           `xml:"tilewidth,attr"`
+	TileHeight int           `xml:"tileheight,attr"`
+	TileCount  uint32        `xml:"tilecount,attr"`
+	Columns    int           `xml:"columns,attr"`
+	Spacing    int           `xml:"spacing,attr"`
+	Margin     int           `xml:"margin,attr"`
+	Image      TileSetImage  `xml:"image"`
+	Tiles      []TileSetTile `xml:"tile"` // only tiles with custom information are listed
+}
+
+// TileSetTile contains the custom information of a single tile of a tileset
+type TileSetTile struct {
+	Id         uint32     `xml:"id,attr"` // starts at 0
+	Properties Properties `xml:"properties>property"`
+}
+
+// GetTileProperties returns the custom properties of the tile with the given index (starting at 1, see Tile.Index)
+func (tileset *TileSet) GetTileProperties(index uint32) Properties {
+	for _, tile := range tileset.Tiles {
+		if tile.Id+1 == index {
+			return tile.Properties
+		}
+	}
+	return nil
+}
+
+type TileSetImage struct {
+	Source string `xml:"source,attr"`
+	Width  int    `xml:"width,attr"`
+	Height int    `xml:"height,attr"`
 }
 
 type TileMapLayer struct {
+	Name       string           `xml:"name,attr"`
+	OffsetX    float32          `xml:"offsetx,attr"` // in pixels
+	OffsetY    float32          `xml:"offsety,attr"`
+	Data       TileMapLayerData `xml:"data"`
+	Properties Properties       `xml:"properties>property"`
+	Tiles      []Tile           `xml:"-"`
+}
+
+// TileMapLayerData contains the layer's tiles, either as text (csv or base64) or as <tile> elements (no encoding)
+type TileMapLayerData struct {
+	Encoding    string            `xml:"encoding,attr"`
+	Compression string            `xml:"compression,attr"` // base64 only, empty if uncompressed
+	RawData     string            `xml:",chardata"`
+	Tiles       []TileMapDataTile `xml:"tile"`
+}
+
+type TileMapDataTile struct {
+	Gid uint32 `xml:"gid,attr"`
+}
+
+// DecoderOptions control how tolerant the decoder is
+type DecoderOptions struct {
+	Legacy             bool             // accept quirks of maps that were created with Tiled 0.x
+	AllowUnknownLayers bool             // skip layers that can't be converted instead of failing
+	ObjectLayerNames   ObjectLayerNames // nil = DefaultObjectLayerNames
+}
+
+// UnsupportedLayer is a map element that is not converted (for example a group)
+type UnsupportedLayer struct {
+	XMLName xml.Name
 	Name    string `xml:"name,attr"`
-	RawData string `xml:"data"`
-	Tiles   []Tile `xml:"-"`
+}
+
+// ignoredMapElements are elements of the map that are not layers and therefore not reported as unsupported
+var ignoredMapElements = map[string]bool{
+	"editorsettings": true,
+}
+
+// String returns the kind and name of the layer
+func (layer UnsupportedLayer) String() string {
+	kind := layer.XMLName.Local
+	if kind == "group" {
+		kind = "group layer"
+	}
+	return fmt.Sprintf("%s %q", kind, layer.Name)
 }
 
 type Tile struct {
@@ -65,11 +182,15 @@ type Tile struct {
 
 type TileMapObjectLayer struct {
 	Name    string          `xml:"name,attr"`
+	OffsetX float32         `xml:"offsetx,attr"` // in pixels, applied to the objects after loading (see ApplyObjectLayerOffsets)
+	OffsetY float32         `xml:"offsety,attr"`
 	Objects []TileMapObject `xml:"object"`
 }
 
 type TileMapObject struct {
 	Id       uint32   `xml:"id,attr"`
+	Name     string   `xml:"name,attr"`
+	Type     string   `xml:"type,attr"`
 	Index    uint32   `xml:"gid,attr"`
 	Flags    uint8    `xml:"-"`
 	X        float32  `xml:"x,attr"`
@@ -78,6 +199,22 @@ type TileMapObject struct {
 	Height   float32  `xml:"height,attr"`
 	Rotation float32  `xml:"rotation,attr"`
 	TileSet  *TileSet `xml:"-"`
+
+	Properties Properties `xml:"properties>property"`
+	Polyline   *Polyline  `xml:"polyline"`
+}
+
+// Scale returns the object's scale factors relative to the size of its tile. Objects can be scaled non-uniformly.
+func (object *TileMapObject) Scale() (float32, float32) {
+	if object.TileSet == nil {
+		return 1, 1
+	}
+	return object.Width / float32(object.TileSet.TileWidth), object.Height / float32(object.TileSet.TileHeight)
+}
+
+// Polyline contains the points of a polyline object, relative to the object's position
+type Polyline struct {
+	Points string `xml:"points,attr"` // "x1,y1 x2,y2 ..."
 }
 
 const FIRST_DIAGONAL_TILE_TYPE uint32 = 6*8 + 1
@@ -220,6 +357,55 @@ func (tile *Tile) HasBorderTowards(side Orientation) bool {
 	panic("Invalid tile type")
 }
 
+// Get returns the value of the property with the given name
+func (props Properties) Get(name string) (string, bool) {
+	for _, prop := range props {
+		if prop.Name == name {
+			return prop.Value, true
+		}
+	}
+	return "", false
+}
+
+// GetFloat returns the property with the given name as float, or the default value if it doesn't exist
+func (props Properties) GetFloat(name string, defaultValue float32) (float32, error) {
+	value, ok := props.Get(name)
+	if !ok {
+		return defaultValue, nil
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(value), 32)
+	if err != nil {
+		return defaultValue, fmt.Errorf("Property %q is not a valid number: %q", name, value)
+	}
+	return float32(f), nil
+}
+
+// GetInt returns the property with the given name as integer, or the default value if it doesn't exist
+func (props Properties) GetInt(name string, defaultValue int) (int, error) {
+	value, ok := props.Get(name)
+	if !ok {
+		return defaultValue, nil
+	}
+	i, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return defaultValue, fmt.Errorf("Property %q is not a valid integer: %q", name, value)
+	}
+	return i, nil
+}
+
+// GetBool returns the property with the given name as boolean, or the default value if it doesn't exist
+func (props Properties) GetBool(name string, defaultValue bool) (bool, error) {
+	value, ok := props.Get(name)
+	if !ok {
+		return defaultValue, nil
+	}
+	b, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		return defaultValue, fmt.Errorf("Property %q is not a valid boolean: %q", name, value)
+	}
+	return b, nil
+}
+
 func (tilemap *TileMap) GetLayer(layername string) (int, error) {
 	layerIdx := -1
 	for idx, layer := range tilemap.Layers {
@@ -238,6 +424,23 @@ func (tilemap *TileMap) GetLayer(layername string) (int, error) {
 	return layerIdx, nil
 }
 
+// conversionLayers only contain information for the conversion (spawn info, no-build zones) and are not stored in the output file
+var conversionLayers = map[string]bool{
+	"spawn":   true,
+	"noBuild": true,
+}
+
+// OutputLayers returns the indices of the layers that are stored in the output file, in Tiled order (see conversionLayers)
+func (tilemap *TileMap) OutputLayers() []int {
+	indices := make([]int, 0, len(tilemap.Layers))
+	for idx, layer := range tilemap.Layers {
+		if !conversionLayers[layer.Name] {
+			indices = append(indices, idx)
+		}
+	}
+	return indices
+}
+
 func (tilemap *TileMap) String() string {
 	var str = fmt.Sprintf(
 		"Version:           %v\n"+
@@ -271,15 +474,64 @@ func (layer *TileMapLayer) String() string {
 		layer.Name)
 }
 
-func LoadTilesFile(filepath string) (tilemap TileMap, err error) {
-	sourceData, err := ioutil.ReadFile(filepath)
+// LoadTilesFile loads a map from a local file, an URL or from stdin ("-")
+func LoadTilesFile(filepath string, options DecoderOptions) (tilemap TileMap, err error) {
+	if filepath == "-" {
+		return LoadTiles(os.Stdin, filepath, options)
+	}
+
+	sourceData, err := ReadInput(filepath)
 	if err != nil {
 		return tilemap, fmt.Errorf("Failed to read source file '%v': %v", filepath, err)
 	}
+	return LoadTiles(bytes.NewReader(sourceData), filepath, options)
+}
+
+// LoadTiles reads a map (TMX or Tiled's JSON format, see IsJSONMap) from the reader. The location is used to resolve
+// external tilesets, which are relative to the working directory when reading from stdin ("-").
+func LoadTiles(reader io.Reader, filepath string, options DecoderOptions) (tilemap TileMap, err error) {
+	stopDecoding := BeginPhase(Phase_Decoding)
+	defer stopDecoding()
 
-	err = xml.Unmarshal(sourceData, &tilemap)
+	sourceData, err := ioutil.ReadAll(reader)
 	if err != nil {
-		return tilemap, err
+		return tilemap, fmt.Errorf("Failed to read source file '%v': %v", filepath, err)
+	}
+	if sourceData, err = NormalizeXML(sourceData); err != nil {
+		return tilemap, fmt.Errorf("Failed to read source file '%v': %v", filepath, err)
+	}
+	if IsJSONMap(filepath, sourceData) {
+		err = UnmarshalJSONMap(sourceData, &tilemap)
+	} else {
+		err = xml.Unmarshal(sourceData, &tilemap)
+	}
+	if err != nil {
+		return tilemap, fmt.Errorf("Failed to read source file '%v': %v", filepath, err)
+	}
+
+	if err := tilemap.checkUnsupportedLayers(options); err != nil {
+		return tilemap, fmt.Errorf("Failed to read source file '%v': %v", filepath, err)
+	}
+
+	// Load external tilesets:
+	for idx := range tilemap.Tilesets {
+		if err := tilemap.Tilesets[idx].loadExternal(filepath); err != nil {
+			return tilemap, err
+		}
+	}
+
+	if tilemap.Renderorder == "" {
+		if !options.Legacy {
+			return tilemap, fmt.Errorf("Failed to read source file '%v': The map has no render order. Maps of Tiled 0.x can be converted with -legacy", filepath)
+		}
+		log.Warningf("Legacy map: No render order defined. Assuming 'right-down'")
+		tilemap.Renderorder = "right-down"
+	}
+
+	for idx := range tilemap.Tilesets {
+		if err := tilemap.Tilesets[idx].computeTileCount(options); err != nil {
+			return tilemap, err
+		}
 	}
 
 	// Validate tilesets and assign types:
@@ -299,23 +551,13 @@ func LoadTilesFile(filepath string) (tilemap TileMap, err error) {
 	}
 
 	// Validate objects and assign types:
+	ApplyObjectLayerOffsets(&tilemap)
+	if err := RouteObjectLayers(&tilemap, options.ObjectLayerNames); err != nil {
+		return tilemap, err
+	}
 	for idx := 0; idx < len(tilemap.ObjectLayers); idx++ {
 		objectLayer := &tilemap.ObjectLayers[idx]
 
-		if strings.ToLower(objectLayer.Name) == "backgroundobjects" {
-			if tilemap.BackgroundObjectLayer != nil {
-				return tilemap, fmt.Errorf("Multiple background object layers found. Only one layer is supported")
-			}
-			tilemap.BackgroundObjectLayer = objectLayer
-		} else if strings.ToLower(objectLayer.Name) == "foregroundobjects" {
-			if tilemap.ForegroundObjectLayer != nil {
-				return tilemap, fmt.Errorf("Multiple foreground object layers found. Only one layer is supported")
-			}
-			tilemap.ForegroundObjectLayer = objectLayer
-		} else {
-			return tilemap, fmt.Errorf("Invalid TileMap: Unsupported object layer. There can be only two object layers, one named 'BackgroundObjects' and one named 'ForegroundObjects'. Found object layer with name %q, objectLayer.Name")
-		}
-
 		for obj := 0; obj < len(objectLayer.Objects); obj++ {
 			object := &objectLayer.Objects[obj]
 			var tileID = object.Index
@@ -355,10 +597,19 @@ func LoadTilesFile(filepath string) (tilemap TileMap, err error) {
 			object.Index = tileID
 			object.Flags = flags
 			object.TileSet = tileSet
+
+			if tileSet != nil && object.Width == 0 && object.Height == 0 {
+				// Older Tiled versions don't store the size of unscaled tile objects
+				object.Width = float32(tileSet.TileWidth)
+				object.Height = float32(tileSet.TileHeight)
+			}
 		}
 
 	}
 
+	stopDecoding()
+	defer BeginPhase(Phase_TileExtraction)()
+
 	expectedTileCount := tilemap.Width * tilemap.Height
 	for idx := range tilemap.Layers {
 		if err := tilemap.Layers[idx].extractTiles(expectedTileCount, tilemap.Tilesets); err != nil {
@@ -368,25 +619,188 @@ func LoadTilesFile(filepath string) (tilemap TileMap, err error) {
 	return tilemap, err
 }
 
+// checkUnsupportedLayers reports all layers that can't be converted at once, so that designers know what won't appear in-game.
+// Unless they are allowed, they cause an error. Layers inside of groups are not converted either.
+func (tilemap *TileMap) checkUnsupportedLayers(options DecoderOptions) error {
+	var names []string
+	for _, layer := range tilemap.UnsupportedLayers {
+		if !ignoredMapElements[layer.XMLName.Local] {
+			names = append(names, layer.String())
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	if !options.AllowUnknownLayers {
+		return fmt.Errorf("The map contains layers that can't be converted: %s. Use -allow-unknown-layers to skip them", strings.Join(names, ", "))
+	}
+	log.Warningf("Skipping %d layers that can't be converted: %s", len(names), strings.Join(names, ", "))
+	return nil
+}
+
+// loadExternal reads the tileset's content from the referenced .tsx or .tsj file (if any). The path is relative to the map file.
+func (tileset *TileSet) loadExternal(mapFile string) error {
+	if tileset.Source == "" {
+		return nil
+	}
+	location, err := ResolveReference(mapFile, tileset.Source)
+	if err != nil {
+		return fmt.Errorf("Failed to load external tileset %q: %v", tileset.Source, err)
+	}
+	data, err := ReadInput(location)
+	if err != nil {
+		return fmt.Errorf("Failed to load external tileset %q: %v", tileset.Source, err)
+	}
+
+	if data, err = NormalizeXML(data); err != nil {
+		return fmt.Errorf("Failed to load external tileset %q: %v", tileset.Source, err)
+	}
+
+	firstGid, source := tileset.FirstGid, tileset.Source
+	if IsJSONMap(location, data) {
+		err = UnmarshalJSONTileSet(data, tileset)
+	} else {
+		err = xml.Unmarshal(data, tileset)
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to load external tileset %q: %v", source, err)
+	}
+	tileset.FirstGid, tileset.Source = firstGid, source // not part of the .tsx file
+	return nil
+}
+
+// computeTileCount computes the tile count and column count of tilesets that don't store them (Tiled 0.x)
+func (tileset *TileSet) computeTileCount(options DecoderOptions) error {
+	// The tile count is all that's needed to map global tile ids. The columns are not required,
+	// image collection tilesets don't have any (columns="0").
+	if tileset.TileCount != 0 {
+		return nil
+	}
+	if !options.Legacy {
+		return fmt.Errorf("The tileset %q has no tile count. Maps of Tiled 0.x can be converted with -legacy", tileset.Name)
+	}
+	if tileset.TileWidth <= 0 || tileset.TileHeight <= 0 || tileset.Image.Width <= 0 || tileset.Image.Height <= 0 {
+		return fmt.Errorf("The tileset %q has no tile count and it can't be computed from the tileset image", tileset.Name)
+	}
+
+	columns := (tileset.Image.Width - 2*tileset.Margin + tileset.Spacing) / (tileset.TileWidth + tileset.Spacing)
+	rows := (tileset.Image.Height - 2*tileset.Margin + tileset.Spacing) / (tileset.TileHeight + tileset.Spacing)
+	if columns <= 0 || rows <= 0 { // the image is smaller than a single tile
+		return fmt.Errorf("The tileset %q has no tile count and it can't be computed from the tileset image", tileset.Name)
+	}
+	if tileset.Columns == 0 {
+		tileset.Columns = columns
+	}
+	tileset.TileCount = uint32(columns * rows)
+	log.Warningf("Legacy map: The tileset %q has no tile count. Computed %d tiles (%d columns) from the tileset image", tileset.Name, tileset.TileCount, tileset.Columns)
+	return nil
+}
+
+// decodeGids returns the global tile ids (including flip flags) of all tiles stored in the layer data.
+// Without encoding attribute, the tiles are stored as <tile gid="..."> elements.
+func (data *TileMapLayerData) decodeGids() ([]uint32, error) {
+	if data.Compression != "" && data.Encoding != "base64" {
+		return nil, fmt.Errorf("Unexpected layer data. Compression %q is only supported with base64 encoding", data.Compression)
+	}
+	switch data.Encoding {
+	case "csv":
+		tiles := strings.FieldsFunc(data.RawData, func(r rune) bool { // remove separators
+			return r == ',' || unicode.IsSpace(r)
+		})
+		gids := make([]uint32, len(tiles))
+		for i, tile := range tiles {
+			value, err := strconv.ParseUint(tile, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("Unexpected layer data. Failed to parse tile number: '%v'", tile)
+			}
+			gids[i] = uint32(value)
+		}
+		return gids, nil
+
+	case "base64":
+		return data.decodeBase64Gids()
+
+	case "":
+		if len(data.Tiles) == 0 && strings.TrimSpace(data.RawData) != "" {
+			return nil, fmt.Errorf("Unexpected layer data. The layer data has no encoding attribute, but isn't stored as <tile> elements")
+		}
+		gids := make([]uint32, len(data.Tiles))
+		for i, tile := range data.Tiles {
+			gids[i] = tile.Gid
+		}
+		return gids, nil
+	}
+	return nil, fmt.Errorf("Unexpected layer data. Unknown encoding %q. Supported encodings: csv, base64 or <tile> elements (no encoding)", data.Encoding)
+}
+
+// decodeBase64Gids decodes base64 layer data. The (decompressed) data is an array of little-endian uint32 gids, including the flip flags.
+func (data *TileMapLayerData) decodeBase64Gids() ([]uint32, error) {
+	encoded, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(data.RawData), ""))
+	if err != nil {
+		return nil, fmt.Errorf("Unexpected layer data. Invalid base64: %v", err)
+	}
+	raw, err := decompressLayerData(encoded, data.Compression)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(raw)%4 != 0 {
+		return nil, fmt.Errorf("Unexpected layer data. The decoded data has %d bytes, which is not a multiple of 4", len(raw))
+	}
+	gids := make([]uint32, len(raw)/4)
+	for i := range gids {
+		gids[i] = binary.LittleEndian.Uint32(raw[i*4:])
+	}
+	return gids, nil
+}
+
+// decompressLayerData decompresses base64 decoded layer data. Layers without compression are returned as they are.
+func decompressLayerData(data []byte, compression string) ([]byte, error) {
+	var reader io.ReadCloser
+	var err error
+	switch compression {
+	case "":
+		return data, nil
+	case "zlib":
+		if reader, err = zlib.NewReader(bytes.NewReader(data)); err != nil {
+			return nil, fmt.Errorf("Unexpected layer data. Invalid zlib data: %v", err)
+		}
+	case "gzip":
+		if reader, err = gzip.NewReader(bytes.NewReader(data)); err != nil {
+			return nil, fmt.Errorf("Unexpected layer data. Invalid gzip data: %v", err)
+		}
+	case "zstd":
+		decoder, err := zstd.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("Unexpected layer data. Invalid zstd data: %v", err)
+		}
+		reader = decoder.IOReadCloser()
+	default:
+		return nil, fmt.Errorf("Unexpected layer data. Unsupported compression %q. Please use zlib, gzip, zstd or no compression", compression)
+	}
+	defer reader.Close()
+	raw, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("Unexpected layer data. Failed to decompress (%s): %v", compression, err)
+	}
+	return raw, nil
+}
+
 // extractTiles convert's the layers raw data into correct tile data.
 func (layer *TileMapLayer) extractTiles(expectedTileCount int, Tilesets []TileSet) error {
-	tiles := strings.FieldsFunc(layer.RawData, func(r rune) bool { // remove separators
-		return r == ',' || r == '\n' || r == '\r'
-	})
+	gids, err := layer.Data.decodeGids()
+	if err != nil {
+		return fmt.Errorf("%v (layer=%q)", err, layer.Name)
+	}
 
-	if len(tiles) != expectedTileCount {
+	if len(gids) != expectedTileCount {
 		return fmt.Errorf("Unexpected layer data. Tile count doesn't match map size")
 	}
 
 	layer.Tiles = make([]Tile, expectedTileCount)
 
-	for i := 0; i < len(tiles); i++ {
-		value, err := strconv.Atoi(tiles[i])
-		if err != nil {
-			return fmt.Errorf("Unexpected layer data. Failed to parse tile number: '%v'", tiles[i])
-		}
-
-		tileID := uint32(value)
+	for i := 0; i < len(gids); i++ {
+		tileID := gids[i]
 
 		var flags uint8 = 0
 		if tileID&FlippedHorizontallyTiledFlag != 0 {
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// DensityLimits define how many decoration tiles and objects are allowed within a single screen area
+type DensityLimits struct {
+	AreaWidth  int // in tiles
+	AreaHeight int // in tiles
+	Warn       int // 0 = no limit
+	Error      int // 0 = no limit
+}
+
+// DensityHotspot is a screen area with a high decoration density
+type DensityHotspot struct {
+	Area  Rect
+	Count int
+}
+
+// MaxReportedHotspots is the maximum number of hotspots that are reported
+const MaxReportedHotspots = 10
+
+// ComputeDecorationDensity counts the decoration tiles and objects per tile
+func ComputeDecorationDensity(tilemap *TileMap) []int {
+	density := make([]int, tilemap.Width*tilemap.Height)
+
+	for _, layer := range tilemap.Layers {
+		for idx, tile := range layer.Tiles {
+			if tile.Index != 0 && tile.TileSet != nil && (tile.TileSet.Type == DECORATION1_TILESET || tile.TileSet.Type == DECORATION2_TILESET) {
+				density[idx]++
+			}
+		}
+	}
+
+	for _, layer := range []*TileMapObjectLayer{tilemap.BackgroundObjectLayer, tilemap.ForegroundObjectLayer} {
+		if layer == nil {
+			continue
+		}
+		for i := range layer.Objects {
+			centerX, centerY := layer.Objects[i].Center()
+			x := int(centerX) / tilemap.Tilewidth
+			y := int(centerY) / tilemap.Tileheight
+			if x >= 0 && y >= 0 && x < tilemap.Width && y < tilemap.Height {
+				density[y*tilemap.Width+x]++
+			}
+		}
+	}
+	return density
+}
+
+// FindDensityHotspots returns up to maxCount screen areas with the most decorations (most dense first). The areas don't overlap.
+// Only areas containing at least minCount decorations are returned.
+func FindDensityHotspots(width, height int, density []int, areaWidth, areaHeight, minCount, maxCount int) []DensityHotspot {
+	if areaWidth > width {
+		areaWidth = width
+	}
+	if areaHeight > height {
+		areaHeight = height
+	}
+
+	// summed-area table
+	sums := getIntScratch((width + 1) * (height + 1))
+	defer putIntScratch(sums)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			sums[(y+1)*(width+1)+x+1] = density[y*width+x] + sums[y*(width+1)+x+1] + sums[(y+1)*(width+1)+x] - sums[y*(width+1)+x]
+		}
+	}
+
+	var candidates []DensityHotspot
+	for y := 0; y+areaHeight <= height; y++ {
+		for x := 0; x+areaWidth <= width; x++ {
+			count := sums[(y+areaHeight)*(width+1)+x+areaWidth] - sums[y*(width+1)+x+areaWidth] - sums[(y+areaHeight)*(width+1)+x] + sums[y*(width+1)+x]
+			if count >= minCount {
+				candidates = append(candidates, DensityHotspot{Rect{float32(x), float32(y), float32(areaWidth), float32(areaHeight)}, count})
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Count > candidates[j].Count
+	})
+
+	var hotspots []DensityHotspot
+	for _, candidate := range candidates {
+		if len(hotspots) >= maxCount {
+			break
+		}
+		overlaps := false
+		for _, hotspot := range hotspots {
+			overlaps = overlaps || hotspot.Area.Overlaps(candidate.Area)
+		}
+		if !overlaps {
+			hotspots = append(hotspots, candidate)
+		}
+	}
+	return hotspots
+}
+
+// CheckDecorationDensity reports the decoration density and validates it against the limits
+func CheckDecorationDensity(tilemap *TileMap, limits DensityLimits) error {
+	if limits.AreaWidth <= 0 || limits.AreaHeight <= 0 {
+		return fmt.Errorf("Invalid density area: %dx%d", limits.AreaWidth, limits.AreaHeight)
+	}
+
+	density := ComputeDecorationDensity(tilemap)
+	densest := FindDensityHotspots(tilemap.Width, tilemap.Height, density, limits.AreaWidth, limits.AreaHeight, 1, 1)
+	if len(densest) == 0 {
+		log.Infof("Decoration density: no decorations")
+		return nil
+	}
+	log.Infof("Maximum decoration density: %d per %dx%d tiles (at x=%v, y=%v)", densest[0].Count, limits.AreaWidth, limits.AreaHeight, densest[0].Area.X, densest[0].Area.Y)
+
+	minLimit := limits.Warn
+	if minLimit <= 0 || (limits.Error > 0 && limits.Error < minLimit) {
+		minLimit = limits.Error
+	}
+	if minLimit <= 0 {
+		return nil
+	}
+
+	hotspots := FindDensityHotspots(tilemap.Width, tilemap.Height, density, limits.AreaWidth, limits.AreaHeight, minLimit+1, MaxReportedHotspots)
+	for _, hotspot := range hotspots {
+		message := fmt.Sprintf("Decoration hotspot at x=%v, y=%v (%dx%d tiles): %d decorations",
+			hotspot.Area.X, hotspot.Area.Y, limits.AreaWidth, limits.AreaHeight, hotspot.Count)
+		if limits.Error > 0 && hotspot.Count > limits.Error {
+			log.Errorf("%s (limit: %d)", message, limits.Error)
+		} else {
+			log.Warningf("%s (limit: %d)", message, limits.Warn)
+		}
+	}
+
+	if limits.Error > 0 && densest[0].Count > limits.Error {
+		return fmt.Errorf("Invalid map: The decoration density exceeds the limit of %d per %dx%d tiles", limits.Error, limits.AreaWidth, limits.AreaHeight)
+	}
+	return nil
+}
@@ -3,6 +3,7 @@
 echo Fetching go dependencies...
 
 go get "github.com/op/go-logging" || goto :error
+go get "github.com/klauspost/compress/zstd" || goto :error
 
 echo All dependencies have been retrieved
 pause
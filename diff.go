@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"reflect"
+)
+
+// maxListedDifferences limits how many individual entries (tiles, objects, ...) are listed per category
+const maxListedDifferences = 10
+
+// DiffMaps compares two converted maps and returns a human-readable list of structural differences.
+// The list is empty if both maps are identical.
+func DiffMaps(old, new *EncodedMap) []string {
+	var diffs []string
+	report := func(format string, args ...interface{}) {
+		diffs = append(diffs, fmt.Sprintf(format, args...))
+	}
+
+	if old.Version != new.Version {
+		report("Format version: %d -> %d", old.Version, new.Version)
+	}
+	if old.Flags != new.Flags {
+		report("Encoding flags: 0x%02X -> 0x%02X", uint8(old.Flags), uint8(new.Flags))
+	}
+	if !reflect.DeepEqual(old.TileFlagNames, new.TileFlagNames) {
+		report("Custom tile flags: %v -> %v", old.TileFlagNames, new.TileFlagNames)
+	}
+
+	if old.Width != new.Width || old.Height != new.Height {
+		report("Map size: %dx%d -> %dx%d (tiles are not compared)", old.Width, old.Height, new.Width, new.Height)
+	} else {
+		diffs = append(diffs, diffLayers(old, new)...)
+	}
+
+	diffs = append(diffs, diffList("Background object", old.BackgroundObjects, new.BackgroundObjects)...)
+	diffs = append(diffs, diffList("Foreground object", old.ForegroundObjects, new.ForegroundObjects)...)
+	diffs = append(diffs, diffList("Resource point", old.Resources, new.Resources)...)
+	diffs = append(diffs, diffList("Water drop source", old.WaterdropSources, new.WaterdropSources)...)
+
+	if len(old.Players) != len(new.Players) {
+		report("Number of players: %d -> %d", len(old.Players), len(new.Players))
+	}
+	for p := 0; p < len(old.Players) && p < len(new.Players); p++ {
+		oldPlayer, newPlayer := old.Players[p], new.Players[p]
+		diffs = append(diffs, diffList(fmt.Sprintf("Player %d: Building", p), oldPlayer.Buildings, newPlayer.Buildings)...)
+		diffs = append(diffs, diffList(fmt.Sprintf("Player %d: Unit", p), oldPlayer.Units, newPlayer.Units)...)
+		if !reflect.DeepEqual(oldPlayer.Color, newPlayer.Color) {
+			report("Player %d: Color: %v -> %v", p, colorString(oldPlayer.Color), colorString(newPlayer.Color))
+		}
+		if oldPlayer.Faction != newPlayer.Faction {
+			report("Player %d: Faction: %q -> %q", p, oldPlayer.Faction, newPlayer.Faction)
+		}
+		if oldPlayer.Handicap != newPlayer.Handicap {
+			report("Player %d: Handicap: %d%% -> %d%%", p, oldPlayer.Handicap, newPlayer.Handicap)
+		}
+		if oldPlayer.AIDifficulty != newPlayer.AIDifficulty {
+			report("Player %d: AI difficulty: %v -> %v", p, oldPlayer.AIDifficulty, newPlayer.AIDifficulty)
+		}
+		if oldPlayer.AIPersonality != newPlayer.AIPersonality {
+			report("Player %d: AI personality: %q -> %q", p, oldPlayer.AIPersonality, newPlayer.AIPersonality)
+		}
+	}
+
+	diffs = append(diffs, diffBorders(old.Borders, new.Borders)...)
+	diffs = append(diffs, diffSections(old.Sections, new.Sections)...)
+	return diffs
+}
+
+// diffLayers compares the tiles of all layers. The layers of both maps must have the same size.
+func diffLayers(old, new *EncodedMap) []string {
+	var diffs []string
+	if len(old.Layers) != len(new.Layers) {
+		diffs = append(diffs, fmt.Sprintf("Number of layers: %d -> %d", len(old.Layers), len(new.Layers)))
+	}
+	if old.EnvironmentLayer != new.EnvironmentLayer {
+		diffs = append(diffs, fmt.Sprintf("Environment layer: %d -> %d", old.EnvironmentLayer, new.EnvironmentLayer))
+	}
+
+	for l := 0; l < len(old.Layers) && l < len(new.Layers); l++ {
+		oldLayer, newLayer := &old.Layers[l], &new.Layers[l]
+		name := fmt.Sprintf("Layer %d", l)
+		if l == new.EnvironmentLayer {
+			name += " (environment)"
+		}
+		if oldLayer.TileSetType != newLayer.TileSetType {
+			diffs = append(diffs, fmt.Sprintf("%s: Tileset type: %d -> %d", name, oldLayer.TileSetType, newLayer.TileSetType))
+		}
+
+		changed := 0
+		minX, minY, maxX, maxY := old.Width, old.Height, -1, -1
+		var listed []string
+		for i := range oldLayer.Indices {
+			if oldLayer.Indices[i] == newLayer.Indices[i] && oldLayer.Flags[i] == newLayer.Flags[i] {
+				continue
+			}
+			x, y := i%old.Width, i/old.Width
+			changed++
+			minX, minY, maxX, maxY = minInt(minX, x), minInt(minY, y), maxInt(maxX, x), maxInt(maxY, y)
+			if len(listed) < maxListedDifferences {
+				listed = append(listed, fmt.Sprintf("\t(x=%d, y=%d): tile %d flags 0x%02X -> tile %d flags 0x%02X",
+					x, y, oldLayer.Indices[i], oldLayer.Flags[i], newLayer.Indices[i], newLayer.Flags[i]))
+			}
+		}
+		if changed == 0 {
+			continue
+		}
+		diffs = append(diffs, fmt.Sprintf("%s: %d changed tiles (x=%d-%d, y=%d-%d)", name, changed, minX, maxX, minY, maxY))
+		diffs = append(diffs, listed...)
+		if changed > len(listed) {
+			diffs = append(diffs, fmt.Sprintf("\t... and %d more", changed-len(listed)))
+		}
+	}
+	return diffs
+}
+
+// diffList compares two lists of comparable entries (objects, spawns, ...) as multisets and reports added and removed entries.
+// The order of the entries is ignored.
+func diffList(name string, old, new interface{}) []string {
+	oldValues, newValues := reflect.ValueOf(old), reflect.ValueOf(new)
+
+	remaining := make(map[string]int) // entry -> number of occurrences in old that have no counterpart in new (yet)
+	for i := 0; i < oldValues.Len(); i++ {
+		remaining[entryString(oldValues.Index(i).Interface())]++
+	}
+	var added []string
+	for i := 0; i < newValues.Len(); i++ {
+		entry := entryString(newValues.Index(i).Interface())
+		if remaining[entry] > 0 {
+			remaining[entry]--
+		} else {
+			added = append(added, entry)
+		}
+	}
+	var removed []string
+	for i := 0; i < oldValues.Len(); i++ {
+		entry := entryString(oldValues.Index(i).Interface())
+		if remaining[entry] > 0 {
+			remaining[entry]--
+			removed = append(removed, entry)
+		}
+	}
+
+	var diffs []string
+	for _, change := range []struct {
+		kind    string
+		entries []string
+	}{{"removed", removed}, {"added", added}} {
+		for i, entry := range change.entries {
+			if i == maxListedDifferences {
+				diffs = append(diffs, fmt.Sprintf("%s %s: ... and %d more", name, change.kind, len(change.entries)-i))
+				break
+			}
+			diffs = append(diffs, fmt.Sprintf("%s %s: %s", name, change.kind, entry))
+		}
+	}
+	return diffs
+}
+
+// entryString returns a readable, unique representation of a list entry
+func entryString(entry interface{}) string {
+	switch entry := entry.(type) {
+	case EncodedObject:
+		return fmt.Sprintf("tile %d at (%.3f, %.3f), size %.3fx%.3f, rotation %.3f", entry.Index, entry.X, entry.Y, entry.Width, entry.Height, entry.Rotation)
+	case ResourcePoint:
+		return fmt.Sprintf("(x=%d, y=%d) flags 0x%02X", entry.SpawnX, entry.SpawnY, entry.ResourcePointFlags)
+	case WaterdropSource:
+		return fmt.Sprintf("(x=%d, y=%d) flags 0x%02X", entry.SpawnX, entry.SpawnY, entry.WaterdropFlags)
+	case Building:
+		str := fmt.Sprintf("%s at (x=%d, y=%d) flags 0x%02X", buildingTypeName(entry.Type), entry.SpawnX, entry.SpawnY, entry.Flags)
+		if entry.Type == BuildingType_Bridge {
+			str += fmt.Sprintf(", span %d", entry.SpanLength)
+		}
+		if entry.Type == BuildingType_Turret {
+			str += fmt.Sprintf(", arc %.3f..%.3f", entry.FiringArcMin, entry.FiringArcMax)
+		}
+		return str
+	case Unit:
+		return fmt.Sprintf("%s at (x=%d, y=%d)", unitTypeName(entry.Type), entry.SpawnX, entry.SpawnY)
+	case BorderLine:
+		return fmt.Sprintf("(x=%d, y=%d) length %d", entry.StartX, entry.StartY, entry.Length)
+	}
+	return fmt.Sprintf("%v", entry)
+}
+
+func buildingTypeName(buildingType BuildingType) string {
+	if name, ok := buildingTypeNames[buildingType]; ok {
+		return name
+	}
+	return fmt.Sprintf("building type %d", buildingType)
+}
+
+func unitTypeName(unitType UnitType) string {
+	if name, ok := unitTypeNames[unitType]; ok {
+		return name
+	}
+	return fmt.Sprintf("unit type %d", unitType)
+}
+
+func colorString(color *Color) string {
+	if color == nil {
+		return "none"
+	}
+	return fmt.Sprintf("#%02X%02X%02X%02X", color.R, color.G, color.B, color.A)
+}
+
+// diffBorders reports the border deltas per direction
+func diffBorders(old, new SortedBorderLines) []string {
+	var diffs []string
+	directions := []struct {
+		name     string
+		old, new []BorderLine
+	}{
+		{"left", old.Left, new.Left}, {"right", old.Right, new.Right}, {"up", old.Up, new.Up}, {"down", old.Down, new.Down},
+		{"up-left", old.UpLeft, new.UpLeft}, {"up-right", old.UpRight, new.UpRight},
+		{"down-left", old.DownLeft, new.DownLeft}, {"down-right", old.DownRight, new.DownRight},
+	}
+	for _, dir := range directions {
+		lineDiffs := diffList(fmt.Sprintf("Border line (%s)", dir.name), dir.old, dir.new)
+		if len(lineDiffs) == 0 {
+			continue
+		}
+		diffs = append(diffs, fmt.Sprintf("Borders (%s): %d lines, length %d -> %d lines, length %d",
+			dir.name, len(dir.old), borderLength(dir.old), len(dir.new), borderLength(dir.new)))
+		diffs = append(diffs, lineDiffs...)
+	}
+	return diffs
+}
+
+func borderLength(lines []BorderLine) int {
+	length := 0
+	for _, line := range lines {
+		length += line.Length
+	}
+	return length
+}
+
+// diffSections reports added, removed and changed sections. Sections are compared by their raw content.
+func diffSections(old, new []EncodedSection) []string {
+	var diffs []string
+	oldSections := make(map[SectionID][]byte)
+	for _, section := range old {
+		oldSections[section.ID] = section.Content
+	}
+	newSections := make(map[SectionID][]byte)
+	for _, section := range new {
+		newSections[section.ID] = section.Content
+		oldContent, ok := oldSections[section.ID]
+		if !ok {
+			diffs = append(diffs, fmt.Sprintf("Section added: %v (%d bytes)", section.ID, len(section.Content)))
+		} else if !bytes.Equal(oldContent, section.Content) {
+			diffs = append(diffs, fmt.Sprintf("Section changed: %v (%d -> %d bytes)", section.ID, len(oldContent), len(section.Content)))
+		}
+	}
+	for _, section := range old {
+		if _, ok := newSections[section.ID]; !ok {
+			diffs = append(diffs, fmt.Sprintf("Section removed: %v (%d bytes)", section.ID, len(section.Content)))
+		}
+	}
+	return diffs
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func absInt(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+// RunDiff compares two converted map files and prints their differences
+func RunDiff(args []string) error {
+	flags := flag.NewFlagSet("diff", flag.ContinueOnError)
+	byteOrder := flags.String("byte-order", "le", "Byte order of both files: le (little-endian) or be (big-endian)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		return fmt.Errorf("Usage: diff [-byte-order le|be] <old.tilemap> <new.tilemap>")
+	}
+
+	order, err := ParseByteOrder(*byteOrder)
+	if err != nil {
+		return err
+	}
+
+	old, err := LoadEncodedMap(flags.Arg(0), order)
+	if err != nil {
+		return err
+	}
+	new, err := LoadEncodedMap(flags.Arg(1), order)
+	if err != nil {
+		return err
+	}
+
+	diffs := DiffMaps(old, new)
+	if len(diffs) == 0 {
+		fmt.Printf("No differences\n")
+		return nil
+	}
+	for _, diff := range diffs {
+		fmt.Println(diff)
+	}
+	return nil
+}
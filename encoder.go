@@ -2,87 +2,413 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/binary"
 	"fmt"
-	"math"
+	"unicode/utf8"
 )
 
-// Encode encodes and writes the given tilemap into the writer (=output file)
-func Encode(writer *bufio.Writer, order binary.ByteOrder, tilemap *TileMap, resourcePoints []ResourcePoint, waterdropSources []WaterdropSource, players []Player, borders SortedBorderLines) error {
+// EncodingFlags are stored in the header and define how some of the sections are encoded
+type EncodingFlags uint8
+
+const (
+	EncodingFlag_PackedBorders EncodingFlags = 0x01 // borders are stored as bit-packed stream (see encodePackedBorders)
+	EncodingFlag_Varint        EncodingFlags = 0x02 // 16bit counts and coordinates are stored as varints (see writeShort)
+	EncodingFlag_BottomLeft    EncodingFlags = 0x04 // all coordinates and vectors use a bottom-left origin (y up), per-tile data is still stored top-down (see ToBottomLeftOrigin)
+	EncodingFlag_TileFlags     EncodingFlags = 0x08 // environment tiles contain custom flags, the header contains their names (format version 4+, set automatically)
+	EncodingFlag_PlayerSetup   EncodingFlags = 0x10 // players contain a handicap and AI settings (format version 4+, set automatically)
+)
+
+// SectionID identifies an optional section that is stored after the borders
+type SectionID uint8
+
+// In format version 3, the section ids are used as magic bytes in front of each section.
+// Since format version 4, each section is prefixed with its id and length, so that loaders can skip unknown sections.
+// New sections need a new, unique id.
+const (
+	Section_End         SectionID = 0x00 // terminates the section list (format version 4+)
+	Section_Hazards     SectionID = 0x3C
+	Section_Wind        SectionID = 0xC3
+	Section_Environment SectionID = 0xE7
+	Section_Checkpoints SectionID = 0x7E
+	Section_CameraPaths SectionID = 0xCA
+	Section_Victory     SectionID = 0x71
+	Section_AIHints     SectionID = 0xA1
+	Section_ObjectScale SectionID = 0x5C // format version 4+
+	Section_Anchors     SectionID = 0x9A // format version 4+
+	Section_Squads      SectionID = 0x5D // format version 4+
+	Section_Inventories SectionID = 0x1B // format version 4+
+	Section_Obstacles   SectionID = 0x0B // format version 4+
+	Section_DynBorders  SectionID = 0xDB // format version 4+
+	Section_FlyBorders  SectionID = 0xF1 // format version 4+
+	Section_Metadata    SectionID = 0x3D // format version 4+
+	Section_Fluids      SectionID = 0xF7 // format version 4+
+	Section_Navigation  SectionID = 0xC0 // format version 4+
+	Section_NoBuild     SectionID = 0x8B // format version 4+
+	Section_Thumbnail   SectionID = 0x7B // format version 4+
+	Section_RenderPass  SectionID = 0x2B // format version 4+
+	Section_ImageLayers SectionID = 0x1A // format version 4+
+	Section_Offsets     SectionID = 0x0F // format version 4+
+	Section_Debug       SectionID = 0xDE // format version 4+, only written with -debug-warnings
+)
+
+// The parts in front of the sections. These ids are only used in the checksum table (format version 5+, see SectionChecksum)
+// and must not be used for sections.
+const (
+	Section_Layer      SectionID = 0x01 // a single tile layer
+	Section_Objects    SectionID = 0x02 // background and foreground objects
+	Section_Resources  SectionID = 0x03
+	Section_Waterdrops SectionID = 0x04
+	Section_Players    SectionID = 0x05
+	Section_Borders    SectionID = 0x06
+)
+
+// Section is an optional part of the output file
+type Section struct {
+	ID     SectionID
+	Encode func(writer *bufio.Writer) error
+}
+
+// Encode encodes and writes the given tilemap into the writer (=output file).
+// version is the format version to produce (see SupportedFormatVersions). Information that can't be stored in older versions is dropped.
+func Encode(writer *bufio.Writer, order binary.ByteOrder, version uint8, flags EncodingFlags, tilemap *TileMap, resourcePoints []ResourcePoint, waterdropSources []WaterdropSource, players []Player, borders SortedBorderLines) error {
+	if !IsSupportedFormatVersion(int(version)) {
+		return fmt.Errorf("Unsupported format version %d", version)
+	}
+	if version < 3 && flags != 0 {
+		return fmt.Errorf("Encoding flags (packed borders, varints, origin) require format version 3 or newer")
+	}
+	var customTileFlags []uint8
+	if version >= 4 && len(tilemap.TileFlags.Names) > 0 {
+		flags |= EncodingFlag_TileFlags
+		customTileFlags = tilemap.TileFlags.Bits
+	}
+	if version >= 4 {
+		for _, player := range players {
+			if player.HasCustomSettings() {
+				flags |= EncodingFlag_PlayerSetup
+			}
+		}
+	}
+
 	writer.WriteByte(byte(0xA5)) // magic byte
-	writer.WriteByte(byte(0x02)) // magic byte used for versioning
+	writer.WriteByte(version)    // magic byte used for versioning
+	if version >= 3 {
+		writer.WriteByte(byte(flags)) // encoding flags
+	}
+	if flags&EncodingFlag_TileFlags != 0 {
+		// Bit assignment of the custom tile flags: [count (uint8), [name]...]
+		writer.WriteByte(byte(len(tilemap.TileFlags.Names)))
+		for _, name := range tilemap.TileFlags.Names {
+			if err := writeString(writer, name); err != nil {
+				return err
+			}
+		}
+	}
 
-	if err := binary.Write(writer, order, int16(tilemap.Width)); err != nil {
+	if err := writeShort(writer, order, flags, tilemap.Width); err != nil {
 		return err
 	}
-	if err := binary.Write(writer, order, int16(tilemap.Height)); err != nil {
+	if err := writeShort(writer, order, flags, tilemap.Height); err != nil {
 		return err
 	}
-	writer.WriteByte(byte(uint8(len(tilemap.Layers))))
+	layers := tilemap.OutputLayers()
+	writer.WriteByte(byte(uint8(len(layers))))
 
 	environmentLayerIdx, err := tilemap.GetLayer("environment")
 	if err != nil {
 		return err
 	}
-	environmentLayerIdx = len(tilemap.Layers) - 1 - environmentLayerIdx // The layers will be stored in reversed order
-	writer.WriteByte(byte(environmentLayerIdx))
+	for i, idx := range layers {
+		if idx == environmentLayerIdx {
+			writer.WriteByte(byte(len(layers) - 1 - i)) // The layers will be stored in reversed order
+		}
+	}
 
-	for i := len(tilemap.Layers) - 1; i >= 0; i-- {
-		layer := tilemap.Layers[i]
-		if err := encodeLayer(writer, order, &layer); err != nil {
+	// Since format version 5, the header ends with the checksum table (preceded by the feature flags since format version 6).
+	// Everything after it is buffered until the checksums and feature flags are known.
+	var checksums *checksumRecorder
+	output := writer
+	if version >= 5 {
+		checksums = newChecksumRecorder()
+		writer = checksums.writer
+	}
+
+	for i := len(layers) - 1; i >= 0; i-- {
+		checksums.Begin(Section_Layer, len(layers)-1-i)
+		layer := tilemap.Layers[layers[i]]
+		var customFlags []uint8
+		if layers[i] == environmentLayerIdx {
+			customFlags = customTileFlags
+		}
+		if err := encodeLayer(writer, order, &layer, customFlags); err != nil {
 			return err
 		}
 	}
 	writer.WriteByte(byte(0xAA)) // magic byte
 
-	if err := encodeObjectLayer(writer, order, tilemap.BackgroundObjectLayer); err != nil {
+	checksums.Begin(Section_Objects, 0)
+	if err := encodeObjectLayer(writer, order, flags, tilemap.BackgroundObjectLayer); err != nil {
 		return fmt.Errorf("Failed to encode BackgroundObjectLayer: %v", err)
 	}
-	if err := encodeObjectLayer(writer, order, tilemap.ForegroundObjectLayer); err != nil {
+	if err := encodeObjectLayer(writer, order, flags, tilemap.ForegroundObjectLayer); err != nil {
 		return fmt.Errorf("Failed to encode ForegroundObjectLayer: %v", err)
 	}
 
 	writer.WriteByte(byte(0x99)) // magic byte
 
+	checksums.Begin(Section_Resources, 0)
 	if len(resourcePoints) < 0 || len(resourcePoints) > 0xFF {
 		return fmt.Errorf("Number of resource points can't be encoded (not within range [0,256]): %d", len(resourcePoints))
 	}
 	writer.WriteByte(byte(uint8(len(resourcePoints)))) // number of resource points
 	for _, resource := range resourcePoints {
-		if err := encodeResourcePoint(writer, order, &resource); err != nil {
+		if err := encodeResourcePoint(writer, order, flags, &resource); err != nil {
 			return err
 		}
 	}
 	writer.WriteByte(byte(0x5A)) // magic byte
 
+	checksums.Begin(Section_Waterdrops, 0)
 	if len(waterdropSources) < 0 || len(waterdropSources) > 0xFF {
 		return fmt.Errorf("Number of water drop sources can't be encoded (not within range [0,256]): %d", len(waterdropSources))
 	}
 	writer.WriteByte(byte(uint8(len(waterdropSources)))) // number of water drop sources
 	for _, source := range waterdropSources {
-		if err := encodeWaterdropSource(writer, order, &source); err != nil {
+		if err := encodeWaterdropSource(writer, order, flags, &source); err != nil {
 			return err
 		}
 	}
 	writer.WriteByte(byte(0xFF)) // magic byte
 
+	checksums.Begin(Section_Players, 0)
 	writer.WriteByte(byte(uint8(len(players)))) // number of players
 	for _, player := range players {
-		if err := encodePlayer(writer, order, &player); err != nil {
+		if err := encodePlayer(writer, order, version, flags, &player); err != nil {
 			return err
 		}
 	}
 
 	writer.WriteByte(byte(0xA5)) // magic byte
-	if err := encodeBorders(writer, order, borders); err != nil {
+	checksums.Begin(Section_Borders, 0)
+	if err := encodeBorderSet(writer, order, flags, borders); err != nil {
 		return err
 	}
 
+	warnDroppedFeatures(version, tilemap, resourcePoints, players)
+	if version < 3 {
+		writer.WriteByte(byte(0x55)) // magic byte
+		return nil
+	}
+
+	sections := []Section{
+		{Section_Hazards, func(w *bufio.Writer) error { return encodeHazards(w, order, tilemap.Hazards) }},
+		{Section_Wind, func(w *bufio.Writer) error { return encodeWindField(w, order, tilemap.WindField) }},
+		{Section_Environment, func(w *bufio.Writer) error { return encodeEnvironment(w, order, tilemap.Environment) }},
+		{Section_Checkpoints, func(w *bufio.Writer) error { return encodeCheckpoints(w, order, tilemap.Checkpoints) }},
+		{Section_CameraPaths, func(w *bufio.Writer) error { return encodeCameraPaths(w, order, tilemap.CameraPaths) }},
+		{Section_Victory, func(w *bufio.Writer) error { return encodeVictoryConditions(w, order, tilemap.Victory) }},
+		{Section_AIHints, func(w *bufio.Writer) error { return encodeAIHints(w, order, flags, tilemap.AIHints) }},
+	}
+	if version >= 4 {
+		sections = append(sections, Section{Section_ObjectScale, func(w *bufio.Writer) error {
+			return encodeObjectScales(w, order, flags, tilemap.BackgroundObjectLayer, tilemap.ForegroundObjectLayer)
+		}})
+		sections = append(sections, Section{Section_Anchors, func(w *bufio.Writer) error {
+			return encodeResourceAnchors(w, order, resourcePoints)
+		}})
+		sections = append(sections, Section{Section_Squads, func(w *bufio.Writer) error {
+			return encodeSquads(w, order, flags, tilemap.Squads)
+		}})
+		sections = append(sections, Section{Section_Inventories, func(w *bufio.Writer) error {
+			return encodeBuildingInventories(w, order, flags, players)
+		}})
+		sections = append(sections, Section{Section_Obstacles, func(w *bufio.Writer) error {
+			return encodeObstacles(w, order, tilemap.Obstacles)
+		}})
+		sections = append(sections, Section{Section_DynBorders, func(w *bufio.Writer) error {
+			return encodeDynamicBorders(w, order, flags, tilemap.DynamicBorders)
+		}})
+		sections = append(sections, Section{Section_FlyBorders, func(w *bufio.Writer) error {
+			return encodeFlyingBorders(w, order, flags, tilemap.FlyingBorders)
+		}})
+		sections = append(sections, Section{Section_Fluids, func(w *bufio.Writer) error {
+			return encodeWaterVolumes(w, order, flags, tilemap.Water)
+		}})
+		sections = append(sections, Section{Section_Navigation, func(w *bufio.Writer) error {
+			return encodeConnectivityGraph(w, order, flags, tilemap.Navigation)
+		}})
+		sections = append(sections, Section{Section_NoBuild, func(w *bufio.Writer) error {
+			return encodeNoBuildZones(w, order, flags, tilemap.NoBuild)
+		}})
+		sections = append(sections, Section{Section_Thumbnail, func(w *bufio.Writer) error {
+			return encodeThumbnail(w, tilemap.Thumbnail)
+		}})
+		sections = append(sections, Section{Section_RenderPass, func(w *bufio.Writer) error {
+			passes := make([]RenderPass, len(layers))
+			for i, idx := range layers {
+				passes[i] = tilemap.RenderPass[idx]
+			}
+			return encodeRenderPasses(w, passes)
+		}})
+		sections = append(sections, Section{Section_ImageLayers, func(w *bufio.Writer) error {
+			return encodeImageLayers(w, order, flags, tilemap.Images)
+		}})
+		sections = append(sections, Section{Section_Offsets, func(w *bufio.Writer) error {
+			offsets := make([]LayerOffset, len(layers))
+			for i, idx := range layers {
+				offsets[i] = tilemap.Offsets[idx]
+			}
+			return encodeLayerOffsets(w, order, offsets)
+		}})
+		if tilemap.DebugWarnings != nil {
+			sections = append(sections, Section{Section_Debug, func(w *bufio.Writer) error {
+				return encodeDebugWarnings(w, order, flags, tilemap.DebugWarnings)
+			}})
+		}
+		sections = append(sections, Section{Section_Metadata, func(w *bufio.Writer) error {
+			return encodeMetadata(w, version)
+		}})
+	}
+	features, err := encodeSections(writer, order, version, sections, checksums)
+	if err != nil {
+		return err
+	}
 	writer.WriteByte(byte(0x55)) // magic byte
-	return nil
+
+	if version >= 6 {
+		// The rest of the header. It's written last, because the feature flags are only known once all sections are encoded
+		if err := encodeFeatureHeader(output, order, features); err != nil {
+			return err
+		}
+	}
+	return checksums.Finish(output, order, flags)
 }
 
-func encodeLayer(writer *bufio.Writer, order binary.ByteOrder, layer *TileMapLayer) error {
+// encodeSections writes the sections after the borders.
+// Format version 3 only knows a fixed list of sections, each one prefixed with a magic byte.
+// Since format version 4, every section is stored as [id (uint8), length (uint32), content], the list ends with Section_End.
+// Each section is a separate part of the checksum table (nil for format versions < 5).
+// Returns the feature flags of all sections with content (format version 4+, see sectionFeatures).
+func encodeSections(writer *bufio.Writer, order binary.ByteOrder, version uint8, sections []Section, checksums *checksumRecorder) (FeatureFlags, error) {
+	var features FeatureFlags
+	for _, section := range sections {
+		checksums.Begin(section.ID, 0)
+		if version < 4 {
+			writer.WriteByte(byte(section.ID)) // magic byte
+			if err := section.Encode(writer); err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		var content bytes.Buffer
+		contentWriter := bufio.NewWriter(&content)
+		if err := section.Encode(contentWriter); err != nil {
+			return 0, err
+		}
+		contentWriter.Flush()
+		features |= sectionFeature(section.ID, content.Bytes(), order)
+
+		writer.WriteByte(byte(section.ID))
+		if err := binary.Write(writer, order, uint32(content.Len())); err != nil {
+			return 0, err
+		}
+		writer.Write(content.Bytes())
+	}
+
+	if version >= 4 {
+		writer.WriteByte(byte(Section_End))
+	}
+	return features, nil
+}
+
+// warnDroppedFeatures warns about map features that are not part of the given format version
+func warnDroppedFeatures(version uint8, tilemap *TileMap, resourcePoints []ResourcePoint, players []Player) {
+	anchors := 0
+	for _, resource := range resourcePoints {
+		if resource.Anchor != nil {
+			anchors++
+		}
+	}
+	bridges, turrets, inventories, appearances, playerSetups := 0, 0, 0, 0, 0
+	for _, player := range players {
+		for _, building := range player.Buildings {
+			if building.Type == BuildingType_Bridge {
+				bridges++
+			} else if building.Type == BuildingType_Turret {
+				turrets++
+			}
+			if len(building.Inventory) > 0 || len(building.Tech) > 0 {
+				inventories++
+			}
+		}
+		if player.Color != nil || player.Faction != "" {
+			appearances++
+		}
+		if player.HasCustomSettings() {
+			playerSetups++
+		}
+	}
+	hasWind := 0
+	if tilemap.WindField != nil {
+		hasWind = 1
+	}
+	flyingBorders := 0
+	if tilemap.FlyingBorders != nil {
+		flyingBorders = 1
+	}
+	offsetLayers := 0
+	for _, offset := range tilemap.Offsets {
+		if !offset.IsZero() {
+			offsetLayers++
+		}
+	}
+
+	features := []struct {
+		feature    string
+		count      int
+		minVersion uint8
+	}{
+		{"bridge span lengths", bridges, 3},
+		{"turret firing arcs", turrets, 3},
+		{"player colors and factions", appearances, 3},
+		{"hazards", len(tilemap.Hazards), 3},
+		{"wind", hasWind, 3},
+		{"checkpoints", len(tilemap.Checkpoints), 3},
+		{"camera paths", len(tilemap.CameraPaths), 3},
+		{"AI hints", len(tilemap.AIHints), 3},
+		{"resource anchors", anchors, 4},
+		{"squads", len(tilemap.Squads), 4},
+		{"building inventories", inventories, 4},
+		{"obstacles", len(tilemap.Obstacles), 4},
+		{"flying unit borders", flyingBorders, 4},
+		{"water volumes", len(tilemap.Water), 4},
+		{"navigation connectors", len(tilemap.Navigation.Connectors), 4},
+		{"custom tile flags", len(tilemap.TileFlags.Names), 4},
+		{"no-build zones", len(tilemap.NoBuild), 4},
+		{"player handicaps and AI settings", playerSetups, 4},
+		{"image layers", len(tilemap.Images), 4},
+		{"layer offsets", offsetLayers, 4},
+	}
+	for _, f := range features {
+		if f.count > 0 && version < f.minVersion {
+			log.Warningf("Format version %d doesn't support %s. %d will be missing in the output", version, f.feature, f.count)
+		}
+	}
+	if version >= 3 {
+		return
+	}
+	if tilemap.Environment != (EnvironmentSettings{AmbientColor: Color{0xFF, 0xFF, 0xFF, 0xFF}, GravityMultiplier: 1}) {
+		log.Warningf("Format version %d doesn't support environment settings. They will be missing in the output", version)
+	}
+	if tilemap.Victory.Mode != VictoryMode_Annihilation || tilemap.Victory.TimeLimit != 0 {
+		log.Warningf("Format version %d doesn't support victory conditions. They will be missing in the output", version)
+	}
+}
+
+// encodeLayer stores the flags and index of every tile. The custom flags (nil = none) are stored in the upper bits of the tile flags.
+func encodeLayer(writer *bufio.Writer, order binary.ByteOrder, layer *TileMapLayer, customFlags []uint8) error {
 	tilesetType := probeLayer(layer)
 	writer.WriteByte(byte(tilesetType))
 
@@ -97,7 +423,11 @@ func encodeLayer(writer *bufio.Writer, order binary.ByteOrder, layer *TileMapLay
 			return fmt.Errorf("Tile index can't be encoded (not within range [0,256]): %d", tileID)
 		}
 
-		writer.WriteByte(byte(tile.Flags))
+		flags := tile.Flags
+		if customFlags != nil {
+			flags |= customFlags[i] << FirstCustomTileFlagBit
+		}
+		writer.WriteByte(byte(flags))
 		writer.WriteByte(byte(uint8(tileID)))
 
 	}
@@ -115,7 +445,7 @@ func probeLayer(layer *TileMapLayer) TileSetType {
 	return DECORATION1_TILESET
 }
 
-func encodeObjectLayer(writer *bufio.Writer, order binary.ByteOrder, layer *TileMapObjectLayer) error {
+func encodeObjectLayer(writer *bufio.Writer, order binary.ByteOrder, flags EncodingFlags, layer *TileMapObjectLayer) error {
 	var objectCount int = 0
 	if layer != nil {
 		objectCount = len(layer.Objects)
@@ -124,7 +454,7 @@ func encodeObjectLayer(writer *bufio.Writer, order binary.ByteOrder, layer *Tile
 		return fmt.Errorf("Number of objects can't be encoded (16bit): %d", objectCount)
 	}
 
-	if err := binary.Write(writer, order, int16(objectCount)); err != nil {
+	if err := writeShort(writer, order, flags, objectCount); err != nil {
 		return err
 	}
 
@@ -141,6 +471,10 @@ func encodeObjectLayer(writer *bufio.Writer, order binary.ByteOrder, layer *Tile
 
 		tileID := object.Index
 
+		if scaleX, scaleY := object.Scale(); scaleX <= 0 || scaleY <= 0 {
+			return fmt.Errorf("The object (%d, layer=%q) can't be encoded. Its size must be positive (scale: %v x %v)", i, layer.Name, scaleX, scaleY)
+		}
+
 		if tileID < 0 || tileID > 0xFF {
 			return fmt.Errorf("Tile index of object can't be encoded (not within range [0,256]): %d", tileID)
 		}
@@ -148,16 +482,7 @@ func encodeObjectLayer(writer *bufio.Writer, order binary.ByteOrder, layer *Tile
 		writer.WriteByte(byte(uint8(tileID)))
 
 		// Tiled uses the bottom-left corner for the position. We store the object's center ==> convert!
-		localCenterX := object.Width / 2
-		localCenterY := object.Height / 2
-		cosRot := float32(math.Cos(float64(-object.Rotation) / 180 * math.Pi))
-		sinRot := float32(math.Sin(float64(-object.Rotation) / 180 * math.Pi))
-
-		rotatedCenterX := localCenterX*cosRot - localCenterY*sinRot
-		rotatedCenterY := localCenterX*sinRot + localCenterY*cosRot
-
-		centerX := object.X + rotatedCenterX
-		centerY := object.Y - rotatedCenterY // objects have an inverted coordinate system (up = positive)
+		centerX, centerY := object.Center()
 
 		Hor := (object.Flags & 0x01) != 0
 		Ver := (object.Flags & 0x02) != 0
@@ -170,16 +495,16 @@ func encodeObjectLayer(writer *bufio.Writer, order binary.ByteOrder, layer *Tile
 			object.Height = -object.Height
 		}
 		if Diag {
-			return fmt.Errorf("Unable to encode object (%d, layer=%q) - Unexpected flag. Tiled should not set the diagonal-flipped flag, as such flips can always be expressed with X/Y-flips and rotations", i, layer.Name)
+			return fmt.Errorf("Unable to encode object (%d, layer=%q) - Unexpected flag. Diagonal flips must be converted into X/Y-flips and rotations (see NormalizeObjectTransforms)", i, layer.Name)
 		}
 
 		if err := writeFloat(writer, order, centerX/float32(object.TileSet.TileWidth)); err != nil {
 			return fmt.Errorf("Unable to encode object (%d, layer=%q) - Failed to write x-coordinate: %v", i, layer.Name, err)
 		}
-		if err := writeFloat(writer, order, centerY/float32(object.TileSet.TileWidth)); err != nil { // invert y axis
+		if err := writeFloat(writer, order, centerY/float32(object.TileSet.TileHeight)); err != nil { // invert y axis
 			return fmt.Errorf("Unable to encode object (%d, layer=%q) - Failed to write y-coordinate: %v", i, layer.Name, err)
 		}
-		if err := writeFloat(writer, order, object.Width/float32(object.TileSet.TileHeight)); err != nil {
+		if err := writeFloat(writer, order, object.Width/float32(object.TileSet.TileWidth)); err != nil {
 			return fmt.Errorf("Unable to encode object (%d, layer=%q) - Failed to write width: %v", i, layer.Name, err)
 		}
 		if err := writeFloat(writer, order, object.Height/float32(object.TileSet.TileHeight)); err != nil {
@@ -192,44 +517,214 @@ func encodeObjectLayer(writer *bufio.Writer, order binary.ByteOrder, layer *Tile
 	return nil
 }
 
+// encodeObjectScales stores the scale factors of all objects (same order as the object layers).
+// The scale is relative to the object's tile size and always positive - flips are part of the object size.
+func encodeObjectScales(writer *bufio.Writer, order binary.ByteOrder, flags EncodingFlags, layers ...*TileMapObjectLayer) error {
+	for _, layer := range layers {
+		objectCount := 0
+		if layer != nil {
+			objectCount = len(layer.Objects)
+		}
+		if err := writeShort(writer, order, flags, objectCount); err != nil {
+			return err
+		}
+		for i := 0; i < objectCount; i++ {
+			scaleX, scaleY := layer.Objects[i].Scale()
+			if err := writeFloat(writer, order, scaleX); err != nil {
+				return err
+			}
+			if err := writeFloat(writer, order, scaleY); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// encodeResourceAnchors stores the sub-tile positions of resource points: [count (uint8), [resource index (uint8), x (float), y (float)]...]
+// The position is in tiles. Like all floats, it's stored as fixed-point number with a precision of 1/FixedPointScale tiles (see writeFloat).
+func encodeResourceAnchors(writer *bufio.Writer, order binary.ByteOrder, resourcePoints []ResourcePoint) error {
+	count := 0
+	for _, resource := range resourcePoints {
+		if resource.Anchor != nil {
+			count++
+		}
+	}
+	writer.WriteByte(byte(count)) // the number of resource points is limited to 256 as well
+
+	for i, resource := range resourcePoints {
+		if resource.Anchor == nil {
+			continue
+		}
+		writer.WriteByte(byte(i))
+		if err := writeFloat(writer, order, resource.Anchor.X); err != nil {
+			return err
+		}
+		if err := writeFloat(writer, order, resource.Anchor.Y); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeSquads stores the squad table: [count (uint8), [name, player (uint8), unit count, [unit index]...]...]
+func encodeSquads(writer *bufio.Writer, order binary.ByteOrder, flags EncodingFlags, squads []Squad) error {
+	if len(squads) > 0xFF {
+		return fmt.Errorf("Number of squads can't be encoded (not within range [0,256]): %d", len(squads))
+	}
+	writer.WriteByte(byte(len(squads)))
+
+	for _, squad := range squads {
+		if err := writeString(writer, squad.Name); err != nil {
+			return fmt.Errorf("Squad name can't be encoded: %v", err)
+		}
+		writer.WriteByte(byte(squad.Player))
+		if err := writeShort(writer, order, flags, len(squad.Units)); err != nil {
+			return err
+		}
+		for _, unit := range squad.Units {
+			if err := writeShort(writer, order, flags, unit); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// encodeBuildingInventories stores the items and technologies of buildings:
+// [count, [player (uint8), building index (uint8), item count (uint8), [item]..., tech count (uint8), [tech]...]...]
+func encodeBuildingInventories(writer *bufio.Writer, order binary.ByteOrder, flags EncodingFlags, players []Player) error {
+	count := 0
+	for _, player := range players {
+		for _, building := range player.Buildings {
+			if len(building.Inventory) > 0 || len(building.Tech) > 0 {
+				count++
+			}
+		}
+	}
+	if err := writeShort(writer, order, flags, count); err != nil {
+		return err
+	}
+
+	for p, player := range players {
+		for b, building := range player.Buildings {
+			if len(building.Inventory) == 0 && len(building.Tech) == 0 {
+				continue
+			}
+			writer.WriteByte(byte(p))
+			writer.WriteByte(byte(b))
+			for _, ids := range [][]string{building.Inventory, building.Tech} {
+				if len(ids) > 0xFF {
+					return fmt.Errorf("Building inventory can't be encoded (not within range [0,256]): %d entries", len(ids))
+				}
+				writer.WriteByte(byte(len(ids)))
+				for _, id := range ids {
+					if err := writeString(writer, id); err != nil {
+						return fmt.Errorf("Building inventory can't be encoded: %v", err)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// writeShort writes a 16bit count or coordinate. If the varint-flag is set, a (zig-zag encoded) varint is written instead.
+func writeShort(writer *bufio.Writer, order binary.ByteOrder, flags EncodingFlags, value int) error {
+	if flags&EncodingFlag_Varint != 0 {
+		buf := make([]byte, binary.MaxVarintLen64)
+		_, err := writer.Write(buf[:binary.PutVarint(buf, int64(value))])
+		return err
+	}
+	return binary.Write(writer, order, int16(value))
+}
+
+// FixedPointScale is the factor all floats are multiplied with before they are stored as int32.
+// The loader has to divide by FixedPointScale to get the original float value.
+const FixedPointScale = 1000
+
+// writeFloat stores the value as fixed-point number: int32(value * FixedPointScale)
 func writeFloat(writer *bufio.Writer, order binary.ByteOrder, value float32) error {
-	var intVal int = int(value * 1000) // All floats are multiplied by 1000. The loader has to divide by 1000 to get the original float value.
+	var intVal int = int(value * FixedPointScale)
 	return binary.Write(writer, order, int32(intVal))
 }
 
-func encodeResourcePoint(writer *bufio.Writer, order binary.ByteOrder, resource *ResourcePoint) error {
-	if err := binary.Write(writer, order, int16(resource.SpawnX)); err != nil {
+// writeString writes a string with a preceding length byte
+func writeString(writer *bufio.Writer, str string) error {
+	if len(str) > 0xFF {
+		return fmt.Errorf("String too long (not within range [0,256]): %q", str)
+	}
+	writer.WriteByte(byte(uint8(len(str))))
+	writer.WriteString(str)
+	return nil
+}
+
+func encodeResourcePoint(writer *bufio.Writer, order binary.ByteOrder, flags EncodingFlags, resource *ResourcePoint) error {
+	if err := writeShort(writer, order, flags, resource.SpawnX); err != nil {
 		return err
 	}
-	if err := binary.Write(writer, order, int16(resource.SpawnY)); err != nil {
+	if err := writeShort(writer, order, flags, resource.SpawnY); err != nil {
 		return err
 	}
 	writer.WriteByte(byte(resource.ResourcePointFlags))
 	return nil
 }
 
-func encodeWaterdropSource(writer *bufio.Writer, order binary.ByteOrder, source *WaterdropSource) error {
-	if err := binary.Write(writer, order, int16(source.SpawnX)); err != nil {
+func encodeWaterdropSource(writer *bufio.Writer, order binary.ByteOrder, flags EncodingFlags, source *WaterdropSource) error {
+	if err := writeShort(writer, order, flags, source.SpawnX); err != nil {
 		return err
 	}
-	if err := binary.Write(writer, order, int16(source.SpawnY)); err != nil {
+	if err := writeShort(writer, order, flags, source.SpawnY); err != nil {
 		return err
 	}
 	writer.WriteByte(byte(source.WaterdropFlags))
 	return nil
 }
 
-func encodePlayer(writer *bufio.Writer, order binary.ByteOrder, player *Player) error {
-	if err := encodeBuildings(writer, order, player); err != nil {
+func encodePlayer(writer *bufio.Writer, order binary.ByteOrder, version uint8, flags EncodingFlags, player *Player) error {
+	if err := encodeBuildings(writer, order, version, flags, player); err != nil {
 		return err
 	}
-	if err := encodeUnits(writer, order, player); err != nil {
+	if err := encodeUnits(writer, order, flags, player); err != nil {
 		return err
 	}
+	if version < 3 {
+		return nil
+	}
+
+	if player.Color == nil {
+		writer.WriteByte(byte(0x00)) // no forced color
+	} else {
+		writer.WriteByte(byte(0x01))
+		writer.WriteByte(byte(player.Color.R))
+		writer.WriteByte(byte(player.Color.G))
+		writer.WriteByte(byte(player.Color.B))
+		writer.WriteByte(byte(player.Color.A))
+	}
+	if err := writeString(writer, player.Faction); err != nil {
+		return fmt.Errorf("Player faction can't be encoded: %v", err)
+	}
+	if flags&EncodingFlag_PlayerSetup == 0 {
+		return nil
+	}
+
+	// Handicap and AI settings: [handicap (percentage), AI difficulty, AI personality]
+	handicap := player.Handicap
+	if handicap == 0 {
+		handicap = DefaultHandicap
+	}
+	if handicap < 0 || handicap > 0xFF {
+		return fmt.Errorf("Player handicap can't be encoded (not within range [0,256]): %d", handicap)
+	}
+	writer.WriteByte(byte(handicap))
+	writer.WriteByte(byte(player.AIDifficulty))
+	if err := writeString(writer, player.AIPersonality); err != nil {
+		return fmt.Errorf("Player AI personality can't be encoded: %v", err)
+	}
 	return nil
 }
 
-func encodeBuildings(writer *bufio.Writer, order binary.ByteOrder, player *Player) error {
+func encodeBuildings(writer *bufio.Writer, order binary.ByteOrder, version uint8, flags EncodingFlags, player *Player) error {
 	buildingCount := len(player.Buildings)
 	if buildingCount < 0 || buildingCount > 0xFF {
 		return fmt.Errorf("Player buildings can't be encoded (building count not within range [0,256]): %d", buildingCount)
@@ -244,19 +739,37 @@ func encodeBuildings(writer *bufio.Writer, order binary.ByteOrder, player *Playe
 
 		writer.WriteByte(byte(building.Type))
 
-		if err := binary.Write(writer, order, int16(building.SpawnX)); err != nil {
+		if err := writeShort(writer, order, flags, building.SpawnX); err != nil {
 			return err
 		}
-		if err := binary.Write(writer, order, int16(building.SpawnY)); err != nil {
+		if err := writeShort(writer, order, flags, building.SpawnY); err != nil {
 			return err
 		}
 
 		writer.WriteByte(byte(building.Flags))
+
+		if version < 3 {
+			continue
+		}
+		if building.Type == BuildingType_Bridge {
+			if building.SpanLength <= 0 || building.SpanLength > 0xFF {
+				return fmt.Errorf("Bridge can't be encoded (span length not within range [1,256]): %d", building.SpanLength)
+			}
+			writer.WriteByte(byte(building.SpanLength)) // only bridges store their span length
+		}
+		if building.Type == BuildingType_Turret { // only turrets store their firing arc
+			if err := writeFloat(writer, order, building.FiringArcMin); err != nil {
+				return err
+			}
+			if err := writeFloat(writer, order, building.FiringArcMax); err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
 
-func encodeUnits(writer *bufio.Writer, order binary.ByteOrder, player *Player) error {
+func encodeUnits(writer *bufio.Writer, order binary.ByteOrder, flags EncodingFlags, player *Player) error {
 	unitCount := len(player.Units)
 	if unitCount < 0 || unitCount > 0xFF {
 		return fmt.Errorf("Player units can't be encoded (unit count not within range [0,256]): %d", unitCount)
@@ -270,95 +783,545 @@ func encodeUnits(writer *bufio.Writer, order binary.ByteOrder, player *Player) e
 		}
 
 		writer.WriteByte(byte(unit.Type))
-		if err := binary.Write(writer, order, int16(unit.SpawnX)); err != nil {
+		if err := writeShort(writer, order, flags, unit.SpawnX); err != nil {
 			return err
 		}
-		if err := binary.Write(writer, order, int16(unit.SpawnY)); err != nil {
+		if err := writeShort(writer, order, flags, unit.SpawnY); err != nil {
 			return err
 		}
 	}
 	return nil
 }
-func encodeBorders(writer *bufio.Writer, order binary.ByteOrder, borders SortedBorderLines) error {
-	if err := binary.Write(writer, order, int16(len(borders.Left))); err != nil {
+
+// encodeBorderSet stores borders in the format that is selected by the encoding flags
+func encodeBorderSet(writer *bufio.Writer, order binary.ByteOrder, flags EncodingFlags, borders SortedBorderLines) error {
+	if flags&EncodingFlag_PackedBorders != 0 {
+		return encodePackedBorders(writer, borders)
+	}
+	return encodeBorders(writer, order, flags, borders)
+}
+
+func encodeBorders(writer *bufio.Writer, order binary.ByteOrder, flags EncodingFlags, borders SortedBorderLines) error {
+	if err := writeShort(writer, order, flags, len(borders.Left)); err != nil {
 		return err
 	}
-	if err := binary.Write(writer, order, int16(len(borders.Right))); err != nil {
+	if err := writeShort(writer, order, flags, len(borders.Right)); err != nil {
 		return err
 	}
-	if err := binary.Write(writer, order, int16(len(borders.Up))); err != nil {
+	if err := writeShort(writer, order, flags, len(borders.Up)); err != nil {
 		return err
 	}
-	if err := binary.Write(writer, order, int16(len(borders.Down))); err != nil {
+	if err := writeShort(writer, order, flags, len(borders.Down)); err != nil {
 		return err
 	}
 
-	if err := binary.Write(writer, order, int16(len(borders.UpLeft))); err != nil {
+	if err := writeShort(writer, order, flags, len(borders.UpLeft)); err != nil {
 		return err
 	}
-	if err := binary.Write(writer, order, int16(len(borders.UpRight))); err != nil {
+	if err := writeShort(writer, order, flags, len(borders.UpRight)); err != nil {
 		return err
 	}
-	if err := binary.Write(writer, order, int16(len(borders.DownLeft))); err != nil {
+	if err := writeShort(writer, order, flags, len(borders.DownLeft)); err != nil {
 		return err
 	}
-	if err := binary.Write(writer, order, int16(len(borders.DownRight))); err != nil {
+	if err := writeShort(writer, order, flags, len(borders.DownRight)); err != nil {
 		return err
 	}
 
 	for _, line := range borders.Left {
-		if err := encodeBorderLine(writer, order, line); err != nil {
+		if err := encodeBorderLine(writer, order, flags, line); err != nil {
 			return err
 		}
 	}
 	for _, line := range borders.Right {
-		if err := encodeBorderLine(writer, order, line); err != nil {
+		if err := encodeBorderLine(writer, order, flags, line); err != nil {
 			return err
 		}
 	}
 	for _, line := range borders.Up {
-		if err := encodeBorderLine(writer, order, line); err != nil {
+		if err := encodeBorderLine(writer, order, flags, line); err != nil {
 			return err
 		}
 	}
 	for _, line := range borders.Down {
-		if err := encodeBorderLine(writer, order, line); err != nil {
+		if err := encodeBorderLine(writer, order, flags, line); err != nil {
 			return err
 		}
 	}
 
 	for _, line := range borders.UpLeft {
-		if err := encodeBorderLine(writer, order, line); err != nil {
+		if err := encodeBorderLine(writer, order, flags, line); err != nil {
 			return err
 		}
 	}
 	for _, line := range borders.UpRight {
-		if err := encodeBorderLine(writer, order, line); err != nil {
+		if err := encodeBorderLine(writer, order, flags, line); err != nil {
 			return err
 		}
 	}
 	for _, line := range borders.DownLeft {
-		if err := encodeBorderLine(writer, order, line); err != nil {
+		if err := encodeBorderLine(writer, order, flags, line); err != nil {
 			return err
 		}
 	}
 	for _, line := range borders.DownRight {
-		if err := encodeBorderLine(writer, order, line); err != nil {
+		if err := encodeBorderLine(writer, order, flags, line); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func encodeBorderLine(writer *bufio.Writer, order binary.ByteOrder, borderLine BorderLine) error {
-	if err := binary.Write(writer, order, int16(borderLine.StartX)); err != nil {
+// encodePackedBorders writes all border lines into a single, compact stream:
+// The number of lines (uvarint), followed by each line as
+//   - uvarint: length<<3 | direction (0-7, see Orientation)
+//   - varint:  StartX delta to the previous line's StartX
+//   - varint:  StartY delta to the previous line's StartY
+//
+// Lines are sorted by direction in the same order as in the unpacked format.
+func encodePackedBorders(writer *bufio.Writer, borders SortedBorderLines) error {
+	directions := []struct {
+		orientation Orientation
+		lines       []BorderLine
+	}{
+		{LEFT, borders.Left}, {RIGHT, borders.Right}, {UP, borders.Up}, {DOWN, borders.Down},
+		{UPLEFT, borders.UpLeft}, {UPRIGHT, borders.UpRight}, {DOWNLEFT, borders.DownLeft}, {DOWNRIGHT, borders.DownRight},
+	}
+
+	count := 0
+	for _, dir := range directions {
+		count += len(dir.lines)
+	}
+
+	buf := make([]byte, binary.MaxVarintLen64)
+	writer.Write(buf[:binary.PutUvarint(buf, uint64(count))])
+
+	prevX, prevY := 0, 0
+	for _, dir := range directions {
+		for _, line := range dir.lines {
+			if line.Length <= 0 {
+				return fmt.Errorf("Border line can't be encoded (invalid length): %d", line.Length)
+			}
+			writer.Write(buf[:binary.PutUvarint(buf, uint64(line.Length)<<3|uint64(dir.orientation))])
+			writer.Write(buf[:binary.PutVarint(buf, int64(line.StartX-prevX))])
+			writer.Write(buf[:binary.PutVarint(buf, int64(line.StartY-prevY))])
+			prevX, prevY = line.StartX, line.StartY
+		}
+	}
+	return nil
+}
+
+func encodeBorderLine(writer *bufio.Writer, order binary.ByteOrder, flags EncodingFlags, borderLine BorderLine) error {
+	if err := writeShort(writer, order, flags, borderLine.StartX); err != nil {
 		return err
 	}
-	if err := binary.Write(writer, order, int16(borderLine.StartY)); err != nil {
+	if err := writeShort(writer, order, flags, borderLine.StartY); err != nil {
 		return err
 	}
-	if err := binary.Write(writer, order, int16(borderLine.Length)); err != nil {
+	if err := writeShort(writer, order, flags, borderLine.Length); err != nil {
 		return err
 	}
 	return nil
 }
+
+func encodeHazards(writer *bufio.Writer, order binary.ByteOrder, hazards []Hazard) error {
+	if len(hazards) > 0xFF {
+		return fmt.Errorf("Number of hazards can't be encoded (not within range [0,256]): %d", len(hazards))
+	}
+	writer.WriteByte(byte(uint8(len(hazards)))) // number of hazards
+
+	for i, hazard := range hazards {
+		writer.WriteByte(byte(hazard.Type))
+
+		if err := encodeRect(writer, order, hazard.Area); err != nil {
+			return fmt.Errorf("Unable to encode hazard %d: %v", i, err)
+		}
+		if err := writeFloat(writer, order, hazard.Damage); err != nil {
+			return fmt.Errorf("Unable to encode hazard %d - Failed to write damage: %v", i, err)
+		}
+		if err := writeFloat(writer, order, hazard.Interval); err != nil {
+			return fmt.Errorf("Unable to encode hazard %d - Failed to write interval: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// encodeObstacles stores all obstacles: [count (uint8), [type (uint8), area, hp]...]
+func encodeObstacles(writer *bufio.Writer, order binary.ByteOrder, obstacles []Obstacle) error {
+	if len(obstacles) > 0xFF {
+		return fmt.Errorf("Number of obstacles can't be encoded (not within range [0,256]): %d", len(obstacles))
+	}
+	writer.WriteByte(byte(uint8(len(obstacles)))) // number of obstacles
+
+	for i, obstacle := range obstacles {
+		writer.WriteByte(byte(obstacle.Type))
+
+		if err := encodeRect(writer, order, obstacle.Area); err != nil {
+			return fmt.Errorf("Unable to encode obstacle %d: %v", i, err)
+		}
+		if err := writeFloat(writer, order, obstacle.HP); err != nil {
+			return fmt.Errorf("Unable to encode obstacle %d - Failed to write hp: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// encodeNoBuildZones stores all areas where construction is forbidden: [count, [area]...]
+func encodeNoBuildZones(writer *bufio.Writer, order binary.ByteOrder, flags EncodingFlags, zones []Rect) error {
+	if err := writeShort(writer, order, flags, len(zones)); err != nil {
+		return err
+	}
+	for i, zone := range zones {
+		if err := encodeRect(writer, order, zone); err != nil {
+			return fmt.Errorf("Unable to encode no-build zone %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// encodeThumbnail stores the lobby thumbnail: [width (uint8), height (uint8), dominant color (RGBA), [pixel (RGB)]...]
+// Pixels are stored row by row, starting at the top. The size is 0x0 if there is no thumbnail.
+func encodeThumbnail(writer *bufio.Writer, thumbnail Thumbnail) error {
+	if thumbnail.Image == nil {
+		writer.WriteByte(byte(0x00))
+		writer.WriteByte(byte(0x00))
+		writer.Write([]byte{0, 0, 0, 0})
+		return nil
+	}
+	width, height := thumbnail.Image.Bounds().Dx(), thumbnail.Image.Bounds().Dy()
+	if width > 0xFF || height > 0xFF {
+		return fmt.Errorf("Thumbnail can't be encoded (size not within range [0,256]): %dx%d", width, height)
+	}
+	writer.WriteByte(byte(width))
+	writer.WriteByte(byte(height))
+	writer.Write([]byte{thumbnail.Dominant.R, thumbnail.Dominant.G, thumbnail.Dominant.B, thumbnail.Dominant.A})
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := thumbnail.Image.RGBAAt(x, y)
+			writer.Write([]byte{c.R, c.G, c.B})
+		}
+	}
+	return nil
+}
+
+// encodeDebugWarnings stores the conversion warnings: [count, [x, y, message]...]
+// The position is -1/-1 for warnings that don't refer to a tile. Long messages are truncated.
+func encodeDebugWarnings(writer *bufio.Writer, order binary.ByteOrder, flags EncodingFlags, warnings []DebugWarning) error {
+	if err := writeShort(writer, order, flags, len(warnings)); err != nil {
+		return err
+	}
+	for _, warning := range warnings {
+		if err := writeShort(writer, order, flags, warning.X); err != nil {
+			return err
+		}
+		if err := writeShort(writer, order, flags, warning.Y); err != nil {
+			return err
+		}
+		message := warning.Message
+		if len(message) > 0xFF {
+			cut := 0xFF
+			for cut > 0 && !utf8.RuneStart(message[cut]) {
+				cut-- // don't split a multi-byte character (names within the message can contain any character)
+			}
+			message = message[:cut]
+		}
+		if err := writeString(writer, message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeDynamicBorders stores the borders of each obstacle (same order as the obstacles): [count (uint8), [borders]...]
+// The count is 0 if dynamic borders are disabled.
+func encodeDynamicBorders(writer *bufio.Writer, order binary.ByteOrder, flags EncodingFlags, dynamicBorders []SortedBorderLines) error {
+	writer.WriteByte(byte(uint8(len(dynamicBorders)))) // limited by the number of obstacles
+
+	for _, borders := range dynamicBorders {
+		if err := encodeBorderSet(writer, order, flags, borders); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeWaterVolumes stores all water volumes: [count, [tile count (uint32), span count, [span]..., surface count, [line]...]...]
+// Spans and surface lines are encoded like border lines.
+func encodeWaterVolumes(writer *bufio.Writer, order binary.ByteOrder, flags EncodingFlags, volumes []WaterVolume) error {
+	if err := writeShort(writer, order, flags, len(volumes)); err != nil {
+		return err
+	}
+	for _, volume := range volumes {
+		if err := binary.Write(writer, order, uint32(volume.Tiles)); err != nil {
+			return err
+		}
+		for _, lines := range [][]BorderLine{volume.Spans, volume.Surface} {
+			if err := writeShort(writer, order, flags, len(lines)); err != nil {
+				return err
+			}
+			for _, line := range lines {
+				if err := encodeBorderLine(writer, order, flags, line); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// encodeConnectivityGraph stores the regions and connectors:
+// [region count, [span count, [span]...]..., connector count, [type (uint8), bidirectional (uint8), from region, to region, from, to]...]
+func encodeConnectivityGraph(writer *bufio.Writer, order binary.ByteOrder, flags EncodingFlags, graph ConnectivityGraph) error {
+	if err := writeShort(writer, order, flags, len(graph.Regions)); err != nil {
+		return err
+	}
+	for _, spans := range graph.Regions {
+		if err := writeShort(writer, order, flags, len(spans)); err != nil {
+			return err
+		}
+		for _, span := range spans {
+			if err := encodeBorderLine(writer, order, flags, span); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := writeShort(writer, order, flags, len(graph.Connectors)); err != nil {
+		return err
+	}
+	for _, connector := range graph.Connectors {
+		writer.WriteByte(byte(connector.Type))
+		if connector.Bidirectional {
+			writer.WriteByte(byte(0x01))
+		} else {
+			writer.WriteByte(byte(0x00))
+		}
+		if err := writeShort(writer, order, flags, connector.FromRegion); err != nil {
+			return err
+		}
+		if err := writeShort(writer, order, flags, connector.ToRegion); err != nil {
+			return err
+		}
+		for _, value := range []float32{connector.From.X, connector.From.Y, connector.To.X, connector.To.Y} {
+			if err := writeFloat(writer, order, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// encodeMetadata stores information about the converter that produced the file: [converter version, format version (uint8)].
+// The format version is repeated, so that the section can be checked without the header.
+func encodeMetadata(writer *bufio.Writer, version uint8) error {
+	if err := writeString(writer, ConverterVersion); err != nil {
+		return err
+	}
+	writer.WriteByte(version)
+	return nil
+}
+
+// encodeFlyingBorders writes a single byte whether flying units have their own borders, followed by the borders
+func encodeFlyingBorders(writer *bufio.Writer, order binary.ByteOrder, flags EncodingFlags, borders *SortedBorderLines) error {
+	if borders == nil {
+		writer.WriteByte(byte(0x00)) // same borders as ground units
+		return nil
+	}
+	writer.WriteByte(byte(0x01))
+	return encodeBorderSet(writer, order, flags, *borders)
+}
+
+// encodeWindField writes a single byte whether the map has wind, followed by one vector per tile
+func encodeWindField(writer *bufio.Writer, order binary.ByteOrder, field WindField) error {
+	if field == nil {
+		writer.WriteByte(byte(0x00)) // no wind
+		return nil
+	}
+	writer.WriteByte(byte(0x01))
+
+	for i, vec := range field {
+		if err := writeFloat(writer, order, vec.X); err != nil {
+			return fmt.Errorf("Unable to encode wind field (tile %d): %v", i, err)
+		}
+		if err := writeFloat(writer, order, vec.Y); err != nil {
+			return fmt.Errorf("Unable to encode wind field (tile %d): %v", i, err)
+		}
+	}
+	return nil
+}
+
+func encodeEnvironment(writer *bufio.Writer, order binary.ByteOrder, env EnvironmentSettings) error {
+	if err := writeFloat(writer, order, env.RainIntensity); err != nil {
+		return fmt.Errorf("Unable to encode environment settings - Failed to write rain intensity: %v", err)
+	}
+	if err := writeFloat(writer, order, env.FogDensity); err != nil {
+		return fmt.Errorf("Unable to encode environment settings - Failed to write fog density: %v", err)
+	}
+	writer.WriteByte(byte(env.AmbientColor.R))
+	writer.WriteByte(byte(env.AmbientColor.G))
+	writer.WriteByte(byte(env.AmbientColor.B))
+	writer.WriteByte(byte(env.AmbientColor.A))
+	if err := writeFloat(writer, order, env.GravityMultiplier); err != nil {
+		return fmt.Errorf("Unable to encode environment settings - Failed to write gravity multiplier: %v", err)
+	}
+	return nil
+}
+
+// encodeCheckpoints writes all checkpoints in the order they need to be passed
+func encodeCheckpoints(writer *bufio.Writer, order binary.ByteOrder, checkpoints []Checkpoint) error {
+	if len(checkpoints) > 0xFF {
+		return fmt.Errorf("Number of checkpoints can't be encoded (not within range [0,256]): %d", len(checkpoints))
+	}
+	writer.WriteByte(byte(uint8(len(checkpoints)))) // number of checkpoints
+
+	for _, checkpoint := range checkpoints {
+		if err := encodeRect(writer, order, checkpoint.Area); err != nil {
+			return fmt.Errorf("Unable to encode checkpoint %d: %v", checkpoint.Order, err)
+		}
+	}
+	return nil
+}
+
+func encodeCameraPaths(writer *bufio.Writer, order binary.ByteOrder, paths []CameraPath) error {
+	if len(paths) > 0xFF {
+		return fmt.Errorf("Number of camera paths can't be encoded (not within range [0,256]): %d", len(paths))
+	}
+	writer.WriteByte(byte(uint8(len(paths)))) // number of camera paths
+
+	for i, path := range paths {
+		if len(path.Points) > 0xFF {
+			return fmt.Errorf("Camera path %d (%q) can't be encoded (point count not within range [0,256]): %d", i, path.Name, len(path.Points))
+		}
+		writer.WriteByte(byte(uint8(len(path.Points)))) // number of points
+
+		for _, point := range path.Points {
+			if err := writeFloat(writer, order, point.Position.X); err != nil {
+				return fmt.Errorf("Unable to encode camera path %d (%q): %v", i, path.Name, err)
+			}
+			if err := writeFloat(writer, order, point.Position.Y); err != nil {
+				return fmt.Errorf("Unable to encode camera path %d (%q): %v", i, path.Name, err)
+			}
+			if err := writeFloat(writer, order, point.Dwell); err != nil {
+				return fmt.Errorf("Unable to encode camera path %d (%q): %v", i, path.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func encodeVictoryConditions(writer *bufio.Writer, order binary.ByteOrder, victory VictoryConditions) error {
+	writer.WriteByte(byte(victory.Mode))
+	if err := writeFloat(writer, order, victory.TimeLimit); err != nil {
+		return fmt.Errorf("Unable to encode victory conditions - Failed to write time limit: %v", err)
+	}
+
+	switch victory.Mode {
+	case VictoryMode_KingOfTheHill:
+		if err := writeFloat(writer, order, victory.HoldTime); err != nil {
+			return fmt.Errorf("Unable to encode victory conditions - Failed to write hold time: %v", err)
+		}
+		if len(victory.Hills) > 0xFF {
+			return fmt.Errorf("Number of hills can't be encoded (not within range [0,256]): %d", len(victory.Hills))
+		}
+		writer.WriteByte(byte(uint8(len(victory.Hills)))) // number of hills
+		for i, hill := range victory.Hills {
+			if err := encodeRect(writer, order, hill); err != nil {
+				return fmt.Errorf("Unable to encode hill %d: %v", i, err)
+			}
+		}
+	case VictoryMode_Economic:
+		if err := binary.Write(writer, order, int32(victory.ResourceGoal)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func encodeAIHints(writer *bufio.Writer, order binary.ByteOrder, flags EncodingFlags, hints []AIHint) error {
+	if len(hints) > 0xFFFF {
+		return fmt.Errorf("Number of AI hints can't be encoded (16bit): %d", len(hints))
+	}
+	if err := writeShort(writer, order, flags, len(hints)); err != nil {
+		return err
+	}
+
+	for i, hint := range hints {
+		writer.WriteByte(byte(hint.Type))
+		writer.WriteByte(byte(hint.Priority))
+		if err := writeFloat(writer, order, hint.Position.X); err != nil {
+			return fmt.Errorf("Unable to encode AI hint %d: %v", i, err)
+		}
+		if err := writeFloat(writer, order, hint.Position.Y); err != nil {
+			return fmt.Errorf("Unable to encode AI hint %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+func encodeRect(writer *bufio.Writer, order binary.ByteOrder, rect Rect) error {
+	if err := writeFloat(writer, order, rect.X); err != nil {
+		return err
+	}
+	if err := writeFloat(writer, order, rect.Y); err != nil {
+		return err
+	}
+	if err := writeFloat(writer, order, rect.Width); err != nil {
+		return err
+	}
+	return writeFloat(writer, order, rect.Height)
+}
+
+// encodeRenderPasses stores whether each layer is rendered behind or in front of units: [count (uint8), [RenderPass (uint8)]...]
+// The passes are given in Tiled order and stored in file order, like the layers.
+func encodeRenderPasses(writer *bufio.Writer, passes []RenderPass) error {
+	writer.WriteByte(byte(len(passes)))
+	for i := len(passes) - 1; i >= 0; i-- {
+		writer.WriteByte(byte(passes[i]))
+	}
+	return nil
+}
+
+// encodeLayerOffsets stores the offset of each layer in tiles: [count (uint8), [x (float), y (float)]...]
+// The offsets are given in Tiled order and stored in file order, like the layers. y points up with EncodingFlag_BottomLeft.
+func encodeLayerOffsets(writer *bufio.Writer, order binary.ByteOrder, offsets []LayerOffset) error {
+	writer.WriteByte(byte(len(offsets)))
+	for i := len(offsets) - 1; i >= 0; i-- {
+		if err := writeFloat(writer, order, offsets[i].X); err != nil {
+			return err
+		}
+		if err := writeFloat(writer, order, offsets[i].Y); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeImageLayers stores the image layers in drawing order (bottom first):
+// [count (uint8), [image path (string), x (float), y (float), width (short), height (short), flags (uint8)]...]
+// The position of the top-left corner (bottom-left with EncodingFlag_BottomLeft) is in tiles, the size in pixels (see ImageLayer).
+// The flags are ImageLayerFlag_*.
+func encodeImageLayers(writer *bufio.Writer, order binary.ByteOrder, flags EncodingFlags, layers []ImageLayer) error {
+	if len(layers) > 0xFF {
+		return fmt.Errorf("Number of image layers can't be encoded (not within range [0,256]): %d", len(layers))
+	}
+	writer.WriteByte(byte(len(layers)))
+	for _, layer := range layers {
+		if err := writeString(writer, layer.Image); err != nil {
+			return fmt.Errorf("Unable to encode image layer %q: %v", layer.Name, err)
+		}
+		if err := writeFloat(writer, order, layer.X); err != nil {
+			return err
+		}
+		if err := writeFloat(writer, order, layer.Y); err != nil {
+			return err
+		}
+		if err := writeShort(writer, order, flags, layer.Width); err != nil {
+			return err
+		}
+		if err := writeShort(writer, order, flags, layer.Height); err != nil {
+			return err
+		}
+		writer.WriteByte(layer.Flags())
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// EnvironmentSettings describes the atmosphere of a map. They are read from the map properties.
+type EnvironmentSettings struct {
+	RainIntensity     float32 // [0, 1]
+	FogDensity        float32 // [0, 1]
+	AmbientColor      Color
+	GravityMultiplier float32
+}
+
+// Color is a color with alpha channel
+type Color struct {
+	R uint8
+	G uint8
+	B uint8
+	A uint8
+}
+
+// ParseColor parses colors in the format used by Tiled: '#RRGGBB' or '#AARRGGBB'
+func ParseColor(str string) (Color, error) {
+	hex := strings.TrimPrefix(strings.TrimSpace(str), "#")
+	if len(hex) != 6 && len(hex) != 8 {
+		return Color{}, fmt.Errorf("Invalid color %q. Expected '#RRGGBB' or '#AARRGGBB'", str)
+	}
+	value, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return Color{}, fmt.Errorf("Invalid color %q. Expected '#RRGGBB' or '#AARRGGBB'", str)
+	}
+	if len(hex) == 6 {
+		value |= 0xFF000000
+	}
+	return Color{
+		A: uint8(value >> 24),
+		R: uint8(value >> 16),
+		G: uint8(value >> 8),
+		B: uint8(value),
+	}, nil
+}
+
+// ExtractEnvironmentSettings reads the weather and environment settings from the map properties.
+// Missing properties are set to the game's defaults (no rain, no fog, white ambient light, normal gravity).
+func ExtractEnvironmentSettings(tilemap *TileMap) (env EnvironmentSettings, err error) {
+	props := tilemap.Properties
+
+	if env.RainIntensity, err = props.GetFloat("rain", 0); err != nil {
+		return env, fmt.Errorf("Invalid environment settings: %v", err)
+	}
+	if env.RainIntensity < 0 || env.RainIntensity > 1 {
+		return env, fmt.Errorf("Invalid environment settings: The rain intensity must be within [0, 1], but is %v", env.RainIntensity)
+	}
+
+	if env.FogDensity, err = props.GetFloat("fog", 0); err != nil {
+		return env, fmt.Errorf("Invalid environment settings: %v", err)
+	}
+	if env.FogDensity < 0 || env.FogDensity > 1 {
+		return env, fmt.Errorf("Invalid environment settings: The fog density must be within [0, 1], but is %v", env.FogDensity)
+	}
+
+	env.AmbientColor = Color{0xFF, 0xFF, 0xFF, 0xFF}
+	if color, ok := props.Get("ambientColor"); ok {
+		if env.AmbientColor, err = ParseColor(color); err != nil {
+			return env, fmt.Errorf("Invalid environment settings: %v", err)
+		}
+	}
+
+	if env.GravityMultiplier, err = props.GetFloat("gravity", 1); err != nil {
+		return env, fmt.Errorf("Invalid environment settings: %v", err)
+	}
+	if env.GravityMultiplier <= 0 {
+		return env, fmt.Errorf("Invalid environment settings: The gravity multiplier must be positive, but is %v", env.GravityMultiplier)
+	}
+	return env, nil
+}
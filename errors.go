@@ -0,0 +1,81 @@
+package main
+
+import "fmt"
+
+// UsageError is returned if the command line arguments are invalid
+type UsageError struct {
+	Err error
+}
+
+func (err *UsageError) Error() string {
+	return err.Err.Error()
+}
+
+func usageErrorf(format string, args ...interface{}) error {
+	return &UsageError{fmt.Errorf(format, args...)}
+}
+
+// ConversionStage is the part of the conversion in which an error occurred
+type ConversionStage int
+
+const (
+	Stage_Load         ConversionStage = iota // reading and parsing the map
+	Stage_Validation                          // the map content is invalid
+	Stage_Encoding                            // the map is valid, but can't be encoded
+	Stage_Output                              // writing the output file
+	Stage_Verification                        // the output differs from the existing file (verify)
+)
+
+// ConversionError is returned if a single map failed to convert
+type ConversionError struct {
+	Stage ConversionStage
+	Err   error
+}
+
+func (err *ConversionError) Error() string {
+	return err.Err.Error()
+}
+
+// BatchError is returned if one or more maps of a batch failed to convert
+type BatchError struct {
+	Failed   int
+	Total    int
+	ExitCode int // the highest exit code of all failed maps
+}
+
+func (err *BatchError) Error() string {
+	return fmt.Sprintf("%d of %d maps failed to convert", err.Failed, err.Total)
+}
+
+// ExitCodeOf returns the exit code (see ExitCode_*) for an error returned by Run
+func ExitCodeOf(err error) int {
+	switch err := err.(type) {
+	case *UsageError:
+		return ExitCode_Usage
+	case *OutputNotWritableError:
+		return ExitCode_OutputNotWritable
+	case *BatchError:
+		return err.ExitCode
+	case *ConversionError:
+		switch err.Stage {
+		case Stage_Load:
+			return ExitCode_LoadFailed
+		case Stage_Validation:
+			return ExitCode_ValidationFailed
+		case Stage_Encoding:
+			return ExitCode_EncodingFailed
+		case Stage_Verification:
+			return ExitCode_VerifyFailed
+		}
+		return ExitCodeOf(err.Err)
+	}
+	return ExitCode_Error
+}
+
+// RunSummary counts the converted maps of a run. It's printed at the end, together with the number of warnings.
+type RunSummary struct {
+	Converted int
+	Total     int
+}
+
+var runSummary RunSummary
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/op/go-logging"
+)
+
+// Event is a single line of the event stream (see -events). GUI wrappers and editor integrations use it to show
+// the progress of a conversion without parsing the log.
+type Event struct {
+	Time    string `json:"time"`
+	Event   string `json:"event"`             // see Event_*
+	Map     string `json:"map,omitempty"`     // the map that is being converted
+	Phase   string `json:"phase,omitempty"`   // phase-start, phase-end (see Phase_*)
+	Message string `json:"message,omitempty"` // warning, error, map-end (if the conversion failed)
+	File    string `json:"file,omitempty"`    // artifact
+	Size    int    `json:"size,omitempty"`    // artifact: number of bytes written
+	Success *bool  `json:"success,omitempty"` // map-end
+}
+
+// Event types
+const (
+	Event_MapStart   = "map-start"
+	Event_MapEnd     = "map-end"
+	Event_PhaseStart = "phase-start"
+	Event_PhaseEnd   = "phase-end"
+	Event_Warning    = "warning"
+	Event_Error      = "error"
+	Event_Artifact   = "artifact" // an output, sidecar, report or backup file was written
+)
+
+// EventStream writes events as newline-delimited JSON
+type EventStream struct {
+	mutex  sync.Mutex
+	writer io.Writer
+}
+
+// runEvents is nil if no events are written
+var runEvents *EventStream
+
+// NewEventStream creates an event stream in the given format. Only "ndjson" is supported.
+func NewEventStream(format string, writer io.Writer) (*EventStream, error) {
+	if format != "ndjson" {
+		return nil, fmt.Errorf("Unknown event format %q. Allowed values: ndjson", format)
+	}
+	return &EventStream{writer: writer}, nil
+}
+
+// Emit writes an event. The time and the current map (see SetLogMapFile) are added.
+func (stream *EventStream) Emit(event Event) {
+	if stream == nil {
+		return
+	}
+	event.Time = time.Now().Format(time.RFC3339Nano)
+	if event.Map == "" {
+		event.Map = logMapFile
+	}
+	line, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+	stream.writer.Write(append(line, '\n'))
+}
+
+// MapEnd emits the end of a conversion, including the error if it failed
+func (stream *EventStream) MapEnd(mapFile string, err error) {
+	success := err == nil
+	event := Event{Event: Event_MapEnd, Map: mapFile, Success: &success}
+	if err != nil {
+		event.Message = err.Error()
+	}
+	stream.Emit(event)
+}
+
+// Log emits warnings and errors
+func (stream *EventStream) Log(level logging.Level, message string) {
+	if level <= logging.ERROR {
+		stream.Emit(Event{Event: Event_Error, Message: message})
+	} else if level == logging.WARNING {
+		stream.Emit(Event{Event: Event_Warning, Message: message})
+	}
+}
@@ -9,6 +9,8 @@ type ResourcePoint struct {
 	SpawnX             int
 	SpawnY             int
 	ResourcePointFlags uint8 // needed for rotation
+
+	Anchor *Point // optional sub-tile position in tiles (see ExtractResourceAnchors)
 }
 
 // WaterdropSource contains all information about the spawn of a water drop source that continuously spawns drops falling of the roof.
@@ -20,8 +22,16 @@ type WaterdropSource struct {
 
 // Player contains all spawn inform about a single player in the game.
 type Player struct {
+	Slot      int // the player index used in the spawn tileset
 	Buildings []Building
 	Units     []Unit
+
+	Color   *Color // nil if the game should choose
+	Faction string // empty if the game should choose
+
+	Handicap      int          // percentage of the normal strength, 0 if unknown (=DefaultHandicap)
+	AIDifficulty  AIDifficulty // difficulty of the AI if it controls the player
+	AIPersonality string       // empty if the game should choose
 }
 
 // Unit contains all spawn information about a unit that should spawn at game start.
@@ -49,10 +59,17 @@ type UnitMapping struct {
 }
 
 type Building struct {
-	Type   BuildingType
-	SpawnX int
-	SpawnY int
-	Flags  uint8 // needed for rotation
+	Type       BuildingType
+	SpawnX     int
+	SpawnY     int
+	Flags      uint8 // needed for rotation
+	SpanLength int   // only used by bridges
+
+	FiringArcMin float32 // only used by turrets. In degrees, relative to the facing direction
+	FiringArcMax float32 // only used by turrets. In degrees, relative to the facing direction
+
+	Inventory []string // purchasable items (ids of the game data registry)
+	Tech      []string // researchable technologies (ids of the game data registry)
 }
 
 type BuildingType int
@@ -85,6 +102,10 @@ func NewPlayer() *Player {
 }
 
 func GetTileMapping() (uint32, uint32, map[uint32]PlayerMapping, map[uint32]BuildingMapping, map[uint32]UnitMapping) {
+	if spawnMapping != nil {
+		return spawnMapping.TileMapping()
+	}
+
 	playermapping := make(map[uint32]PlayerMapping)
 	buildingmapping := make(map[uint32]BuildingMapping)
 	unitmapping := make(map[uint32]UnitMapping)
@@ -112,6 +133,7 @@ func GetTileMapping() (uint32, uint32, map[uint32]PlayerMapping, map[uint32]Buil
 	buildingmapping[162] = BuildingMapping{BuildingType_Base}
 	buildingmapping[234] = BuildingMapping{BuildingType_Pump}
 	buildingmapping[238] = BuildingMapping{BuildingType_Turret}
+	// Bridges don't have a spawn tile yet. Once they have, their placement is validated by ValidateBridges.
 
 	return resourceMapping, waterdropSpawnMapping, playermapping, buildingmapping, unitmapping
 }
@@ -122,18 +144,14 @@ func ExtractSpawnInfo(tilemap *TileMap) ([]ResourcePoint, []WaterdropSource, []P
 		return nil, nil, nil, err
 	}
 
-	resources, waterdropSources, player, err := ExtractSpawnInfoFromLayer(tilemap.Width, tilemap.Height, &tilemap.Layers[spawnLayerIdx])
-	if err != nil {
-		return nil, nil, nil, err
-	}
-	tilemap.Layers = append(tilemap.Layers[:spawnLayerIdx], tilemap.Layers[spawnLayerIdx+1:]...) // remove spawn layer from tilemap
-	return resources, waterdropSources, player, nil
+	return ExtractSpawnInfoFromLayer(tilemap.Width, tilemap.Height, &tilemap.Layers[spawnLayerIdx])
 }
 
 func ExtractSpawnInfoFromLayer(width, height int, layer *TileMapLayer) ([]ResourcePoint, []WaterdropSource, []Player, error) {
 	var players = make([]Player, 8)
 	for i := 0; i < 8; i++ {
 		players[i] = *NewPlayer()
+		players[i].Slot = i
 	}
 
 	var resources = make([]ResourcePoint, 0, 16)
@@ -220,14 +238,15 @@ func ExtractSpawnInfoFromLayer(width, height int, layer *TileMapLayer) ([]Resour
 					newBuilding.SpawnY = y
 					newBuilding.Flags = flags
 
-					vecX, vecY := tile.GetRightVector()
-					identX, identY := x+vecX, y+vecY
-					buildingTile := layer.Tiles[identY*width+identX]
+					buildingTile, identX, identY, err := findBuildingTile(layer, width, height, x, y, flags, buildingMapping)
+					if err != nil {
+						return nil, nil, nil, err
+					}
 
 					if buildingTile.TileSet == nil {
 						return nil, nil, nil, fmt.Errorf("Invalid map: Unknown tileset. The tile (x=%d, y=%d, layer=%q) should be part of the Spawn TileSet, but is empty.", identX, identY, layer.Name)
-					} else if tile.TileSet.Type != SPAWN_TILESET {
-						return nil, nil, nil, fmt.Errorf("Invalid tileset: The tile (x=%d, y=%d, layer=%q) should be part of the Spawn TileSet, but it is part of the tileset %q.", identX, identY, layer.Name, tile.TileSet.Name)
+					} else if buildingTile.TileSet.Type != SPAWN_TILESET {
+						return nil, nil, nil, fmt.Errorf("Invalid tileset: The tile (x=%d, y=%d, layer=%q) should be part of the Spawn TileSet, but it is part of the tileset %q.", identX, identY, layer.Name, buildingTile.TileSet.Name)
 					}
 
 					tileID := buildingTile.Index
@@ -242,6 +261,9 @@ func ExtractSpawnInfoFromLayer(width, height int, layer *TileMapLayer) ([]Resour
 					}
 
 					newBuilding.Type = buildingMapping.Type
+					if err := checkFootprint(layer, width, height, &newBuilding, identX, identY); err != nil {
+						return nil, nil, nil, err
+					}
 					players[mapping.Player].Buildings = append(players[mapping.Player].Buildings, newBuilding)
 					continue
 				}
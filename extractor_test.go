@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// Tiles of the default spawn mapping (see GetTileMapping)
+const (
+	testPlayerToken  uint32 = 10 // player 0
+	testOtherToken   uint32 = 20 // player 1
+	testBaseBuilding uint32 = 162
+	testResource     uint32 = 173
+)
+
+// Tile flags that rotate a (not mirrored) tile clockwise
+var testRotations = []struct {
+	name  string
+	flags uint8
+}{
+	{"0°", 0},
+	{"90°", 5},
+	{"180°", 3},
+	{"270°", 6},
+}
+
+func TestExtractSpawnInfoBuildingsAtMapEdges(t *testing.T) {
+	const width, height = 7, 7
+	edges := []struct {
+		name string
+		x, y int
+	}{
+		{"top", 3, 0},
+		{"bottom", 3, height - 1},
+		{"left", 0, 3},
+		{"right", width - 1, 3},
+	}
+
+	for _, edge := range edges {
+		for _, rotation := range testRotations {
+			t.Run(edge.name+" "+rotation.name, func(t *testing.T) {
+				spawn := &TileSet{Name: "spawn", Type: SPAWN_TILESET}
+				layer := &TileMapLayer{Name: "spawn", Tiles: make([]Tile, width*height)}
+				layer.Tiles[3*width+3] = Tile{Index: testResource, TileSet: spawn}
+				layer.Tiles[1*width+1] = Tile{Index: testOtherToken, TileSet: spawn} // maps need at least two players
+				layer.Tiles[1*width+2] = Tile{Index: testBaseBuilding, TileSet: spawn}
+				layer.Tiles[edge.y*width+edge.x] = Tile{Index: testPlayerToken, Flags: rotation.flags, TileSet: spawn}
+
+				// The building type tile is right of the token (relative to its rotation)
+				rightX, rightY := (&Tile{Flags: rotation.flags}).GetRightVector()
+				typeX, typeY := edge.x+rightX, edge.y+rightY
+				outside := typeX < 0 || typeY < 0 || typeX >= width || typeY >= height
+				if !outside {
+					layer.Tiles[typeY*width+typeX] = Tile{Index: testBaseBuilding, Flags: rotation.flags, TileSet: spawn}
+				}
+
+				_, _, players, err := ExtractSpawnInfoFromLayer(width, height, layer)
+				if outside {
+					if err == nil || !strings.Contains(err.Error(), "rotated towards the map edge") {
+						t.Fatalf("Expected an error about the map edge, got %v", err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if len(players) != 2 || len(players[0].Buildings) != 1 {
+					t.Fatalf("Expected two players with one building each, got %+v", players)
+				}
+				building := players[0].Buildings[0]
+				if building.Type != BuildingType_Base || building.SpawnX != edge.x || building.SpawnY != edge.y || building.Flags != rotation.flags {
+					t.Errorf("Unexpected building %+v", building)
+				}
+			})
+		}
+	}
+}
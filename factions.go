@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ExtractPlayerAppearance reads the forced player colors and factions from the map properties.
+// The properties are named 'player<N>_color' and 'player<N>_faction', where N is the player slot
+// of the spawn tileset (0-7). Colors must be unique.
+func ExtractPlayerAppearance(tilemap *TileMap, players []Player) error {
+	existingSlots := make(map[int]bool)
+	for _, p := range players {
+		existingSlots[p.Slot] = true
+	}
+
+	// Detect properties for players that don't exist
+	for _, prop := range tilemap.Properties {
+		var slot int
+		var suffix string
+		if n, _ := fmt.Sscanf(prop.Name, "player%d_%s", &slot, &suffix); n != 2 {
+			continue
+		}
+		if suffix != "color" && suffix != "faction" && suffix != "handicap" && suffix != "ai_difficulty" && suffix != "ai_personality" {
+			continue
+		}
+		if !existingSlots[slot] {
+			return fmt.Errorf("Invalid map property %q: Player %d doesn't exist", prop.Name, slot)
+		}
+	}
+
+	usedColors := make(map[Color]int)
+	for i := range players {
+		player := &players[i]
+
+		if value, ok := tilemap.Properties.Get(fmt.Sprintf("player%d_color", player.Slot)); ok {
+			color, err := ParseColor(value)
+			if err != nil {
+				return fmt.Errorf("Invalid color for player %d: %v", player.Slot, err)
+			}
+			if other, ok := usedColors[color]; ok {
+				return fmt.Errorf("Invalid color for player %d: The color %q is already used by player %d", player.Slot, value, other)
+			}
+			usedColors[color] = player.Slot
+			player.Color = &color
+		}
+
+		if value, ok := tilemap.Properties.Get(fmt.Sprintf("player%d_faction", player.Slot)); ok {
+			faction := strings.ToLower(strings.TrimSpace(value))
+			if faction == "" {
+				return fmt.Errorf("Invalid faction for player %d: The faction must not be empty", player.Slot)
+			}
+			player.Faction = faction
+		}
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"sort"
+	"strings"
+)
+
+// FeatureFlags tell the loader which optional subsystems a map uses, so that it doesn't need to parse the sections to find out (format version 6+)
+type FeatureFlags uint32
+
+const (
+	Feature_Hazards FeatureFlags = 1 << iota
+	Feature_Wind
+	Feature_Environment // weather, lighting or gravity differ from the defaults
+	Feature_Checkpoints
+	Feature_CameraPaths
+	Feature_Victory // victory conditions other than annihilation without time limit
+	Feature_AIHints
+	Feature_Anchors // sub-tile positions of resource points
+	Feature_Squads
+	Feature_Inventories // building inventories
+	Feature_Obstacles
+	Feature_DynamicBorders
+	Feature_FlyingBorders
+	Feature_Water      // water volumes
+	Feature_Navigation // navigation graph
+	Feature_NoBuild    // no-build zones
+	Feature_Thumbnail
+	Feature_Debug // embedded warnings
+	Feature_ImageLayers
+	Feature_LayerOffsets // decoration layers that are offset
+)
+
+// HeaderReservedBytes follow the feature flags in the header (format version 6+).
+// They are 0 and reserved for future header fields, so that old loaders can still read the header of newer files.
+const HeaderReservedBytes = 4
+
+// sectionFeatures assigns a feature flag to optional sections. The flag is set if the section has content (see sectionHasContent).
+var sectionFeatures = map[SectionID]FeatureFlags{
+	Section_Hazards:     Feature_Hazards,
+	Section_Wind:        Feature_Wind,
+	Section_Environment: Feature_Environment,
+	Section_Checkpoints: Feature_Checkpoints,
+	Section_CameraPaths: Feature_CameraPaths,
+	Section_Victory:     Feature_Victory,
+	Section_AIHints:     Feature_AIHints,
+	Section_Anchors:     Feature_Anchors,
+	Section_Squads:      Feature_Squads,
+	Section_Inventories: Feature_Inventories,
+	Section_Obstacles:   Feature_Obstacles,
+	Section_DynBorders:  Feature_DynamicBorders,
+	Section_FlyBorders:  Feature_FlyingBorders,
+	Section_Fluids:      Feature_Water,
+	Section_Navigation:  Feature_Navigation,
+	Section_NoBuild:     Feature_NoBuild,
+	Section_Thumbnail:   Feature_Thumbnail,
+	Section_Debug:       Feature_Debug,
+	Section_ImageLayers: Feature_ImageLayers,
+	Section_Offsets:     Feature_LayerOffsets,
+}
+
+// featureNames are used by inspect and gen-loader
+var featureNames = map[FeatureFlags]string{
+	Feature_Hazards:        "hazards",
+	Feature_Wind:           "wind",
+	Feature_Environment:    "environment",
+	Feature_Checkpoints:    "checkpoints",
+	Feature_CameraPaths:    "camera paths",
+	Feature_Victory:        "victory",
+	Feature_AIHints:        "ai hints",
+	Feature_Anchors:        "anchors",
+	Feature_Squads:         "squads",
+	Feature_Inventories:    "inventories",
+	Feature_Obstacles:      "obstacles",
+	Feature_DynamicBorders: "dynamic borders",
+	Feature_FlyingBorders:  "flying borders",
+	Feature_Water:          "water",
+	Feature_Navigation:     "navigation",
+	Feature_NoBuild:        "no-build zones",
+	Feature_Thumbnail:      "thumbnail",
+	Feature_Debug:          "debug",
+	Feature_ImageLayers:    "image layers",
+	Feature_LayerOffsets:   "layer offsets",
+}
+
+// String returns the names of all set flags
+func (features FeatureFlags) String() string {
+	var names []string
+	for flag, name := range featureNames {
+		if features&flag != 0 {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// sectionFeature returns the feature flag of an encoded section, or 0 if the section has no feature or is empty
+func sectionFeature(id SectionID, content []byte, order binary.ByteOrder) FeatureFlags {
+	feature, ok := sectionFeatures[id]
+	if !ok || !sectionHasContent(id, content, order) {
+		return 0
+	}
+	return feature
+}
+
+// sectionHasContent returns false if the section only contains the defaults. Empty sections (no elements, nil)
+// are encoded as zeros, except for the environment and victory conditions, which have non-zero defaults, and the layer offsets,
+// which start with the layer count.
+func sectionHasContent(id SectionID, content []byte, order binary.ByteOrder) bool {
+	var defaults bytes.Buffer
+	writer := bufio.NewWriter(&defaults)
+	switch id {
+	case Section_Environment:
+		encodeEnvironment(writer, order, EnvironmentSettings{AmbientColor: Color{0xFF, 0xFF, 0xFF, 0xFF}, GravityMultiplier: 1})
+	case Section_Victory:
+		encodeVictoryConditions(writer, order, VictoryConditions{Mode: VictoryMode_Annihilation})
+	case Section_Offsets:
+		// The layer count is always set, even if no layer is offset
+		return len(content) > 1 && hasNonZeroByte(content[1:])
+	default:
+		return hasNonZeroByte(content)
+	}
+	writer.Flush()
+	return !bytes.Equal(content, defaults.Bytes())
+}
+
+func hasNonZeroByte(content []byte) bool {
+	for _, b := range content {
+		if b != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeFeatureHeader writes the end of the header (format version 6+): [features (uint32), reserved (HeaderReservedBytes)]
+func encodeFeatureHeader(writer *bufio.Writer, order binary.ByteOrder, features FeatureFlags) error {
+	if err := binary.Write(writer, order, uint32(features)); err != nil {
+		return err
+	}
+	_, err := writer.Write(make([]byte, HeaderReservedBytes))
+	return err
+}
@@ -0,0 +1,43 @@
+package main
+
+import "fmt"
+
+// ComputeFlyingBorders computes the borders for flying units, which ignore ground-only obstacles like low walls.
+// Ground-only tiles are environment tiles with the boolean tile property 'ground_only' in the tileset.
+// Returns nil if the map doesn't contain ground-only tiles, because flying units then use the regular borders.
+func ComputeFlyingBorders(tilemap *TileMap) (*SortedBorderLines, error) {
+	environmentLayerIdx, err := tilemap.GetLayer("environment")
+	if err != nil {
+		return nil, err
+	}
+	layer := &tilemap.Layers[environmentLayerIdx]
+
+	flyingLayer := TileMapLayer{
+		Name:  layer.Name,
+		Tiles: make([]Tile, len(layer.Tiles)),
+	}
+	groundOnlyCount := 0
+	for i, tile := range layer.Tiles {
+		if tile.TileSet != nil {
+			groundOnly, err := tile.TileSet.GetTileProperties(tile.Index).GetBool("ground_only", false)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid tile %d of tileset '%s': %v", tile.Index-1, tile.TileSet.Name, err)
+			}
+			if groundOnly {
+				groundOnlyCount++
+				continue // accessible for flying units
+			}
+		}
+		flyingLayer.Tiles[i] = tile
+	}
+	if groundOnlyCount == 0 {
+		return nil, nil
+	}
+
+	log.Infof("Number of ground-only tiles: %d", groundOnlyCount)
+	borders, err := ComputeBorderOfLayer(tilemap.Width, tilemap.Height, &flyingLayer)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to compute borders for flying units: %v", err)
+	}
+	return &borders, nil
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// BuildingFootprint defines which spawn tiles make up a building (mapping files only). Offsets are relative to the
+// player token of the unrotated building (x to the right, y down) and rotate with the token.
+// By default, a building consists of its player token and the building type tile right of it.
+type BuildingFootprint struct {
+	TypeOffset [2]int          `json:"typeOffset"` // position of the building type tile. [0, 0] = default ([1, 0])
+	Tiles      []FootprintTile `json:"tiles"`      // additional tiles that must be placed, eg. for a 3x2 factory
+	Rotations  []int           `json:"rotations"`  // allowed rotations in degrees (clockwise). Empty = all
+}
+
+// FootprintTile is an additional tile of a building footprint. It must have the same rotation as the player token.
+type FootprintTile struct {
+	Offset [2]int `json:"offset"`
+	Tile   uint32 `json:"tile"` // tile index within the spawn tileset
+}
+
+var defaultTypeOffset = [2]int{1, 0}
+
+// GetBuildingFootprint returns the footprint of the building type (see SpawnMapping.Footprints)
+func GetBuildingFootprint(buildingType BuildingType) BuildingFootprint {
+	if spawnMapping != nil {
+		if footprint, ok := spawnMapping.Footprints[buildingTypeNames[buildingType]]; ok {
+			if footprint.TypeOffset == [2]int{} {
+				footprint.TypeOffset = defaultTypeOffset
+			}
+			return footprint
+		}
+	}
+	return BuildingFootprint{TypeOffset: defaultTypeOffset}
+}
+
+// buildingTypeOffsets returns all positions where building type tiles can be, the default position first
+func buildingTypeOffsets() [][2]int {
+	offsets := [][2]int{defaultTypeOffset}
+	if spawnMapping == nil {
+		return offsets
+	}
+	for _, name := range sortedFootprintNames(spawnMapping.Footprints) {
+		buildingType, _ := buildingTypeByName(name)
+		offset := GetBuildingFootprint(buildingType).TypeOffset
+		known := false
+		for _, o := range offsets {
+			known = known || o == offset
+		}
+		if !known {
+			offsets = append(offsets, offset)
+		}
+	}
+	return offsets
+}
+
+// RotateFootprintOffset returns the position of a footprint offset relative to a token with the given flags
+func RotateFootprintOffset(flags uint8, offset [2]int) (int, int) {
+	token := Tile{Flags: flags}
+	rightX, rightY := token.GetRightVector()
+	upX, upY := token.GetUpVector()
+	return offset[0]*rightX - offset[1]*upX, offset[0]*rightY - offset[1]*upY
+}
+
+// TileRotation returns the clockwise rotation of a (not mirrored) tile in degrees
+func TileRotation(flags uint8) int {
+	token := Tile{Flags: flags}
+	switch x, y := token.GetUpVector(); {
+	case x > 0:
+		return 90
+	case y > 0:
+		return 180
+	case x < 0:
+		return 270
+	}
+	return 0
+}
+
+// FootprintPositions returns the positions of all tiles of the building except for its player token
+func (building *Building) FootprintPositions() [][2]int {
+	footprint := GetBuildingFootprint(building.Type)
+	var positions [][2]int
+	for _, offset := range append([][2]int{footprint.TypeOffset}, footprintOffsets(footprint.Tiles)...) {
+		dx, dy := RotateFootprintOffset(building.Flags, offset)
+		positions = append(positions, [2]int{building.SpawnX + dx, building.SpawnY + dy})
+	}
+	return positions
+}
+
+// findBuildingTile returns the building type tile that belongs to the player token at (x, y). If no type tile
+// is found at any of the possible positions, the tile at the default position is returned.
+func findBuildingTile(layer *TileMapLayer, width, height, x, y int, flags uint8, mapping map[uint32]BuildingMapping) (Tile, int, int, error) {
+	var fallback *Tile
+	fallbackX, fallbackY := 0, 0
+	for i, offset := range buildingTypeOffsets() {
+		dx, dy := RotateFootprintOffset(flags, offset)
+		identX, identY := x+dx, y+dy
+		if identX < 0 || identY < 0 || identX >= width || identY >= height {
+			continue
+		}
+		tile := layer.Tiles[identY*width+identX]
+		if building, ok := mapping[tile.Index]; ok && GetBuildingFootprint(building.Type).TypeOffset == offset {
+			return tile, identX, identY, nil
+		}
+		if i == 0 {
+			fallback, fallbackX, fallbackY = &tile, identX, identY
+		}
+	}
+	if fallback == nil {
+		dx, dy := RotateFootprintOffset(flags, defaultTypeOffset)
+		return Tile{}, 0, 0, fmt.Errorf("Invalid map: The player mapping tile (x=%d, y=%d, layer=%q) is rotated towards the map edge. The building tile would be outside of the map (x=%d, y=%d)", x, y, layer.Name, x+dx, y+dy)
+	}
+	return *fallback, fallbackX, fallbackY, nil
+}
+
+// checkFootprint validates the rotation, the position of the building type tile and the additional tiles of a building
+func checkFootprint(layer *TileMapLayer, width, height int, building *Building, typeX, typeY int) error {
+	footprint := GetBuildingFootprint(building.Type)
+	name := buildingTypeNames[building.Type]
+
+	rotation := TileRotation(building.Flags)
+	if len(footprint.Rotations) > 0 {
+		allowed := false
+		for _, r := range footprint.Rotations {
+			allowed = allowed || r == rotation
+		}
+		if !allowed {
+			return fmt.Errorf("Invalid map: The %s (x=%d, y=%d, layer=%q) is rotated by %d degrees. Allowed rotations: %v", name, building.SpawnX, building.SpawnY, layer.Name, rotation, footprint.Rotations)
+		}
+	}
+
+	if dx, dy := RotateFootprintOffset(building.Flags, footprint.TypeOffset); building.SpawnX+dx != typeX || building.SpawnY+dy != typeY {
+		return fmt.Errorf("Invalid map: The building type tile of the %s (x=%d, y=%d, layer=%q) must be at (x=%d, y=%d)", name, building.SpawnX, building.SpawnY, layer.Name, building.SpawnX+dx, building.SpawnY+dy)
+	}
+
+	for _, required := range footprint.Tiles {
+		dx, dy := RotateFootprintOffset(building.Flags, required.Offset)
+		x, y := building.SpawnX+dx, building.SpawnY+dy
+		if x < 0 || y < 0 || x >= width || y >= height {
+			return fmt.Errorf("Invalid map: The footprint of the %s (x=%d, y=%d, layer=%q) exceeds the map at (x=%d, y=%d)", name, building.SpawnX, building.SpawnY, layer.Name, x, y)
+		}
+		tile := layer.Tiles[y*width+x]
+		if tile.Index != required.Tile || tile.Flags != building.Flags {
+			return fmt.Errorf("Invalid map: The footprint of the %s (x=%d, y=%d, layer=%q) requires tile %d with the same rotation as the player token at (x=%d, y=%d)", name, building.SpawnX, building.SpawnY, layer.Name, required.Tile, x, y)
+		}
+	}
+	return nil
+}
+
+// lintFootprints checks the footprints of a mapping file. Footprint tiles can be shared between buildings,
+// but must not be used for anything else.
+func lintFootprints(footprints map[string]BuildingFootprint, tileCount uint32, usedBy map[uint32]string) []string {
+	var problems []string
+	for _, name := range sortedFootprintNames(footprints) {
+		footprint := footprints[name]
+		if _, ok := buildingTypeByName(name); !ok {
+			problems = append(problems, fmt.Sprintf("footprints: unknown building type %q", name))
+			continue
+		}
+		for _, rotation := range footprint.Rotations {
+			if rotation != 0 && rotation != 90 && rotation != 180 && rotation != 270 {
+				problems = append(problems, fmt.Sprintf("footprint %q: invalid rotation %d (allowed: 0, 90, 180, 270)", name, rotation))
+			}
+		}
+		typeOffset := footprint.TypeOffset
+		if typeOffset == [2]int{} {
+			typeOffset = defaultTypeOffset
+		}
+		occupied := map[[2]int]bool{{0, 0}: true, typeOffset: true}
+		for _, tile := range footprint.Tiles {
+			switch {
+			case occupied[tile.Offset]:
+				problems = append(problems, fmt.Sprintf("footprint %q: offset %v is used more than once (the token is at [0, 0])", name, tile.Offset))
+			case tile.Tile == 0 || tile.Tile > tileCount:
+				problems = append(problems, fmt.Sprintf("footprint %q: tile %d does not exist in the spawn tileset (%d tiles)", name, tile.Tile, tileCount))
+			case usedBy[tile.Tile] != "":
+				problems = append(problems, fmt.Sprintf("footprint %q: tile %d is already used by %s", name, tile.Tile, usedBy[tile.Tile]))
+			}
+			occupied[tile.Offset] = true
+		}
+	}
+	return problems
+}
+
+func footprintOffsets(tiles []FootprintTile) [][2]int {
+	offsets := make([][2]int, len(tiles))
+	for i, tile := range tiles {
+		offsets[i] = tile.Offset
+	}
+	return offsets
+}
+
+func sortedFootprintNames(footprints map[string]BuildingFootprint) []string {
+	var names []string
+	for name := range footprints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
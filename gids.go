@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const gidFlagMask = FlippedHorizontallyTiledFlag | FlippedVerticallyTiledFlag | FlippedDiagonallyTiledFlag
+
+// GidRemapping maps the global tile ids of a map to new, normalized ones.
+// Normalized firstgids are contiguous: the first tileset starts at 1, every other tileset directly after its predecessor.
+type GidRemapping struct {
+	oldFirstGids []uint32
+	newFirstGids []uint32
+	tileCounts   []uint32
+	names        []string
+}
+
+// NewGidRemapping computes the normalized firstgids for the given tilesets
+func NewGidRemapping(tilesets []TileSet) (*GidRemapping, error) {
+	sorted := make([]TileSet, len(tilesets))
+	copy(sorted, tilesets)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].FirstGid < sorted[j].FirstGid
+	})
+
+	remapping := &GidRemapping{}
+	var nextGid uint32 = 1
+	for i, tileset := range sorted {
+		if tileset.TileCount == 0 {
+			return nil, fmt.Errorf("The tileset %q has no tile count", tileset.Name)
+		}
+		if i > 0 && tileset.FirstGid < sorted[i-1].FirstGid+sorted[i-1].TileCount {
+			return nil, fmt.Errorf("The tilesets %q and %q overlap", sorted[i-1].Name, tileset.Name)
+		}
+		remapping.oldFirstGids = append(remapping.oldFirstGids, tileset.FirstGid)
+		remapping.newFirstGids = append(remapping.newFirstGids, nextGid)
+		remapping.tileCounts = append(remapping.tileCounts, tileset.TileCount)
+		remapping.names = append(remapping.names, tileset.Name)
+		nextGid += tileset.TileCount
+	}
+	return remapping, nil
+}
+
+// FirstGid returns the new firstgid of the tileset with the given (old) firstgid
+func (remapping *GidRemapping) FirstGid(oldFirstGid uint32) (uint32, error) {
+	for i, first := range remapping.oldFirstGids {
+		if first == oldFirstGid {
+			return remapping.newFirstGids[i], nil
+		}
+	}
+	return 0, fmt.Errorf("Unknown tileset with firstgid %d", oldFirstGid)
+}
+
+// Gid converts an old gid (including its flip flags) into the new one.
+// Returns an error if the gid doesn't belong to any tileset.
+func (remapping *GidRemapping) Gid(gid uint32) (uint32, error) {
+	flags := gid & gidFlagMask
+	id := gid &^ gidFlagMask
+	if id == 0 {
+		return gid, nil
+	}
+	for i, first := range remapping.oldFirstGids {
+		if id >= first && id < first+remapping.tileCounts[i] {
+			return (remapping.newFirstGids[i] + id - first) | flags, nil
+		}
+	}
+	return 0, fmt.Errorf("The tile id %d is outside of all tileset ranges", id)
+}
+
+var csvNumber = regexp.MustCompile(`[0-9]+`)
+
+// NormalizeGids rewrites a TMX document with normalized firstgids. All gids of csv layers, <tile> layer data and
+// tile objects are remapped accordingly. Everything else is preserved as it is (see TMXRewriter).
+func NormalizeGids(source []byte, remapping *GidRemapping) ([]byte, error) {
+	rewriter := NewTMXRewriter(source)
+	for {
+		token, err := rewriter.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			path := rewriter.Path()
+			for i, attr := range t.Attr {
+				var remapped uint32
+				switch {
+				case path == "map/tileset" && attr.Name.Local == "firstgid":
+					remapped, err = remapAttr(attr.Value, remapping.FirstGid)
+				case t.Name.Local == "object" && attr.Name.Local == "gid",
+					strings.HasSuffix(path, "/data/tile") && attr.Name.Local == "gid":
+					remapped, err = remapAttr(attr.Value, remapping.Gid)
+				case t.Name.Local == "data" && attr.Name.Local == "encoding" && attr.Value != "csv":
+					return nil, fmt.Errorf("Unsupported layer encoding %q", attr.Value)
+				default:
+					continue
+				}
+				if err != nil {
+					return nil, fmt.Errorf("Line %d: %v", rewriter.Line(), err)
+				}
+				t.Attr[i].Value = strconv.FormatUint(uint64(remapped), 10)
+			}
+			if err := rewriter.UpdateAttrs(t); err != nil {
+				return nil, err
+			}
+
+		case xml.CharData:
+			if !strings.HasSuffix(rewriter.Path(), "/data") || !csvNumber.Match(t) {
+				continue
+			}
+			var remapErr error
+			remappedCSV := csvNumber.ReplaceAllFunc(t, func(number []byte) []byte {
+				remapped, err := remapAttr(string(number), remapping.Gid)
+				if err != nil && remapErr == nil {
+					remapErr = err
+				}
+				return []byte(strconv.FormatUint(uint64(remapped), 10))
+			})
+			if remapErr != nil {
+				return nil, fmt.Errorf("Invalid layer data: %v", remapErr)
+			}
+			rewriter.ReplaceText(string(remappedCSV))
+		}
+	}
+	return rewriter.Bytes(), nil
+}
+
+var emptyElement = regexp.MustCompile(`<([A-Za-z_][\w.-]*)([^<>]*)></([A-Za-z_][\w.-]*)>`)
+
+// collapseEmptyElements turns "<a></a>" back into "<a/>", the form written by Tiled
+func collapseEmptyElements(data []byte) []byte {
+	return emptyElement.ReplaceAllFunc(data, func(element []byte) []byte {
+		match := emptyElement.FindSubmatch(element)
+		if !bytes.Equal(match[1], match[3]) {
+			return element
+		}
+		return append(append(append([]byte("<"), match[1]...), match[2]...), "/>"...)
+	})
+}
+
+func remapAttr(value string, remap func(uint32) (uint32, error)) (uint32, error) {
+	gid, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid gid %q", value)
+	}
+	return remap(uint32(gid))
+}
+
+// RunNormalizeGids rewrites a TMX file with contiguous firstgids
+func RunNormalizeGids(args []string) error {
+	flags := flag.NewFlagSet("normalize-gids", flag.ContinueOnError)
+	outputFile := flags.String("o", "", "Output file (default: overwrite the input file)")
+	noBackup := flags.Bool("no-backup", false, "Don't create a timestamped backup of the file that is overwritten")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("Usage: normalize-gids [-o <output.tmx>] [-no-backup] <inputfile.tmx>")
+	}
+	sourceFile := flags.Arg(0)
+	if *outputFile == "" {
+		*outputFile = sourceFile
+	}
+
+	source, err := ReadInput(sourceFile)
+	if err != nil {
+		return fmt.Errorf("Failed to read source file '%v': %v", sourceFile, err)
+	}
+
+	var tilemap TileMap
+	if err := xml.Unmarshal(source, &tilemap); err != nil {
+		return fmt.Errorf("Failed to read source file '%v': %v", sourceFile, err)
+	}
+	for idx := range tilemap.Tilesets {
+		if err := tilemap.Tilesets[idx].loadExternal(sourceFile); err != nil {
+			return err
+		}
+	}
+
+	remapping, err := NewGidRemapping(tilemap.Tilesets)
+	if err != nil {
+		return err
+	}
+	for i, name := range remapping.names {
+		log.Infof("Tileset %q: firstgid %d -> %d", name, remapping.oldFirstGids[i], remapping.newFirstGids[i])
+	}
+
+	normalized, err := NormalizeGids(source, remapping)
+	if err != nil {
+		return fmt.Errorf("Failed to normalize '%v': %v", sourceFile, err)
+	}
+	return WriteTMXOutput(*outputFile, normalized, !*noBackup)
+}
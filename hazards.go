@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Hazard is an area that damages units inside of it.
+// Hazards are authored as rectangle objects with the type 'hazard' inside the 'Markers' object layer.
+type Hazard struct {
+	Type     HazardType
+	Area     Rect    // in tiles
+	Damage   float32 // damage per tick
+	Interval float32 // seconds between two damage ticks
+}
+
+type HazardType uint8
+
+const (
+	HazardType_Lava   HazardType = 1
+	HazardType_Spikes HazardType = 2
+	HazardType_Acid   HazardType = 3
+)
+
+// ExtractHazards reads all hazard markers of the tilemap and validates that they don't cover any spawn points
+func ExtractHazards(tilemap *TileMap, resources []ResourcePoint, waterdropSources []WaterdropSource, players []Player) ([]Hazard, error) {
+	hazards := make([]Hazard, 0)
+
+	for _, object := range tilemap.GetMarkers("hazard") {
+		var hazard Hazard
+		var err error
+
+		if hazard.Area, err = tilemap.GetMarkerRect(object); err != nil {
+			return nil, fmt.Errorf("Invalid hazard: %v", err)
+		}
+
+		hazardType, _ := object.Properties.Get("hazard")
+		switch strings.ToLower(hazardType) {
+		case "lava":
+			hazard.Type = HazardType_Lava
+		case "spikes":
+			hazard.Type = HazardType_Spikes
+		case "acid":
+			hazard.Type = HazardType_Acid
+		default:
+			return nil, fmt.Errorf("Invalid hazard %d (%q): The property 'hazard' must be 'lava', 'spikes' or 'acid', but is %q", object.Id, object.Name, hazardType)
+		}
+
+		if hazard.Damage, err = object.Properties.GetFloat("damage", 0); err != nil {
+			return nil, fmt.Errorf("Invalid hazard %d (%q): %v", object.Id, object.Name, err)
+		}
+		if hazard.Damage <= 0 {
+			return nil, fmt.Errorf("Invalid hazard %d (%q): The property 'damage' must be positive", object.Id, object.Name)
+		}
+		if hazard.Interval, err = object.Properties.GetFloat("interval", 1); err != nil {
+			return nil, fmt.Errorf("Invalid hazard %d (%q): %v", object.Id, object.Name, err)
+		}
+		if hazard.Interval <= 0 {
+			return nil, fmt.Errorf("Invalid hazard %d (%q): The property 'interval' must be positive", object.Id, object.Name)
+		}
+
+		// Spawning something inside a hazard is never intended
+		for _, r := range resources {
+			if hazard.Area.ContainsTile(r.SpawnX, r.SpawnY) {
+				return nil, fmt.Errorf("Invalid hazard %d (%q): Overlaps the resource point at x=%d, y=%d", object.Id, object.Name, r.SpawnX, r.SpawnY)
+			}
+		}
+		for _, s := range waterdropSources {
+			if hazard.Area.ContainsTile(s.SpawnX, s.SpawnY) {
+				return nil, fmt.Errorf("Invalid hazard %d (%q): Overlaps the water drop source at x=%d, y=%d", object.Id, object.Name, s.SpawnX, s.SpawnY)
+			}
+		}
+		for i, p := range players {
+			for _, b := range p.Buildings {
+				if hazard.Area.ContainsTile(b.SpawnX, b.SpawnY) {
+					return nil, fmt.Errorf("Invalid hazard %d (%q): Overlaps a building of player %d at x=%d, y=%d", object.Id, object.Name, i, b.SpawnX, b.SpawnY)
+				}
+			}
+			for _, u := range p.Units {
+				if hazard.Area.ContainsTile(u.SpawnX, u.SpawnY) {
+					return nil, fmt.Errorf("Invalid hazard %d (%q): Overlaps a unit of player %d at x=%d, y=%d", object.Id, object.Name, i, u.SpawnX, u.SpawnY)
+				}
+			}
+		}
+
+		hazards = append(hazards, hazard)
+	}
+	return hazards, nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TileMapImageLayer is a layer that shows a single image, eg. hand-placed background art
+type TileMapImageLayer struct {
+	Name       string       `xml:"name,attr"`
+	OffsetX    float32      `xml:"offsetx,attr"` // in pixels
+	OffsetY    float32      `xml:"offsety,attr"`
+	RepeatX    bool         `xml:"repeatx,attr"` // the image is repeated horizontally (Tiled 1.8+)
+	RepeatY    bool         `xml:"repeaty,attr"`
+	Visible    string       `xml:"visible,attr"` // "0" if hidden
+	Image      TileSetImage `xml:"image"`
+	Properties Properties   `xml:"properties>property"`
+}
+
+// ImageLayer is an image layer as it is stored in the output
+type ImageLayer struct {
+	Name          string
+	Image         string  // path of the image as referenced by the map (relative to the map file, forward slashes)
+	X, Y          float32 // offset of the top-left corner in tiles (bottom-left corner with a bottom-left origin, see ImageLayersToBottomLeftOrigin)
+	Width, Height int     // size of the image in pixels (0 if unknown)
+	RepeatX       bool
+	RepeatY       bool
+	RenderPass    RenderPass
+}
+
+// Image layer flags (see encodeImageLayers)
+const (
+	ImageLayerFlag_RepeatX    uint8 = 0x01
+	ImageLayerFlag_RepeatY    uint8 = 0x02
+	ImageLayerFlag_Foreground uint8 = 0x04 // rendered in front of units
+)
+
+// ExtractImageLayers converts all visible image layers, in drawing order (bottom first).
+// Hidden image layers are often used for reference art while drawing the map and are skipped.
+// Image layers are rendered behind units, unless their property "renderPass" says otherwise.
+func ExtractImageLayers(tilemap *TileMap) ([]ImageLayer, error) {
+	imageLayers := make([]ImageLayer, 0)
+	for _, layer := range tilemap.ImageLayers {
+		if layer.Visible == "0" {
+			log.Infof("Skipping hidden image layer %q", layer.Name)
+			continue
+		}
+		if layer.Image.Source == "" {
+			return nil, fmt.Errorf("Invalid image layer %q: The layer has no image", layer.Name)
+		}
+		imageLayer := ImageLayer{
+			Name:       layer.Name,
+			Image:      strings.Replace(layer.Image.Source, "\\", "/", -1),
+			X:          layer.OffsetX / float32(tilemap.Tilewidth),
+			Y:          layer.OffsetY / float32(tilemap.Tileheight),
+			Width:      layer.Image.Width,
+			Height:     layer.Image.Height,
+			RepeatX:    layer.RepeatX,
+			RepeatY:    layer.RepeatY,
+			RenderPass: RenderPass_Background,
+		}
+		if value, ok := layer.Properties.Get("renderPass"); ok {
+			var err error
+			if imageLayer.RenderPass, err = ParseRenderPass(value); err != nil {
+				return nil, fmt.Errorf("Invalid image layer %q: %v", layer.Name, err)
+			}
+		}
+		imageLayers = append(imageLayers, imageLayer)
+	}
+	return imageLayers, nil
+}
+
+// Flags returns the image layer flags that are stored in the output
+func (layer *ImageLayer) Flags() uint8 {
+	var flags uint8
+	if layer.RepeatX {
+		flags |= ImageLayerFlag_RepeatX
+	}
+	if layer.RepeatY {
+		flags |= ImageLayerFlag_RepeatY
+	}
+	if layer.RenderPass == RenderPass_Foreground {
+		flags |= ImageLayerFlag_Foreground
+	}
+	return flags
+}
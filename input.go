@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Limits of downloads (see ReadInput)
+const (
+	RemoteTimeout      = 60 * time.Second // for the whole request, including the body
+	MaxRemoteInputSize = 64 << 20         // bytes
+)
+
+// IsRemoteInput returns true if the input location is a URL (http, https or object store) instead of a local file
+func IsRemoteInput(location string) bool {
+	return strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") || IsObjectStoreURL(location)
+}
+
+// ReadInput reads the whole content of a local file or downloads it from an URL
+func ReadInput(location string) ([]byte, error) {
+	if !IsRemoteInput(location) {
+		return ioutil.ReadFile(LongPath(location))
+	}
+
+	var req *http.Request
+	var err error
+	if IsObjectStoreURL(location) {
+		req, err = NewObjectStoreRequest("GET", location, nil)
+	} else {
+		req, err = http.NewRequest("GET", location, nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to download %q: %v", location, err)
+	}
+
+	log.Debugf("Downloading '%s'", location)
+	resp, err := doObjectStoreRequest(req)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to download %q: %v", location, err)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, MaxRemoteInputSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to download %q: %v", location, err)
+	}
+	if len(data) > MaxRemoteInputSize {
+		return nil, fmt.Errorf("Failed to download %q: The file is larger than %d bytes", location, MaxRemoteInputSize)
+	}
+	return data, nil
+}
+
+// ResolveReference returns the location of a file that is referenced (relative) by another file.
+// References of remote files are resolved against the same base URL.
+func ResolveReference(base, reference string) (string, error) {
+	if !IsRemoteInput(base) {
+		if filepath.IsAbs(reference) {
+			return reference, nil
+		}
+		return filepath.Join(filepath.Dir(base), reference), nil
+	}
+
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	refURL, err := url.Parse(strings.Replace(reference, "\\", "/", -1))
+	if err != nil {
+		return "", err
+	}
+	if refURL.IsAbs() || strings.HasPrefix(refURL.Path, "/") {
+		return "", fmt.Errorf("The reference %q must be relative to %q", reference, base)
+	}
+
+	baseDir := path.Dir(baseURL.Path)
+	resolved := *baseURL
+	resolved.Path = path.Join(baseDir, refURL.Path)
+	if resolved.Path != baseDir && !strings.HasPrefix(resolved.Path, strings.TrimSuffix(baseDir, "/")+"/") { // "maps-evil" is not within "maps"
+		return "", fmt.Errorf("The reference %q points outside of the base URL %q", reference, base)
+	}
+	return resolved.String(), nil
+}
+
+// InputFile is a map that should be converted
+type InputFile struct {
+	Path     string // local path or URL
+	Relative string // path relative to the directory or pattern it was found with. Empty if the file was passed directly
+}
+
+// ExpandInputs resolves the input arguments into the list of maps to convert.
+// Directories are searched recursively for .tmx and .tmj files. Patterns support the wildcards of filepath.Match and '**' for any number of directories.
+func ExpandInputs(args []string) ([]InputFile, error) {
+	var inputs []InputFile
+	for _, arg := range args {
+		if IsRemoteInput(arg) {
+			inputs = append(inputs, InputFile{Path: arg})
+			continue
+		}
+
+		root, pattern := splitPattern(arg)
+		if pattern == "" {
+			info, err := os.Stat(LongPath(arg))
+			if err != nil || !info.IsDir() {
+				inputs = append(inputs, InputFile{Path: arg}) // errors are reported during conversion
+				continue
+			}
+			root, pattern = arg, "**/*.tm[xj]"
+		}
+
+		matches, err := findFiles(root, pattern)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to search for input files in '%s': %v", arg, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("No input files found for '%s'", arg)
+		}
+		inputs = append(inputs, matches...)
+	}
+	return inputs, nil
+}
+
+// splitPattern splits an input argument into the directory that can be searched and the pattern (relative to the directory).
+// The pattern is empty if the argument doesn't contain any wildcards.
+func splitPattern(arg string) (string, string) {
+	parts := strings.Split(filepath.ToSlash(arg), "/")
+	for i, part := range parts {
+		if strings.ContainsAny(part, "*?[") {
+			root := strings.Join(parts[:i], "/")
+			if root == "" && i > 0 {
+				root = "/"
+			} else if root == "" {
+				root = "."
+			}
+			return filepath.FromSlash(root), strings.Join(parts[i:], "/")
+		}
+	}
+	return arg, ""
+}
+
+// findFiles returns all files within root whose relative path matches the pattern. The results are sorted.
+func findFiles(root, pattern string) ([]InputFile, error) {
+	patternParts := strings.Split(pattern, "/")
+	var files []InputFile
+	err := filepath.Walk(root, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		relative, err := filepath.Rel(root, file)
+		if err != nil {
+			return err
+		}
+		if matchPattern(patternParts, strings.Split(filepath.ToSlash(relative), "/")) {
+			files = append(files, InputFile{Path: file, Relative: relative})
+		}
+		return nil
+	})
+	return files, err
+}
+
+// matchPattern matches path elements against pattern elements. '**' matches any number of path elements.
+func matchPattern(pattern, parts []string) bool {
+	if len(pattern) == 0 {
+		return len(parts) == 0
+	}
+	if pattern[0] == "**" {
+		for skip := 0; skip <= len(parts); skip++ {
+			if matchPattern(pattern[1:], parts[skip:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(parts) == 0 {
+		return false
+	}
+	if ok, _ := filepath.Match(pattern[0], parts[0]); !ok {
+		return false
+	}
+	return matchPattern(pattern[1:], parts[1:])
+}
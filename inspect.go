@@ -0,0 +1,210 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+func (tilesetType TileSetType) String() string {
+	switch tilesetType {
+	case ENVIRONMENT_TILESET:
+		return "environment"
+	case DECORATION1_TILESET:
+		return "decoration1"
+	case DECORATION2_TILESET:
+		return "decoration2"
+	case SPAWN_TILESET:
+		return "spawn"
+	}
+	return fmt.Sprintf("unknown tileset type %d", uint8(tilesetType))
+}
+
+func (flags EncodingFlags) String() string {
+	var names []string
+	for _, flag := range []struct {
+		flag EncodingFlags
+		name string
+	}{
+		{EncodingFlag_PackedBorders, "packed borders"},
+		{EncodingFlag_Varint, "varint"},
+		{EncodingFlag_BottomLeft, "bottom-left origin"},
+		{EncodingFlag_TileFlags, "tile flags"},
+		{EncodingFlag_PlayerSetup, "player setup"},
+	} {
+		if flags&flag.flag != 0 {
+			names = append(names, flag.name)
+			flags &^= flag.flag
+		}
+	}
+	if flags != 0 {
+		names = append(names, fmt.Sprintf("unknown 0x%02X", uint8(flags)))
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
+
+// PrintEncodedMap prints the content of a converted map in a human-readable form.
+// If verbose is set, all tiles and border lines are printed as well.
+func PrintEncodedMap(encoded *EncodedMap, verbose bool) {
+	fmt.Printf("Format version:      %d\n", encoded.Version)
+	fmt.Printf("Encoding flags:      0x%02X (%v)\n", uint8(encoded.Flags), encoded.Flags)
+	if encoded.Flags&EncodingFlag_TileFlags != 0 {
+		for i, name := range encoded.TileFlagNames {
+			fmt.Printf("\tTile flag bit %d: %s\n", int(FirstCustomTileFlagBit)+i, name)
+		}
+	}
+	if encoded.Version >= 6 {
+		fmt.Printf("Features:            0x%08X (%v)\n", uint32(encoded.Features), encoded.Features)
+	}
+	fmt.Printf("Size:                %dx%d\n", encoded.Width, encoded.Height)
+
+	fmt.Printf("\nLayers:              %d\n", len(encoded.Layers))
+	for l, layer := range encoded.Layers {
+		used := 0
+		for _, index := range layer.Indices {
+			if index != 0 {
+				used++
+			}
+		}
+		environment := ""
+		if l == encoded.EnvironmentLayer {
+			environment = ", environment layer"
+		}
+		fmt.Printf("\tLayer %d: tileset %v, %d non-empty tiles%s\n", l, layer.TileSetType, used, environment)
+		if !verbose {
+			continue
+		}
+		for y := 0; y < encoded.Height; y++ {
+			row := make([]string, encoded.Width)
+			for x := 0; x < encoded.Width; x++ {
+				i := y*encoded.Width + x
+				row[x] = fmt.Sprintf("%02X:%02X", layer.Flags[i], layer.Indices[i])
+			}
+			fmt.Printf("\t\t%s\n", strings.Join(row, " "))
+		}
+	}
+
+	for _, objectLayer := range []struct {
+		name    string
+		objects []EncodedObject
+	}{{"Background objects", encoded.BackgroundObjects}, {"Foreground objects", encoded.ForegroundObjects}} {
+		fmt.Printf("\n%-20s %d\n", objectLayer.name+":", len(objectLayer.objects))
+		for i, object := range objectLayer.objects {
+			fmt.Printf("\t%3d: %s\n", i, entryString(object))
+		}
+	}
+
+	fmt.Printf("\nResource points:     %d\n", len(encoded.Resources))
+	for i, resource := range encoded.Resources {
+		fmt.Printf("\t%3d: %s\n", i, entryString(resource))
+	}
+	fmt.Printf("\nWater drop sources:  %d\n", len(encoded.WaterdropSources))
+	for i, source := range encoded.WaterdropSources {
+		fmt.Printf("\t%3d: %s\n", i, entryString(source))
+	}
+
+	fmt.Printf("\nPlayers:             %d\n", len(encoded.Players))
+	for p, player := range encoded.Players {
+		fmt.Printf("\tPlayer %d: %d buildings, %d units", p, len(player.Buildings), len(player.Units))
+		if encoded.Version >= 3 {
+			fmt.Printf(", color %s, faction %q", colorString(player.Color), player.Faction)
+		}
+		if encoded.Flags&EncodingFlag_PlayerSetup != 0 {
+			fmt.Printf(", handicap %d%%, AI difficulty %v, AI personality %q", player.Handicap, player.AIDifficulty, player.AIPersonality)
+		}
+		fmt.Printf("\n")
+		for _, building := range player.Buildings {
+			fmt.Printf("\t\tBuilding: %s\n", entryString(building))
+		}
+		for _, unit := range player.Units {
+			fmt.Printf("\t\tUnit:     %s\n", entryString(unit))
+		}
+	}
+
+	fmt.Printf("\nBorders (lines / length):\n")
+	for _, dir := range []struct {
+		name  string
+		lines []BorderLine
+	}{
+		{"left", encoded.Borders.Left}, {"right", encoded.Borders.Right}, {"up", encoded.Borders.Up}, {"down", encoded.Borders.Down},
+		{"up-left", encoded.Borders.UpLeft}, {"up-right", encoded.Borders.UpRight},
+		{"down-left", encoded.Borders.DownLeft}, {"down-right", encoded.Borders.DownRight},
+	} {
+		fmt.Printf("\t%-12s %6d / %d\n", dir.name, len(dir.lines), borderLength(dir.lines))
+		if !verbose {
+			continue
+		}
+		for _, line := range dir.lines {
+			fmt.Printf("\t\t%s\n", entryString(line))
+		}
+	}
+
+	if encoded.Version < 3 {
+		return
+	}
+	if encoded.Version >= 5 {
+		fmt.Printf("\nChecksums:           %d\n", len(encoded.Checksums))
+		for _, checksum := range encoded.Checksums {
+			fmt.Printf("\t%-28s 0x%08X\n", checksum.Name(), checksum.Checksum)
+		}
+	}
+	fmt.Printf("\nSections:            %d\n", len(encoded.Sections))
+	for _, section := range encoded.Sections {
+		fmt.Printf("\t0x%02X %-22s %6d bytes", uint8(section.ID), section.ID.String(), len(section.Content))
+		if summary := sectionSummary(section); summary != "" {
+			fmt.Printf("   %s", summary)
+		}
+		fmt.Printf("\n")
+	}
+}
+
+// sectionSummary returns a short description of the section content, or an empty string if there is nothing worth printing
+func sectionSummary(section EncodedSection) string {
+	content := section.Content
+	switch section.ID {
+	case Section_Metadata:
+		if len(content) > 0 && len(content) >= 1+int(content[0])+1 {
+			return fmt.Sprintf("converter %s, format version %d", string(content[1:1+int(content[0])]), content[1+int(content[0])])
+		}
+	case Section_Thumbnail:
+		if len(content) >= 6 {
+			if content[0] == 0 {
+				return "no thumbnail"
+			}
+			return fmt.Sprintf("%dx%d, dominant color #%02X%02X%02X%02X", content[0], content[1], content[2], content[3], content[4], content[5])
+		}
+	case Section_Wind, Section_FlyBorders:
+		if len(content) > 0 && content[0] == 0x00 {
+			return "not used"
+		}
+	}
+	return ""
+}
+
+// RunInspect decodes a converted map file, validates its structure and prints its content
+func RunInspect(args []string) error {
+	flags := flag.NewFlagSet("inspect", flag.ContinueOnError)
+	byteOrder := flags.String("byte-order", "le", "Byte order of the file: le (little-endian) or be (big-endian)")
+	verbose := flags.Bool("v", false, "Print all tiles and border lines")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("Usage: inspect [-byte-order le|be] [-v] <map.tilemap>")
+	}
+	order, err := ParseByteOrder(*byteOrder)
+	if err != nil {
+		return err
+	}
+
+	encoded, err := LoadEncodedMap(flags.Arg(0), order)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("File:                %s\n", flags.Arg(0))
+	PrintEncodedMap(encoded, *verbose)
+	return nil
+}
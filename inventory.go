@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// GameData is the registry of the game's items and technologies (-game-data). Building inventories are validated against it.
+type GameData struct {
+	Items []string `json:"items"`
+	Techs []string `json:"techs"`
+}
+
+// LoadGameData reads a game data registry (JSON) from a local file or URL
+func LoadGameData(location string) (*GameData, error) {
+	data, err := ReadInput(location)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read game data '%v': %v", location, err)
+	}
+	var gameData GameData
+	if err := json.Unmarshal(data, &gameData); err != nil {
+		return nil, fmt.Errorf("Failed to read game data '%v': %v", location, err)
+	}
+	return &gameData, nil
+}
+
+// ExtractBuildingInventories reads the purchasable items and technologies of buildings, which turns them into scenario-specific shops.
+// They are defined by rectangle objects with the type 'building' inside the 'Markers' object layer, which cover exactly one building.
+// The properties 'inventory' and 'tech' contain comma-separated ids of the game data registry.
+func ExtractBuildingInventories(tilemap *TileMap, players []Player, gameData *GameData) error {
+	marked := make(map[*Building]bool)
+	for _, object := range tilemap.GetMarkers("building") {
+		rect, err := tilemap.GetMarkerRect(object)
+		if err != nil {
+			return fmt.Errorf("Invalid building marker: %v", err)
+		}
+
+		var building *Building
+		for p := range players {
+			for b := range players[p].Buildings {
+				candidate := &players[p].Buildings[b]
+				if !rect.ContainsTile(candidate.SpawnX, candidate.SpawnY) {
+					continue
+				}
+				if building != nil {
+					return fmt.Errorf("Invalid building marker %d (%q): The marker covers multiple buildings (x=%d, y=%d and x=%d, y=%d)",
+						object.Id, object.Name, building.SpawnX, building.SpawnY, candidate.SpawnX, candidate.SpawnY)
+				}
+				building = candidate
+			}
+		}
+		if building == nil {
+			return fmt.Errorf("Invalid building marker %d (%q): The marker doesn't cover any building", object.Id, object.Name)
+		}
+		if marked[building] {
+			return fmt.Errorf("Invalid building marker %d (%q): The building (x=%d, y=%d) has multiple markers", object.Id, object.Name, building.SpawnX, building.SpawnY)
+		}
+
+		marked[building] = true
+
+		if gameData == nil {
+			return fmt.Errorf("Invalid building marker %d (%q): Inventories and tech require the game data registry (-game-data)", object.Id, object.Name)
+		}
+		if building.Inventory, err = parseRegistryList(object, "inventory", gameData.Items); err != nil {
+			return err
+		}
+		if building.Tech, err = parseRegistryList(object, "tech", gameData.Techs); err != nil {
+			return err
+		}
+		if len(building.Inventory) == 0 && len(building.Tech) == 0 {
+			logTileWarningf(building.SpawnX, building.SpawnY, "The building marker %d (%q) has neither an inventory nor tech (x=%d, y=%d)", object.Id, object.Name, building.SpawnX, building.SpawnY)
+		}
+	}
+	return nil
+}
+
+// parseRegistryList parses a comma-separated list of ids and checks that all of them are part of the registry.
+// Returns nil if the property doesn't exist.
+func parseRegistryList(object *TileMapObject, property string, registry []string) ([]string, error) {
+	value, ok := object.Properties.Get(property)
+	if !ok {
+		return nil, nil
+	}
+
+	known := make(map[string]bool)
+	for _, id := range registry {
+		known[id] = true
+	}
+
+	ids := make([]string, 0)
+	used := make(map[string]bool)
+	for _, id := range strings.Split(value, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+		if !known[id] {
+			return nil, fmt.Errorf("Invalid building marker %d (%q): Unknown %s %q", object.Id, object.Name, property, id)
+		}
+		if used[id] {
+			return nil, fmt.Errorf("Invalid building marker %d (%q): The %s %q is listed multiple times", object.Id, object.Name, property, id)
+		}
+		used[id] = true
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Tiled's JSON map format (.tmj, .json). The JSON map is converted into the same model as TMX files,
+// so that everything after decoding doesn't need to know the input format.
+
+type jsonMap struct {
+	Width       int             `json:"width"`
+	Height      int             `json:"height"`
+	Version     json.RawMessage `json:"version"` // a number before Tiled 1.2
+	Orientation string          `json:"orientation"`
+	Renderorder string          `json:"renderorder"`
+	Tilewidth   int             `json:"tilewidth"`
+	Tileheight  int             `json:"tileheight"`
+	Infinite    bool            `json:"infinite"`
+	Properties  []jsonProperty  `json:"properties"`
+	Tilesets    []jsonTileSet   `json:"tilesets"`
+	Layers      []jsonLayer     `json:"layers"`
+}
+
+type jsonProperty struct {
+	Name  string      `json:"name"`
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+type jsonTileSet struct {
+	FirstGid    uint32     `json:"firstgid"`
+	Source      string     `json:"source"`
+	Name        string     `json:"name"`
+	TileWidth   int        `json:"tilewidth"`
+	TileHeight  int        `json:"tileheight"`
+	TileCount   uint32     `json:"tilecount"`
+	Columns     int        `json:"columns"`
+	Spacing     int        `json:"spacing"`
+	Margin      int        `json:"margin"`
+	Image       string     `json:"image"`
+	ImageWidth  int        `json:"imagewidth"`
+	ImageHeight int        `json:"imageheight"`
+	Tiles       []jsonTile `json:"tiles"`
+}
+
+type jsonTile struct {
+	Id         uint32         `json:"id"`
+	Properties []jsonProperty `json:"properties"`
+}
+
+type jsonLayer struct {
+	Type        string          `json:"type"` // tilelayer, objectgroup, imagelayer or group
+	Name        string          `json:"name"`
+	Data        json.RawMessage `json:"data"` // array of gids (csv) or a base64 string
+	Encoding    string          `json:"encoding"`
+	Compression string          `json:"compression"`
+	Properties  []jsonProperty  `json:"properties"`
+	Objects     []jsonObject    `json:"objects"`
+
+	OffsetX float32 `json:"offsetx"`
+	OffsetY float32 `json:"offsety"`
+
+	// image layers:
+	Image       string `json:"image"`
+	ImageWidth  int    `json:"imagewidth"`
+	ImageHeight int    `json:"imageheight"`
+	RepeatX     bool   `json:"repeatx"`
+	RepeatY     bool   `json:"repeaty"`
+	Visible     *bool  `json:"visible"`
+}
+
+type jsonObject struct {
+	Id         uint32         `json:"id"`
+	Name       string         `json:"name"`
+	Type       string         `json:"type"`
+	Class      string         `json:"class"` // replaced the type in Tiled 1.9
+	Gid        uint32         `json:"gid"`
+	X          float32        `json:"x"`
+	Y          float32        `json:"y"`
+	Width      float32        `json:"width"`
+	Height     float32        `json:"height"`
+	Rotation   float32        `json:"rotation"`
+	Properties []jsonProperty `json:"properties"`
+	Polyline   []jsonPoint    `json:"polyline"`
+}
+
+type jsonPoint struct {
+	X float32 `json:"x"`
+	Y float32 `json:"y"`
+}
+
+// IsJSONMap returns true if the map or tileset is stored in Tiled's JSON format.
+// Files are detected by their extension (.tmj, .tsj, .json). Other sources (eg. stdin) are detected by their content.
+func IsJSONMap(filepath string, data []byte) bool {
+	switch strings.ToLower(path.Ext(filepath)) {
+	case ".tmj", ".tsj", ".json":
+		return true
+	case ".tmx", ".tsx", ".xml":
+		return false
+	}
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte("{"))
+}
+
+// UnmarshalJSONMap decodes a map in Tiled's JSON format
+func UnmarshalJSONMap(data []byte, tilemap *TileMap) error {
+	var source jsonMap
+	if err := unmarshalJSON(data, &source); err != nil {
+		return err
+	}
+	if source.Infinite {
+		return fmt.Errorf("Infinite maps are not supported")
+	}
+
+	*tilemap = TileMap{
+		Width:       source.Width,
+		Height:      source.Height,
+		Version:     strings.Trim(string(source.Version), `"`),
+		Orientation: source.Orientation,
+		Renderorder: source.Renderorder,
+		Tilewidth:   source.Tilewidth,
+		Tileheight:  source.Tileheight,
+		Properties:  convertJSONProperties(source.Properties),
+	}
+	for _, tileset := range source.Tilesets {
+		tilemap.Tilesets = append(tilemap.Tilesets, tileset.convert())
+	}
+	for _, layer := range source.Layers {
+		switch layer.Type {
+		case "tilelayer":
+			data, err := layer.convertData()
+			if err != nil {
+				return fmt.Errorf("%v (layer=%q)", err, layer.Name)
+			}
+			tilemap.Layers = append(tilemap.Layers, TileMapLayer{
+				Name:       layer.Name,
+				OffsetX:    layer.OffsetX,
+				OffsetY:    layer.OffsetY,
+				Data:       data,
+				Properties: convertJSONProperties(layer.Properties),
+			})
+		case "objectgroup":
+			objectLayer := TileMapObjectLayer{Name: layer.Name, OffsetX: layer.OffsetX, OffsetY: layer.OffsetY}
+			for _, object := range layer.Objects {
+				objectLayer.Objects = append(objectLayer.Objects, object.convert())
+			}
+			tilemap.ObjectLayers = append(tilemap.ObjectLayers, objectLayer)
+		case "imagelayer":
+			tilemap.ImageLayers = append(tilemap.ImageLayers, layer.convertImageLayer())
+		default:
+			tilemap.UnsupportedLayers = append(tilemap.UnsupportedLayers, UnsupportedLayer{XMLName: xml.Name{Local: layer.Type}, Name: layer.Name})
+		}
+	}
+	return nil
+}
+
+// UnmarshalJSONTileSet decodes an external tileset in Tiled's JSON format (.tsj)
+func UnmarshalJSONTileSet(data []byte, tileset *TileSet) error {
+	var source jsonTileSet
+	if err := unmarshalJSON(data, &source); err != nil {
+		return err
+	}
+	*tileset = source.convert()
+	return nil
+}
+
+// unmarshalJSON keeps numbers as they are written, so that property values are converted to the same strings as in TMX files
+func unmarshalJSON(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+func (tileset *jsonTileSet) convert() TileSet {
+	converted := TileSet{
+		FirstGid:   tileset.FirstGid,
+		Name:       tileset.Name,
+		Source:     tileset.Source,
+		TileWidth:  tileset.TileWidth,
+		TileHeight: tileset.TileHeight,
+		TileCount:  tileset.TileCount,
+		Columns:    tileset.Columns,
+		Spacing:    tileset.Spacing,
+		Margin:     tileset.Margin,
+		Image:      TileSetImage{Source: tileset.Image, Width: tileset.ImageWidth, Height: tileset.ImageHeight},
+	}
+	for _, tile := range tileset.Tiles {
+		converted.Tiles = append(converted.Tiles, TileSetTile{Id: tile.Id, Properties: convertJSONProperties(tile.Properties)})
+	}
+	return converted
+}
+
+// convertData stores csv layers as <tile> elements and base64 layers as text, like in TMX files
+func (layer *jsonLayer) convertData() (TileMapLayerData, error) {
+	data := TileMapLayerData{Compression: layer.Compression}
+	switch layer.Encoding {
+	case "", "csv":
+		var gids []uint32
+		if err := json.Unmarshal(layer.Data, &gids); err != nil {
+			return data, fmt.Errorf("Unexpected layer data. Expected an array of tile ids: %v", err)
+		}
+		data.Tiles = make([]TileMapDataTile, len(gids))
+		for i, gid := range gids {
+			data.Tiles[i].Gid = gid
+		}
+	case "base64":
+		data.Encoding = layer.Encoding
+		if err := json.Unmarshal(layer.Data, &data.RawData); err != nil {
+			return data, fmt.Errorf("Unexpected layer data. Expected a base64 string: %v", err)
+		}
+	default:
+		return data, fmt.Errorf("Unexpected layer data. Unknown encoding %q. Supported encodings: csv, base64", layer.Encoding)
+	}
+	return data, nil
+}
+
+func (layer *jsonLayer) convertImageLayer() TileMapImageLayer {
+	converted := TileMapImageLayer{
+		Name:       layer.Name,
+		OffsetX:    layer.OffsetX,
+		OffsetY:    layer.OffsetY,
+		RepeatX:    layer.RepeatX,
+		RepeatY:    layer.RepeatY,
+		Image:      TileSetImage{Source: layer.Image, Width: layer.ImageWidth, Height: layer.ImageHeight},
+		Properties: convertJSONProperties(layer.Properties),
+	}
+	if layer.Visible != nil && !*layer.Visible {
+		converted.Visible = "0"
+	}
+	return converted
+}
+
+func (object *jsonObject) convert() TileMapObject {
+	converted := TileMapObject{
+		Id:         object.Id,
+		Name:       object.Name,
+		Type:       object.Type,
+		Index:      object.Gid,
+		X:          object.X,
+		Y:          object.Y,
+		Width:      object.Width,
+		Height:     object.Height,
+		Rotation:   object.Rotation,
+		Properties: convertJSONProperties(object.Properties),
+	}
+	if converted.Type == "" {
+		converted.Type = object.Class
+	}
+	if object.Polyline != nil {
+		points := make([]string, len(object.Polyline))
+		for i, point := range object.Polyline {
+			points[i] = strconv.FormatFloat(float64(point.X), 'g', -1, 32) + "," + strconv.FormatFloat(float64(point.Y), 'g', -1, 32)
+		}
+		converted.Polyline = &Polyline{Points: strings.Join(points, " ")}
+	}
+	return converted
+}
+
+// convertJSONProperties converts the typed property values into strings
+func convertJSONProperties(properties []jsonProperty) Properties {
+	var converted Properties
+	for _, property := range properties {
+		var value string
+		switch v := property.Value.(type) {
+		case string:
+			value = v
+		case json.Number:
+			value = v.String()
+		case bool:
+			value = strconv.FormatBool(v)
+		case nil:
+		default: // class properties
+			data, _ := json.Marshal(v)
+			value = string(data)
+		}
+		converted = append(converted, Property{Name: property.Name, Type: property.Type, Value: value})
+	}
+	return converted
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// JUnit XML, as understood by CI dashboards (-junit). Every map is a test case that fails if the map couldn't be converted.
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Errors   int             `xml:"errors,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"` // warnings
+	SystemErr string        `xml:"system-err,omitempty"` // logged errors
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit stores the report as JUnit XML at the given target (see WriteOutput)
+func (report *ConversionReport) WriteJUnit(target string) error {
+	suite := junitTestSuite{Name: "maps", Cases: []junitTestCase{}}
+	var total time.Duration
+	for _, mapReport := range report.Maps {
+		testCase := junitTestCase{
+			ClassName: "maps",
+			Name:      mapReport.Map,
+			Time:      junitSeconds(mapReport.duration),
+			SystemOut: strings.Join(mapReport.Warnings, "\n"),
+			SystemErr: strings.Join(mapReport.Errors, "\n"),
+		}
+		if !mapReport.Success {
+			testCase.Failure = &junitFailure{Message: mapReport.Error, Type: "ConversionError", Text: strings.Join(mapReport.Errors, "\n")}
+			suite.Failures++
+		}
+		suite.Cases = append(suite.Cases, testCase)
+		total += mapReport.duration
+	}
+	suite.Tests = len(suite.Cases)
+	suite.Time = junitSeconds(total)
+
+	suites := junitTestSuites{
+		Name:     "TiledMapConverter",
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Time:     suite.Time,
+		Suites:   []junitTestSuite{suite},
+	}
+	data, err := xml.MarshalIndent(suites, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Failed to create JUnit report: %v", err)
+	}
+	data = append([]byte(xml.Header), append(data, '\n')...)
+	if err := WriteOutput(target, data); err != nil {
+		return fmt.Errorf("Failed to write JUnit report: %v", err)
+	}
+	return nil
+}
+
+func junitSeconds(duration time.Duration) string {
+	return fmt.Sprintf("%.3f", duration.Seconds())
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+)
+
+// LayerOffset is the offset of a tile layer in tiles (Tiled stores it in pixels). Y is negated with a bottom-left origin (see LayerOffsetsToBottomLeftOrigin).
+type LayerOffset struct {
+	X, Y float32
+}
+
+// IsZero returns true if the layer is not offset
+func (offset LayerOffset) IsZero() bool {
+	return offset.X == 0 && offset.Y == 0
+}
+
+// ApplyObjectLayerOffsets moves the objects of all offset object layers, so that their coordinates are where Tiled shows them.
+// The offsets of the object layers are reset afterwards.
+func ApplyObjectLayerOffsets(tilemap *TileMap) {
+	for idx := range tilemap.ObjectLayers {
+		objectLayer := &tilemap.ObjectLayers[idx]
+		if objectLayer.OffsetX == 0 && objectLayer.OffsetY == 0 {
+			continue
+		}
+		for obj := range objectLayer.Objects {
+			objectLayer.Objects[obj].X += objectLayer.OffsetX
+			objectLayer.Objects[obj].Y += objectLayer.OffsetY
+		}
+		log.Infof("Moved the objects of layer %q by its offset (x=%v, y=%v)", objectLayer.Name, objectLayer.OffsetX, objectLayer.OffsetY)
+		objectLayer.OffsetX, objectLayer.OffsetY = 0, 0
+	}
+}
+
+// ExtractLayerOffsets returns the offset of every tile layer (in Tiled order).
+// Only decoration layers can be offset. The environment layer and the conversion layers (see conversionLayers) define
+// the terrain and spawn positions, which must be aligned to the tile grid.
+func ExtractLayerOffsets(tilemap *TileMap) ([]LayerOffset, error) {
+	environmentLayerIdx, err := tilemap.GetLayer("environment")
+	if err != nil {
+		return nil, err
+	}
+
+	offsets := make([]LayerOffset, len(tilemap.Layers))
+	for i, layer := range tilemap.Layers {
+		if layer.OffsetX == 0 && layer.OffsetY == 0 {
+			continue
+		}
+		if i == environmentLayerIdx || conversionLayers[layer.Name] {
+			return nil, fmt.Errorf("Invalid layer %q: The layer is offset (x=%v, y=%v). Only decoration layers can be offset", layer.Name, layer.OffsetX, layer.OffsetY)
+		}
+		offsets[i] = LayerOffset{
+			X: layer.OffsetX / float32(tilemap.Tilewidth),
+			Y: layer.OffsetY / float32(tilemap.Tileheight),
+		}
+	}
+	return offsets, nil
+}
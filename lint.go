@@ -0,0 +1,357 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// LintSeverity defines how a lint finding is reported
+type LintSeverity int
+
+const (
+	LintSeverity_Off LintSeverity = iota
+	LintSeverity_Info
+	LintSeverity_Warning
+	LintSeverity_Error
+)
+
+var lintSeverityNames = []string{"off", "info", "warning", "error"}
+
+func (severity LintSeverity) String() string {
+	if int(severity) < len(lintSeverityNames) {
+		return lintSeverityNames[severity]
+	}
+	return fmt.Sprintf("unknown severity %d", int(severity))
+}
+
+// ParseLintSeverity parses the name of a severity ("off", "info", "warning" or "error")
+func ParseLintSeverity(name string) (LintSeverity, error) {
+	for severity, n := range lintSeverityNames {
+		if strings.EqualFold(strings.TrimSpace(name), n) {
+			return LintSeverity(severity), nil
+		}
+	}
+	return LintSeverity_Off, fmt.Errorf("Unknown severity %q. Allowed values: %s", name, strings.Join(lintSeverityNames, ", "))
+}
+
+// LintFinding is a single problem found by a lint rule
+type LintFinding struct {
+	Rule     string
+	Severity LintSeverity
+	Message  string
+}
+
+// lintMap is the map that is checked by the lint rules
+type lintMap struct {
+	tilemap     *TileMap
+	environment *TileMapLayer
+	spawn       *TileMapLayer
+	resources   []ResourcePoint
+	waterdrops  []WaterdropSource
+	players     []Player // only existing players (with a base)
+}
+
+// LintRule is a check that can be enabled and configured in the rules file
+type LintRule struct {
+	Name             string
+	Description      string
+	DefaultSeverity  LintSeverity
+	DefaultThreshold float64 // 0 if the rule has no threshold
+	Check            func(m *lintMap, threshold float64) []string
+}
+
+// LintRules are all available lint rules
+var LintRules = []LintRule{
+	{"empty-layer", "Tile layers without any tiles", LintSeverity_Warning, 0, lintEmptyLayers},
+	{"diagonal-outer-ring", "Diagonal environment tiles on the outermost ring of the map, which create borders along the map edge", LintSeverity_Warning, 0, lintDiagonalOuterRing},
+	{"mirrored-resource-point", "Mirrored resource point tiles, which can't be converted (only rotations are allowed)", LintSeverity_Error, 0, lintMirroredResourcePoints},
+	{"spawn-distance", "Bases of different players that are closer than the threshold (in tiles)", LintSeverity_Warning, 20, lintSpawnDistance},
+	{"unit-balance", "Players that start with a different number of units", LintSeverity_Info, 0, lintUnitBalance},
+	{"resource-count", "Maps with fewer resource points per player than the threshold", LintSeverity_Warning, 2, lintResourceCount},
+	{"no-waterdrops", "Maps without water drop sources", LintSeverity_Info, 0, lintNoWaterdrops},
+}
+
+// LintRuleConfig is the configuration of a single rule in the rules file
+type LintRuleConfig struct {
+	Severity  string   `json:"severity"`
+	Threshold *float64 `json:"threshold,omitempty"`
+}
+
+// LintConfig contains the effective severity and threshold of every rule
+type LintConfig struct {
+	Severities map[string]LintSeverity
+	Thresholds map[string]float64
+}
+
+// DefaultLintConfig returns the configuration that is used without rules file
+func DefaultLintConfig() LintConfig {
+	config := LintConfig{make(map[string]LintSeverity), make(map[string]float64)}
+	for _, rule := range LintRules {
+		config.Severities[rule.Name] = rule.DefaultSeverity
+		config.Thresholds[rule.Name] = rule.DefaultThreshold
+	}
+	return config
+}
+
+// LoadLintConfig reads a rules file (JSON). It has the form {"rules": {"<rule>": {"severity": "error", "threshold": 10}, ...}}.
+// Rules that are not listed keep their default severity.
+func LoadLintConfig(location string) (LintConfig, error) {
+	config := DefaultLintConfig()
+	data, err := ReadInput(location)
+	if err != nil {
+		return config, fmt.Errorf("Failed to read rules file '%v': %v", location, err)
+	}
+	var file struct {
+		Rules map[string]LintRuleConfig `json:"rules"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return config, fmt.Errorf("Failed to read rules file '%v': %v", location, err)
+	}
+	for name, ruleConfig := range file.Rules {
+		if _, ok := config.Severities[name]; !ok {
+			return config, fmt.Errorf("Invalid rules file '%v': Unknown rule %q (see lint -list)", location, name)
+		}
+		if ruleConfig.Severity != "" {
+			severity, err := ParseLintSeverity(ruleConfig.Severity)
+			if err != nil {
+				return config, fmt.Errorf("Invalid rules file '%v': Rule %q: %v", location, name, err)
+			}
+			config.Severities[name] = severity
+		}
+		if ruleConfig.Threshold != nil {
+			if config.Thresholds[name] == 0 {
+				return config, fmt.Errorf("Invalid rules file '%v': Rule %q has no threshold", location, name)
+			}
+			config.Thresholds[name] = *ruleConfig.Threshold
+		}
+	}
+	return config, nil
+}
+
+// LintMap checks a loaded map with all enabled rules. The spawn layer must not have been extracted.
+// Returns an error if the map can't be checked at all (eg. because the spawn layer is missing).
+func LintMap(tilemap *TileMap, config LintConfig) ([]LintFinding, error) {
+	m := &lintMap{tilemap: tilemap}
+	environmentIdx, err := tilemap.GetLayer("environment")
+	if err != nil {
+		return nil, err
+	}
+	spawnIdx, err := tilemap.GetLayer("spawn")
+	if err != nil {
+		return nil, err
+	}
+	m.environment, m.spawn = &tilemap.Layers[environmentIdx], &tilemap.Layers[spawnIdx]
+
+	var findings []LintFinding
+	resources, waterdrops, players, err := ExtractSpawnInfoFromLayer(tilemap.Width, tilemap.Height, m.spawn)
+	if err != nil {
+		// Rules that need the spawn information are skipped, the remaining ones are still useful
+		findings = append(findings, LintFinding{"spawn-layer", LintSeverity_Error, err.Error()})
+	}
+	m.resources, m.waterdrops = resources, waterdrops
+	for _, player := range players {
+		for _, building := range player.Buildings {
+			if building.Type == BuildingType_Base {
+				m.players = append(m.players, player)
+				break
+			}
+		}
+	}
+
+	for _, rule := range LintRules {
+		severity := config.Severities[rule.Name]
+		if severity == LintSeverity_Off {
+			continue
+		}
+		if err != nil && rule.needsSpawnInfo() {
+			continue
+		}
+		for _, message := range rule.Check(m, config.Thresholds[rule.Name]) {
+			findings = append(findings, LintFinding{rule.Name, severity, message})
+		}
+	}
+	return findings, nil
+}
+
+// needsSpawnInfo returns true if the rule can't be checked if the spawn layer is invalid
+func (rule *LintRule) needsSpawnInfo() bool {
+	switch rule.Name {
+	case "empty-layer", "diagonal-outer-ring", "mirrored-resource-point":
+		return false
+	}
+	return true
+}
+
+func lintEmptyLayers(m *lintMap, threshold float64) []string {
+	var messages []string
+	for _, layer := range m.tilemap.Layers {
+		empty := true
+		for _, tile := range layer.Tiles {
+			if tile.Index != 0 {
+				empty = false
+				break
+			}
+		}
+		if empty {
+			messages = append(messages, fmt.Sprintf("The layer %q is empty", layer.Name))
+		}
+	}
+	return messages
+}
+
+func lintDiagonalOuterRing(m *lintMap, threshold float64) []string {
+	var messages []string
+	width, height := m.tilemap.Width, m.tilemap.Height
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x != 0 && y != 0 && x != width-1 && y != height-1 {
+				continue
+			}
+			if m.environment.Tiles[y*width+x].IsDiagonal() {
+				messages = append(messages, fmt.Sprintf("Diagonal environment tile on the outer ring of the map (x=%d, y=%d)", x, y))
+			}
+		}
+	}
+	return messages
+}
+
+func lintMirroredResourcePoints(m *lintMap, threshold float64) []string {
+	resourceMapping, _, _, _, _ := GetTileMapping()
+	var messages []string
+	for i, tile := range m.spawn.Tiles {
+		if tile.Index == resourceMapping && tile.IsMirrored() {
+			messages = append(messages, fmt.Sprintf("Mirrored resource point (x=%d, y=%d)", i%m.tilemap.Width, i/m.tilemap.Width))
+		}
+	}
+	return messages
+}
+
+func lintSpawnDistance(m *lintMap, threshold float64) []string {
+	var messages []string
+	for a := 0; a < len(m.players); a++ {
+		for b := a + 1; b < len(m.players); b++ {
+			for _, baseA := range m.players[a].Buildings {
+				for _, baseB := range m.players[b].Buildings {
+					if baseA.Type != BuildingType_Base || baseB.Type != BuildingType_Base {
+						continue
+					}
+					dx, dy := float64(baseA.SpawnX-baseB.SpawnX), float64(baseA.SpawnY-baseB.SpawnY)
+					if dx*dx+dy*dy < threshold*threshold {
+						messages = append(messages, fmt.Sprintf("The bases of player %d (x=%d, y=%d) and player %d (x=%d, y=%d) are closer than %v tiles",
+							m.players[a].Slot, baseA.SpawnX, baseA.SpawnY, m.players[b].Slot, baseB.SpawnX, baseB.SpawnY, threshold))
+					}
+				}
+			}
+		}
+	}
+	return messages
+}
+
+func lintUnitBalance(m *lintMap, threshold float64) []string {
+	counts := make(map[int][]string)
+	for _, player := range m.players {
+		counts[len(player.Units)] = append(counts[len(player.Units)], fmt.Sprintf("%d", player.Slot))
+	}
+	if len(counts) <= 1 {
+		return nil
+	}
+	var groups []string
+	for count, slots := range counts {
+		groups = append(groups, fmt.Sprintf("%d units: player %s", count, strings.Join(slots, ", ")))
+	}
+	sort.Strings(groups)
+	return []string{fmt.Sprintf("Players start with a different number of units (%s)", strings.Join(groups, "; "))}
+}
+
+func lintResourceCount(m *lintMap, threshold float64) []string {
+	if len(m.players) == 0 || float64(len(m.resources))/float64(len(m.players)) >= threshold {
+		return nil
+	}
+	return []string{fmt.Sprintf("The map has %d resource points for %d players (less than %v per player)", len(m.resources), len(m.players), threshold)}
+}
+
+func lintNoWaterdrops(m *lintMap, threshold float64) []string {
+	if len(m.waterdrops) > 0 {
+		return nil
+	}
+	return []string{"The map has no water drop sources"}
+}
+
+// RunLint checks maps with a configurable set of rules
+func RunLint(args []string) error {
+	flags := flag.NewFlagSet("lint", flag.ContinueOnError)
+	rulesFile := flags.String("rules", "", "Rules file (JSON) with the severity and threshold of each rule (default: the default severities)")
+	list := flags.Bool("list", false, "List all rules with their default severity and exit")
+	legacy := flags.Bool("legacy", false, "Accept maps created with Tiled 0.x and fill in missing information")
+	allowUnknownLayers := flags.Bool("allow-unknown-layers", false, "Skip layers that can't be converted (groups) with a warning instead of failing")
+	objectLayers := flags.String("object-layers", "", "Names of the object layers, comma separated: <role>=<layer name> (see the -object-layers option of the conversion)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *list {
+		for _, rule := range LintRules {
+			threshold := ""
+			if rule.DefaultThreshold != 0 {
+				threshold = fmt.Sprintf(", threshold %v", rule.DefaultThreshold)
+			}
+			fmt.Printf("%-24s %s%s\n\t%s\n", rule.Name, rule.DefaultSeverity, threshold, rule.Description)
+		}
+		return nil
+	}
+	if flags.NArg() == 0 {
+		return fmt.Errorf("Usage: lint [-rules <rules.json>] [-list] [-legacy] [-allow-unknown-layers] [-object-layers <names>] <inputfile.tmx | directory | pattern | URL>...")
+	}
+	objectLayerNames, err := ParseObjectLayerNames(*objectLayers)
+	if err != nil {
+		return err
+	}
+
+	config := DefaultLintConfig()
+	if *rulesFile != "" {
+		var err error
+		if config, err = LoadLintConfig(*rulesFile); err != nil {
+			return err
+		}
+	}
+
+	inputs, err := ExpandInputs(flags.Args())
+	if err != nil {
+		return err
+	}
+	errors := 0
+	for _, input := range inputs {
+		tilemap, err := LoadTilesFile(input.Path, DecoderOptions{Legacy: *legacy, AllowUnknownLayers: *allowUnknownLayers, ObjectLayerNames: objectLayerNames})
+		if err != nil {
+			log.Errorf("%v", err)
+			errors++
+			continue
+		}
+		findings, err := LintMap(&tilemap, config)
+		if err != nil {
+			log.Errorf("%s: %v", input.Path, err)
+			errors++
+			continue
+		}
+		for _, finding := range findings {
+			switch finding.Severity {
+			case LintSeverity_Error:
+				log.Errorf("%s: [%s] %s", input.Path, finding.Rule, finding.Message)
+				errors++
+			case LintSeverity_Warning:
+				log.Warningf("%s: [%s] %s", input.Path, finding.Rule, finding.Message)
+			default:
+				log.Infof("%s: [%s] %s", input.Path, finding.Rule, finding.Message)
+			}
+		}
+		if len(findings) == 0 {
+			log.Infof("%s: No problems found", input.Path)
+		}
+	}
+	if errors > 0 {
+		return fmt.Errorf("Lint failed with %d error(s)", errors)
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// TileRect is a rectangular area of the map in tiles
+type TileRect struct {
+	X, Y          int
+	Width, Height int
+}
+
+// LiveProblem is a problem of a single tile that was found by the live analysis
+type LiveProblem struct {
+	X, Y    int
+	Message string
+}
+
+// LiveAnalysis caches the borders and tile problems of a map, so that they can be updated for a changed region (see Update).
+// It's used by the editor plugin to give feedback while a map is being edited, which would be too slow for large maps
+// if the whole map was analysed after every change. The result of an update is identical to a new analysis.
+type LiveAnalysis struct {
+	width, height int
+	layerTypes    []TileSetType // per layer, the tileset type of the first occupied tile (see probeLayer)
+
+	// Border lines, in the same order as ComputeBorderOfLayer finds them
+	rowRight, rowLeft               [][]BorderLine // per row y (between the rows y-1 and y)
+	columnUp, columnDown            [][]BorderLine // per column x (between the columns x-1 and x)
+	fallingDownRight, fallingUpLeft [][]BorderLine // per diagonal from the top-left to the bottom-right (see sweepFallingDiagonal)
+	risingUpRight, risingDownLeft   [][]BorderLine // per diagonal from the bottom-left to the top-right (see sweepRisingDiagonal)
+
+	problems map[int][]string // per tile index
+}
+
+// NewLiveAnalysis analyses the whole map
+func NewLiveAnalysis(tilemap *TileMap) (*LiveAnalysis, error) {
+	analysis := &LiveAnalysis{}
+	if err := analysis.reset(tilemap); err != nil {
+		return nil, err
+	}
+	return analysis, nil
+}
+
+func (analysis *LiveAnalysis) reset(tilemap *TileMap) error {
+	width, height := tilemap.Width, tilemap.Height
+	diagonals := width + height - 1
+	*analysis = LiveAnalysis{
+		width:            width,
+		height:           height,
+		layerTypes:       liveLayerTypes(tilemap),
+		rowRight:         make([][]BorderLine, height),
+		rowLeft:          make([][]BorderLine, height),
+		columnUp:         make([][]BorderLine, width),
+		columnDown:       make([][]BorderLine, width),
+		fallingDownRight: make([][]BorderLine, diagonals),
+		fallingUpLeft:    make([][]BorderLine, diagonals),
+		risingUpRight:    make([][]BorderLine, diagonals),
+		risingDownLeft:   make([][]BorderLine, diagonals),
+		problems:         make(map[int][]string),
+	}
+	return analysis.Update(tilemap, TileRect{0, 0, width, height})
+}
+
+// Update analyses the changed region of the map again. Everything outside of the region must be unchanged since the last
+// update (or NewLiveAnalysis). If the size, the layers or the tileset of a layer changed, the whole map is analysed again.
+func (analysis *LiveAnalysis) Update(tilemap *TileMap, changed TileRect) error {
+	if tilemap.Width != analysis.width || tilemap.Height != analysis.height || len(tilemap.Layers) != len(analysis.layerTypes) {
+		return analysis.reset(tilemap)
+	}
+	for l, tilesetType := range liveLayerTypes(tilemap) {
+		if tilesetType != analysis.layerTypes[l] {
+			return analysis.reset(tilemap)
+		}
+	}
+	environmentIdx, err := tilemap.GetLayer("environment")
+	if err != nil {
+		return err
+	}
+	environment := &tilemap.Layers[environmentIdx]
+	width, height := analysis.width, analysis.height
+
+	x0, y0 := maxInt(changed.X, 0), maxInt(changed.Y, 0)
+	x1, y1 := minInt(changed.X+changed.Width, width), minInt(changed.Y+changed.Height, height) // exclusive
+	if x0 >= x1 || y0 >= y1 {
+		return nil
+	}
+
+	// A tile affects the borders towards its upper and lower neighbour (rows y and y+1) and its left and right neighbour
+	for y := maxInt(y0, 1); y <= minInt(y1, height-1); y++ {
+		if analysis.rowRight[y], analysis.rowLeft[y], err = sweepRow(width, height, environment, y, analysis.rowRight[y][:0], analysis.rowLeft[y][:0]); err != nil {
+			return err
+		}
+	}
+	for x := maxInt(x0, 1); x <= minInt(x1, width-1); x++ {
+		if analysis.columnUp[x], analysis.columnDown[x], err = sweepColumn(width, height, environment, x, analysis.columnUp[x][:0], analysis.columnDown[x][:0]); err != nil {
+			return err
+		}
+	}
+	// Falling diagonals have a constant x-y, rising diagonals a constant x+y
+	for k := x0 - (y1 - 1); k <= (x1-1)-y0; k++ {
+		d := k
+		if k < 0 {
+			d = width - 1 - k
+		}
+		if analysis.fallingDownRight[d], analysis.fallingUpLeft[d], err = sweepFallingDiagonal(width, height, environment, d, analysis.fallingDownRight[d][:0], analysis.fallingUpLeft[d][:0]); err != nil {
+			return err
+		}
+	}
+	for s := x0 + y0; s <= (x1-1)+(y1-1); s++ {
+		d := s + width
+		if s >= height-1 {
+			d = s - height + 1
+		}
+		if analysis.risingUpRight[d], analysis.risingDownLeft[d], err = sweepRisingDiagonal(width, height, environment, d, analysis.risingUpRight[d][:0], analysis.risingDownLeft[d][:0]); err != nil {
+			return err
+		}
+	}
+
+	spawnIdx, err := tilemap.GetLayer("spawn")
+	if err != nil {
+		spawnIdx = -1
+	}
+	resourceMapping, _, _, _, _ := GetTileMapping()
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			i := y*width + x
+			delete(analysis.problems, i)
+			for l := range tilemap.Layers {
+				layer := &tilemap.Layers[l]
+				tile := layer.Tiles[i]
+				if tile.Index == 0 {
+					continue
+				}
+				if tile.TileSet.Type != analysis.layerTypes[l] {
+					analysis.addProblem(i, fmt.Sprintf("The tile (x=%d, y=%d, layer=%q) can't be encoded. All tiles within a layer must come from the same tileset", x, y, layer.Name))
+				}
+				if l == environmentIdx && tile.IsDiagonal() && (x == 0 || y == 0 || x == width-1 || y == height-1) {
+					analysis.addProblem(i, fmt.Sprintf("Diagonal environment tile on the outer ring of the map (x=%d, y=%d)", x, y))
+				}
+				if l == spawnIdx && tile.Index == resourceMapping && tile.IsMirrored() {
+					analysis.addProblem(i, fmt.Sprintf("Mirrored resource point (x=%d, y=%d)", x, y))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// liveLayerTypes returns the tileset type of every layer like probeLayer, but without warning about empty layers
+func liveLayerTypes(tilemap *TileMap) []TileSetType {
+	types := make([]TileSetType, len(tilemap.Layers))
+	for l, layer := range tilemap.Layers {
+		types[l] = DECORATION1_TILESET
+		for _, tile := range layer.Tiles {
+			if tile.Index > 0 {
+				types[l] = tile.TileSet.Type
+				break
+			}
+		}
+	}
+	return types
+}
+
+func (analysis *LiveAnalysis) addProblem(tile int, message string) {
+	analysis.problems[tile] = append(analysis.problems[tile], message)
+}
+
+// Borders returns the borders of the environment layer, identical to ComputeBorder
+func (analysis *LiveAnalysis) Borders() SortedBorderLines {
+	return SortedBorderLines{
+		Left:      concatBorderLines(analysis.rowLeft),
+		Right:     concatBorderLines(analysis.rowRight),
+		Up:        concatBorderLines(analysis.columnUp),
+		Down:      concatBorderLines(analysis.columnDown),
+		UpLeft:    concatBorderLines(analysis.fallingUpLeft),
+		UpRight:   concatBorderLines(analysis.risingUpRight),
+		DownLeft:  concatBorderLines(analysis.risingDownLeft),
+		DownRight: concatBorderLines(analysis.fallingDownRight),
+	}
+}
+
+// Problems returns all problems of the map, sorted by position
+func (analysis *LiveAnalysis) Problems() []LiveProblem {
+	tiles := make([]int, 0, len(analysis.problems))
+	for i := range analysis.problems {
+		tiles = append(tiles, i)
+	}
+	sort.Ints(tiles)
+
+	problems := make([]LiveProblem, 0, len(tiles))
+	for _, i := range tiles {
+		for _, message := range analysis.problems[i] {
+			problems = append(problems, LiveProblem{X: i % analysis.width, Y: i / analysis.width, Message: message})
+		}
+	}
+	return problems
+}
+
+func concatBorderLines(parts [][]BorderLine) []BorderLine {
+	lines := make([]BorderLine, 0, 64)
+	for _, part := range parts {
+		lines = append(lines, part...)
+	}
+	return lines
+}
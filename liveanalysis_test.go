@@ -0,0 +1,125 @@
+package main
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/op/go-logging"
+)
+
+func loadTestMap(tb testing.TB) *TileMap {
+	tilemap, err := LoadTilesFile("resources/testMap.tmx", DecoderOptions{})
+	if err != nil {
+		tb.Fatalf("Failed to load the test map: %v", err)
+	}
+	return &tilemap
+}
+
+// repeatTestMap returns a map that repeats the tile layers of the test map in both directions
+func repeatTestMap(tb testing.TB, repeatX, repeatY int) *TileMap {
+	source := loadTestMap(tb)
+	tilemap := &TileMap{Width: source.Width * repeatX, Height: source.Height * repeatY}
+	for _, sourceLayer := range source.Layers {
+		layer := TileMapLayer{Name: sourceLayer.Name, Tiles: make([]Tile, tilemap.Width*tilemap.Height)}
+		for y := 0; y < tilemap.Height; y++ {
+			for x := 0; x < tilemap.Width; x++ {
+				layer.Tiles[y*tilemap.Width+x] = sourceLayer.Tiles[(y%source.Height)*source.Width+x%source.Width]
+			}
+		}
+		tilemap.Layers = append(tilemap.Layers, layer)
+	}
+	return tilemap
+}
+
+// editEnvironment replaces the environment tiles within a random region (which can overlap the map edge) by empty tiles or
+// by other tiles of the layer with random flags. It returns the region.
+func editEnvironment(tilemap *TileMap, random *rand.Rand) TileRect {
+	environmentIdx, _ := tilemap.GetLayer("environment")
+	tiles := tilemap.Layers[environmentIdx].Tiles
+
+	changed := TileRect{X: random.Intn(tilemap.Width+4) - 2, Y: random.Intn(tilemap.Height+4) - 2, Width: 1 + random.Intn(5), Height: 1 + random.Intn(5)}
+	for y := maxInt(changed.Y, 0); y < minInt(changed.Y+changed.Height, tilemap.Height); y++ {
+		for x := maxInt(changed.X, 0); x < minInt(changed.X+changed.Width, tilemap.Width); x++ {
+			tile := Tile{}
+			if random.Intn(3) != 0 {
+				tile = tiles[random.Intn(len(tiles))]
+				tile.Flags = uint8(random.Intn(8))
+			}
+			tiles[y*tilemap.Width+x] = tile
+		}
+	}
+	return changed
+}
+
+func TestLiveAnalysisUpdateMatchesNewAnalysis(t *testing.T) {
+	SetupLogger(logging.CRITICAL) // warnings are still counted
+	tilemap := loadTestMap(t)
+	environmentIdx, err := tilemap.GetLayer("environment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	analysis, err := NewLiveAnalysis(tilemap)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	random := rand.New(rand.NewSource(42))
+	for i := 0; i < 200; i++ {
+		changed := editEnvironment(tilemap, random)
+
+		warnings := logWarningCount
+		if err := analysis.Update(tilemap, changed); err != nil {
+			t.Fatalf("Update %d failed: %v", i, err)
+		}
+		if logWarningCount != warnings {
+			t.Fatalf("Update %d logged %d warnings", i, logWarningCount-warnings)
+		}
+
+		expected, err := NewLiveAnalysis(tilemap)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(analysis.Borders(), expected.Borders()) {
+			t.Fatalf("Update %d (%+v): The borders differ from a new analysis", i, changed)
+		}
+		if !reflect.DeepEqual(analysis.Problems(), expected.Problems()) {
+			t.Fatalf("Update %d (%+v): The problems differ from a new analysis:\n%v\n%v", i, changed, analysis.Problems(), expected.Problems())
+		}
+
+		borders, err := ComputeBorderOfLayer(tilemap.Width, tilemap.Height, &tilemap.Layers[environmentIdx])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(analysis.Borders(), borders) {
+			t.Fatalf("Update %d (%+v): The borders differ from ComputeBorderOfLayer", i, changed)
+		}
+	}
+}
+
+func BenchmarkLiveAnalysisUpdate(b *testing.B) {
+	tilemap := repeatTestMap(b, 5, 10) // 1000x1000 tiles
+	analysis, err := NewLiveAnalysis(tilemap)
+	if err != nil {
+		b.Fatal(err)
+	}
+	random := rand.New(rand.NewSource(42))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		changed := editEnvironment(tilemap, random)
+		if err := analysis.Update(tilemap, changed); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkNewLiveAnalysis(b *testing.B) {
+	tilemap := repeatTestMap(b, 5, 10) // 1000x1000 tiles
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := NewLiveAnalysis(tilemap); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	goformat "go/format"
+	"sort"
+	"strings"
+)
+
+// loaderFieldType is the storage type of a record field in the binary format
+type loaderFieldType int
+
+const (
+	loaderField_U8     loaderFieldType = iota // uint8
+	loaderField_Short                         // int16, or a zigzag varint if EncodingFlag_Varint is set (see writeShort)
+	loaderField_Fixed                         // int32, divided by FixedPointScale (see writeFloat)
+	loaderField_U32                           // uint32
+	loaderField_String                        // uint8 length, followed by the characters (see writeString)
+)
+
+// loaderTypes are the C and Go types of the decoded fields. The storage type is added as comment if it differs.
+var loaderTypes = map[loaderFieldType]struct{ C, Go, Stored string }{
+	loaderField_U8:     {"uint8_t", "uint8", ""},
+	loaderField_Short:  {"int32_t", "int", "short"},
+	loaderField_Fixed:  {"float", "float32", "fixed"},
+	loaderField_U32:    {"uint32_t", "uint32", ""},
+	loaderField_String: {"char", "string", "string"},
+}
+
+// loaderField is a single field of a record
+type loaderField struct {
+	Name    string
+	Type    loaderFieldType
+	Comment string
+}
+
+// comment returns the comment of the field, including its storage type
+func (field loaderField) comment() string {
+	var parts []string
+	if stored := loaderTypes[field.Type].Stored; stored != "" {
+		parts = append(parts, stored)
+	}
+	if field.Comment != "" {
+		parts = append(parts, field.Comment)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return " // " + strings.Join(parts, ", ")
+}
+
+// loaderRecord describes a record of the binary format in the order it is written by the encoder
+type loaderRecord struct {
+	Name    string
+	Comment string
+	Fields  []loaderField
+}
+
+// loaderMagicBytes are the magic bytes that separate the parts of the file (see Encode)
+var loaderMagicBytes = []struct {
+	Name  string
+	Value uint8
+}{
+	{"HEADER", 0xA5},
+	{"LAYERS_END", 0xAA},
+	{"OBJECTS_END", 0x99},
+	{"RESOURCES_END", 0x5A},
+	{"WATERDROPS_END", 0xFF},
+	{"PLAYERS_END", 0xA5},
+	{"FILE_END", 0x55},
+}
+
+// loaderRecords are the fixed records of the file. They have to be kept in sync with Encode and DecodeMap.
+var loaderRecords = []loaderRecord{
+	{"Header", "File header. The encoding flags exist since format version 3, followed by the custom tile flag names if ENCODING_FLAG_TILE_FLAGS is set", []loaderField{
+		{"Magic", loaderField_U8, "MAGIC_HEADER"},
+		{"Version", loaderField_U8, "format version"},
+		{"Flags", loaderField_U8, "encoding flags, format version 3+"},
+		{"Width", loaderField_Short, "in tiles"},
+		{"Height", loaderField_Short, "in tiles"},
+		{"LayerCount", loaderField_U8, ""},
+		{"EnvironmentLayer", loaderField_U8, "index of the environment layer"},
+		{"Features", loaderField_U32, "FEATURE_* bits of the optional sections with content, format version 6+"},
+		{"Reserved", loaderField_U32, "0, reserved for future header fields, format version 6+"},
+	}},
+	{"Tile", "Tiles of a layer (width*height, row by row), preceded by the tileset type of the layer", []loaderField{
+		{"Flags", loaderField_U8, "bit 0-2: flipped horizontally, vertically, diagonally. Higher bits: custom tile flags"},
+		{"Index", loaderField_U8, "0 = empty"},
+	}},
+	{"Object", "Background and foreground objects, each layer preceded by a short count", []loaderField{
+		{"Index", loaderField_U8, ""},
+		{"X", loaderField_Fixed, "in tiles"},
+		{"Y", loaderField_Fixed, "in tiles"},
+		{"Width", loaderField_Fixed, "in tiles, negative if flipped"},
+		{"Height", loaderField_Fixed, "in tiles, negative if flipped"},
+		{"Rotation", loaderField_Fixed, "in degrees"},
+	}},
+	{"ResourcePoint", "Resource points, preceded by an uint8 count", []loaderField{
+		{"X", loaderField_Short, ""},
+		{"Y", loaderField_Short, ""},
+		{"Flags", loaderField_U8, ""},
+	}},
+	{"WaterdropSource", "Water drop sources, preceded by an uint8 count", []loaderField{
+		{"X", loaderField_Short, ""},
+		{"Y", loaderField_Short, ""},
+		{"Flags", loaderField_U8, ""},
+	}},
+	{"Building", "Buildings of a player, preceded by an uint8 count", []loaderField{
+		{"Type", loaderField_U8, "BUILDING_TYPE_*"},
+		{"X", loaderField_Short, ""},
+		{"Y", loaderField_Short, ""},
+		{"Flags", loaderField_U8, ""},
+		{"SpanLength", loaderField_U8, "format version 3+, bridges only"},
+		{"FiringArcMin", loaderField_Fixed, "format version 3+, turrets only"},
+		{"FiringArcMax", loaderField_Fixed, "format version 3+, turrets only"},
+	}},
+	{"Unit", "Units of a player, preceded by an uint8 count", []loaderField{
+		{"Type", loaderField_U8, "UNIT_TYPE_*"},
+		{"X", loaderField_Short, ""},
+		{"Y", loaderField_Short, ""},
+	}},
+	{"PlayerSettings", "Follows the units of a player, format version 3+", []loaderField{
+		{"HasColor", loaderField_U8, "the color is only stored if this is not 0"},
+		{"R", loaderField_U8, ""},
+		{"G", loaderField_U8, ""},
+		{"B", loaderField_U8, ""},
+		{"A", loaderField_U8, ""},
+		{"Faction", loaderField_String, ""},
+	}},
+	{"PlayerSetup", "Follows the player settings if ENCODING_FLAG_PLAYER_SETUP is set", []loaderField{
+		{"Handicap", loaderField_U8, "percentage of the normal strength"},
+		{"AIDifficulty", loaderField_U8, "AI_DIFFICULTY_*, 0 = game default"},
+		{"AIPersonality", loaderField_String, "empty if the game should choose"},
+	}},
+	{"BorderLine", "Border lines. Preceded by 8 short counts (left, right, up, down, up-left, up-right, down-left, down-right) unless ENCODING_FLAG_PACKED_BORDERS is set", []loaderField{
+		{"StartX", loaderField_Short, ""},
+		{"StartY", loaderField_Short, ""},
+		{"Length", loaderField_Short, ""},
+	}},
+	{"ChecksumEntry", "Checksum table at the end of the header (format version 5+), preceded by a short count. Every part after the header has an entry, in file order. A part ends where the next one starts", []loaderField{
+		{"ID", loaderField_U8, "SECTION_*, SECTION_LAYER to SECTION_BORDERS for the parts in front of the sections"},
+		{"Index", loaderField_U8, "layer index for SECTION_LAYER, 0 otherwise"},
+		{"Checksum", loaderField_U32, "CRC-32 (IEEE)"},
+	}},
+	{"SectionHeader", "Precedes every section (format version 4+). The list is terminated by SECTION_END. Unknown sections can be skipped", []loaderField{
+		{"ID", loaderField_U8, "SECTION_*"},
+		{"Length", loaderField_U32, "length of the content"},
+	}},
+}
+
+// loaderLayout is the order of the file content
+var loaderLayout = []string{
+	"Header [custom tile flags: count (uint8), names (string)]",
+	"Format version 5+: count (short), ChecksumEntry[count]",
+	"Layers (stored in reversed order): tileset type (uint8), Tile[width*height]",
+	"MAGIC_LAYERS_END",
+	"Background objects: count (short), Object[count]",
+	"Foreground objects: count (short), Object[count]",
+	"MAGIC_OBJECTS_END",
+	"count (uint8), ResourcePoint[count]",
+	"MAGIC_RESOURCES_END",
+	"count (uint8), WaterdropSource[count]",
+	"MAGIC_WATERDROPS_END",
+	"Players: count (uint8), per player: count (uint8), Building[count], count (uint8), Unit[count], PlayerSettings, [PlayerSetup]",
+	"MAGIC_PLAYERS_END",
+	"Borders: BorderLine[] or packed borders",
+	"Format version 3: all sections, each prefixed with its id. Format version 4+: (SectionHeader, content)..., SECTION_END",
+	"MAGIC_FILE_END",
+}
+
+// loaderConstant is a named constant of the binary format
+type loaderConstant struct {
+	Name  string
+	Value int
+}
+
+// valueString returns the value as hex number, except for general constants that are no ids
+func (constant loaderConstant) valueString(group int) string {
+	if group == 0 {
+		return fmt.Sprintf("%d", constant.Value)
+	}
+	return fmt.Sprintf("0x%02X", constant.Value)
+}
+
+// loaderConstants returns the named constants of the binary format, grouped by their prefix. The first group contains general constants.
+func loaderConstants() [][]loaderConstant {
+	type constant = loaderConstant
+	var magic []constant
+	for _, m := range loaderMagicBytes {
+		magic = append(magic, constant{"MAGIC_" + m.Name, int(m.Value)})
+	}
+
+	flags := []constant{
+		{"ENCODING_FLAG_PACKED_BORDERS", int(EncodingFlag_PackedBorders)},
+		{"ENCODING_FLAG_VARINT", int(EncodingFlag_Varint)},
+		{"ENCODING_FLAG_BOTTOM_LEFT", int(EncodingFlag_BottomLeft)},
+		{"ENCODING_FLAG_TILE_FLAGS", int(EncodingFlag_TileFlags)},
+		{"ENCODING_FLAG_PLAYER_SETUP", int(EncodingFlag_PlayerSetup)},
+	}
+
+	sections := []constant{{"SECTION_END", int(Section_End)}}
+	ids := make([]int, 0, len(sectionNames))
+	for id := range sectionNames {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		name := strings.ToUpper(strings.NewReplacer(" ", "_", "-", "_").Replace(sectionNames[SectionID(id)]))
+		sections = append(sections, constant{"SECTION_" + name, id})
+	}
+
+	var features []constant
+	for flag := FeatureFlags(1); flag != 0; flag <<= 1 {
+		if name, ok := featureNames[flag]; ok {
+			features = append(features, constant{"FEATURE_" + strings.ToUpper(strings.NewReplacer(" ", "_", "-", "_").Replace(name)), int(flag)})
+		}
+	}
+
+	tilesets := []constant{
+		{"TILESET_ENVIRONMENT", int(ENVIRONMENT_TILESET)},
+		{"TILESET_DECORATION1", int(DECORATION1_TILESET)},
+		{"TILESET_DECORATION2", int(DECORATION2_TILESET)},
+		{"TILESET_SPAWN", int(SPAWN_TILESET)},
+	}
+	buildings := []constant{
+		{"BUILDING_TYPE_BASE", int(BuildingType_Base)},
+		{"BUILDING_TYPE_PUMP", int(BuildingType_Pump)},
+		{"BUILDING_TYPE_FACTORY", int(BuildingType_Factory)},
+		{"BUILDING_TYPE_TURRET", int(BuildingType_Turret)},
+		{"BUILDING_TYPE_BRIDGE", int(BuildingType_Bridge)},
+	}
+	units := []constant{
+		{"UNIT_TYPE_OFFENSE", int(UnitType_Offense)},
+		{"UNIT_TYPE_DEFENSE", int(UnitType_Defense)},
+		{"UNIT_TYPE_LONG_RANGE", int(UnitType_LongRange)},
+		{"UNIT_TYPE_SPECIAL", int(UnitType_Special)},
+		{"UNIT_TYPE_CONSTRUCTION", int(UnitType_Construction)},
+	}
+	difficulties := []constant{
+		{"AI_DIFFICULTY_DEFAULT", int(AIDifficulty_Default)},
+		{"AI_DIFFICULTY_EASY", int(AIDifficulty_Easy)},
+		{"AI_DIFFICULTY_NORMAL", int(AIDifficulty_Normal)},
+		{"AI_DIFFICULTY_HARD", int(AIDifficulty_Hard)},
+		{"AI_DIFFICULTY_BRUTAL", int(AIDifficulty_Brutal)},
+	}
+	general := []constant{
+		{"FORMAT_VERSION", int(FormatVersion)},
+		{"FIXED_POINT_SCALE", FixedPointScale},
+		{"FIRST_DIAGONAL_TILE", int(FIRST_DIAGONAL_TILE_TYPE)},
+		{"FIRST_CUSTOM_TILE_FLAG_BIT", FirstCustomTileFlagBit},
+		{"SECTION_HEADER_SIZE", 5},
+	}
+	return [][]constant{general, magic, flags, sections, features, tilesets, buildings, units, difficulties}
+}
+
+// GenerateCLoader returns a C/C++ header that describes the binary format
+func GenerateCLoader() []byte {
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Generated by TiledMapConverter %s (gen-loader). DO NOT EDIT.\n", ConverterVersion)
+	fmt.Fprintf(&out, "//\n// File layout:\n")
+	for _, line := range loaderLayout {
+		fmt.Fprintf(&out, "//   %s\n", line)
+	}
+	fmt.Fprintf(&out, "//\n// Stored types: short = int16 (zigzag varint if ENCODING_FLAG_VARINT is set), fixed = int32 / FIXED_POINT_SCALE,\n")
+	fmt.Fprintf(&out, "// string = uint8 length + characters. The structs below contain the decoded values.\n\n")
+	fmt.Fprintf(&out, "#pragma once\n\n#include <stdint.h>\n")
+
+	for g, group := range loaderConstants() {
+		fmt.Fprintf(&out, "\n")
+		for _, constant := range group {
+			fmt.Fprintf(&out, "#define TILEMAP_%s %s\n", constant.Name, constant.valueString(g))
+		}
+	}
+
+	for _, record := range loaderRecords {
+		fmt.Fprintf(&out, "\n// %s\ntypedef struct {\n", record.Comment)
+		for _, field := range record.Fields {
+			size := ""
+			if field.Type == loaderField_String {
+				size = "[256]"
+			}
+			fmt.Fprintf(&out, "\t%s %s%s;%s\n", loaderTypes[field.Type].C, field.Name, size, field.comment())
+		}
+		fmt.Fprintf(&out, "} Tilemap%s;\n", record.Name)
+	}
+	return out.Bytes()
+}
+
+// GenerateGoLoader returns a Go package that describes the binary format
+func GenerateGoLoader(packageName string) ([]byte, error) {
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by TiledMapConverter %s (gen-loader). DO NOT EDIT.\n\n", ConverterVersion)
+	fmt.Fprintf(&out, "// Package %s describes the binary format of converted maps.\n//\n// File layout:\n", packageName)
+	for _, line := range loaderLayout {
+		fmt.Fprintf(&out, "//   %s\n", line)
+	}
+	fmt.Fprintf(&out, "//\n// Stored types: short = int16 (zigzag varint if ENCODING_FLAG_VARINT is set), fixed = int32 / FIXED_POINT_SCALE,\n")
+	fmt.Fprintf(&out, "// string = uint8 length + characters. The structs below contain the decoded values.\n")
+	fmt.Fprintf(&out, "package %s\n", packageName)
+
+	for g, group := range loaderConstants() {
+		fmt.Fprintf(&out, "\nconst (\n")
+		for _, constant := range group {
+			fmt.Fprintf(&out, "\t%s = %s\n", constant.Name, constant.valueString(g))
+		}
+		fmt.Fprintf(&out, ")\n")
+	}
+
+	for _, record := range loaderRecords {
+		fmt.Fprintf(&out, "\n// %s is stored as follows: %s\ntype %s struct {\n", record.Name, record.Comment, record.Name)
+		for _, field := range record.Fields {
+			fmt.Fprintf(&out, "\t%s %s%s\n", field.Name, loaderTypes[field.Type].Go, field.comment())
+		}
+		fmt.Fprintf(&out, "}\n")
+	}
+	return goformat.Source(out.Bytes())
+}
+
+// RunGenLoader writes a description of the binary format that can be used by the game's loader
+func RunGenLoader(args []string) error {
+	flags := flag.NewFlagSet("gen-loader", flag.ContinueOnError)
+	language := flags.String("lang", "c", "Language of the generated code: c (C/C++ header) or go (Go package)")
+	packageName := flags.String("package", "tilemap", "Package name of the generated Go code")
+	outputTarget := flags.String("o", "-", "Output file or '-' for stdout")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return fmt.Errorf("Usage: gen-loader [-lang c|go] [-package <name>] [-o <output>]")
+	}
+
+	var output []byte
+	switch *language {
+	case "c":
+		output = GenerateCLoader()
+	case "go":
+		var err error
+		if output, err = GenerateGoLoader(*packageName); err != nil {
+			return fmt.Errorf("Failed to generate Go code: %v", err)
+		}
+	default:
+		return fmt.Errorf("Unknown language %q. Allowed values: c, go", *language)
+	}
+	return WriteOutput(*outputTarget, output)
+}
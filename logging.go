@@ -1,8 +1,13 @@
 package main
 
 import (
+    "encoding/json"
+    "fmt"
     "github.com/op/go-logging"
+    "io"
     "os"
+    "sync"
+    "time"
 )
 
 var log = logging.MustGetLogger("main")
@@ -17,6 +22,135 @@ func SetupLogger(consoleLevel logging.Level) {
     consoleBackendFormatter := logging.NewBackendFormatter(consoleBackend, format)
     consoleBackendLeveled := logging.AddModuleLevel(consoleBackendFormatter)
     consoleBackendLeveled.SetLevel(consoleLevel, "")
+    consoleBackendLevel = consoleBackendLeveled
 
-    logging.SetBackend(consoleBackendLeveled)
+    logging.SetBackend(consoleBackendLeveled, newRecorderBackend())
+}
+
+// SetupJSONLogger logs one JSON object per line instead of human readable text, so that build pipelines can index the records
+func SetupJSONLogger(consoleLevel logging.Level) {
+    consoleBackend := &jsonBackend{writer: os.Stderr}
+
+    consoleBackendFormatter := logging.NewBackendFormatter(consoleBackend, logging.MustStringFormatter(`%{shortfunc}`))
+    consoleBackendLeveled := logging.AddModuleLevel(consoleBackendFormatter)
+    consoleBackendLeveled.SetLevel(consoleLevel, "")
+    consoleBackendLevel = consoleBackendLeveled
+
+    logging.SetBackend(consoleBackendLeveled, newRecorderBackend())
+}
+
+// consoleBackendLevel controls which records are written to the console. Warnings and errors are still recorded if they are hidden.
+var consoleBackendLevel logging.LeveledBackend
+
+// SetConsoleLevel changes the level of the console output and returns the previous one
+func SetConsoleLevel(level logging.Level) logging.Level {
+    previous := consoleBackendLevel.GetLevel("")
+    consoleBackendLevel.SetLevel(level, "")
+    return previous
+}
+
+// logMapFile is the map that is currently being converted. It's added to JSON log records.
+var logMapFile string
+
+// SetLogMapFile sets the map file that is added to all following JSON log records ("" = none)
+func SetLogMapFile(mapFile string) {
+    logMapFile = mapFile
+}
+
+// jsonLogRecord is a single line of the JSON log output
+type jsonLogRecord struct {
+    Time     string `json:"time"`
+    Level    string `json:"level"`
+    Function string `json:"function"`
+    Message  string `json:"message"`
+    MapFile  string `json:"map,omitempty"`
+    TileX    *int   `json:"x,omitempty"`
+    TileY    *int   `json:"y,omitempty"`
+}
+
+// tileMessage is a log message about a single tile. It's logged as the only argument of the record,
+// so that the backends can read the position (see logTileWarningf).
+type tileMessage struct {
+    text string
+    x, y int
+}
+
+func (message tileMessage) String() string {
+    return message.text
+}
+
+// logTileWarningf logs a warning about the tile at (x, y). The position is added to JSON log records and debug warnings.
+func logTileWarningf(x, y int, format string, args ...interface{}) {
+    log.Warning(tileMessage{fmt.Sprintf(format, args...), x, y})
+}
+
+// logTileErrorf logs an error about the tile at (x, y), like logTileWarningf
+func logTileErrorf(x, y int, format string, args ...interface{}) {
+    log.Error(tileMessage{fmt.Sprintf(format, args...), x, y})
+}
+
+// recordTile returns the tile of a record that was logged with logTileWarningf or logTileErrorf
+func recordTile(rec *logging.Record) (x, y int, ok bool) {
+    if len(rec.Args) == 1 {
+        if message, ok := rec.Args[0].(tileMessage); ok {
+            return message.x, message.y, true
+        }
+    }
+    return -1, -1, false
+}
+
+type jsonBackend struct {
+    writer io.Writer
+}
+
+func (backend *jsonBackend) Log(level logging.Level, calldepth int, rec *logging.Record) error {
+    record := jsonLogRecord{
+        Time:     rec.Time.Format(time.RFC3339Nano),
+        Level:    level.String(),
+        Function: rec.Formatted(calldepth + 1),
+        Message:  rec.Message(),
+        MapFile:  logMapFile,
+    }
+    if x, y, ok := recordTile(rec); ok {
+        record.TileX, record.TileY = &x, &y
+    }
+
+    line, err := json.Marshal(record)
+    if err != nil {
+        return err
+    }
+    _, err = backend.writer.Write(append(line, '\n'))
+    return err
+}
+
+// logRecorder receives all warnings and errors, independent of the log format. It's used for the conversion report (nil = disabled).
+// x and y are the tile of the message, -1 if it has none (see logTileWarningf).
+var logRecorder func(level logging.Level, message string, x, y int)
+
+// logWarningCount is the total number of warnings that were logged so far
+var logWarningCount int
+
+// recorderMutex serializes the recording, because warnings can be logged from multiple goroutines
+var recorderMutex sync.Mutex
+
+type recorderBackend struct{}
+
+func newRecorderBackend() logging.LeveledBackend {
+    recorder := logging.AddModuleLevel(recorderBackend{})
+    recorder.SetLevel(logging.WARNING, "")
+    return recorder
+}
+
+func (recorderBackend) Log(level logging.Level, calldepth int, rec *logging.Record) error {
+    recorderMutex.Lock()
+    defer recorderMutex.Unlock()
+    if level == logging.WARNING {
+        logWarningCount++
+    }
+    if logRecorder != nil {
+        x, y, _ := recordTile(rec)
+        logRecorder(level, rec.Message(), x, y)
+    }
+    runEvents.Log(level, rec.Message())
+    return nil
 }
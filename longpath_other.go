@@ -0,0 +1,9 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+// LongPath returns the path unchanged. Only windows has path length limitations that need special handling.
+func LongPath(path string) string {
+	return path
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// maxShortPath is the length from which windows requires the extended-length prefix
+const maxShortPath = 248
+
+// LongPath converts a path into an absolute, extended-length path (\\?\C:\... or \\?\UNC\server\share\...),
+// so paths with more than MAX_PATH characters can be used. Short paths are returned unchanged.
+// Go does this on its own for absolute paths, but not for relative ones or ones containing '..'.
+func LongPath(path string) string {
+	if len(path) < maxShortPath || strings.HasPrefix(path, `\\?\`) {
+		return path
+	}
+	abs, err := filepath.Abs(path) // also cleans '..' and '/', which are not allowed in extended-length paths
+	if err != nil {
+		return path
+	}
+	if strings.HasPrefix(abs, `\\`) {
+		return `\\?\UNC\` + abs[2:]
+	}
+	return `\\?\` + abs
+}
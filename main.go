@@ -1,45 +1,474 @@
 package main
 
 import (
-	"bufio"
+	"bytes"
 	"encoding/binary"
+	"flag"
 	"fmt"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/op/go-logging"
 )
 
-// GetTargetFilePath returns the file path for the new, converted file that has the same name/path as the input file
+// GetTargetFilePath returns the file path for the new, converted file that has the same name/path as the input file.
+// It is used if neither -o nor -out-dir are given.
+// For remote input files, the converted file is stored in the working directory. Maps read from stdin are written to stdout.
 func GetTargetFilePath(sourceFile string) string {
-	path, filename := filepath.Split(sourceFile)
+	if sourceFile == "-" {
+		return "-"
+	}
+	if IsRemoteInput(sourceFile) {
+		if u, err := url.Parse(sourceFile); err == nil {
+			sourceFile = path.Base(u.Path)
+		}
+	}
+	dir, filename := filepath.Split(sourceFile)
 	ext := filepath.Ext(filename)
 	filename = filename[:len(filename)-len(ext)]
-	return path + filename + ".tilemap"
+	return dir + filename + ".tilemap"
+}
+
+// If multiple maps fail to convert, the highest exit code is used
+const (
+	ExitCode_Error             = 1 // generic error
+	ExitCode_Usage             = 2 // invalid command line arguments
+	ExitCode_OutputNotWritable = 3 // the output location is read-only or locked
+	ExitCode_LoadFailed        = 4 // the map can't be read or parsed
+	ExitCode_ValidationFailed  = 5 // the map content is invalid
+	ExitCode_EncodingFailed    = 6 // the map is valid, but can't be encoded (most likely a bug)
+	ExitCode_VerifyFailed      = 7 // the output differs from the existing file (verify)
+)
+
+// subcommands are tools besides the conversion itself. They log like the conversion does.
+var subcommands = map[string]func(args []string) error{
+	"normalize-gids":    RunNormalizeGids,
+	"gen-spawn-tileset": RunGenerateSpawnTileset,
+	"lint":              RunLint,
+	"lint-mapping":      RunLintMapping,
+	"diff":              RunDiff,
+	"inspect":           RunInspect,
+	"upgrade":           RunUpgrade,
+	"gen-loader":        RunGenLoader,
+	"extract-arena":     RunExtractArena,
+	"stats":             RunStats,
+	"ascii":             RunASCII,
+	"tile-usage":        RunTileUsage,
+	"bundle":            RunBundle,
 }
 
 func main() {
-	if err := Run(); err != nil {
+	if len(os.Args) > 1 && (os.Args[1] == "version" || os.Args[1] == "-version" || os.Args[1] == "--version") {
+		if err := RunVersion(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(ExitCode_Error)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 {
+		if subcommand, ok := subcommands[os.Args[1]]; ok {
+			SetupLogger(logging.DEBUG)
+			if err := subcommand(os.Args[2:]); err != nil {
+				log.Error(err)
+				os.Exit(ExitCode_Error)
+			}
+			return
+		}
+	}
+
+	// 'verify' uses the same options as the conversion, but compares the output with the existing files instead of writing them
+	args, verify := os.Args[1:], false
+	if len(args) > 0 && args[0] == "verify" {
+		args, verify = args[1:], true
+	}
+	err := Run(args, verify)
+	if err != nil {
 		log.Error(err)
-		os.Exit(1)
+	} else {
+		log.Info("Success")
+	}
+	if runSummary.Total > 0 {
+		log.Infof("Summary: %d of %d maps converted, %d failed, %d warnings", runSummary.Converted, runSummary.Total, runSummary.Total-runSummary.Converted, logWarningCount)
+	}
+	runProfile.Print()
+	if err != nil {
+		os.Exit(ExitCodeOf(err))
 	}
-	log.Info("Success")
 }
 
-// Run executes the application and returns an error message if something went wrong
-func Run() error {
+// Run executes the application and returns an error message if something went wrong.
+// If verify is set, the existing output files are compared with the conversion result instead of being overwritten.
+func Run(args []string, verify bool) (err error) {
 	SetupLogger(logging.DEBUG)
 
-	if len(os.Args) != 2 {
-		return fmt.Errorf("Usage: %s <inputfile.tmx>", os.Args[0])
+	flags := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	packedBorders := flags.Bool("packed-borders", false, "Store borders in the compact, bit-packed format")
+	outputTarget := flags.String("o", "", "Output file, object-store URL (s3://bucket/key, gs://bucket/key) or '-' for stdout. A URL ending with '/' is used as prefix")
+	outputDir := flags.String("out-dir", "", "Output directory. Files found in directories or with patterns keep their relative path")
+	manifest := flags.String("manifest", "", "Add every output file with its size, checksum, player and resource count and source file to the given JSON manifest")
+	checksumManifest := flags.String("sha256sums", "", "Add the checksum of the output file to the given SHA256SUMS manifest")
+	signingKey := flags.String("sign-key", "", "Sign the checksum manifest with the given ed25519 private key (PEM)")
+	writeRetries := flags.Int("write-retries", 0, "Number of retries (with backoff) if the output file is locked or read-only")
+	legacy := flags.Bool("legacy", false, "Accept maps created with Tiled 0.x and fill in missing information")
+	allowUnknownLayers := flags.Bool("allow-unknown-layers", false, "Skip layers that can't be converted (groups) with a warning instead of failing")
+	objectLayers := flags.String("object-layers", "", "Names of the object layers, comma separated: <role>=<layer name>. Roles: background (default 'BackgroundObjects'), foreground (default 'ForegroundObjects'), markers (default 'Markers')")
+	varints := flags.Bool("varint", false, "Store counts and coordinates as varints to reduce the output size")
+	formatVersions := flags.String("format-version", strconv.Itoa(int(FormatVersion)), "Comma-separated list of output format versions. One output file is written per version")
+	rotationStep := flags.Float64("rotation-step", 0, "Snap object rotations to multiples of the given angle (degrees)")
+	outOfBounds := flags.String("out-of-bounds", "keep", "What to do with objects outside of the map: keep (warn), clamp, drop (warn) or error")
+	byteOrder := flags.String("byte-order", "le", "Byte order of the output file: le (little-endian) or be (big-endian)")
+	densityArea := flags.String("density-area", "16x9", "Screen area (in tiles) used for the decoration density check")
+	densityWarn := flags.Int("density-warn", 0, "Warn if a screen area contains more decoration tiles and objects (0 = no limit)")
+	densityError := flags.Int("density-error", 0, "Fail if a screen area contains more decoration tiles and objects (0 = no limit)")
+	origin := flags.String("origin", "top-left", "Origin of all coordinates (spawns, borders, markers, objects, image layers) and of wind vectors and layer offsets: top-left (y down) or bottom-left (y up)")
+	logFormat := flags.String("log-format", "text", "Log format: text or json (one record per line)")
+	watch := flags.Bool("watch", false, "Watch the input files and directories and convert maps again whenever they change")
+	mappingFile := flags.String("mapping", "", "Use the spawn tile mapping of the given mapping file (JSON) instead of the built-in one")
+	dynamicBorders := flags.Bool("dynamic-borders", false, "Treat obstacles as temporary solids and store their borders in a separate section")
+	gameDataFile := flags.String("game-data", "", "Game data registry (JSON) with the item and tech ids that can be used in building inventories")
+	strict := flags.Bool("strict", false, "Treat warnings as errors (same as -max-warnings 0)")
+	maxWarnings := flags.Int("max-warnings", -1, "Fail if a map has more warnings than the given number (-1 = no limit)")
+	thumbnailSize := flags.Int("thumbnail-size", 64, "Size (in pixels) of the larger side of the lobby thumbnail (0 = no thumbnail, max 255)")
+	thumbnailPNG := flags.Bool("thumbnail-png", false, "Also write the lobby thumbnail as PNG next to each output file (<name>.thumb.png)")
+	spawnThumbnail := flags.Int("spawn-thumbnail", 0, "Also write a thumbnail with highlighted start positions and resource points next to each output file (<name>.spawns.png). Size (in pixels) of the larger side, 0 = none")
+	collisionSVG := flags.Bool("collision-svg", false, "Also write an SVG preview of the collision borders next to each output file (<name>.collision.svg)")
+	outputs := flags.String("outputs", "", "Additional outputs that are written next to each output file, comma separated. Available: "+strings.Join(OutputWriterNames(), ", "))
+	debugWarnings := flags.Bool("debug-warnings", false, "Embed all warnings into a debug section of the output, so that they can be displayed in-game (format version 4+)")
+	events := flags.String("events", "", "Write progress events (phases, warnings, errors, written files) to stdout. Format: ndjson (one JSON object per line)")
+	profile := flags.Bool("profile", false, "Print the time spent in decoding, tile extraction, spawn extraction, border computation, encoding and output")
+	profilePprof := flags.String("profile-pprof", "", "Also write a CPU and a heap profile for pprof (<prefix>.cpu.pprof, <prefix>.heap.pprof). Requires -profile")
+	junitFile := flags.String("junit", "", "Write a JUnit XML report with one test case per map to the given file or '-' for stdout (for CI dashboards)")
+	reportFile := flags.String("report", "", "Write a JSON report with warnings, errors, element counts and output checksums to the given file or '-' for stdout")
+	if err := flags.Parse(args); err != nil {
+		return &UsageError{err}
+	}
+
+	switch *logFormat {
+	case "text":
+	case "json":
+		SetupJSONLogger(logging.DEBUG)
+	default:
+		return usageErrorf("Unknown log format %q. Allowed values: text, json", *logFormat)
 	}
 
-	var sourceFile = os.Args[1]
-	var targetFile = GetTargetFilePath(sourceFile)
+	if flags.NArg() == 0 {
+		return usageErrorf("Usage: %s [options] <inputfile.tmx | inputfile.tmj | directory | pattern | URL | ->...", os.Args[0])
+	}
 
-	tilemap, err := LoadTilesFile(sourceFile)
+	options := ConvertOptions{
+		OutputTarget:     *outputTarget,
+		OutputDir:        *outputDir,
+		ChecksumManifest: *checksumManifest,
+		Manifest:         *manifest,
+		SigningKey:       *signingKey,
+		WriteRetries:     *writeRetries,
+		Decoder:          DecoderOptions{Legacy: *legacy, AllowUnknownLayers: *allowUnknownLayers},
+		MappingFile:      *mappingFile,
+		RotationStep:     float32(*rotationStep),
+		DynamicBorders:   *dynamicBorders,
+		MaxWarnings:      *maxWarnings,
+		ThumbnailSize:    *thumbnailSize,
+		SpawnThumbnail:   *spawnThumbnail,
+		DebugWarnings:    *debugWarnings,
+		Verify:           verify,
+	}
+	if *thumbnailSize < 0 || *thumbnailSize > 0xFF {
+		return usageErrorf("Invalid thumbnail size %d. Allowed values: 0-255", *thumbnailSize)
+	}
+	if *thumbnailPNG && *thumbnailSize == 0 {
+		return usageErrorf("The option -thumbnail-png requires a thumbnail size greater than 0")
+	}
+	if *events != "" {
+		if *outputTarget == "-" || *reportFile == "-" || *junitFile == "-" || (*outputTarget == "" && flags.NArg() == 1 && flags.Arg(0) == "-") {
+			return usageErrorf("Events are written to stdout and can't be combined with writing the output or a report to stdout")
+		}
+		if runEvents, err = NewEventStream(*events, os.Stdout); err != nil {
+			return &UsageError{err}
+		}
+	}
+	if *profilePprof != "" && !*profile {
+		return usageErrorf("The option -profile-pprof requires -profile")
+	}
+	if *spawnThumbnail < 0 {
+		return usageErrorf("Invalid spawn thumbnail size %d", *spawnThumbnail)
+	}
+	var outputNames []string
+	if *thumbnailPNG {
+		outputNames = append(outputNames, thumbnailPNGWriter{}.Name())
+	}
+	if *spawnThumbnail > 0 {
+		outputNames = append(outputNames, spawnThumbnailWriter{}.Name())
+	}
+	if *collisionSVG {
+		outputNames = append(outputNames, collisionSVGWriter{}.Name())
+	}
+	if *outputs != "" {
+		outputNames = append(outputNames, strings.Split(*outputs, ",")...)
+	}
+	if options.Outputs, err = selectOutputWriters(outputNames); err != nil {
+		return &UsageError{err}
+	}
+	if *strict {
+		if *maxWarnings != -1 {
+			return usageErrorf("The options -strict and -max-warnings can't be combined")
+		}
+		options.MaxWarnings = 0
+	}
+	if options.OutOfBounds, err = ParseObjectBoundsPolicy(*outOfBounds); err != nil {
+		return &UsageError{err}
+	}
+	options.Density = DensityLimits{Warn: *densityWarn, Error: *densityError}
+	if _, err := fmt.Sscanf(*densityArea, "%dx%d", &options.Density.AreaWidth, &options.Density.AreaHeight); err != nil || options.Density.AreaWidth <= 0 || options.Density.AreaHeight <= 0 {
+		return usageErrorf("Invalid density area %q. Expected <width>x<height> in tiles", *densityArea)
+	}
+	if options.ByteOrder, err = ParseByteOrder(*byteOrder); err != nil {
+		return &UsageError{err}
+	}
+	if options.Decoder.ObjectLayerNames, err = ParseObjectLayerNames(*objectLayers); err != nil {
+		return &UsageError{err}
+	}
+	for _, v := range strings.Split(*formatVersions, ",") {
+		version, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil || !IsSupportedFormatVersion(version) {
+			return usageErrorf("Unsupported format version %q. Supported versions: %v", v, SupportedFormatVersions)
+		}
+		options.FormatVersions = append(options.FormatVersions, uint8(version))
+	}
+	if *packedBorders {
+		options.EncodingFlags |= EncodingFlag_PackedBorders
+	}
+	if *varints {
+		options.EncodingFlags |= EncodingFlag_Varint
+	}
+	if coordinateOrigin, err := ParseCoordinateOrigin(*origin); err != nil {
+		return &UsageError{err}
+	} else if coordinateOrigin == Origin_BottomLeft {
+		options.EncodingFlags |= EncodingFlag_BottomLeft
+	}
+
+	for _, version := range options.FormatVersions {
+		if options.EncodingFlags != 0 && version < 3 {
+			return usageErrorf("The options -packed-borders, -varint and -origin require format version 3 or newer")
+		}
+	}
+	if *outputTarget != "" && *outputDir != "" {
+		return usageErrorf("The options -o and -out-dir can't be combined")
+	}
+	if *outputTarget == "-" || (*outputTarget == "" && flags.NArg() == 1 && flags.Arg(0) == "-") {
+		if *checksumManifest != "" || *manifest != "" || len(options.FormatVersions) > 1 || *watch {
+			return usageErrorf("Writing to stdout can't be combined with -sha256sums, -manifest, -watch or multiple format versions")
+		}
+	}
+	if (*reportFile != "" || *junitFile != "") && *watch {
+		return usageErrorf("The options -report and -junit can't be combined with -watch")
+	}
+	if (*reportFile == "-" || *junitFile == "-") && (*outputTarget == "-" || (*outputTarget == "" && flags.NArg() == 1 && flags.Arg(0) == "-")) {
+		return usageErrorf("The report and the output file can't both be written to stdout")
+	}
+	if *reportFile == "-" && *junitFile == "-" {
+		return usageErrorf("The JSON and the JUnit report can't both be written to stdout")
+	}
+	if *signingKey != "" && *checksumManifest == "" {
+		return usageErrorf("The option -sign-key requires -sha256sums")
+	}
+	if verify {
+		if *outputTarget == "-" || (*outputTarget == "" && flags.NArg() == 1 && flags.Arg(0) == "-") {
+			return usageErrorf("verify needs existing output files and can't compare with stdout")
+		}
+		if *checksumManifest != "" || *manifest != "" || *watch || len(options.Outputs) > 0 {
+			return usageErrorf("verify doesn't write any files and can't be combined with -sha256sums, -manifest, -watch, -outputs, -thumbnail-png, -collision-svg or -spawn-thumbnail")
+		}
+	}
+	inputs, err := ExpandInputs(flags.Args())
 	if err != nil {
-		return fmt.Errorf("Failed to load source file: %v", err)
+		return &UsageError{err}
+	}
+	if *outputTarget != "" && len(inputs) > 1 && !IsOutputPrefix(*outputTarget) {
+		return usageErrorf("The option -o must be a prefix URL (ending with '/') when converting multiple files")
+	}
+
+	if *mappingFile != "" {
+		if options.Mapping, err = LoadSpawnMapping(*mappingFile); err != nil {
+			return &UsageError{err}
+		}
+	}
+
+	if *gameDataFile != "" {
+		if options.GameData, err = LoadGameData(*gameDataFile); err != nil {
+			return &UsageError{err}
+		}
+	}
+
+	if *profile {
+		runProfile = NewProfile()
+	}
+	if *profilePprof != "" {
+		stopPprof, err := StartPprof(*profilePprof)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if pprofErr := stopPprof(); pprofErr != nil && err == nil {
+				err = pprofErr
+			}
+		}()
+	}
+
+	if *watch {
+		return Watch(flags.Args(), options)
+	}
+
+	if *reportFile != "" || *junitFile != "" {
+		options.Report = &ConversionReport{}
+		err = convertInputs(inputs, options)
+		if *reportFile != "" {
+			if reportErr := options.Report.Write(*reportFile); reportErr != nil && err == nil {
+				err = reportErr
+			}
+		}
+		if *junitFile != "" {
+			if reportErr := options.Report.WriteJUnit(*junitFile); reportErr != nil && err == nil {
+				err = reportErr
+			}
+		}
+		return err
+	}
+	return convertInputs(inputs, options)
+}
+
+// convertInputs converts all maps. A single map that was passed directly is converted without a summary.
+func convertInputs(inputs []InputFile, options ConvertOptions) error {
+	if len(inputs) == 1 && inputs[0].Relative == "" {
+		return ConvertFile(inputs[0], options)
+	}
+
+	var failed []string
+	exitCode := 0
+	for _, input := range inputs {
+		log.Infof("=======================================")
+		log.Infof("Converting '%s'", input.Path)
+		if err := ConvertFile(input, options); err != nil {
+			log.Errorf("Failed to convert '%s': %v", input.Path, err)
+			failed = append(failed, input.Path)
+			if code := ExitCodeOf(err); code > exitCode {
+				exitCode = code
+			}
+		}
+	}
+
+	log.Infof("=======================================")
+	for _, sourceFile := range failed {
+		log.Errorf("\tFailed: %s", sourceFile)
+	}
+	if len(failed) > 0 {
+		return &BatchError{Failed: len(failed), Total: len(inputs), ExitCode: exitCode}
+	}
+	return nil
+}
+
+// ConvertOptions contains the settings for converting a single map
+type ConvertOptions struct {
+	OutputTarget     string // -o
+	OutputDir        string // -out-dir
+	ChecksumManifest string
+	Manifest         string // JSON manifest of all output files (-manifest)
+	SigningKey       string
+	WriteRetries     int
+	Decoder          DecoderOptions
+	FormatVersions   []uint8 // one output file is written per version
+	ByteOrder        binary.ByteOrder
+	EncodingFlags    EncodingFlags
+	MappingFile      string
+	Mapping          *SpawnMapping // nil for the built-in mapping
+	RotationStep     float32       // in degrees, 0 = no snapping
+	OutOfBounds      ObjectBoundsPolicy
+	Density          DensityLimits
+	MaxWarnings      int // the conversion fails if there are more warnings. -1 = no limit
+	DynamicBorders   bool
+	ThumbnailSize    int               // larger side of the lobby thumbnail in pixels. 0 = no thumbnail
+	SpawnThumbnail   int               // larger side of the spawn overlay sidecar file in pixels. 0 = default size
+	Outputs          []OutputWriter    // additional outputs that are written next to each output file
+	DebugWarnings    bool              // embed warnings into the output
+	Verify           bool              // compare the output with the existing target files instead of writing them
+	GameData         *GameData         // nil if no registry is given
+	Report           *ConversionReport // nil if no report is written
+}
+
+// ConvertFile converts a single map and writes the output file
+func ConvertFile(input InputFile, options ConvertOptions) error {
+	report := options.Report.BeginMap(input.Path)
+	runEvents.Emit(Event{Event: Event_MapStart, Map: input.Path})
+	err := convertFile(input, options, report)
+	if _, ok := err.(*ConversionError); err != nil && !ok {
+		err = &ConversionError{Stage_Validation, err}
+	}
+	report.Finish(err)
+	runEvents.MapEnd(input.Path, err)
+
+	runSummary.Total++
+	if err == nil {
+		runSummary.Converted++
+	}
+	return err
+}
+
+// convertFile does the conversion of ConvertFile and adds the extracted counts and written files to the report (can be nil)
+func convertFile(input InputFile, options ConvertOptions, report *MapReport) error {
+	sourceFile := input.Path
+	warningsBefore := logWarningCount
+	SetLogMapFile(sourceFile)
+	defer SetLogMapFile("")
+
+	var debugWarnings []DebugWarning
+	if options.DebugWarnings {
+		debugWarnings = []DebugWarning{}
+		previousRecorder := logRecorder
+		logRecorder = func(level logging.Level, message string, x, y int) {
+			if level == logging.WARNING {
+				debugWarnings = append(debugWarnings, DebugWarning{Message: message, X: x, Y: y})
+			}
+			if previousRecorder != nil {
+				previousRecorder(level, message, x, y)
+			}
+		}
+		defer func() { logRecorder = previousRecorder }()
+	}
+
+	var targetFiles = make([]string, len(options.FormatVersions))
+	for i, version := range options.FormatVersions {
+		targetFiles[i] = ResolveOutputTarget(options.OutputTarget, options.OutputDir, input)
+		if len(options.FormatVersions) > 1 {
+			targetFiles[i] = VersionedTargetPath(targetFiles[i], version)
+		}
+		if options.Verify {
+			continue
+		}
+		if err := CheckOutputWritable(targetFiles[i]); err != nil && options.WriteRetries == 0 {
+			return &ConversionError{Stage_Output, err}
+		}
+	}
+
+	tilemap, err := LoadTilesFile(sourceFile, options.Decoder)
+	if err != nil {
+		return &ConversionError{Stage_Load, fmt.Errorf("Failed to load source file: %v", err)}
+	}
+
+	if options.Mapping != nil {
+		spawnTileCount := uint32(SpawnTilesetTileCount)
+		for _, tileset := range tilemap.Tilesets {
+			if tileset.Type == SPAWN_TILESET {
+				spawnTileCount = tileset.TileCount
+			}
+		}
+		if problems := options.Mapping.Lint(spawnTileCount); len(problems) > 0 {
+			return fmt.Errorf("Invalid mapping file '%v': %s (see lint-mapping)", options.MappingFile, problems[0])
+		}
+		spawnMapping = options.Mapping
 	}
 
 	log.Info("Input data:\n" + tilemap.String())
@@ -49,16 +478,159 @@ func Run() error {
 		return err
 	}
 
+	for _, layer := range []*TileMapObjectLayer{tilemap.BackgroundObjectLayer, tilemap.ForegroundObjectLayer} {
+		if err := NormalizeObjectTransforms(layer, options.RotationStep); err != nil {
+			return err
+		}
+		if err := ApplyObjectBoundsPolicy(&tilemap, layer, options.OutOfBounds); err != nil {
+			return err
+		}
+	}
+
+	tilemap.Environment, err = ExtractEnvironmentSettings(&tilemap)
+	if err != nil {
+		return err
+	}
+
+	stopSpawnExtraction := BeginPhase(Phase_SpawnExtract)
 	resources, waterdropSources, players, err := ExtractSpawnInfo(&tilemap)
+	stopSpawnExtraction()
 	if err != nil {
 		return err
 	}
 
+	if err := ExtractResourceAnchors(&tilemap, resources); err != nil {
+		return err
+	}
+
+	if err := ExtractPlayerAppearance(&tilemap, players); err != nil {
+		return err
+	}
+
+	if err := ExtractPlayerSettings(&tilemap, players); err != nil {
+		return err
+	}
+
+	if err := ValidateBridges(&tilemap, players); err != nil {
+		return err
+	}
+
+	if err := ValidateTurrets(&tilemap, players); err != nil {
+		return err
+	}
+
+	tilemap.Hazards, err = ExtractHazards(&tilemap, resources, waterdropSources, players)
+	if err != nil {
+		return err
+	}
+
+	tilemap.WindField, err = ExtractWindField(&tilemap)
+	if err != nil {
+		return err
+	}
+
+	tilemap.Checkpoints, err = ExtractCheckpoints(&tilemap)
+	if err != nil {
+		return err
+	}
+
+	tilemap.CameraPaths, err = ExtractCameraPaths(&tilemap)
+	if err != nil {
+		return err
+	}
+
+	tilemap.Victory, err = ExtractVictoryConditions(&tilemap)
+	if err != nil {
+		return err
+	}
+
+	tilemap.AIHints, err = ExtractAIHints(&tilemap)
+	if err != nil {
+		return err
+	}
+
+	tilemap.Squads, err = ExtractSquads(&tilemap, players)
+	if err != nil {
+		return err
+	}
+
+	tilemap.Obstacles, err = ExtractObstacles(&tilemap, resources, waterdropSources, players)
+	if err != nil {
+		return err
+	}
+	if options.DynamicBorders {
+		if tilemap.DynamicBorders, err = ComputeObstacleBorders(&tilemap, tilemap.Obstacles); err != nil {
+			return err
+		}
+	}
+
+	if err := ExtractBuildingInventories(&tilemap, players, options.GameData); err != nil {
+		return err
+	}
+
+	tilemap.NoBuild, err = ExtractNoBuildZones(&tilemap)
+	if err != nil {
+		return err
+	}
+
+	tilemap.RenderPass, err = ExtractRenderPasses(&tilemap)
+	if err != nil {
+		return err
+	}
+
+	tilemap.Offsets, err = ExtractLayerOffsets(&tilemap)
+	if err != nil {
+		return err
+	}
+
+	tilemap.Images, err = ExtractImageLayers(&tilemap)
+	if err != nil {
+		return err
+	}
+
+	if err := CheckDecorationDensity(&tilemap, options.Density); err != nil {
+		return err
+	}
+
+	stopBorders := BeginPhase(Phase_Borders)
 	borders, err := ComputeBorder(&tilemap)
+	stopBorders()
+	if err != nil {
+		return err
+	}
+
+	tilemap.FlyingBorders, err = ComputeFlyingBorders(&tilemap)
+	if err != nil {
+		return err
+	}
+
+	tilemap.Water, err = ExtractWaterVolumes(&tilemap)
 	if err != nil {
 		return err
 	}
 
+	tilemap.Navigation, err = ComputeConnectivityGraph(&tilemap, players)
+	if err != nil {
+		return err
+	}
+
+	if err := ValidateSpawnBounds(&tilemap, resources, waterdropSources, players); err != nil {
+		return err
+	}
+
+	tilemap.TileFlags, err = ExtractTileFlags(&tilemap)
+	if err != nil {
+		return err
+	}
+
+	if options.ThumbnailSize > 0 {
+		minimap, err := RenderMinimap(&tilemap)
+		if err != nil {
+			return err
+		}
+		tilemap.Thumbnail = ComputeThumbnail(minimap, options.ThumbnailSize)
+	}
+
 	log.Infof("Number of resource points: %d", len(resources))
 	// for i, r := range resources {
 	// 	log.Debugf("\t%2d: %3d x%3d", i, r.SpawnX, r.SpawnY)
@@ -69,6 +641,21 @@ func Run() error {
 	// 	log.Debugf("\t%2d: %3d x%3d", i, s.SpawnX, s.SpawnY)
 	// }
 
+	log.Infof("Number of hazards: %d", len(tilemap.Hazards))
+
+	log.Infof("Map has wind: %v", tilemap.WindField != nil)
+	log.Infof("Number of checkpoints: %d", len(tilemap.Checkpoints))
+	log.Infof("Number of camera paths: %d", len(tilemap.CameraPaths))
+	log.Infof("Number of AI hints: %d", len(tilemap.AIHints))
+	log.Infof("Number of squads: %d", len(tilemap.Squads))
+	log.Infof("Number of obstacles: %d", len(tilemap.Obstacles))
+	log.Infof("Number of no-build zones: %d", len(tilemap.NoBuild))
+	for _, idx := range tilemap.OutputLayers() {
+		log.Infof("Render pass of layer %q: %v", tilemap.Layers[idx].Name, tilemap.RenderPass[idx])
+	}
+	log.Infof("Number of water volumes: %d", len(tilemap.Water))
+	log.Infof("Number of regions: %d, connectors: %d", len(tilemap.Navigation.Regions), len(tilemap.Navigation.Connectors))
+
 	log.Infof("Number of players: %d", len(players))
 	for i, p := range players {
 		log.Infof("\tPlayer %d: %d buildings, %d units", i, len(p.Buildings), len(p.Units))
@@ -90,25 +677,151 @@ func Run() error {
 	log.Infof("Number of borders (up-left, up-right, down-left, down-right): %d, %d, %d, %d",
 		len(borders.UpLeft), len(borders.UpRight), len(borders.DownLeft), len(borders.DownRight))
 	//log.Debug(borders.String())
+	report.SetCounts(&tilemap, resources, waterdropSources, players, borders)
 
-	log.Infof("Writing to '%s'", targetFile)
-	err = os.Remove(targetFile)
-	if err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("Failed to remove existing file '%v'", targetFile)
+	// Warnings of the encoder itself (dropped features) are not embedded
+	tilemap.DebugWarnings = debugWarnings
+
+	// Additional outputs use Tiled's coordinate system and are therefore created before the origin is changed
+	converted := ConvertedMap{TileMap: &tilemap, Resources: resources, WaterdropSources: waterdropSources, Players: players, Borders: borders}
+	sidecars := make([][]byte, len(options.Outputs))
+	for i, writer := range options.Outputs {
+		var sidecar bytes.Buffer
+		if err := writer.Write(&converted, &sidecar, options); err != nil {
+			return &ConversionError{Stage_Encoding, fmt.Errorf("Failed to create output %q: %v", writer.Name(), err)}
+		}
+		sidecars[i] = sidecar.Bytes()
 	}
 
-	file, err := os.Create(targetFile)
-	if err != nil {
-		return fmt.Errorf("Failed to create output file: %v", err)
+	if options.EncodingFlags&EncodingFlag_BottomLeft != 0 {
+		resources, waterdropSources, players, borders = ToBottomLeftOrigin(tilemap.Height, resources, waterdropSources, players, borders)
+		if tilemap.FlyingBorders != nil {
+			flyingBorders := BordersToBottomLeftOrigin(tilemap.Height, *tilemap.FlyingBorders)
+			tilemap.FlyingBorders = &flyingBorders
+		}
+		tilemap.Water = WaterToBottomLeftOrigin(tilemap.Height, tilemap.Water)
+		tilemap.Navigation = NavigationToBottomLeftOrigin(tilemap.Height, tilemap.Navigation)
+		for i := range tilemap.DynamicBorders {
+			tilemap.DynamicBorders[i] = BordersToBottomLeftOrigin(tilemap.Height, tilemap.DynamicBorders[i])
+		}
+		tilemap.DebugWarnings = DebugWarningsToBottomLeftOrigin(tilemap.Height, tilemap.DebugWarnings)
+		MarkersToBottomLeftOrigin(&tilemap)
+		ObjectsToBottomLeftOrigin(&tilemap)
+		tilemap.WindField = WindToBottomLeftOrigin(tilemap.WindField)
+		tilemap.Images = ImageLayersToBottomLeftOrigin(tilemap.Height, tilemap.Tileheight, tilemap.Images)
+		tilemap.Offsets = LayerOffsetsToBottomLeftOrigin(tilemap.Offsets)
 	}
-	defer file.Close()
 
-	writer := bufio.NewWriter(file)
-	err = Encode(writer, binary.LittleEndian, &tilemap, resources, waterdropSources, players, borders)
-	if err != nil {
-		os.Remove(targetFile)
-		return fmt.Errorf("Failed to write output file: %v", err)
+	// All versions are encoded before anything is written, so that warnings of the encoder count towards the limit
+	stopEncoding := BeginPhase(Phase_Encoding)
+	outputs := make([][]byte, len(options.FormatVersions))
+	for i, version := range options.FormatVersions {
+		if outputs[i], err = encodeOutput(version, options, &tilemap, resources, waterdropSources, players, borders); err != nil {
+			stopEncoding()
+			return &ConversionError{Stage_Encoding, err}
+		}
+	}
+	stopEncoding()
+
+	if warnings := logWarningCount - warningsBefore; options.MaxWarnings >= 0 && warnings > options.MaxWarnings {
+		return fmt.Errorf("The map has %d warnings (allowed: %d). Fix them or remove -strict / -max-warnings", warnings, options.MaxWarnings)
+	}
+
+	defer BeginPhase(Phase_Output)()
+	for i, version := range options.FormatVersions {
+		if options.Verify {
+			if err := VerifyOutputFile(targetFiles[i], options.ByteOrder, outputs[i]); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := writeOutputFile(targetFiles[i], version, options, report, outputs[i]); err != nil {
+			return &ConversionError{Stage_Output, err}
+		}
+		if options.Manifest != "" && targetFiles[i] != "-" {
+			entry := ManifestEntry{
+				File:          targetFiles[i],
+				Source:        sourceFile,
+				FormatVersion: version,
+				Size:          len(outputs[i]),
+				SHA256:        sha256Hex(outputs[i]),
+				Players:       len(players),
+				Resources:     len(resources),
+			}
+			if err := UpdateMapManifest(options.Manifest, entry); err != nil {
+				return &ConversionError{Stage_Output, err}
+			}
+		}
+		if targetFiles[i] == "-" {
+			continue
+		}
+		for s, writer := range options.Outputs {
+			outputFile := OutputTargetPath(targetFiles[i], writer)
+			log.Infof("Writing %s to '%s'", writer.Name(), outputFile)
+			if err := WriteOutputWithRetry(outputFile, sidecars[s], options.WriteRetries); err != nil {
+				return &ConversionError{Stage_Output, err}
+			}
+		}
+	}
+	return nil
+}
+
+// selectOutputWriters returns the registered output writers with the given names, without duplicates.
+// The .tilemap output is always written and can't be selected.
+func selectOutputWriters(names []string) ([]OutputWriter, error) {
+	var writers []OutputWriter
+	selected := make(map[string]bool)
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" || selected[name] {
+			continue
+		}
+		writer, err := GetOutputWriter(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := writer.(TileMapWriter); ok {
+			return nil, fmt.Errorf("The output %q is always written", name)
+		}
+		selected[name] = true
+		writers = append(writers, writer)
+	}
+	return writers, nil
+}
+
+// VersionedTargetPath adds the format version to the file name of the target ("map.tilemap" -> "map.v2.tilemap")
+func VersionedTargetPath(target string, version uint8) string {
+	ext := path.Ext(target)
+	return fmt.Sprintf("%s.v%d%s", target[:len(target)-len(ext)], version, ext)
+}
+
+// encodeOutput encodes the converted map in the given format version
+func encodeOutput(version uint8, options ConvertOptions, tilemap *TileMap, resources []ResourcePoint, waterdropSources []WaterdropSource, players []Player, borders SortedBorderLines) ([]byte, error) {
+	var output bytes.Buffer
+	model := ConvertedMap{TileMap: tilemap, Resources: resources, WaterdropSources: waterdropSources, Players: players, Borders: borders}
+	if err := (TileMapWriter{Version: version}).Write(&model, &output, options); err != nil {
+		return nil, fmt.Errorf("Failed to write output file: %v", err)
+	}
+	return output.Bytes(), nil
+}
+
+// writeOutputFile writes an encoded map to the target and adds it to the checksum manifest
+func writeOutputFile(targetFile string, version uint8, options ConvertOptions, report *MapReport, output []byte) error {
+	log.Infof("Writing to '%s' (format version %d)", targetFile, version)
+	if err := WriteOutputWithRetry(targetFile, output, options.WriteRetries); err != nil {
+		return err
+	}
+	report.AddOutput(targetFile, version, output)
+
+	if options.ChecksumManifest != "" {
+		if err := UpdateChecksumManifest(options.ChecksumManifest, targetFile, output); err != nil {
+			return err
+		}
+		if options.SigningKey != "" {
+			if err := SignChecksumManifest(options.ChecksumManifest, options.SigningKey); err != nil {
+				return err
+			}
+		}
 	}
-	writer.Flush()
 	return nil
 }
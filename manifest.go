@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+// MapManifest lists converted maps for the game's asset pipeline, which builds the map catalogs from it (-manifest)
+type MapManifest struct {
+	Maps []ManifestEntry `json:"maps"`
+}
+
+// ManifestEntry describes a single output file. Paths of local files are relative to the manifest.
+type ManifestEntry struct {
+	File          string `json:"file"`
+	Source        string `json:"source"`
+	FormatVersion uint8  `json:"formatVersion"`
+	Size          int    `json:"size"`
+	SHA256        string `json:"sha256"`
+	Players       int    `json:"players"`
+	Resources     int    `json:"resources"`
+}
+
+// UpdateMapManifest adds (or replaces) the entry of an output file in the manifest. The entries are sorted by file.
+// Like the checksum manifest, the manifest is updated after every map, so that it stays valid if a batch fails halfway.
+func UpdateMapManifest(manifestPath string, entry ManifestEntry) error {
+	var manifest MapManifest
+	if content, err := ioutil.ReadFile(LongPath(manifestPath)); err == nil {
+		if err := json.Unmarshal(content, &manifest); err != nil {
+			return fmt.Errorf("Invalid manifest '%s': %v", manifestPath, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("Failed to read manifest: %v", err)
+	}
+
+	entry.File = manifestRelativePath(manifestPath, entry.File)
+	entry.Source = manifestRelativePath(manifestPath, entry.Source)
+	replaced := false
+	for i := range manifest.Maps {
+		if manifest.Maps[i].File == entry.File {
+			manifest.Maps[i] = entry
+			replaced = true
+		}
+	}
+	if !replaced {
+		manifest.Maps = append(manifest.Maps, entry)
+	}
+	sort.Slice(manifest.Maps, func(i, j int) bool { return manifest.Maps[i].File < manifest.Maps[j].File })
+
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Failed to create manifest: %v", err)
+	}
+	if err := ioutil.WriteFile(LongPath(manifestPath), append(content, '\n'), 0644); err != nil {
+		return fmt.Errorf("Failed to write manifest: %v", err)
+	}
+	return nil
+}
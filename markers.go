@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Rect is an axis-aligned rectangle in tile-units (1.0 = one tile).
+type Rect struct {
+	X      float32
+	Y      float32
+	Width  float32
+	Height float32
+}
+
+// ContainsTile returns true if the rectangle overlaps the tile at the given tile-position
+func (rect Rect) ContainsTile(x, y int) bool {
+	return rect.X < float32(x+1) && rect.X+rect.Width > float32(x) &&
+		rect.Y < float32(y+1) && rect.Y+rect.Height > float32(y)
+}
+
+// CenterTile returns the position of the tile in the center of the rectangle
+func (rect Rect) CenterTile() (int, int) {
+	return int(rect.X + rect.Width/2), int(rect.Y + rect.Height/2)
+}
+
+// Overlaps returns true if both rectangles overlap
+func (rect Rect) Overlaps(other Rect) bool {
+	return rect.X < other.X+other.Width && rect.X+rect.Width > other.X &&
+		rect.Y < other.Y+other.Height && rect.Y+rect.Height > other.Y
+}
+
+// Point is a position in tile-units
+type Point struct {
+	X float32
+	Y float32
+}
+
+// GetMarkers returns all objects of the marker layer with the given type (case insensitive)
+func (tilemap *TileMap) GetMarkers(markerType string) []*TileMapObject {
+	markers := make([]*TileMapObject, 0)
+	if tilemap.MarkerObjectLayer == nil {
+		return markers
+	}
+	for i := range tilemap.MarkerObjectLayer.Objects {
+		object := &tilemap.MarkerObjectLayer.Objects[i]
+		if strings.ToLower(object.Type) == markerType {
+			markers = append(markers, object)
+		}
+	}
+	return markers
+}
+
+// GetMarkerRect returns the area covered by a rectangular marker object in tile-units.
+// Tiled stores the upper-left corner for rectangles (objects without tiles).
+func (tilemap *TileMap) GetMarkerRect(object *TileMapObject) (Rect, error) {
+	if object.Index != 0 {
+		return Rect{}, fmt.Errorf("Marker object %d (%q) must be a rectangle, not a tile object", object.Id, object.Name)
+	}
+	if object.Rotation != 0 {
+		return Rect{}, fmt.Errorf("Marker object %d (%q) must not be rotated", object.Id, object.Name)
+	}
+	if object.Width <= 0 || object.Height <= 0 {
+		return Rect{}, fmt.Errorf("Marker object %d (%q) has an invalid size: %vx%v", object.Id, object.Name, object.Width, object.Height)
+	}
+	return Rect{
+		X:      object.X / float32(tilemap.Tilewidth),
+		Y:      object.Y / float32(tilemap.Tileheight),
+		Width:  object.Width / float32(tilemap.Tilewidth),
+		Height: object.Height / float32(tilemap.Tileheight),
+	}, nil
+}
+
+// GetMarkerPosition returns the position of a point marker, or the center of a rectangle marker, in tile-units
+func (tilemap *TileMap) GetMarkerPosition(object *TileMapObject) Point {
+	return Point{
+		X: (object.X + object.Width/2) / float32(tilemap.Tilewidth),
+		Y: (object.Y + object.Height/2) / float32(tilemap.Tileheight),
+	}
+}
+
+// GetMarkerPolyline returns the absolute points of a polyline marker object in tile-units
+func (tilemap *TileMap) GetMarkerPolyline(object *TileMapObject) ([]Point, error) {
+	if object.Polyline == nil {
+		return nil, fmt.Errorf("Marker object %d (%q) must be a polyline", object.Id, object.Name)
+	}
+	if object.Rotation != 0 {
+		return nil, fmt.Errorf("Marker object %d (%q) must not be rotated", object.Id, object.Name)
+	}
+
+	points := make([]Point, 0)
+	for _, pair := range strings.Fields(object.Polyline.Points) {
+		coords := strings.Split(pair, ",")
+		if len(coords) != 2 {
+			return nil, fmt.Errorf("Marker object %d (%q) has an invalid polyline point: %q", object.Id, object.Name, pair)
+		}
+		x, errX := strconv.ParseFloat(coords[0], 32)
+		y, errY := strconv.ParseFloat(coords[1], 32)
+		if errX != nil || errY != nil {
+			return nil, fmt.Errorf("Marker object %d (%q) has an invalid polyline point: %q", object.Id, object.Name, pair)
+		}
+		points = append(points, Point{
+			X: (object.X + float32(x)) / float32(tilemap.Tilewidth),
+			Y: (object.Y + float32(y)) / float32(tilemap.Tileheight),
+		})
+	}
+	return points, nil
+}
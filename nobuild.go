@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// ExtractNoBuildZones collects all areas where players must not construct buildings.
+// Zones are authored as rectangle objects with the type 'no_build' inside the 'Markers' object layer, and/or
+// by painting any tile into the optional tile layer 'noBuild'. The overlay layer is removed from the tilemap afterwards.
+// All zones are returned as rectangles in tiles, aligned to the tile grid.
+func ExtractNoBuildZones(tilemap *TileMap) ([]Rect, error) {
+	zones := make([]Rect, 0)
+
+	for _, object := range tilemap.GetMarkers("no_build") {
+		rect, err := tilemap.GetMarkerRect(object)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid no-build zone: %v", err)
+		}
+		x0, y0 := math.Floor(float64(rect.X)), math.Floor(float64(rect.Y))
+		x1, y1 := math.Ceil(float64(rect.X+rect.Width)), math.Ceil(float64(rect.Y+rect.Height))
+		if x0 < 0 || y0 < 0 || int(x1) > tilemap.Width || int(y1) > tilemap.Height {
+			return nil, fmt.Errorf("Invalid no-build zone %d (%q): The zone exceeds the map boundaries", object.Id, object.Name)
+		}
+		zones = append(zones, Rect{X: float32(x0), Y: float32(y0), Width: float32(x1 - x0), Height: float32(y1 - y0)})
+	}
+
+	layerIdx := -1
+	for idx, layer := range tilemap.Layers {
+		if layer.Name != "noBuild" {
+			continue
+		}
+		if layerIdx != -1 {
+			return nil, fmt.Errorf("Multiple layers with name 'noBuild' found")
+		}
+		layerIdx = idx
+	}
+	if layerIdx == -1 {
+		return zones, nil
+	}
+	return append(zones, overlayToRects(tilemap.Width, tilemap.Height, &tilemap.Layers[layerIdx])...), nil
+}
+
+// overlayToRects converts all non-empty tiles of the layer into as few rectangles as possible (without being optimal):
+// Horizontal runs of tiles are merged with identical runs of the rows below.
+func overlayToRects(width, height int, layer *TileMapLayer) []Rect {
+	var runs []BorderLine
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if layer.Tiles[y*width+x].Index != 0 {
+				runs = extendLine(runs, x, y)
+			}
+		}
+	}
+
+	rects := make([]Rect, 0)
+	open := make(map[[2]int]int) // [startX, length] -> index of the rect that ended in the previous row
+	for _, run := range runs {
+		key := [2]int{run.StartX, run.Length}
+		if idx, ok := open[key]; ok && int(rects[idx].Y+rects[idx].Height) == run.StartY {
+			rects[idx].Height++
+			continue
+		}
+		open[key] = len(rects)
+		rects = append(rects, Rect{X: float32(run.StartX), Y: float32(run.StartY), Width: float32(run.Length), Height: 1})
+	}
+	return rects
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseLocaleFloat parses a float that might have been written with a comma as decimal separator ("12,5"),
+// optionally with dots as thousands separators ("1.234,5"). Returns true if the value was not in the standard format.
+func ParseLocaleFloat(value string) (float32, bool, error) {
+	value = strings.TrimSpace(value)
+	if f, err := strconv.ParseFloat(value, 32); err == nil {
+		return float32(f), false, nil
+	}
+	if strings.Count(value, ",") == 1 {
+		converted := strings.Replace(strings.Replace(value, ".", "", -1), ",", ".", 1)
+		if f, err := strconv.ParseFloat(converted, 32); err == nil {
+			return float32(f), true, nil
+		}
+	}
+	return 0, false, fmt.Errorf("Invalid number %q", value)
+}
+
+// UnmarshalXML decodes an object. The numeric attributes are parsed with ParseLocaleFloat, because some third-party tools
+// export them with a comma as decimal separator. Such attributes are accepted with a warning.
+func (object *TileMapObject) UnmarshalXML(decoder *xml.Decoder, start xml.StartElement) error {
+	type plainObject TileMapObject // without methods, to prevent recursion
+	var raw struct {
+		plainObject
+		X        string `xml:"x,attr"`
+		Y        string `xml:"y,attr"`
+		Width    string `xml:"width,attr"`
+		Height   string `xml:"height,attr"`
+		Rotation string `xml:"rotation,attr"`
+	}
+	if err := decoder.DecodeElement(&raw, &start); err != nil {
+		return err
+	}
+	*object = TileMapObject(raw.plainObject)
+
+	var invalid []string
+	for _, attr := range []struct {
+		name  string
+		value string
+		field *float32
+	}{
+		{"x", raw.X, &object.X},
+		{"y", raw.Y, &object.Y},
+		{"width", raw.Width, &object.Width},
+		{"height", raw.Height, &object.Height},
+		{"rotation", raw.Rotation, &object.Rotation},
+	} {
+		if attr.value == "" {
+			continue
+		}
+		value, localized, err := ParseLocaleFloat(attr.value)
+		if err != nil {
+			invalid = append(invalid, fmt.Sprintf("%s=%q", attr.name, attr.value))
+			continue
+		}
+		if localized {
+			log.Warningf("Object %d (%q): The attribute '%s' uses a comma as decimal separator (%q). Reading it as %v", object.Id, object.Name, attr.name, attr.value, value)
+		}
+		*attr.field = value
+	}
+	if len(invalid) > 0 {
+		return fmt.Errorf("Object %d (%q) has invalid numeric attributes: %s", object.Id, object.Name, strings.Join(invalid, ", "))
+	}
+	return nil
+}
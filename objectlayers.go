@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ObjectLayerRole defines what an object layer is used for
+type ObjectLayerRole int
+
+const (
+	ObjectLayer_Background ObjectLayerRole = iota
+	ObjectLayer_Foreground
+	ObjectLayer_Markers
+)
+
+var objectLayerRoleNames = []string{
+	ObjectLayer_Background: "background",
+	ObjectLayer_Foreground: "foreground",
+	ObjectLayer_Markers:    "markers",
+}
+
+// ObjectLayerNames maps the (lower case) names of object layers to their roles. Multiple names can have the same role,
+// but a map can only contain one layer per role.
+type ObjectLayerNames map[string]ObjectLayerRole
+
+// DefaultObjectLayerNames are used for all roles that are not configured with -object-layers
+var DefaultObjectLayerNames = ObjectLayerNames{
+	"backgroundobjects": ObjectLayer_Background,
+	"foregroundobjects": ObjectLayer_Foreground,
+	"markers":           ObjectLayer_Markers,
+}
+
+// ParseObjectLayerNames parses the -object-layers option, eg. "background=Back,background=Behind,foreground=Front".
+// Configured roles replace the default layer names of that role.
+func ParseObjectLayerNames(value string) (ObjectLayerNames, error) {
+	configured := make(ObjectLayerNames)
+	roles := make(map[ObjectLayerRole]bool)
+	for _, entry := range strings.Split(value, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		name := strings.ToLower(strings.TrimSpace(parts[len(parts)-1]))
+		if len(parts) != 2 || name == "" {
+			return nil, fmt.Errorf("Invalid object layer name %q. Expected <role>=<layer name>", entry)
+		}
+		role, ok := objectLayerRoleByName(strings.TrimSpace(parts[0]))
+		if !ok {
+			return nil, fmt.Errorf("Unknown object layer role %q. Allowed values: %s", parts[0], strings.Join(objectLayerRoleNames, ", "))
+		}
+		if previous, ok := configured[name]; ok && previous != role {
+			return nil, fmt.Errorf("The object layer name %q is used for %s and %s", name, objectLayerRoleNames[previous], objectLayerRoleNames[role])
+		}
+		configured[name] = role
+		roles[role] = true
+	}
+
+	names := make(ObjectLayerNames)
+	for name, role := range DefaultObjectLayerNames {
+		if _, ok := configured[name]; !roles[role] && !ok {
+			names[name] = role
+		}
+	}
+	for name, role := range configured {
+		names[name] = role
+	}
+	return names, nil
+}
+
+func objectLayerRoleByName(name string) (ObjectLayerRole, bool) {
+	for role, roleName := range objectLayerRoleNames {
+		if strings.EqualFold(name, roleName) {
+			return ObjectLayerRole(role), true
+		}
+	}
+	return 0, false
+}
+
+// RouteObjectLayers assigns all object layers of the map to the background, foreground or marker layer.
+// nil names use DefaultObjectLayerNames.
+func RouteObjectLayers(tilemap *TileMap, names ObjectLayerNames) error {
+	if names == nil {
+		names = DefaultObjectLayerNames
+	}
+	targets := []**TileMapObjectLayer{
+		ObjectLayer_Background: &tilemap.BackgroundObjectLayer,
+		ObjectLayer_Foreground: &tilemap.ForegroundObjectLayer,
+		ObjectLayer_Markers:    &tilemap.MarkerObjectLayer,
+	}
+
+	for idx := range tilemap.ObjectLayers {
+		objectLayer := &tilemap.ObjectLayers[idx]
+		role, ok := names[strings.ToLower(objectLayer.Name)]
+		if !ok {
+			return fmt.Errorf("Invalid TileMap: Unsupported object layer %q. Allowed object layers: %s (see -object-layers)", objectLayer.Name, names)
+		}
+		target := targets[role]
+		if *target != nil {
+			return fmt.Errorf("Invalid TileMap: The object layers %q and %q are both %s layers. Only one layer is supported", (*target).Name, objectLayer.Name, objectLayerRoleNames[role])
+		}
+		*target = objectLayer
+	}
+	return nil
+}
+
+// String lists the layer names per role, eg. "'backgroundobjects' (background), 'markers' (markers)"
+func (names ObjectLayerNames) String() string {
+	var entries []string
+	for name, role := range names {
+		entries = append(entries, fmt.Sprintf("'%s' (%s)", name, objectLayerRoleNames[role]))
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, ", ")
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// Center returns the object's center in pixels. Tiled uses the bottom-left corner of tile objects as their position
+// and rotates them around it.
+func (object *TileMapObject) Center() (float32, float32) {
+	rotatedCenterX, rotatedCenterY := object.rotatedHalfSize()
+	return object.X + rotatedCenterX, object.Y - rotatedCenterY // objects have an inverted coordinate system (up = positive)
+}
+
+// SetCenter moves the object so that its center is at the given position
+func (object *TileMapObject) SetCenter(centerX, centerY float32) {
+	rotatedCenterX, rotatedCenterY := object.rotatedHalfSize()
+	object.X = centerX - rotatedCenterX
+	object.Y = centerY + rotatedCenterY
+}
+
+func (object *TileMapObject) rotatedHalfSize() (float32, float32) {
+	localCenterX := object.Width / 2
+	localCenterY := object.Height / 2
+	cosRot := float32(math.Cos(float64(-object.Rotation) / 180 * math.Pi))
+	sinRot := float32(math.Sin(float64(-object.Rotation) / 180 * math.Pi))
+
+	return localCenterX*cosRot - localCenterY*sinRot, localCenterX*sinRot + localCenterY*cosRot
+}
+
+// NormalizeObjectTransforms prepares the tile objects of a layer for encoding:
+// Diagonal flips are replaced by an equivalent rotation and horizontal flip, rotations are normalized into [0, 360)
+// and snapped to multiples of rotationStep (degrees, 0 = no snapping). Snapping rotates objects around their center.
+func NormalizeObjectTransforms(layer *TileMapObjectLayer, rotationStep float32) error {
+	if layer == nil {
+		return nil
+	}
+	if rotationStep < 0 || rotationStep > 360 {
+		return fmt.Errorf("The rotation step must be within [0, 360], but is %v", rotationStep)
+	}
+
+	for i := range layer.Objects {
+		object := &layer.Objects[i]
+		if object.TileSet == nil {
+			continue
+		}
+
+		rotation := object.Rotation
+		width, height := object.Width, object.Height
+		flags := object.Flags
+
+		if flags&0x04 != 0 {
+			// A diagonal flip (transpose) equals a horizontal flip followed by a rotation of -90°.
+			// Flips that are applied afterwards invert the rotation direction.
+			if PopCount(flags&0x03)%2 == 0 {
+				rotation -= 90
+			} else {
+				rotation += 90
+			}
+			flags = (flags ^ 0x01) &^ 0x04
+			width, height = height, width // the rotation swaps the object's extents
+			log.Debugf("Converted the diagonal flip of object %d (layer=%q) into a rotation of %v°", object.Id, layer.Name, rotation-object.Rotation)
+		}
+
+		if rotationStep > 0 {
+			rotation = float32(math.Round(float64(rotation/rotationStep))) * rotationStep
+		}
+		rotation = float32(math.Mod(float64(rotation), 360))
+		if rotation < 0 {
+			rotation += 360
+		}
+
+		if rotation == object.Rotation && flags == object.Flags {
+			continue
+		}
+		centerX, centerY := object.Center()
+		object.Rotation = rotation
+		object.Width, object.Height = width, height
+		object.Flags = flags
+		object.SetCenter(centerX, centerY)
+	}
+	return nil
+}
+
+// ObjectBoundsPolicy defines what happens with objects that are (partially) outside of the map
+type ObjectBoundsPolicy int
+
+const (
+	ObjectBounds_Keep  ObjectBoundsPolicy = iota // warn, but encode the object as-is
+	ObjectBounds_Clamp                           // move the object into the map
+	ObjectBounds_Drop                            // remove the object
+	ObjectBounds_Error                           // fail the conversion
+)
+
+// ParseObjectBoundsPolicy parses the -out-of-bounds option
+func ParseObjectBoundsPolicy(policy string) (ObjectBoundsPolicy, error) {
+	switch policy {
+	case "keep":
+		return ObjectBounds_Keep, nil
+	case "clamp":
+		return ObjectBounds_Clamp, nil
+	case "drop":
+		return ObjectBounds_Drop, nil
+	case "error":
+		return ObjectBounds_Error, nil
+	}
+	return 0, fmt.Errorf("Unknown out-of-bounds policy %q. Allowed values: keep, clamp, drop, error", policy)
+}
+
+// Bounds returns the axis-aligned bounding box of the (rotated) object in pixels
+func (object *TileMapObject) Bounds() (minX, minY, maxX, maxY float32) {
+	centerX, centerY := object.Center()
+	cosRot := math.Abs(math.Cos(float64(object.Rotation) / 180 * math.Pi))
+	sinRot := math.Abs(math.Sin(float64(object.Rotation) / 180 * math.Pi))
+	halfWidth := math.Abs(float64(object.Width)) / 2
+	halfHeight := math.Abs(float64(object.Height)) / 2
+
+	extentX := float32(halfWidth*cosRot + halfHeight*sinRot)
+	extentY := float32(halfWidth*sinRot + halfHeight*cosRot)
+	return centerX - extentX, centerY - extentY, centerX + extentX, centerY + extentY
+}
+
+// ApplyObjectBoundsPolicy reports all tile objects of the layer that are not completely inside the map and handles them according to the policy
+func ApplyObjectBoundsPolicy(tilemap *TileMap, layer *TileMapObjectLayer, policy ObjectBoundsPolicy) error {
+	if layer == nil {
+		return nil
+	}
+	mapWidth := float32(tilemap.Width * tilemap.Tilewidth)
+	mapHeight := float32(tilemap.Height * tilemap.Tileheight)
+
+	objects := layer.Objects[:0]
+	for _, object := range layer.Objects {
+		minX, minY, maxX, maxY := object.Bounds()
+		if object.TileSet == nil || (minX >= 0 && minY >= 0 && maxX <= mapWidth && maxY <= mapHeight) {
+			objects = append(objects, object)
+			continue
+		}
+
+		description := fmt.Sprintf("The object %d (layer=%q) is outside of the map (bounds: %.0f, %.0f - %.0f, %.0f; map size: %.0f x %.0f)",
+			object.Id, layer.Name, minX, minY, maxX, maxY, mapWidth, mapHeight)
+
+		switch policy {
+		case ObjectBounds_Keep:
+			log.Warning(description)
+			objects = append(objects, object)
+		case ObjectBounds_Clamp:
+			centerX, centerY := object.Center()
+			centerX += clampOffset(minX, maxX, mapWidth)
+			centerY += clampOffset(minY, maxY, mapHeight)
+			object.SetCenter(centerX, centerY)
+			log.Warningf("%s. It was moved into the map", description)
+			objects = append(objects, object)
+		case ObjectBounds_Drop:
+			log.Warningf("%s. It was removed", description)
+		case ObjectBounds_Error:
+			return fmt.Errorf("Invalid map: %s", description)
+		}
+	}
+	layer.Objects = objects
+	return nil
+}
+
+// clampOffset returns how far the range [min, max] needs to be moved to lie within [0, size].
+// Ranges that are larger than size are centered.
+func clampOffset(min, max, size float32) float32 {
+	switch {
+	case max-min > size:
+		return size/2 - (min+max)/2
+	case min < 0:
+		return -min
+	case max > size:
+		return size - max
+	}
+	return 0
+}
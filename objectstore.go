@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// IsObjectStoreURL returns true if the path points to an object store (s3://bucket/key or gs://bucket/key)
+func IsObjectStoreURL(target string) bool {
+	return strings.HasPrefix(target, "s3://") || strings.HasPrefix(target, "gs://")
+}
+
+// NewObjectStoreRequest creates a signed request for reading (GET) or writing (PUT) an object.
+// Credentials are taken from the environment:
+// S3 uses AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN (optional), AWS_REGION and AWS_ENDPOINT_URL (optional),
+// GCS uses GOOGLE_OAUTH_ACCESS_TOKEN.
+func NewObjectStoreRequest(method, target string, data []byte) (*http.Request, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid object-store URL %q: %v", target, err)
+	}
+	bucket, key := u.Host, strings.TrimPrefix(u.Path, "/")
+	if bucket == "" || key == "" {
+		return nil, fmt.Errorf("Invalid object-store URL %q: Expected <scheme>://<bucket>/<key>", target)
+	}
+
+	switch u.Scheme {
+	case "s3":
+		return newS3Request(method, bucket, key, data)
+	case "gs":
+		return newGCSRequest(method, bucket, key, data)
+	}
+	return nil, fmt.Errorf("Unsupported object-store URL %q", target)
+}
+
+func newS3Request(method, bucket, key string, data []byte) (*http.Request, error) {
+	accessKey := os.Getenv("AWS_ACCESS_KEY_ID")
+	secretKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKey == "" || secretKey == "" {
+		return nil, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set")
+	}
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	var objectURL string
+	if endpoint := os.Getenv("AWS_ENDPOINT_URL"); endpoint != "" { // e.g. minio: path-style addressing
+		objectURL = strings.TrimSuffix(endpoint, "/") + "/" + bucket + "/" + s3EscapePath(key)
+	} else {
+		objectURL = fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucket, region, s3EscapePath(key))
+	}
+
+	req, err := http.NewRequest(method, objectURL, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	signS3Request(req, data, region, accessKey, secretKey, os.Getenv("AWS_SESSION_TOKEN"), time.Now().UTC())
+	return req, nil
+}
+
+func newGCSRequest(method, bucket, key string, data []byte) (*http.Request, error) {
+	token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN")
+	if token == "" {
+		return nil, fmt.Errorf("GOOGLE_OAUTH_ACCESS_TOKEN must be set")
+	}
+
+	objectURL := fmt.Sprintf("https://storage.googleapis.com/%s/%s", bucket, s3EscapePath(key))
+	req, err := http.NewRequest(method, objectURL, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if method == "PUT" {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	return req, nil
+}
+
+// remoteClient is used for all downloads and uploads. Unlike http.DefaultClient, it doesn't wait forever for a server.
+var remoteClient = &http.Client{Timeout: RemoteTimeout}
+
+// doObjectStoreRequest executes the request and returns an error if the response isn't successful
+func doObjectStoreRequest(req *http.Request) (*http.Response, error) {
+	resp, err := remoteClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
+
+// signS3Request adds an AWS signature (version 4) to the request
+func signS3Request(req *http.Request, payload []byte, region, accessKey, secretKey, sessionToken string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(payload)
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+	if sessionToken != "" {
+		req.Header.Set("x-amz-security-token", sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		if strings.HasPrefix(strings.ToLower(name), "x-amz-") {
+			headers[strings.ToLower(name)] = strings.TrimSpace(req.Header.Get(name))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders string
+	for _, name := range names {
+		canonicalHeaders += name + ":" + headers[name] + "\n"
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	signingKey := hmacSHA256([]byte("AWS4"+secretKey), date)
+	signingKey = hmacSHA256(signingKey, region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+// s3EscapePath escapes every character of the object key except the unreserved ones and '/'
+func s3EscapePath(key string) string {
+	var escaped strings.Builder
+	for _, b := range []byte(key) {
+		if (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9') ||
+			b == '-' || b == '_' || b == '.' || b == '~' || b == '/' {
+			escaped.WriteByte(b)
+		} else {
+			fmt.Fprintf(&escaped, "%%%02X", b)
+		}
+	}
+	return escaped.String()
+}
+
+func sha256Hex(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
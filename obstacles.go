@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Obstacle is a neutral, destructible object that blocks movement until it is destroyed.
+// Obstacles are authored as rectangle objects with the type 'obstacle' inside the 'Markers' object layer.
+// The rectangle is extended to full tiles, which must all be accessible.
+type Obstacle struct {
+	Type ObstacleType
+	Area Rect // in tiles, aligned to the tile grid
+	HP   float32
+}
+
+type ObstacleType uint8
+
+const (
+	ObstacleType_Rock   ObstacleType = 1
+	ObstacleType_Barrel ObstacleType = 2
+	ObstacleType_Crate  ObstacleType = 3
+)
+
+// ExtractObstacles reads all obstacle markers of the tilemap and validates that they don't block terrain or spawn points
+func ExtractObstacles(tilemap *TileMap, resources []ResourcePoint, waterdropSources []WaterdropSource, players []Player) ([]Obstacle, error) {
+	environmentLayerIdx, err := tilemap.GetLayer("environment")
+	if err != nil {
+		return nil, err
+	}
+	layer := &tilemap.Layers[environmentLayerIdx]
+
+	obstacles := make([]Obstacle, 0)
+	for _, object := range tilemap.GetMarkers("obstacle") {
+		var obstacle Obstacle
+
+		rect, err := tilemap.GetMarkerRect(object)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid obstacle: %v", err)
+		}
+		x0, y0 := math.Floor(float64(rect.X)), math.Floor(float64(rect.Y))
+		x1, y1 := math.Ceil(float64(rect.X+rect.Width)), math.Ceil(float64(rect.Y+rect.Height))
+		obstacle.Area = Rect{X: float32(x0), Y: float32(y0), Width: float32(x1 - x0), Height: float32(y1 - y0)}
+
+		obstacleType, _ := object.Properties.Get("obstacle")
+		switch strings.ToLower(obstacleType) {
+		case "rock":
+			obstacle.Type = ObstacleType_Rock
+		case "barrel":
+			obstacle.Type = ObstacleType_Barrel
+		case "crate":
+			obstacle.Type = ObstacleType_Crate
+		default:
+			return nil, fmt.Errorf("Invalid obstacle %d (%q): The property 'obstacle' must be 'rock', 'barrel' or 'crate', but is %q", object.Id, object.Name, obstacleType)
+		}
+
+		if obstacle.HP, err = object.Properties.GetFloat("hp", 0); err != nil {
+			return nil, fmt.Errorf("Invalid obstacle %d (%q): %v", object.Id, object.Name, err)
+		}
+		if obstacle.HP <= 0 {
+			return nil, fmt.Errorf("Invalid obstacle %d (%q): The property 'hp' must be positive", object.Id, object.Name)
+		}
+
+		for y := int(y0); y < int(y1); y++ {
+			for x := int(x0); x < int(x1); x++ {
+				tile, err := layer.GetTile(x, y, tilemap.Width, tilemap.Height)
+				if err != nil {
+					return nil, fmt.Errorf("Invalid obstacle %d (%q): %v", object.Id, object.Name, err)
+				}
+				if !tile.IsCompletelyAccessible() {
+					return nil, fmt.Errorf("Invalid obstacle %d (%q): The obstacle must only cover accessible tiles (x=%d, y=%d)", object.Id, object.Name, x, y)
+				}
+			}
+		}
+
+		for _, r := range resources {
+			if obstacle.Area.ContainsTile(r.SpawnX, r.SpawnY) {
+				return nil, fmt.Errorf("Invalid obstacle %d (%q): Overlaps the resource point at x=%d, y=%d", object.Id, object.Name, r.SpawnX, r.SpawnY)
+			}
+		}
+		for _, s := range waterdropSources {
+			if obstacle.Area.ContainsTile(s.SpawnX, s.SpawnY) {
+				return nil, fmt.Errorf("Invalid obstacle %d (%q): Overlaps the water drop source at x=%d, y=%d", object.Id, object.Name, s.SpawnX, s.SpawnY)
+			}
+		}
+		for i, p := range players {
+			for _, b := range p.Buildings {
+				if obstacle.Area.ContainsTile(b.SpawnX, b.SpawnY) {
+					return nil, fmt.Errorf("Invalid obstacle %d (%q): Overlaps a building of player %d at x=%d, y=%d", object.Id, object.Name, i, b.SpawnX, b.SpawnY)
+				}
+			}
+			for _, u := range p.Units {
+				if obstacle.Area.ContainsTile(u.SpawnX, u.SpawnY) {
+					return nil, fmt.Errorf("Invalid obstacle %d (%q): Overlaps a unit of player %d at x=%d, y=%d", object.Id, object.Name, i, u.SpawnX, u.SpawnY)
+				}
+			}
+		}
+
+		obstacles = append(obstacles, obstacle)
+	}
+	return obstacles, nil
+}
+
+// ComputeObstacleBorders returns the additional border lines of every obstacle, which exist as long as the obstacle isn't destroyed.
+// The obstacle is treated as completely solid terrain. Borders of the static terrain are not affected.
+func ComputeObstacleBorders(tilemap *TileMap, obstacles []Obstacle) ([]SortedBorderLines, error) {
+	environmentLayerIdx, err := tilemap.GetLayer("environment")
+	if err != nil {
+		return nil, err
+	}
+	layer := &tilemap.Layers[environmentLayerIdx]
+	solid := Tile{Index: 1}
+
+	// hasBorder checks if the obstacle has a border towards the neighbouring tile. Everything outside of the map is solid.
+	hasBorder := func(x, y int, side Orientation) bool {
+		neighbour, err := layer.GetTile(x, y, tilemap.Width, tilemap.Height)
+		if err != nil {
+			return false
+		}
+		return HasBorderTowards(solid, neighbour, side)
+	}
+
+	dynamicBorders := make([]SortedBorderLines, len(obstacles))
+	for i, obstacle := range obstacles {
+		x0, y0 := int(obstacle.Area.X), int(obstacle.Area.Y)
+		x1, y1 := x0+int(obstacle.Area.Width), y0+int(obstacle.Area.Height)
+		borders := &dynamicBorders[i]
+
+		// The same conventions as in ComputeBorderOfLayer apply
+		for _, run := range findBorderRuns(x0, x1, func(x int) bool { return hasBorder(x, y0-1, UP) }) {
+			borders.Right = append(borders.Right, BorderLine{StartX: run[0], StartY: y0, Length: run[1] - run[0]})
+		}
+		for _, run := range findBorderRuns(x0, x1, func(x int) bool { return hasBorder(x, y1, DOWN) }) {
+			borders.Left = append(borders.Left, BorderLine{StartX: run[1], StartY: y1, Length: run[1] - run[0]})
+		}
+		for _, run := range findBorderRuns(y0, y1, func(y int) bool { return hasBorder(x0-1, y, LEFT) }) {
+			borders.Up = append(borders.Up, BorderLine{StartX: x0, StartY: run[1], Length: run[1] - run[0]})
+		}
+		for _, run := range findBorderRuns(y0, y1, func(y int) bool { return hasBorder(x1, y, RIGHT) }) {
+			borders.Down = append(borders.Down, BorderLine{StartX: x1, StartY: run[0], Length: run[1] - run[0]})
+		}
+	}
+	return dynamicBorders, nil
+}
+
+// findBorderRuns returns the [start, end) ranges within [from, to) for which hasBorder is true
+func findBorderRuns(from, to int, hasBorder func(i int) bool) [][2]int {
+	runs := make([][2]int, 0)
+	start := -1
+	for i := from; i <= to; i++ {
+		if i < to && hasBorder(i) {
+			if start == -1 {
+				start = i
+			}
+		} else if start != -1 {
+			runs = append(runs, [2]int{start, i})
+			start = -1
+		}
+	}
+	return runs
+}
@@ -0,0 +1,245 @@
+package main
+
+import "fmt"
+
+// CoordinateOrigin defines where the origin of the encoded coordinates (spawns, borders, marker areas, ...) is
+type CoordinateOrigin int
+
+const (
+	Origin_TopLeft    CoordinateOrigin = iota // y points down (Tiled's convention)
+	Origin_BottomLeft                         // y points up
+)
+
+// ParseCoordinateOrigin parses the -origin option
+func ParseCoordinateOrigin(origin string) (CoordinateOrigin, error) {
+	switch origin {
+	case "top-left":
+		return Origin_TopLeft, nil
+	case "bottom-left":
+		return Origin_BottomLeft, nil
+	}
+	return 0, fmt.Errorf("Unknown coordinate origin %q. Allowed values: top-left, bottom-left", origin)
+}
+
+// ToBottomLeftOrigin converts spawn coordinates and borders of a map with the given height into a bottom-left origin (y up).
+//
+// Spawn coordinates address tiles, so tile y becomes height-1-y. Resource anchors are positions, so their y becomes height-y.
+// Borders are located on the grid between tiles, so their y becomes height-y.
+// Directions are not affected: a border pointing up (on screen) is still stored as 'Up' and its solid side stays the same.
+// Per-tile data (layers, tile flags, the wind field) is always stored row by row from the top.
+// Water, navigation, debug warnings, markers, objects, wind vectors, image layers and layer offsets are converted by the other *ToBottomLeftOrigin functions.
+func ToBottomLeftOrigin(height int, resources []ResourcePoint, waterdropSources []WaterdropSource, players []Player, borders SortedBorderLines) ([]ResourcePoint, []WaterdropSource, []Player, SortedBorderLines) {
+	flippedResources := make([]ResourcePoint, len(resources))
+	for i, resource := range resources {
+		resource.SpawnY = height - 1 - resource.SpawnY
+		if resource.Anchor != nil {
+			resource.Anchor = &Point{resource.Anchor.X, float32(height) - resource.Anchor.Y}
+		}
+		flippedResources[i] = resource
+	}
+
+	flippedSources := make([]WaterdropSource, len(waterdropSources))
+	for i, source := range waterdropSources {
+		source.SpawnY = height - 1 - source.SpawnY
+		flippedSources[i] = source
+	}
+
+	flippedPlayers := make([]Player, len(players))
+	for i, player := range players {
+		player.Buildings = append([]Building(nil), player.Buildings...)
+		for b := range player.Buildings {
+			player.Buildings[b].SpawnY = height - 1 - player.Buildings[b].SpawnY
+		}
+		player.Units = append([]Unit(nil), player.Units...)
+		for u := range player.Units {
+			player.Units[u].SpawnY = height - 1 - player.Units[u].SpawnY
+		}
+		flippedPlayers[i] = player
+	}
+
+	return flippedResources, flippedSources, flippedPlayers, BordersToBottomLeftOrigin(height, borders)
+}
+
+// WaterToBottomLeftOrigin returns a copy of the water volumes with a bottom-left origin.
+// Spans address tile rows (y becomes height-1-y), surface lines are located on the grid (y becomes height-y).
+func WaterToBottomLeftOrigin(height int, volumes []WaterVolume) []WaterVolume {
+	flipped := make([]WaterVolume, len(volumes))
+	for i, volume := range volumes {
+		volume.Spans = append([]BorderLine(nil), volume.Spans...)
+		for s := range volume.Spans {
+			volume.Spans[s].StartY = height - 1 - volume.Spans[s].StartY
+		}
+		volume.Surface = append([]BorderLine(nil), volume.Surface...)
+		for s := range volume.Surface {
+			volume.Surface[s].StartY = height - volume.Surface[s].StartY
+		}
+		flipped[i] = volume
+	}
+	return flipped
+}
+
+// NavigationToBottomLeftOrigin returns a copy of the connectivity graph with a bottom-left origin.
+// Region spans address tile rows (y becomes height-1-y), connectors are positions (y becomes height-y).
+func NavigationToBottomLeftOrigin(height int, graph ConnectivityGraph) ConnectivityGraph {
+	flipped := ConnectivityGraph{
+		Regions:    make([][]BorderLine, len(graph.Regions)),
+		Connectors: make([]Connector, len(graph.Connectors)),
+	}
+	for r, spans := range graph.Regions {
+		flipped.Regions[r] = make([]BorderLine, len(spans))
+		for s, span := range spans {
+			span.StartY = height - 1 - span.StartY
+			flipped.Regions[r][s] = span
+		}
+	}
+	for c, connector := range graph.Connectors {
+		connector.From.Y = float32(height) - connector.From.Y
+		connector.To.Y = float32(height) - connector.To.Y
+		flipped.Connectors[c] = connector
+	}
+	return flipped
+}
+
+// BordersToBottomLeftOrigin returns a copy of the borders with a bottom-left origin (see ToBottomLeftOrigin)
+func BordersToBottomLeftOrigin(height int, borders SortedBorderLines) SortedBorderLines {
+	flipLines := func(lines []BorderLine) []BorderLine {
+		flipped := make([]BorderLine, len(lines))
+		for i, line := range lines {
+			line.StartY = height - line.StartY
+			flipped[i] = line
+		}
+		return flipped
+	}
+	return SortedBorderLines{
+		Left:      flipLines(borders.Left),
+		Right:     flipLines(borders.Right),
+		Up:        flipLines(borders.Up),
+		Down:      flipLines(borders.Down),
+		UpLeft:    flipLines(borders.UpLeft),
+		UpRight:   flipLines(borders.UpRight),
+		DownLeft:  flipLines(borders.DownLeft),
+		DownRight: flipLines(borders.DownRight),
+	}
+}
+
+// MarkersToBottomLeftOrigin replaces the areas and positions that were read from markers with copies that use a bottom-left origin.
+// Areas keep their size, their position becomes the bottom-left corner (y becomes height-y-areaHeight).
+// Positions are not tile indices, so their y becomes height-y.
+func MarkersToBottomLeftOrigin(tilemap *TileMap) {
+	height := float32(tilemap.Height)
+	flipRect := func(rect Rect) Rect {
+		rect.Y = height - rect.Y - rect.Height
+		return rect
+	}
+	flipRects := func(rects []Rect) []Rect {
+		flipped := make([]Rect, len(rects))
+		for i, rect := range rects {
+			flipped[i] = flipRect(rect)
+		}
+		return flipped
+	}
+	flipPoint := func(point Point) Point {
+		point.Y = height - point.Y
+		return point
+	}
+
+	obstacles := make([]Obstacle, len(tilemap.Obstacles))
+	for i, obstacle := range tilemap.Obstacles {
+		obstacle.Area = flipRect(obstacle.Area)
+		obstacles[i] = obstacle
+	}
+	tilemap.Obstacles = obstacles
+
+	hazards := make([]Hazard, len(tilemap.Hazards))
+	for i, hazard := range tilemap.Hazards {
+		hazard.Area = flipRect(hazard.Area)
+		hazards[i] = hazard
+	}
+	tilemap.Hazards = hazards
+
+	checkpoints := make([]Checkpoint, len(tilemap.Checkpoints))
+	for i, checkpoint := range tilemap.Checkpoints {
+		checkpoint.Area = flipRect(checkpoint.Area)
+		checkpoints[i] = checkpoint
+	}
+	tilemap.Checkpoints = checkpoints
+
+	tilemap.NoBuild = flipRects(tilemap.NoBuild)
+	tilemap.Victory.Hills = flipRects(tilemap.Victory.Hills)
+
+	paths := make([]CameraPath, len(tilemap.CameraPaths))
+	for i, path := range tilemap.CameraPaths {
+		path.Points = append([]CameraPathPoint(nil), path.Points...)
+		for p := range path.Points {
+			path.Points[p].Position = flipPoint(path.Points[p].Position)
+		}
+		paths[i] = path
+	}
+	tilemap.CameraPaths = paths
+
+	hints := make([]AIHint, len(tilemap.AIHints))
+	for i, hint := range tilemap.AIHints {
+		hint.Position = flipPoint(hint.Position)
+		hints[i] = hint
+	}
+	tilemap.AIHints = hints
+}
+
+// ObjectsToBottomLeftOrigin replaces the background and foreground object layers with copies whose objects use a bottom-left origin.
+// The object centers are positions, so their y becomes height-y. Rotations and flips are not affected.
+func ObjectsToBottomLeftOrigin(tilemap *TileMap) {
+	flipLayer := func(layer *TileMapObjectLayer) *TileMapObjectLayer {
+		if layer == nil {
+			return nil
+		}
+		flipped := *layer
+		flipped.Objects = append([]TileMapObject(nil), layer.Objects...)
+		for i := range flipped.Objects {
+			object := &flipped.Objects[i]
+			if object.TileSet == nil {
+				continue // rejected by the encoder
+			}
+			// The encoder stores the center in tiles of the object's tileset
+			centerX, centerY := object.Center()
+			object.SetCenter(centerX, float32(tilemap.Height*object.TileSet.TileHeight)-centerY)
+		}
+		return &flipped
+	}
+	tilemap.BackgroundObjectLayer = flipLayer(tilemap.BackgroundObjectLayer)
+	tilemap.ForegroundObjectLayer = flipLayer(tilemap.ForegroundObjectLayer)
+}
+
+// WindToBottomLeftOrigin returns a copy of the wind field with a bottom-left origin.
+// The tiles are still stored row by row from the top, but the vectors point up if their y is positive.
+func WindToBottomLeftOrigin(field WindField) WindField {
+	if field == nil {
+		return nil
+	}
+	flipped := make(WindField, len(field))
+	for i, vec := range field {
+		flipped[i] = WindVector{vec.X, -vec.Y}
+	}
+	return flipped
+}
+
+// ImageLayersToBottomLeftOrigin returns a copy of the image layers with a bottom-left origin.
+// Like marker areas, the position becomes the bottom-left corner of the image (y becomes height-y-imageHeight).
+// If the size of the image is unknown, y becomes height-y (the top edge).
+func ImageLayersToBottomLeftOrigin(height, tileHeight int, layers []ImageLayer) []ImageLayer {
+	flipped := make([]ImageLayer, len(layers))
+	for i, layer := range layers {
+		layer.Y = float32(height) - layer.Y - float32(layer.Height)/float32(tileHeight)
+		flipped[i] = layer
+	}
+	return flipped
+}
+
+// LayerOffsetsToBottomLeftOrigin returns a copy of the layer offsets with a bottom-left origin.
+// Offsets are vectors, so their y is negated. Objects of offset object layers are already moved (see ApplyObjectLayerOffsets).
+func LayerOffsetsToBottomLeftOrigin(offsets []LayerOffset) []LayerOffset {
+	flipped := make([]LayerOffset, len(offsets))
+	for i, offset := range offsets {
+		flipped[i] = LayerOffset{offset.X, -offset.Y}
+	}
+	return flipped
+}
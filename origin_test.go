@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// convertTestMapWithWind converts the test map with an additional wind region (blowing down-right) and returns the decoded result
+func convertTestMapWithWind(t *testing.T, origin string) *EncodedMap {
+	source, err := ioutil.ReadFile("resources/testMap.tmx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	markers := ` <objectgroup name="Markers">
+  <object id="900" type="wind" x="2560" y="2560" width="1024" height="768">
+   <properties>
+    <property name="direction" value="30"/>
+    <property name="strength" value="2"/>
+   </properties>
+  </object>
+ </objectgroup>
+</map>`
+	dir := t.TempDir()
+	mapFile := filepath.Join(dir, "wind.tmx")
+	if err := ioutil.WriteFile(mapFile, []byte(strings.Replace(string(source), "</map>", markers, 1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	target := filepath.Join(dir, origin+".tilemap")
+	if err := Run([]string{"-origin", origin, "-o", target, mapFile}, false); err != nil {
+		t.Fatalf("Failed to convert the map with origin %s: %v", origin, err)
+	}
+	encoded, err := LoadEncodedMap(target, binary.LittleEndian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encoded
+}
+
+// decodeWindSection returns the wind vectors of an encoded map (see encodeWindField)
+func decodeWindSection(t *testing.T, encoded *EncodedMap) []WindVector {
+	for _, section := range encoded.Sections {
+		if section.ID != Section_Wind {
+			continue
+		}
+		if len(section.Content) == 0 || section.Content[0] == 0x00 {
+			t.Fatal("The map has no wind")
+		}
+		content := section.Content[1:]
+		field := make([]WindVector, len(content)/8)
+		for i := range field {
+			field[i].X = float32(int32(binary.LittleEndian.Uint32(content[i*8:]))) / FixedPointScale
+			field[i].Y = float32(int32(binary.LittleEndian.Uint32(content[i*8+4:]))) / FixedPointScale
+		}
+		return field
+	}
+	t.Fatal("The map has no wind section")
+	return nil
+}
+
+func TestBottomLeftOriginFlipsObjectsAndWind(t *testing.T) {
+	topLeft := convertTestMapWithWind(t, "top-left")
+	bottomLeft := convertTestMapWithWind(t, "bottom-left")
+	height := float32(topLeft.Height)
+
+	// Fixed-point numbers are truncated, so the flipped values can differ in the last digit
+	const epsilon = 2.0 / FixedPointScale
+	equal := func(a, b float32) bool {
+		return math.Abs(float64(a-b)) <= epsilon
+	}
+
+	objectLayers := []struct {
+		name                string
+		topLeft, bottomLeft []EncodedObject
+	}{
+		{"background", topLeft.BackgroundObjects, bottomLeft.BackgroundObjects},
+		{"foreground", topLeft.ForegroundObjects, bottomLeft.ForegroundObjects},
+	}
+	for _, layer := range objectLayers {
+		if len(layer.topLeft) == 0 || len(layer.topLeft) != len(layer.bottomLeft) {
+			t.Fatalf("Unexpected number of %s objects: %d (top-left), %d (bottom-left)", layer.name, len(layer.topLeft), len(layer.bottomLeft))
+		}
+		for i, object := range layer.topLeft {
+			flipped := layer.bottomLeft[i]
+			if !equal(flipped.X, object.X) || !equal(flipped.Y, height-object.Y) || flipped.Rotation != object.Rotation ||
+				flipped.Width != object.Width || flipped.Height != object.Height {
+				t.Errorf("The %s object %d is not flipped: %+v (top-left), %+v (bottom-left)", layer.name, i, object, flipped)
+			}
+		}
+	}
+
+	topLeftWind, bottomLeftWind := decodeWindSection(t, topLeft), decodeWindSection(t, bottomLeft)
+	if len(topLeftWind) != topLeft.Width*topLeft.Height || len(bottomLeftWind) != len(topLeftWind) {
+		t.Fatalf("Unexpected size of the wind field: %d (top-left), %d (bottom-left)", len(topLeftWind), len(bottomLeftWind))
+	}
+	windyTiles := 0
+	for i, vec := range topLeftWind {
+		if vec.Y > 0 {
+			windyTiles++
+		}
+		if flipped := bottomLeftWind[i]; flipped.X != vec.X || flipped.Y != -vec.Y {
+			t.Fatalf("The wind vector of tile %d is not flipped: %+v (top-left), %+v (bottom-left)", i, vec, flipped)
+		}
+	}
+	if windyTiles != 4*3 {
+		t.Errorf("Expected wind blowing down on 12 tiles (top-left), got %d", windyTiles)
+	}
+}
+
+func TestImageLayersToBottomLeftOrigin(t *testing.T) {
+	layers := []ImageLayer{
+		{Name: "sized", X: 2, Y: 10, Width: 512, Height: 768}, // 2x3 tiles
+		{Name: "unknown size", X: 2, Y: 10},
+	}
+	flipped := ImageLayersToBottomLeftOrigin(100, 256, layers)
+	if flipped[0].X != 2 || flipped[0].Y != 87 {
+		t.Errorf("Expected the bottom-left corner of the image at (2, 87), got (%v, %v)", flipped[0].X, flipped[0].Y)
+	}
+	if flipped[1].X != 2 || flipped[1].Y != 90 {
+		t.Errorf("Expected the top edge of the image at (2, 90), got (%v, %v)", flipped[1].X, flipped[1].Y)
+	}
+	if layers[0].Y != 10 {
+		t.Error("The original image layers were modified")
+	}
+}
+
+func TestLayerOffsetsToBottomLeftOrigin(t *testing.T) {
+	offsets := []LayerOffset{{}, {X: 0.5, Y: 1.25}}
+	flipped := LayerOffsetsToBottomLeftOrigin(offsets)
+	if flipped[0] != (LayerOffset{}) || flipped[1] != (LayerOffset{X: 0.5, Y: -1.25}) {
+		t.Errorf("Unexpected offsets: %+v", flipped)
+	}
+}
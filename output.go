@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ResolveOutputTarget combines the output options (-o, -out-dir) with the name of the generated file.
+// If the output option is a URL ending with '/', the file name is appended to it. Files that were found in a directory
+// or with a pattern keep their relative path. Without output options, the file is stored next to the input file (see GetTargetFilePath).
+func ResolveOutputTarget(output, outputDir string, input InputFile) string {
+	defaultTarget := GetTargetFilePath(input.Path)
+	if outputDir != "" {
+		if input.Relative != "" {
+			return filepath.Join(outputDir, GetTargetFilePath(input.Relative))
+		}
+		return filepath.Join(outputDir, filepath.Base(defaultTarget))
+	}
+	if output == "" {
+		return defaultTarget
+	}
+	if IsOutputPrefix(output) {
+		if input.Relative != "" {
+			return output + filepath.ToSlash(GetTargetFilePath(input.Relative))
+		}
+		_, filename := path.Split(strings.Replace(defaultTarget, "\\", "/", -1))
+		return output + filename
+	}
+	return output
+}
+
+// IsOutputPrefix returns true if the output option (-o) is a prefix for the generated files instead of a single file
+func IsOutputPrefix(output string) bool {
+	return IsObjectStoreURL(output) && strings.HasSuffix(output, "/")
+}
+
+// WriteOutput writes the data to the target, which is either a local file, an object-store URL (see NewObjectStoreRequest)
+// or stdout ("-")
+func WriteOutput(target string, data []byte) error {
+	if err := writeOutput(target, data); err != nil {
+		return err
+	}
+	runEvents.Emit(Event{Event: Event_Artifact, File: target, Size: len(data)})
+	return nil
+}
+
+func writeOutput(target string, data []byte) error {
+	if target == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	if !IsObjectStoreURL(target) {
+		return writeLocalFile(target, data)
+	}
+
+	req, err := NewObjectStoreRequest("PUT", target, data)
+	if err != nil {
+		return fmt.Errorf("Failed to upload %q: %v", target, err)
+	}
+	resp, err := doObjectStoreRequest(req)
+	if err != nil {
+		return fmt.Errorf("Failed to upload %q: %v", target, err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// OutputNotWritableError is returned if the output location is read-only or locked (eg. by the running game)
+type OutputNotWritableError struct {
+	Target string
+	Err    error
+}
+
+func (err *OutputNotWritableError) Error() string {
+	return fmt.Sprintf("The output location '%s' is not writable: %v", err.Target, err.Err)
+}
+
+// CheckOutputWritable detects read-only output directories and locked output files before the conversion starts.
+// Object stores are not checked.
+func CheckOutputWritable(target string) error {
+	if IsObjectStoreURL(target) || target == "-" {
+		return nil
+	}
+	if err := createOutputDir(target); err != nil {
+		return err
+	}
+
+	probe, err := ioutil.TempFile(LongPath(filepath.Dir(target)), ".tilemap-probe-")
+	if err != nil {
+		return &OutputNotWritableError{target, err}
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+
+	// Opening the existing file for writing fails if it's read-only or locked by another process (Windows)
+	file, err := os.OpenFile(LongPath(target), os.O_WRONLY, 0)
+	if err != nil && !os.IsNotExist(err) {
+		return &OutputNotWritableError{target, err}
+	}
+	if file != nil {
+		file.Close()
+	}
+	return nil
+}
+
+// WriteOutputWithRetry calls WriteOutput and retries with an exponential backoff if the output is not writable.
+func WriteOutputWithRetry(target string, data []byte, retries int) error {
+	backoff := 250 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		err := WriteOutput(target, data)
+		if _, ok := err.(*OutputNotWritableError); !ok || attempt >= retries {
+			return err
+		}
+		log.Warningf("%v. Retrying in %v", err, backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// writeLocalFile writes the data into a temporary file first, which then replaces the target.
+// If anything goes wrong, the previous file stays untouched.
+func writeLocalFile(target string, data []byte) error {
+	if err := createOutputDir(target); err != nil {
+		return err
+	}
+	// The temporary name doesn't contain the target's name, which might already be close to the file name length limit
+	temp, err := ioutil.TempFile(LongPath(filepath.Dir(target)), ".tilemap-")
+	if err != nil {
+		return &OutputNotWritableError{target, err}
+	}
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		os.Remove(temp.Name())
+		return fmt.Errorf("Failed to write output file: %v", err)
+	}
+	if err := temp.Close(); err != nil {
+		os.Remove(temp.Name())
+		return fmt.Errorf("Failed to write output file: %v", err)
+	}
+	if err := os.Chmod(temp.Name(), 0644); err != nil {
+		os.Remove(temp.Name())
+		return fmt.Errorf("Failed to write output file: %v", err)
+	}
+
+	if err := os.Rename(temp.Name(), LongPath(target)); err != nil {
+		os.Remove(temp.Name())
+		return &OutputNotWritableError{target, err}
+	}
+	return nil
+}
+
+// createOutputDir creates the directory of the target file, if it doesn't exist yet
+func createOutputDir(target string) error {
+	if err := os.MkdirAll(LongPath(filepath.Dir(target)), 0755); err != nil {
+		return &OutputNotWritableError{target, err}
+	}
+	return nil
+}
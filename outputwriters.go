@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+// ConvertedMap is everything an output writer needs to know about a converted map.
+// Additional outputs (-outputs) always get positions in Tiled's coordinate system, the .tilemap writer gets them in the
+// coordinate system of the output (see -origin).
+type ConvertedMap struct {
+	TileMap          *TileMap
+	Resources        []ResourcePoint
+	WaterdropSources []WaterdropSource
+	Players          []Player
+	Borders          SortedBorderLines
+}
+
+// OutputWriter writes a converted map in a certain format.
+// Except for the .tilemap file itself, outputs are written next to the output file (see OutputTargetPath).
+type OutputWriter interface {
+	Name() string      // used to select the writer with -outputs
+	Extension() string // replaces the extension of the output file, eg. ".thumb.png"
+	Write(model *ConvertedMap, writer io.Writer, options ConvertOptions) error
+}
+
+// outputWriters is the registry of all available output writers, by name
+var outputWriters = make(map[string]OutputWriter)
+
+// RegisterOutputWriter makes an output writer available to -outputs. Must be called during initialization.
+func RegisterOutputWriter(writer OutputWriter) {
+	name := writer.Name()
+	if _, ok := outputWriters[name]; ok {
+		panic(fmt.Sprintf("Output writer %q is already registered", name))
+	}
+	outputWriters[name] = writer
+}
+
+// GetOutputWriter returns the registered output writer with the given name
+func GetOutputWriter(name string) (OutputWriter, error) {
+	writer, ok := outputWriters[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown output %q. Available outputs: %s", name, strings.Join(OutputWriterNames(), ", "))
+	}
+	return writer, nil
+}
+
+// OutputWriterNames returns the sorted names of all registered output writers
+func OutputWriterNames() []string {
+	names := make([]string, 0, len(outputWriters))
+	for name := range outputWriters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// OutputTargetPath returns the target of an output that is written next to the output file ("map.tilemap" -> "map.thumb.png")
+func OutputTargetPath(targetFile string, writer OutputWriter) string {
+	ext := path.Ext(targetFile)
+	return targetFile[:len(targetFile)-len(ext)] + writer.Extension()
+}
+
+func init() {
+	RegisterOutputWriter(TileMapWriter{})
+	RegisterOutputWriter(thumbnailPNGWriter{})
+	RegisterOutputWriter(spawnThumbnailWriter{})
+	RegisterOutputWriter(collisionSVGWriter{})
+}
+
+// TileMapWriter encodes the binary .tilemap format (see Encode). The map must use the encoder's coordinate system.
+type TileMapWriter struct {
+	Version uint8 // 0 = FormatVersion
+}
+
+func (TileMapWriter) Name() string      { return "tilemap" }
+func (TileMapWriter) Extension() string { return ".tilemap" }
+
+func (tilemapWriter TileMapWriter) Write(model *ConvertedMap, writer io.Writer, options ConvertOptions) error {
+	version := tilemapWriter.Version
+	if version == 0 {
+		version = FormatVersion
+	}
+	output := bufio.NewWriter(writer)
+	err := Encode(output, options.ByteOrder, version, options.EncodingFlags, model.TileMap, model.Resources, model.WaterdropSources, model.Players, model.Borders)
+	if err != nil {
+		return err
+	}
+	return output.Flush()
+}
+
+// thumbnailPNGWriter writes the lobby thumbnail as PNG (-thumbnail-png)
+type thumbnailPNGWriter struct{}
+
+func (thumbnailPNGWriter) Name() string      { return "thumbnail-png" }
+func (thumbnailPNGWriter) Extension() string { return ".thumb.png" }
+
+func (thumbnailPNGWriter) Write(model *ConvertedMap, writer io.Writer, options ConvertOptions) error {
+	if options.ThumbnailSize == 0 {
+		return fmt.Errorf("The thumbnail requires a thumbnail size greater than 0")
+	}
+	data, err := EncodeThumbnailPNG(model.TileMap.Thumbnail)
+	if err != nil {
+		return fmt.Errorf("Failed to encode thumbnail: %v", err)
+	}
+	_, err = writer.Write(data)
+	return err
+}
+
+// spawnThumbnailWriter writes a thumbnail with highlighted start positions and resource points (-spawn-thumbnail)
+type spawnThumbnailWriter struct{}
+
+func (spawnThumbnailWriter) Name() string      { return "spawn-thumbnail" }
+func (spawnThumbnailWriter) Extension() string { return ".spawns.png" }
+
+func (spawnThumbnailWriter) Write(model *ConvertedMap, writer io.Writer, options ConvertOptions) error {
+	size := options.SpawnThumbnail
+	if size == 0 {
+		size = DefaultSpawnThumbnailSize
+	}
+	data, err := EncodeSpawnOverlayPNG(model.TileMap, size, model.Resources, model.Players)
+	if err != nil {
+		return fmt.Errorf("Failed to render the spawn thumbnail: %v", err)
+	}
+	_, err = writer.Write(data)
+	return err
+}
+
+// collisionSVGWriter writes a preview of the collision borders (-collision-svg)
+type collisionSVGWriter struct{}
+
+func (collisionSVGWriter) Name() string      { return "collision-svg" }
+func (collisionSVGWriter) Extension() string { return ".collision.svg" }
+
+func (collisionSVGWriter) Write(model *ConvertedMap, writer io.Writer, options ConvertOptions) error {
+	environmentLayerIdx, err := model.TileMap.GetLayer("environment")
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(RenderCollisionSVG(model.TileMap.Width, model.TileMap.Height, &model.TileMap.Layers[environmentLayerIdx], model.Borders))
+	return err
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+)
+
+// PlayableArea contains the regions of the environment layer (see ComputeRegions) that can be reached in-game:
+// Regions that are connected to the region of a base building, directly or with connectors (see ConnectivityGraph),
+// and that are enclosed by the solid shell, which means that they don't touch the edge of the map.
+type PlayableArea struct {
+	regions  *RegionMap
+	outside  []bool // regions that touch the edge of the map
+	playable []bool
+}
+
+// ComputePlayableArea finds the playable regions of the map. The navigation graph must have been computed.
+func ComputePlayableArea(tilemap *TileMap, players []Player) (*PlayableArea, error) {
+	environmentLayerIdx, err := tilemap.GetLayer("environment")
+	if err != nil {
+		return nil, err
+	}
+	regions, err := ComputeRegions(tilemap.Width, tilemap.Height, &tilemap.Layers[environmentLayerIdx])
+	if err != nil {
+		return nil, err
+	}
+	area := &PlayableArea{regions: regions, outside: make([]bool, regions.Count), playable: make([]bool, regions.Count)}
+
+	for x := 0; x < tilemap.Width; x++ {
+		area.markOutside(x, 0)
+		area.markOutside(x, tilemap.Height-1)
+	}
+	for y := 0; y < tilemap.Height; y++ {
+		area.markOutside(0, y)
+		area.markOutside(tilemap.Width-1, y)
+	}
+
+	var queue []int
+	reached := make([]bool, regions.Count)
+	for _, player := range players {
+		for _, building := range player.Buildings {
+			if region := regions.GetRegion(building.SpawnX, building.SpawnY); building.Type == BuildingType_Base && region != -1 && !reached[region] {
+				reached[region] = true
+				queue = append(queue, region)
+			}
+		}
+	}
+	for len(queue) > 0 {
+		region := queue[0]
+		queue = queue[1:]
+		for _, connector := range tilemap.Navigation.Connectors {
+			next := -1
+			if connector.FromRegion == region {
+				next = connector.ToRegion
+			} else if connector.Bidirectional && connector.ToRegion == region {
+				next = connector.FromRegion
+			}
+			if next != -1 && !reached[next] {
+				reached[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+
+	for region := range area.playable {
+		area.playable[region] = reached[region] && !area.outside[region]
+	}
+	return area, nil
+}
+
+func (area *PlayableArea) markOutside(x, y int) {
+	if region := area.regions.GetRegion(x, y); region != -1 {
+		area.outside[region] = true
+	}
+}
+
+// Contains returns true if the tile is part of a playable region
+func (area *PlayableArea) Contains(x, y int) bool {
+	region := area.regions.GetRegion(x, y)
+	return region != -1 && area.playable[region]
+}
+
+// Reason describes why a tile is not playable
+func (area *PlayableArea) Reason(x, y int) string {
+	region := area.regions.GetRegion(x, y)
+	switch {
+	case region == -1:
+		return "inside solid terrain"
+	case area.outside[region]:
+		return "outside of the enclosing solid shell"
+	case !area.playable[region]:
+		return "in a sealed-off pocket that can't be reached from any base"
+	}
+	return "playable"
+}
+
+// Nearest returns the playable tile that is closest to the given one (in steps between neighbouring tiles).
+// Returns false if the map has no playable tiles.
+func (area *PlayableArea) Nearest(x, y int) (int, int, bool) {
+	width, height := area.regions.Width, area.regions.Height
+	visited := make([]bool, width*height)
+	queue := []int{y*width + x}
+	visited[y*width+x] = true
+	for len(queue) > 0 {
+		idx := queue[0]
+		queue = queue[1:]
+		tx, ty := idx%width, idx/width
+		if area.Contains(tx, ty) {
+			return tx, ty, true
+		}
+		for _, n := range [][2]int{{tx - 1, ty}, {tx + 1, ty}, {tx, ty - 1}, {tx, ty + 1}} {
+			if n[0] >= 0 && n[1] >= 0 && n[0] < width && n[1] < height && !visited[n[1]*width+n[0]] {
+				visited[n[1]*width+n[0]] = true
+				queue = append(queue, n[1]*width+n[0])
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// ValidateSpawnBounds checks that all resource points, water drop sources, buildings and units are inside of the playable area
+// (see PlayableArea). Resource points and water drop sources are attached to the terrain, so the tile in front of them is checked.
+// Every violation is logged with the nearest playable tile. The navigation graph must have been computed.
+func ValidateSpawnBounds(tilemap *TileMap, resources []ResourcePoint, waterdropSources []WaterdropSource, players []Player) error {
+	area, err := ComputePlayableArea(tilemap, players)
+	if err != nil {
+		return err
+	}
+
+	violations := 0
+	report := func(entity string, x, y int, problem string, nearestX, nearestY int) {
+		violations++
+		suggestion := "The map has no playable tiles"
+		if nx, ny, ok := area.Nearest(nearestX, nearestY); ok {
+			suggestion = fmt.Sprintf("Nearest playable tile: (x=%d, y=%d)", nx, ny)
+		}
+		logTileErrorf(x, y, "%s (x=%d, y=%d) %s. %s", entity, x, y, problem, suggestion)
+	}
+	check := func(entity string, x, y int) {
+		if !area.Contains(x, y) {
+			report(entity, x, y, "is "+area.Reason(x, y), x, y)
+		}
+	}
+
+	checkAttached := func(entity string, x, y int, flags uint8) {
+		tile := Tile{Flags: flags}
+		upX, upY := tile.GetUpVector()
+		frontX, frontY := x+upX, y+upY
+		if !area.Contains(x, y) && !area.Contains(frontX, frontY) {
+			report(entity, x, y, "faces a tile that is "+area.Reason(frontX, frontY), frontX, frontY)
+		}
+	}
+	for i, resource := range resources {
+		checkAttached(fmt.Sprintf("Resource point %d", i), resource.SpawnX, resource.SpawnY, resource.ResourcePointFlags)
+	}
+	for i, source := range waterdropSources {
+		checkAttached(fmt.Sprintf("Water drop source %d", i), source.SpawnX, source.SpawnY, source.WaterdropFlags)
+	}
+	for _, player := range players {
+		for _, building := range player.Buildings {
+			check(fmt.Sprintf("The %s of player %d", buildingTypeNames[building.Type], player.Slot), building.SpawnX, building.SpawnY)
+		}
+		for _, unit := range player.Units {
+			check(fmt.Sprintf("The %s unit of player %d", unitTypeNames[unit.Type], player.Slot), unit.SpawnX, unit.SpawnY)
+		}
+	}
+	if violations > 0 {
+		return fmt.Errorf("Invalid map: %d spawn positions are outside of the playable area", violations)
+	}
+	return nil
+}
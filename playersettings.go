@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AIDifficulty is the default difficulty of the AI if it controls the player
+type AIDifficulty uint8
+
+const (
+	AIDifficulty_Default AIDifficulty = 0 // the game (or the lobby) decides
+	AIDifficulty_Easy    AIDifficulty = 1
+	AIDifficulty_Normal  AIDifficulty = 2
+	AIDifficulty_Hard    AIDifficulty = 3
+	AIDifficulty_Brutal  AIDifficulty = 4
+)
+
+var aiDifficultyNames = map[string]AIDifficulty{
+	"easy":   AIDifficulty_Easy,
+	"normal": AIDifficulty_Normal,
+	"hard":   AIDifficulty_Hard,
+	"brutal": AIDifficulty_Brutal,
+}
+
+func (difficulty AIDifficulty) String() string {
+	for name, d := range aiDifficultyNames {
+		if d == difficulty {
+			return name
+		}
+	}
+	if difficulty == AIDifficulty_Default {
+		return "default"
+	}
+	return fmt.Sprintf("unknown difficulty %d", uint8(difficulty))
+}
+
+// DefaultHandicap is the handicap of players without a 'player<N>_handicap' property (no handicap)
+const DefaultHandicap = 100
+
+// HasCustomSettings returns true if the player has a handicap or AI settings that need to be stored
+func (player *Player) HasCustomSettings() bool {
+	return (player.Handicap != 0 && player.Handicap != DefaultHandicap) || player.AIDifficulty != AIDifficulty_Default || player.AIPersonality != ""
+}
+
+// ExtractPlayerSettings reads the handicap and AI settings of the players from the map properties, so that asymmetric co-op maps
+// can be authored in Tiled. The properties are named 'player<N>_handicap' (percentage of the normal strength, 1-255),
+// 'player<N>_ai_difficulty' (easy, normal, hard, brutal) and 'player<N>_ai_personality', where N is the player slot of the spawn tileset.
+// Properties of players that don't exist are rejected by ExtractPlayerAppearance.
+func ExtractPlayerSettings(tilemap *TileMap, players []Player) error {
+	for i := range players {
+		player := &players[i]
+
+		handicap, err := tilemap.Properties.GetInt(fmt.Sprintf("player%d_handicap", player.Slot), DefaultHandicap)
+		if err != nil {
+			return fmt.Errorf("Invalid handicap for player %d: %v", player.Slot, err)
+		}
+		if handicap < 1 || handicap > 0xFF {
+			return fmt.Errorf("Invalid handicap for player %d: %d%% is not within range [1,255]", player.Slot, handicap)
+		}
+		player.Handicap = handicap
+
+		if value, ok := tilemap.Properties.Get(fmt.Sprintf("player%d_ai_difficulty", player.Slot)); ok {
+			difficulty, ok := aiDifficultyNames[strings.ToLower(strings.TrimSpace(value))]
+			if !ok {
+				return fmt.Errorf("Invalid AI difficulty for player %d: %q. Allowed values: easy, normal, hard, brutal", player.Slot, value)
+			}
+			player.AIDifficulty = difficulty
+		}
+
+		if value, ok := tilemap.Properties.Get(fmt.Sprintf("player%d_ai_personality", player.Slot)); ok {
+			personality := strings.ToLower(strings.TrimSpace(value))
+			if personality == "" {
+				return fmt.Errorf("Invalid AI personality for player %d: The personality must not be empty", player.Slot)
+			}
+			player.AIPersonality = personality
+		}
+	}
+	return nil
+}
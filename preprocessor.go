@@ -2,6 +2,8 @@ package main
 
 import (
 	"fmt"
+	"runtime"
+	"sync"
 )
 
 // BorderLine represents a border between solid terrain data and air.
@@ -85,6 +87,10 @@ func ComputeBorder(tilemap *TileMap) (borders SortedBorderLines, err error) {
 		return borders, err
 	}
 
+	// Other passes compute borders of modified copies of the environment layer (eg. for flying units). They don't warn,
+	// so that every diagonal tile on the outer ring is only reported once.
+	warnDiagonalOuterRing(tilemap.Width, tilemap.Height, &tilemap.Layers[environmentLayerIdx])
+
 	borders, err = ComputeBorderOfLayer(tilemap.Width, tilemap.Height, &tilemap.Layers[environmentLayerIdx])
 	return borders, err
 }
@@ -108,259 +114,360 @@ func ComputeBorderOfLayer(width, height int, layer *TileMapLayer) (SortedBorderL
 
 	// Find horizontal borders:
 	for y := 1; y < height; y++ {
-		var upwardsBorderStart = -1
-		var downwardsBorderStart = -1
+		if borders.Right, borders.Left, err = sweepRow(width, height, layer, y, borders.Right, borders.Left); err != nil {
+			return borders, err
+		}
+	}
+
+	// Find vertical borders:
+	for x := 1; x < width; x++ {
+		if borders.Up, borders.Down, err = sweepColumn(width, height, layer, x, borders.Up, borders.Down); err != nil {
+			return borders, err
+		}
+	}
+
+	// Find diagonal borders. Every diagonal is independent and can be processed in parallel.
+	// For diagonal tiles, we do not ignore the outer ring. Diagonals there are reported by ComputeBorder.
+	diagonalChecks := width + height - 1
+
+	// Diagonals from the top-left to the bottom-right:
+	borders.DownRight, borders.UpLeft, err = sweepDiagonalsParallel(diagonalChecks, borders.DownRight, borders.UpLeft,
+		func(d int, downRight, upLeft []BorderLine) ([]BorderLine, []BorderLine, error) {
+			return sweepFallingDiagonal(width, height, layer, d, downRight, upLeft)
+		})
+	if err != nil {
+		return borders, err
+	}
+
+	// Diagonals from the bottom-left to the top-right:
+	borders.UpRight, borders.DownLeft, err = sweepDiagonalsParallel(diagonalChecks, borders.UpRight, borders.DownLeft,
+		func(d int, upRight, downLeft []BorderLine) ([]BorderLine, []BorderLine, error) {
+			return sweepRisingDiagonal(width, height, layer, d, upRight, downLeft)
+		})
+	if err != nil {
+		return borders, err
+	}
+
+	// Possible optimisation: if the map contains unreachable positions, it's borders can be dropped
+
+	// Validate and reduce:
+	// if len(borders.Left) == 0 || len(borders.Right) == 0 || len(borders.Up) == 0 || len(borders.Down) == 0 ||
+	//     len(borders.UpLeft) == 0 || len(borders.UpRight) == 0 || len(borders.DownLeft) == 0 || len(borders.DownRight) == 0 {
+	//     return borders, fmt.Errorf("Invalid map: Failed to compute border. A closed map contains at least one border in each direction. "+
+	//         "Found (left, right, up, down): %d, %d, %d, %d "+
+	//         "Found (up-left, up-right, down-left, down-right): %d, %d, %d, %d ",
+	//         len(borders.Left), len(borders.Right), len(borders.Up), len(borders.Down),
+	//         len(borders.UpLeft), len(borders.UpRight), len(borders.DownLeft), len(borders.DownRight))
+	// }
+
+	return borders, nil
+}
+
+// sweepRow finds the horizontal borders between the rows y-1 and y.
+func sweepRow(width, height int, layer *TileMapLayer, y int, right, left []BorderLine) ([]BorderLine, []BorderLine, error) {
+	var err error
+	var upwardsBorderStart = -1
+	var downwardsBorderStart = -1
+
+	for x := 1; x < width; x++ {
+		var above Tile
+		var mine Tile
 
-		for x := 1; x < width; x++ {
-			var above Tile
-			var mine Tile
+		if above, err = layer.GetTile(x, y-1, width, height); err != nil {
+			return right, left, fmt.Errorf("Failed to compute horizontal border (%dx%d-1): %v", x, y, err)
+		}
+		if mine, err = layer.GetTile(x, y, width, height); err != nil {
+			return right, left, fmt.Errorf("Failed to compute horizontal border (%dx%d): %v", x, y, err)
+		}
 
-			if above, err = layer.GetTile(x, y-1, width, height); err != nil {
-				return borders, fmt.Errorf("Failed to compute horizontal border (%dx%d-1): %v", x, y, err)
+		// Border facing upwards
+		if HasBorderTowards(mine, above, UP) && x != width-1 {
+			if upwardsBorderStart == -1 {
+				upwardsBorderStart = x // the border just started
 			}
-			if mine, err = layer.GetTile(x, y, width, height); err != nil {
-				return borders, fmt.Errorf("Failed to compute horizontal border (%dx%d): %v", x, y, err)
+		} else {
+			if upwardsBorderStart != -1 { // the border just ended
+				upwardsBorderEnd := x
+				right = append(right, BorderLine{ // below = solid
+					StartX: upwardsBorderStart,
+					StartY: y,
+					Length: upwardsBorderEnd - upwardsBorderStart,
+				})
+				upwardsBorderStart = -1
 			}
+		}
 
-			// Border facing upwards
-			if HasBorderTowards(mine, above, UP) && x != width-1 {
-				if upwardsBorderStart == -1 {
-					upwardsBorderStart = x // the border just started
-				}
-			} else {
-				if upwardsBorderStart != -1 { // the border just ended
-					upwardsBorderEnd := x
-					borders.Right = append(borders.Right, BorderLine{ // below = solid
-						StartX: upwardsBorderStart,
-						StartY: y,
-						Length: upwardsBorderEnd - upwardsBorderStart,
-					})
-					upwardsBorderStart = -1
-				}
+		// Border facing downwards
+		if HasBorderTowards(above, mine, DOWN) && x != width-1 {
+			if downwardsBorderStart == -1 {
+				downwardsBorderStart = x // the border just started
 			}
-
-			// Border facing downwards
-			if HasBorderTowards(above, mine, DOWN) && x != width-1 {
-				if downwardsBorderStart == -1 {
-					downwardsBorderStart = x // the border just started
-				}
-			} else {
-				if downwardsBorderStart != -1 { // the border just ended
-					downwardsBorderEnd := x
-					borders.Left = append(borders.Left, BorderLine{ // above = solid
-						StartX: downwardsBorderEnd, // the border goes from right to left (solid region must be on the  right side)
-						StartY: y,
-						Length: downwardsBorderEnd - downwardsBorderStart,
-					})
-					downwardsBorderStart = -1
-				}
+		} else {
+			if downwardsBorderStart != -1 { // the border just ended
+				downwardsBorderEnd := x
+				left = append(left, BorderLine{ // above = solid
+					StartX: downwardsBorderEnd, // the border goes from right to left (solid region must be on the  right side)
+					StartY: y,
+					Length: downwardsBorderEnd - downwardsBorderStart,
+				})
+				downwardsBorderStart = -1
 			}
 		}
 	}
+	return right, left, nil
+}
 
-	// Find vertical borders:
-	for x := 1; x < width; x++ {
-		var leftBorderStart = -1
-		var rightBorderStart = -1
+// sweepColumn finds the vertical borders between the columns x-1 and x.
+func sweepColumn(width, height int, layer *TileMapLayer, x int, up, down []BorderLine) ([]BorderLine, []BorderLine, error) {
+	var err error
+	var leftBorderStart = -1
+	var rightBorderStart = -1
+
+	for y := 1; y < height; y++ {
+		var left Tile
+		var mine Tile
 
-		for y := 1; y < height; y++ {
-			var left Tile
-			var mine Tile
+		if left, err = layer.GetTile(x-1, y, width, height); err != nil {
+			return up, down, fmt.Errorf("Failed to compute vertical border (%d-1x%d): %v", x, y, err)
+		}
+		if mine, err = layer.GetTile(x, y, width, height); err != nil {
+			return up, down, fmt.Errorf("Failed to compute vertical border (%dx%d): %v", x, y, err)
+		}
 
-			if left, err = layer.GetTile(x-1, y, width, height); err != nil {
-				return borders, fmt.Errorf("Failed to compute vertical border (%d-1x%d): %v", x, y, err)
+		// Border facing to the left
+		if HasBorderTowards(mine, left, LEFT) && y != height-1 {
+			if leftBorderStart == -1 {
+				leftBorderStart = y // the border just started
 			}
-			if mine, err = layer.GetTile(x, y, width, height); err != nil {
-				return borders, fmt.Errorf("Failed to compute vertical border (%dx%d): %v", x, y, err)
+		} else {
+			if leftBorderStart != -1 { // the border just ended
+				leftBorderEnd := y
+				up = append(up, BorderLine{ // right = solid
+					StartX: x,
+					StartY: leftBorderEnd,
+					Length: leftBorderEnd - leftBorderStart,
+				})
+				leftBorderStart = -1
 			}
+		}
 
-			// Border facing to the left
-			if HasBorderTowards(mine, left, LEFT) && y != height-1 {
-				if leftBorderStart == -1 {
-					leftBorderStart = y // the border just started
-				}
-			} else {
-				if leftBorderStart != -1 { // the border just ended
-					leftBorderEnd := y
-					borders.Up = append(borders.Up, BorderLine{ // right = solid
-						StartX: x,
-						StartY: leftBorderEnd,
-						Length: leftBorderEnd - leftBorderStart,
-					})
-					leftBorderStart = -1
-				}
+		// Border facing to the right
+		if HasBorderTowards(left, mine, RIGHT) && y != height-1 {
+			if rightBorderStart == -1 {
+				rightBorderStart = y // the border just started
 			}
-
-			// Border facing to the right
-			if HasBorderTowards(left, mine, RIGHT) && y != height-1 {
-				if rightBorderStart == -1 {
-					rightBorderStart = y // the border just started
-				}
-			} else {
-				if rightBorderStart != -1 { // the border just ended
-					rightBorderEnd := y
-					borders.Down = append(borders.Down, BorderLine{ // left = solid
-						StartX: x,
-						StartY: rightBorderStart, // the border goes from right to left (solid region must be on the right side)
-						Length: rightBorderEnd - rightBorderStart,
-					})
-					rightBorderStart = -1
-				}
+		} else {
+			if rightBorderStart != -1 { // the border just ended
+				rightBorderEnd := y
+				down = append(down, BorderLine{ // left = solid
+					StartX: x,
+					StartY: rightBorderStart, // the border goes from right to left (solid region must be on the right side)
+					Length: rightBorderEnd - rightBorderStart,
+				})
+				rightBorderStart = -1
 			}
 		}
 	}
+	return up, down, nil
+}
 
-	// Find diagonal borders from the top-left to the bottom-right:
-	diagonalChecks := width + height - 1
-	// For diagonal tiles, we do not ignore the outer ring. But if we find diagonals there, we emmit an error
-	for d := 0; d < diagonalChecks; d++ {
-		var firstX int
-		var firstY int
-
-		if d < width {
-			firstX = d
-			firstY = 0
-		} else {
-			firstX = 0
-			firstY = d - width + 1
+// warnDiagonalOuterRing warns about every diagonal tile on the outer ring of the layer, row by row.
+// The tiles create borders along the map edge.
+func warnDiagonalOuterRing(width, height int, layer *TileMapLayer) {
+	for y := 0; y < height; y++ {
+		step := 1
+		if y != 0 && y != height-1 {
+			step = maxInt(width-1, 1) // only the first and last column
+		}
+		for x := 0; x < width; x += step {
+			if layer.Tiles[y*width+x].IsDiagonal() {
+				logTileWarningf(x, y, "The outer ring of the map contains diagonal tiles. Note that the whole area that is reachable within the game must be enclosed by solid, non-diagonal tiles. Position: %vx%v", x, y)
+			}
 		}
+	}
+}
 
-		upRightBorderStart := -1
-		downLeftBorderStart := -1
+// sweepDiagonalsParallel calls sweep for every diagonal in [0, count) and appends the found border lines to first and second.
+// The diagonals are split into one contiguous batch per CPU. Each batch collects its results in its own buffers,
+// which are concatenated in order afterwards. The result is therefore identical to a sequential sweep.
+func sweepDiagonalsParallel(count int, first, second []BorderLine, sweep func(d int, first, second []BorderLine) ([]BorderLine, []BorderLine, error)) ([]BorderLine, []BorderLine, error) {
+	type batchResult struct {
+		first  []BorderLine
+		second []BorderLine
+		err    error
+	}
 
-		x := firstX
-		y := firstY
-		for i := 0; ; i++ {
-			var tile Tile
-			if tile, err = layer.GetTile(x, y, width, height); err != nil {
-				return borders, fmt.Errorf("Failed to compute diagonal border (%dx%d): %v", x, y, err)
+	batchCount := runtime.NumCPU()
+	if batchCount > count {
+		batchCount = count
+	}
+	if batchCount < 1 {
+		return first, second, nil
+	}
+	batchSize := (count + batchCount - 1) / batchCount
+	results := make([]batchResult, batchCount)
+
+	var wg sync.WaitGroup
+	for b := 0; b < batchCount; b++ {
+		wg.Add(1)
+		go func(b int) {
+			defer wg.Done()
+			result := batchResult{
+				first:  getBorderLineScratch(64),
+				second: getBorderLineScratch(64),
 			}
-
-			// border facing up-right
-			if tile.GetType() == SOLID_AT_LOWER_LEFT {
-				if x == 0 || y == 0 || x == width-1 || y == height-1 {
-					log.Warningf("The outer ring of the map contains diagonal tiles. Note that the whole area that is reachable within the game must be enclosed by solid, non-diagonal tiles. Position: %vx%v", x, y)
-				}
-				if upRightBorderStart == -1 {
-					upRightBorderStart = i // the border just started
-				}
-			} else {
-				if upRightBorderStart != -1 { // the border just ended
-					borders.DownRight = append(borders.DownRight, BorderLine{ // bottom left = solid, border pointing down-right
-						StartX: firstX + upRightBorderStart,
-						StartY: firstY + upRightBorderStart,
-						Length: i - upRightBorderStart,
-					})
-					upRightBorderStart = -1
+			for d := b * batchSize; d < (b+1)*batchSize && d < count; d++ {
+				if result.first, result.second, result.err = sweep(d, result.first, result.second); result.err != nil {
+					break
 				}
 			}
+			results[b] = result
+		}(b)
+	}
+	wg.Wait()
 
-			// border facing down-left
-			if tile.GetType() == SOLID_AT_UPPER_RIGHT {
-				if x == 0 || y == 0 || x == width-1 || y == height-1 {
-					log.Warningf("The outer ring of the map contains diagonal tiles. Note that the whole area that is reachable within the game must be enclosed by solid, non-diagonal tiles. Position: %vx%v", x, y)
-				}
-				if downLeftBorderStart == -1 {
-					downLeftBorderStart = i // the border just started
-				}
-			} else {
-				if downLeftBorderStart != -1 { // the border just ended
-					borders.UpLeft = append(borders.UpLeft, BorderLine{ // upper right = solid, border pointing up-left
-						StartX: firstX + i,
-						StartY: firstY + i, // The border goes from down-right to upper-left
-						Length: i - downLeftBorderStart,
-					})
-					downLeftBorderStart = -1
-				}
-			}
-			x++
-			y++
-			if x >= width || y >= height {
-				break
-			}
+	defer func() {
+		for _, result := range results {
+			putBorderLineScratch(result.first)
+			putBorderLineScratch(result.second)
 		}
+	}()
+	for _, result := range results {
+		if result.err != nil {
+			return first, second, result.err
+		}
+		first = append(first, result.first...)
+		second = append(second, result.second...)
 	}
+	return first, second, nil
+}
 
-	// Find diagonal borders from the bottom-left to the top-right:
-	for d := 0; d < diagonalChecks; d++ {
-		var firstX int
-		var firstY int
+// sweepFallingDiagonal finds the diagonal borders on the d-th diagonal going from the top-left to the bottom-right.
+func sweepFallingDiagonal(width, height int, layer *TileMapLayer, d int, downRight, upLeft []BorderLine) ([]BorderLine, []BorderLine, error) {
+	var err error
+	var firstX int
+	var firstY int
+
+	if d < width {
+		firstX = d
+		firstY = 0
+	} else {
+		firstX = 0
+		firstY = d - width + 1
+	}
 
-		if d < width {
-			firstX = d
-			firstY = height - 1
-		} else {
-			firstX = 0
-			firstY = d - width
-		}
+	upRightBorderStart := -1
+	downLeftBorderStart := -1
 
-		upLeftBorderStart := -1
-		downRightBorderStart := -1
+	x := firstX
+	y := firstY
+	for i := 0; ; i++ {
+		var tile Tile
+		if tile, err = layer.GetTile(x, y, width, height); err != nil {
+			return downRight, upLeft, fmt.Errorf("Failed to compute diagonal border (%dx%d): %v", x, y, err)
+		}
 
-		x := firstX
-		y := firstY
-		for i := 0; ; i++ {
-			var tile Tile
-			if tile, err = layer.GetTile(x, y, width, height); err != nil {
-				return borders, fmt.Errorf("Failed to compute diagonal border (%dx%d): %v", x, y, err)
+		// border facing up-right
+		if tile.GetType() == SOLID_AT_LOWER_LEFT {
+			if upRightBorderStart == -1 {
+				upRightBorderStart = i // the border just started
 			}
-
-			// border facing up-left
-			if tile.GetType() == SOLID_AT_LOWER_RIGHT {
-				if x == 0 || y == 0 || x == width-1 || y == height-1 {
-					log.Warningf("The outer ring of the map contains diagonal tiles. Note that the whole area that is reachable within the game must be enclosed by solid, non-diagonal tiles. Position: %vx%v", x, y)
-				}
-				if upLeftBorderStart == -1 {
-					upLeftBorderStart = i // the border just started
-				}
-			} else {
-				if upLeftBorderStart != -1 { // the border just ended
-					borders.UpRight = append(borders.UpRight, BorderLine{ // bottom right = solid, border pointing up-right
-						StartX: firstX + upLeftBorderStart,
-						StartY: firstY - upLeftBorderStart + 1,
-						Length: i - upLeftBorderStart,
-					})
-					upLeftBorderStart = -1
-				}
+		} else {
+			if upRightBorderStart != -1 { // the border just ended
+				downRight = append(downRight, BorderLine{ // bottom left = solid, border pointing down-right
+					StartX: firstX + upRightBorderStart,
+					StartY: firstY + upRightBorderStart,
+					Length: i - upRightBorderStart,
+				})
+				upRightBorderStart = -1
 			}
+		}
 
-			// border facing down-right
-			if tile.GetType() == SOLID_AT_UPPER_LEFT {
-				if x == 0 || y == 0 || x == width-1 || y == height-1 {
-					log.Warningf("The outer ring of the map contains diagonal tiles. Note that the whole area that is reachable within the game must be enclosed by solid, non-diagonal tiles. Position: %vx%v", x, y)
-				}
-				if downRightBorderStart == -1 {
-					downRightBorderStart = i // the border just started
-				}
-			} else {
-				if downRightBorderStart != -1 { // the border just ended
-					borders.DownLeft = append(borders.DownLeft, BorderLine{ // upper left = solid, border pointing down-left
-						StartX: firstX + i,
-						StartY: firstY - i + 1, // The border goes from down-right to upper-left
-						Length: i - downRightBorderStart,
-					})
-					downRightBorderStart = -1
-				}
+		// border facing down-left
+		if tile.GetType() == SOLID_AT_UPPER_RIGHT {
+			if downLeftBorderStart == -1 {
+				downLeftBorderStart = i // the border just started
 			}
-			x++
-			y--
-			if x >= width || y < 0 {
-				break
+		} else {
+			if downLeftBorderStart != -1 { // the border just ended
+				upLeft = append(upLeft, BorderLine{ // upper right = solid, border pointing up-left
+					StartX: firstX + i,
+					StartY: firstY + i, // The border goes from down-right to upper-left
+					Length: i - downLeftBorderStart,
+				})
+				downLeftBorderStart = -1
 			}
 		}
+		x++
+		y++
+		if x >= width || y >= height {
+			break
+		}
 	}
+	return downRight, upLeft, nil
+}
 
-	// Possible optimisation: if the map contains unreachable positions, it's borders can be dropped
+// sweepRisingDiagonal finds the diagonal borders on the d-th diagonal going from the bottom-left to the top-right.
+func sweepRisingDiagonal(width, height int, layer *TileMapLayer, d int, upRight, downLeft []BorderLine) ([]BorderLine, []BorderLine, error) {
+	var err error
+	var firstX int
+	var firstY int
+
+	if d < width {
+		firstX = d
+		firstY = height - 1
+	} else {
+		firstX = 0
+		firstY = d - width
+	}
 
-	// Validate and reduce:
-	// if len(borders.Left) == 0 || len(borders.Right) == 0 || len(borders.Up) == 0 || len(borders.Down) == 0 ||
-	//     len(borders.UpLeft) == 0 || len(borders.UpRight) == 0 || len(borders.DownLeft) == 0 || len(borders.DownRight) == 0 {
-	//     return borders, fmt.Errorf("Invalid map: Failed to compute border. A closed map contains at least one border in each direction. "+
-	//         "Found (left, right, up, down): %d, %d, %d, %d "+
-	//         "Found (up-left, up-right, down-left, down-right): %d, %d, %d, %d ",
-	//         len(borders.Left), len(borders.Right), len(borders.Up), len(borders.Down),
-	//         len(borders.UpLeft), len(borders.UpRight), len(borders.DownLeft), len(borders.DownRight))
-	// }
+	upLeftBorderStart := -1
+	downRightBorderStart := -1
 
-	return borders, nil
+	x := firstX
+	y := firstY
+	for i := 0; ; i++ {
+		var tile Tile
+		if tile, err = layer.GetTile(x, y, width, height); err != nil {
+			return upRight, downLeft, fmt.Errorf("Failed to compute diagonal border (%dx%d): %v", x, y, err)
+		}
+
+		// border facing up-left
+		if tile.GetType() == SOLID_AT_LOWER_RIGHT {
+			if upLeftBorderStart == -1 {
+				upLeftBorderStart = i // the border just started
+			}
+		} else {
+			if upLeftBorderStart != -1 { // the border just ended
+				upRight = append(upRight, BorderLine{ // bottom right = solid, border pointing up-right
+					StartX: firstX + upLeftBorderStart,
+					StartY: firstY - upLeftBorderStart + 1,
+					Length: i - upLeftBorderStart,
+				})
+				upLeftBorderStart = -1
+			}
+		}
+
+		// border facing down-right
+		if tile.GetType() == SOLID_AT_UPPER_LEFT {
+			if downRightBorderStart == -1 {
+				downRightBorderStart = i // the border just started
+			}
+		} else {
+			if downRightBorderStart != -1 { // the border just ended
+				downLeft = append(downLeft, BorderLine{ // upper left = solid, border pointing down-left
+					StartX: firstX + i,
+					StartY: firstY - i + 1, // The border goes from down-right to upper-left
+					Length: i - downRightBorderStart,
+				})
+				downRightBorderStart = -1
+			}
+		}
+		x++
+		y--
+		if x >= width || y < 0 {
+			break
+		}
+	}
+	return upRight, downLeft, nil
 }
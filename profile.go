@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"time"
+)
+
+// Phases of the conversion that are measured with -profile
+const (
+	Phase_Decoding       = "decoding"         // parsing the TMX file and its tilesets
+	Phase_TileExtraction = "tile extraction"  // decoding the layer data into tiles
+	Phase_SpawnExtract   = "spawn extraction" // resource points, water drop sources, buildings and units
+	Phase_Borders        = "border computation"
+	Phase_Encoding       = "encoding" // all format versions
+	Phase_Output         = "output"   // writing the output and sidecar files
+)
+
+// profilePhases is the order in which the phases are printed
+var profilePhases = []string{Phase_Decoding, Phase_TileExtraction, Phase_SpawnExtract, Phase_Borders, Phase_Encoding, Phase_Output}
+
+// BeginPhase marks the start of a conversion phase for -profile and -events. The returned function marks its end.
+// Ending a phase more than once has no effect.
+func BeginPhase(phase string) func() {
+	stopProfile := runProfile.Measure(phase)
+	runEvents.Emit(Event{Event: Event_PhaseStart, Phase: phase})
+	ended := false
+	return func() {
+		if !ended {
+			stopProfile()
+			runEvents.Emit(Event{Event: Event_PhaseEnd, Phase: phase})
+			ended = true
+		}
+	}
+}
+
+// Profile sums up the time spent in the phases of all conversions of a run
+type Profile struct {
+	start     time.Time
+	durations map[string]time.Duration
+}
+
+// runProfile is nil if profiling is disabled
+var runProfile *Profile
+
+// NewProfile starts measuring the total time of a run
+func NewProfile() *Profile {
+	return &Profile{start: time.Now(), durations: make(map[string]time.Duration)}
+}
+
+// Measure starts measuring a phase and returns the function that stops it. Stopping more than once has no effect.
+// Phases can be measured multiple times (eg. once per map), the durations add up.
+func (profile *Profile) Measure(phase string) func() {
+	if profile == nil {
+		return func() {}
+	}
+	start := time.Now()
+	stopped := false
+	return func() {
+		if !stopped {
+			profile.durations[phase] += time.Since(start)
+			stopped = true
+		}
+	}
+}
+
+// Print logs the time spent in each phase. Everything that isn't part of a phase (validation, analysis passes) is listed as other.
+func (profile *Profile) Print() {
+	if profile == nil {
+		return
+	}
+	total := time.Since(profile.start)
+	other := total
+	log.Infof("Profile:")
+	for _, phase := range profilePhases {
+		duration := profile.durations[phase]
+		other -= duration
+		log.Infof("\t%-20s %10v  %5.1f%%", phase, duration.Round(time.Microsecond), percentage(duration, total))
+	}
+	log.Infof("\t%-20s %10v  %5.1f%%", "other", other.Round(time.Microsecond), percentage(other, total))
+	log.Infof("\t%-20s %10v", "total", total.Round(time.Microsecond))
+}
+
+func percentage(duration, total time.Duration) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return float64(duration) / float64(total) * 100
+}
+
+// StartPprof starts a CPU profile ("<prefix>.cpu.pprof"). The returned function stops it and writes a heap profile ("<prefix>.heap.pprof").
+func StartPprof(prefix string) (func() error, error) {
+	cpuFile, err := os.Create(LongPath(prefix + ".cpu.pprof"))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create CPU profile: %v", err)
+	}
+	if err := pprof.StartCPUProfile(cpuFile); err != nil {
+		cpuFile.Close()
+		return nil, fmt.Errorf("Failed to start CPU profile: %v", err)
+	}
+
+	return func() error {
+		pprof.StopCPUProfile()
+		if err := cpuFile.Close(); err != nil {
+			return fmt.Errorf("Failed to write CPU profile: %v", err)
+		}
+		heapFile, err := os.Create(LongPath(prefix + ".heap.pprof"))
+		if err != nil {
+			return fmt.Errorf("Failed to create heap profile: %v", err)
+		}
+		defer heapFile.Close()
+		runtime.GC() // up-to-date statistics
+		if err := pprof.WriteHeapProfile(heapFile); err != nil {
+			return fmt.Errorf("Failed to write heap profile: %v", err)
+		}
+		log.Infof("Wrote pprof profiles '%s.cpu.pprof' and '%s.heap.pprof'", prefix, prefix)
+		return nil
+	}, nil
+}
@@ -0,0 +1,496 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// EncodedMap is the content of a converted map file (see Encode).
+// Spawn information and borders are decoded, optional sections are kept as raw bytes.
+type EncodedMap struct {
+	Version       uint8
+	Flags         EncodingFlags
+	TileFlagNames []string // names of the custom tile flags (EncodingFlag_TileFlags)
+	Width         int
+	Height        int
+
+	Layers           []EncodedLayer // in file order (reversed compared to Tiled)
+	EnvironmentLayer int            // index into Layers
+
+	BackgroundObjects []EncodedObject
+	ForegroundObjects []EncodedObject
+
+	Resources        []ResourcePoint
+	WaterdropSources []WaterdropSource
+	Players          []Player
+	Borders          SortedBorderLines
+
+	Sections  []EncodedSection  // format version 3+
+	Checksums []SectionChecksum // format version 5+
+	Features  FeatureFlags      // format version 6+
+}
+
+// EncodedLayer is a single tile layer of a converted map
+type EncodedLayer struct {
+	TileSetType TileSetType
+	Flags       []uint8 // per tile, including custom tile flags
+	Indices     []uint8 // per tile, 0 = empty
+}
+
+// EncodedObject is a single object of an object layer. The position is the object's center in tiles.
+type EncodedObject struct {
+	Index    uint8
+	X        float32
+	Y        float32
+	Width    float32 // negative if flipped horizontally
+	Height   float32 // negative if flipped vertically
+	Rotation float32
+}
+
+// EncodedSection is an optional section after the borders
+type EncodedSection struct {
+	ID      SectionID
+	Content []byte
+}
+
+// sectionNames are used when printing sections
+var sectionNames = map[SectionID]string{
+	Section_Hazards:     "hazards",
+	Section_Wind:        "wind",
+	Section_Environment: "environment",
+	Section_Checkpoints: "checkpoints",
+	Section_CameraPaths: "camera paths",
+	Section_Victory:     "victory conditions",
+	Section_AIHints:     "AI hints",
+	Section_ObjectScale: "object scales",
+	Section_Anchors:     "resource anchors",
+	Section_Squads:      "squads",
+	Section_Inventories: "building inventories",
+	Section_Obstacles:   "obstacles",
+	Section_DynBorders:  "dynamic borders",
+	Section_FlyBorders:  "flying unit borders",
+	Section_Metadata:    "metadata",
+	Section_Fluids:      "water volumes",
+	Section_Navigation:  "navigation",
+	Section_NoBuild:     "no-build zones",
+	Section_Thumbnail:   "thumbnail",
+	Section_RenderPass:  "render passes",
+	Section_ImageLayers: "image layers",
+	Section_Offsets:     "layer offsets",
+	Section_Debug:       "debug warnings",
+
+	Section_Layer:      "layer",
+	Section_Objects:    "objects",
+	Section_Resources:  "resource points",
+	Section_Waterdrops: "water drop sources",
+	Section_Players:    "players",
+	Section_Borders:    "borders",
+}
+
+func (id SectionID) String() string {
+	if name, ok := sectionNames[id]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown section 0x%02X", uint8(id))
+}
+
+// ParseByteOrder parses the -byte-order option
+func ParseByteOrder(byteOrder string) (binary.ByteOrder, error) {
+	switch byteOrder {
+	case "le":
+		return binary.LittleEndian, nil
+	case "be":
+		return binary.BigEndian, nil
+	}
+	return nil, fmt.Errorf("Unknown byte order %q. Allowed values: le, be", byteOrder)
+}
+
+// LoadEncodedMap reads and decodes a converted map file. The byte order is not part of the file and must be known.
+func LoadEncodedMap(path string, order binary.ByteOrder) (*EncodedMap, error) {
+	data, err := ioutil.ReadFile(LongPath(path))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read map file: %v", err)
+	}
+	encoded, err := DecodeMap(data, order)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode '%s': %v", path, err)
+	}
+	return encoded, nil
+}
+
+// mapReader reads the primitives written by the encoder.
+// The first error is remembered, all following reads return zero values, so that errors only need to be checked occasionally.
+type mapReader struct {
+	reader *bytes.Reader
+	order  binary.ByteOrder
+	flags  EncodingFlags
+	err    error
+}
+
+func (r *mapReader) fail(format string, args ...interface{}) {
+	if r.err == nil {
+		r.err = fmt.Errorf("%s (offset %d)", fmt.Sprintf(format, args...), r.offset())
+	}
+}
+
+func (r *mapReader) offset() int {
+	return int(r.reader.Size()) - r.reader.Len()
+}
+
+func (r *mapReader) readByte() uint8 {
+	if r.err != nil {
+		return 0
+	}
+	b, err := r.reader.ReadByte()
+	if err != nil {
+		r.fail("Unexpected end of file")
+	}
+	return b
+}
+
+func (r *mapReader) readBytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > r.reader.Len() {
+		r.fail("Unexpected end of file (%d more bytes expected)", n)
+		return nil
+	}
+	buf := make([]byte, n)
+	io.ReadFull(r.reader, buf)
+	return buf
+}
+
+func (r *mapReader) expectMagic(magic uint8) {
+	if b := r.readByte(); r.err == nil && b != magic {
+		r.fail("Invalid magic byte 0x%02X (expected 0x%02X)", b, magic)
+	}
+}
+
+// readShort is the counterpart of writeShort
+func (r *mapReader) readShort() int {
+	if r.err != nil {
+		return 0
+	}
+	if r.flags&EncodingFlag_Varint != 0 {
+		value, err := binary.ReadVarint(r.reader)
+		if err != nil {
+			r.fail("Invalid varint: %v", err)
+		}
+		return int(value)
+	}
+	var value int16
+	if err := binary.Read(r.reader, r.order, &value); err != nil {
+		r.fail("Unexpected end of file")
+	}
+	return int(value)
+}
+
+// readCount reads a 16bit count and validates that it isn't negative
+func (r *mapReader) readCount() int {
+	count := r.readShort()
+	if count < 0 {
+		r.fail("Invalid count: %d", count)
+		return 0
+	}
+	return count
+}
+
+func (r *mapReader) readInt32() int32 {
+	if r.err != nil {
+		return 0
+	}
+	var value int32
+	if err := binary.Read(r.reader, r.order, &value); err != nil {
+		r.fail("Unexpected end of file")
+	}
+	return value
+}
+
+// readFloat is the counterpart of writeFloat
+func (r *mapReader) readFloat() float32 {
+	return float32(r.readInt32()) / FixedPointScale
+}
+
+func (r *mapReader) readString() string {
+	return string(r.readBytes(int(r.readByte())))
+}
+
+// DecodeMap decodes a converted map file
+func DecodeMap(data []byte, order binary.ByteOrder) (*EncodedMap, error) {
+	r := &mapReader{reader: bytes.NewReader(data), order: order}
+	encoded := &EncodedMap{}
+
+	r.expectMagic(0xA5)
+	encoded.Version = r.readByte()
+	if r.err == nil && !IsSupportedFormatVersion(int(encoded.Version)) {
+		return nil, fmt.Errorf("Unsupported format version %d", encoded.Version)
+	}
+	if encoded.Version >= 3 {
+		encoded.Flags = EncodingFlags(r.readByte())
+		r.flags = encoded.Flags
+	}
+	if encoded.Flags&EncodingFlag_TileFlags != 0 {
+		count := int(r.readByte())
+		for i := 0; i < count; i++ {
+			encoded.TileFlagNames = append(encoded.TileFlagNames, r.readString())
+		}
+	}
+
+	encoded.Width, encoded.Height = r.readCount(), r.readCount()
+	layerCount := int(r.readByte())
+	encoded.EnvironmentLayer = int(r.readByte())
+	if r.err == nil && encoded.EnvironmentLayer >= layerCount {
+		r.fail("Invalid environment layer %d (%d layers)", encoded.EnvironmentLayer, layerCount)
+	}
+	if encoded.Version >= 6 {
+		var features uint32
+		if r.err == nil && binary.Read(r.reader, r.order, &features) != nil {
+			r.fail("Unexpected end of file")
+		}
+		encoded.Features = FeatureFlags(features)
+		r.readBytes(HeaderReservedBytes) // unknown content is ignored, it's reserved for future versions
+	}
+	var checksums *checksumVerifier
+	if encoded.Version >= 5 {
+		checksums = &checksumVerifier{}
+		count := r.readCount()
+		for i := 0; i < count && r.err == nil; i++ {
+			entry := SectionChecksum{ID: SectionID(r.readByte()), Index: r.readByte()}
+			if r.err == nil && binary.Read(r.reader, r.order, &entry.Checksum) != nil {
+				r.fail("Unexpected end of file")
+			}
+			encoded.Checksums = append(encoded.Checksums, entry)
+		}
+	}
+	tileCount := encoded.Width * encoded.Height
+	for i := 0; i < layerCount && r.err == nil; i++ {
+		checksums.Begin(Section_Layer, i, r.offset())
+		layer := EncodedLayer{TileSetType: TileSetType(r.readByte())}
+		tiles := r.readBytes(2 * tileCount)
+		if r.err != nil {
+			break
+		}
+		layer.Flags, layer.Indices = make([]uint8, tileCount), make([]uint8, tileCount)
+		for t := 0; t < tileCount; t++ {
+			layer.Flags[t], layer.Indices[t] = tiles[2*t], tiles[2*t+1]
+		}
+		encoded.Layers = append(encoded.Layers, layer)
+	}
+	r.expectMagic(0xAA)
+
+	checksums.Begin(Section_Objects, 0, r.offset())
+	encoded.BackgroundObjects = decodeObjectLayer(r)
+	encoded.ForegroundObjects = decodeObjectLayer(r)
+	r.expectMagic(0x99)
+
+	checksums.Begin(Section_Resources, 0, r.offset())
+	count := int(r.readByte())
+	for i := 0; i < count && r.err == nil; i++ {
+		encoded.Resources = append(encoded.Resources, ResourcePoint{SpawnX: r.readShort(), SpawnY: r.readShort(), ResourcePointFlags: r.readByte()})
+	}
+	r.expectMagic(0x5A)
+
+	checksums.Begin(Section_Waterdrops, 0, r.offset())
+	count = int(r.readByte())
+	for i := 0; i < count && r.err == nil; i++ {
+		encoded.WaterdropSources = append(encoded.WaterdropSources, WaterdropSource{SpawnX: r.readShort(), SpawnY: r.readShort(), WaterdropFlags: r.readByte()})
+	}
+	r.expectMagic(0xFF)
+
+	checksums.Begin(Section_Players, 0, r.offset())
+	count = int(r.readByte())
+	for i := 0; i < count && r.err == nil; i++ {
+		encoded.Players = append(encoded.Players, decodePlayer(r, encoded.Version, i))
+	}
+
+	r.expectMagic(0xA5)
+	checksums.Begin(Section_Borders, 0, r.offset())
+	encoded.Borders = decodeBorderSet(r)
+
+	if encoded.Version >= 3 {
+		encoded.Sections = decodeSections(r, encoded.Version, tileCount, checksums)
+	}
+	r.expectMagic(0x55)
+	if r.err == nil && r.reader.Len() > 0 {
+		r.fail("Unexpected data after the end of the map (%d bytes)", r.reader.Len())
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if err := checksums.Verify(data, encoded.Checksums); err != nil {
+		return nil, err
+	}
+	return encoded, nil
+}
+
+func decodeObjectLayer(r *mapReader) []EncodedObject {
+	count := r.readCount()
+	objects := make([]EncodedObject, 0)
+	for i := 0; i < count && r.err == nil; i++ {
+		objects = append(objects, EncodedObject{
+			Index:    r.readByte(),
+			X:        r.readFloat(),
+			Y:        r.readFloat(),
+			Width:    r.readFloat(),
+			Height:   r.readFloat(),
+			Rotation: r.readFloat(),
+		})
+	}
+	return objects
+}
+
+func decodePlayer(r *mapReader, version uint8, slot int) Player {
+	player := Player{Slot: slot, Handicap: DefaultHandicap}
+
+	count := int(r.readByte())
+	for i := 0; i < count && r.err == nil; i++ {
+		building := Building{Type: BuildingType(r.readByte()), SpawnX: r.readShort(), SpawnY: r.readShort(), Flags: r.readByte()}
+		if version >= 3 {
+			if building.Type == BuildingType_Bridge {
+				building.SpanLength = int(r.readByte())
+			}
+			if building.Type == BuildingType_Turret {
+				building.FiringArcMin, building.FiringArcMax = r.readFloat(), r.readFloat()
+			}
+		}
+		player.Buildings = append(player.Buildings, building)
+	}
+
+	count = int(r.readByte())
+	for i := 0; i < count && r.err == nil; i++ {
+		player.Units = append(player.Units, Unit{Type: UnitType(r.readByte()), SpawnX: r.readShort(), SpawnY: r.readShort()})
+	}
+
+	if version >= 3 {
+		if r.readByte() != 0x00 {
+			player.Color = &Color{R: r.readByte(), G: r.readByte(), B: r.readByte(), A: r.readByte()}
+		}
+		player.Faction = r.readString()
+	}
+	if r.flags&EncodingFlag_PlayerSetup != 0 {
+		player.Handicap = int(r.readByte())
+		player.AIDifficulty = AIDifficulty(r.readByte())
+		player.AIPersonality = r.readString()
+	}
+	return player
+}
+
+// decodeBorderSet is the counterpart of encodeBorderSet
+func decodeBorderSet(r *mapReader) SortedBorderLines {
+	var borders SortedBorderLines
+	directions := []*[]BorderLine{
+		&borders.Left, &borders.Right, &borders.Up, &borders.Down,
+		&borders.UpLeft, &borders.UpRight, &borders.DownLeft, &borders.DownRight,
+	}
+
+	if r.flags&EncodingFlag_PackedBorders == 0 {
+		var counts [8]int
+		for i := range counts {
+			counts[i] = r.readCount()
+		}
+		for i, lines := range directions {
+			for l := 0; l < counts[i] && r.err == nil; l++ {
+				*lines = append(*lines, BorderLine{StartX: r.readShort(), StartY: r.readShort(), Length: r.readShort()})
+			}
+		}
+		return borders
+	}
+
+	if r.err != nil {
+		return borders
+	}
+	count, err := binary.ReadUvarint(r.reader)
+	if err != nil {
+		r.fail("Invalid packed borders: %v", err)
+		return borders
+	}
+	prevX, prevY := 0, 0
+	for i := uint64(0); i < count; i++ {
+		lengthAndDirection, err1 := binary.ReadUvarint(r.reader)
+		deltaX, err2 := binary.ReadVarint(r.reader)
+		deltaY, err3 := binary.ReadVarint(r.reader)
+		if err1 != nil || err2 != nil || err3 != nil {
+			r.fail("Invalid packed border line %d", i)
+			return borders
+		}
+		line := BorderLine{StartX: prevX + int(deltaX), StartY: prevY + int(deltaY), Length: int(lengthAndDirection >> 3)}
+		lines := directions[lengthAndDirection&0x07]
+		*lines = append(*lines, line)
+		prevX, prevY = line.StartX, line.StartY
+	}
+	return borders
+}
+
+// decodeSections reads all sections after the borders.
+// Since format version 4, sections are prefixed with their length. Format version 3 has a fixed list of sections,
+// which need to be parsed to find out where they end.
+func decodeSections(r *mapReader, version uint8, tileCount int, checksums *checksumVerifier) []EncodedSection {
+	sections := make([]EncodedSection, 0)
+	if version >= 4 {
+		for r.err == nil {
+			start := r.offset()
+			id := SectionID(r.readByte())
+			if id == Section_End {
+				break
+			}
+			checksums.Begin(id, 0, start)
+			var length uint32
+			if r.err == nil && binary.Read(r.reader, r.order, &length) != nil {
+				r.fail("Unexpected end of file")
+			}
+			sections = append(sections, EncodedSection{ID: id, Content: r.readBytes(int(length))})
+		}
+		return sections
+	}
+
+	for _, id := range []SectionID{Section_Hazards, Section_Wind, Section_Environment, Section_Checkpoints, Section_CameraPaths, Section_Victory, Section_AIHints} {
+		r.expectMagic(uint8(id))
+		start := r.offset()
+		skipSection(r, id, tileCount)
+		if r.err != nil {
+			break
+		}
+		end := r.offset()
+		r.reader.Seek(int64(start), io.SeekStart)
+		sections = append(sections, EncodedSection{ID: id, Content: r.readBytes(end - start)})
+	}
+	return sections
+}
+
+// skipSection reads over the content of a format version 3 section
+func skipSection(r *mapReader, id SectionID, tileCount int) {
+	const floatSize, rectSize = 4, 16
+	switch id {
+	case Section_Hazards:
+		r.readBytes(int(r.readByte()) * (1 + rectSize + 2*floatSize))
+	case Section_Wind:
+		if r.readByte() != 0x00 {
+			r.readBytes(tileCount * 2 * floatSize)
+		}
+	case Section_Environment:
+		r.readBytes(3*floatSize + 4)
+	case Section_Checkpoints:
+		r.readBytes(int(r.readByte()) * rectSize)
+	case Section_CameraPaths:
+		count := int(r.readByte())
+		for i := 0; i < count && r.err == nil; i++ {
+			r.readBytes(int(r.readByte()) * 3 * floatSize)
+		}
+	case Section_Victory:
+		mode := VictoryMode(r.readByte())
+		r.readFloat() // time limit
+		switch mode {
+		case VictoryMode_KingOfTheHill:
+			r.readFloat() // hold time
+			r.readBytes(int(r.readByte()) * rectSize)
+		case VictoryMode_Economic:
+			r.readInt32() // resource goal
+		}
+	case Section_AIHints:
+		r.readBytes(r.readCount() * (2 + 2*floatSize))
+	}
+}
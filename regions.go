@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// RegionMap assigns a region id to every tile of a layer. Tiles with the same id are connected.
+// Completely solid tiles are not part of any region and have the id -1.
+type RegionMap struct {
+	Width   int
+	Height  int
+	Regions []int
+	Count   int // number of regions
+}
+
+// GetRegion returns the region id of the given tile, or -1 for solid tiles and positions outside the map
+func (regions *RegionMap) GetRegion(x, y int) int {
+	if x < 0 || x >= regions.Width || y < 0 || y >= regions.Height {
+		return -1
+	}
+	return regions.Regions[y*regions.Width+x]
+}
+
+// IsConnected returns true if both tiles are in the same region
+func (regions *RegionMap) IsConnected(x1, y1, x2, y2 int) bool {
+	region := regions.GetRegion(x1, y1)
+	return region != -1 && region == regions.GetRegion(x2, y2)
+}
+
+// ComputeRegions finds all areas of the given layer that are connected.
+// Two neighbouring tiles are connected if there is no border between them (see HasBorderTowards).
+// The tiles are joined with a union-find. The rows are split into one contiguous batch per CPU, which are processed
+// in parallel and merged along their boundary rows afterwards. Region ids are assigned in row-major order of the
+// first tile of each region, so that the result doesn't depend on the number of batches.
+func ComputeRegions(width, height int, layer *TileMapLayer) (*RegionMap, error) {
+	if len(layer.Tiles) != width*height {
+		return nil, fmt.Errorf("Failed to compute regions: Invalid map size supplied")
+	}
+
+	regions := &RegionMap{
+		Width:   width,
+		Height:  height,
+		Regions: make([]int, width*height),
+	}
+	sets := newTileUnionFind(layer)
+	defer putInt32Scratch(sets.parent)
+
+	batchCount := runtime.NumCPU()
+	if batchCount > height {
+		batchCount = height
+	}
+	if batchCount < 1 {
+		return regions, nil
+	}
+	batchSize := (height + batchCount - 1) / batchCount
+
+	// Each batch only joins tiles within its own rows, so that the batches never touch the same entries
+	var wg sync.WaitGroup
+	for b := 0; b < batchCount; b++ {
+		wg.Add(1)
+		go func(firstRow, lastRow int) {
+			defer wg.Done()
+			for y := firstRow; y < lastRow && y < height; y++ {
+				sets.joinRow(width, y, y > firstRow)
+			}
+		}(b*batchSize, (b+1)*batchSize)
+	}
+	wg.Wait()
+
+	for y := batchSize; y < height; y += batchSize {
+		sets.joinRows(width, y)
+	}
+
+	ids := getInt32Scratch(len(layer.Tiles)) // root -> region id + 1
+	defer putInt32Scratch(ids)
+	for idx := range regions.Regions {
+		root := sets.find(int32(idx))
+		if root == -1 {
+			regions.Regions[idx] = -1
+			continue
+		}
+		if ids[root] == 0 {
+			regions.Count++
+			ids[root] = int32(regions.Count)
+		}
+		regions.Regions[idx] = int(ids[root]) - 1
+	}
+	return regions, nil
+}
+
+// tileUnionFind joins connected tiles of a layer. Completely solid tiles are not part of any set.
+type tileUnionFind struct {
+	layer  *TileMapLayer
+	parent []int32 // -1 for solid tiles; scratch buffer
+}
+
+func newTileUnionFind(layer *TileMapLayer) *tileUnionFind {
+	sets := &tileUnionFind{layer: layer, parent: getInt32Scratch(len(layer.Tiles))}
+	for idx := range layer.Tiles {
+		if layer.Tiles[idx].IsCompletelySolid() {
+			sets.parent[idx] = -1
+		} else {
+			sets.parent[idx] = int32(idx)
+		}
+	}
+	return sets
+}
+
+// find returns the root of the tile's set, or -1 for solid tiles
+func (sets *tileUnionFind) find(idx int32) int32 {
+	if sets.parent[idx] == -1 {
+		return -1
+	}
+	for sets.parent[idx] != idx {
+		sets.parent[idx] = sets.parent[sets.parent[idx]] // path halving
+		idx = sets.parent[idx]
+	}
+	return idx
+}
+
+// join merges the sets of two neighbouring tiles if there is no border between them. The smaller index becomes the root.
+func (sets *tileUnionFind) join(idx, nidx int, side Orientation) {
+	tiles := sets.layer.Tiles
+	if tiles[idx].HasBorderTowards(side) || tiles[nidx].HasBorderTowards(GetInvertedOrientation(side)) {
+		return
+	}
+	a, b := sets.find(int32(idx)), sets.find(int32(nidx))
+	if a == -1 || b == -1 || a == b {
+		return
+	}
+	if a < b {
+		sets.parent[b] = a
+	} else {
+		sets.parent[a] = b
+	}
+}
+
+// joinRow joins the tiles of a row with their right neighbours and, if withAbove is set, with the tiles in the row above
+func (sets *tileUnionFind) joinRow(width, y int, withAbove bool) {
+	for x := 0; x < width; x++ {
+		idx := y*width + x
+		if x+1 < width {
+			sets.join(idx, idx+1, RIGHT)
+		}
+		if withAbove {
+			sets.join(idx, idx-width, UP)
+		}
+	}
+}
+
+// joinRows joins the tiles of a row with the tiles in the row above
+func (sets *tileUnionFind) joinRows(width, y int) {
+	for x := 0; x < width; x++ {
+		idx := y*width + x
+		sets.join(idx, idx-width, UP)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RenderPass defines whether a tile layer is rendered behind or in front of units
+type RenderPass uint8
+
+const (
+	RenderPass_Background RenderPass = 0x00 // behind units
+	RenderPass_Foreground RenderPass = 0x01 // in front of units
+)
+
+func (pass RenderPass) String() string {
+	if pass == RenderPass_Foreground {
+		return "foreground"
+	}
+	return "background"
+}
+
+// ParseRenderPass parses the value of the layer property "renderPass"
+func ParseRenderPass(str string) (RenderPass, error) {
+	switch strings.ToLower(str) {
+	case "background", "behind":
+		return RenderPass_Background, nil
+	case "foreground", "front":
+		return RenderPass_Foreground, nil
+	}
+	return 0, fmt.Errorf("Invalid render pass %q. Allowed values: background, foreground", str)
+}
+
+// ExtractRenderPasses decides for every layer whether it's rendered behind or in front of units (in Tiled order).
+// The layer property "renderPass" has precedence. Otherwise, layers named "...foreground..." or "...front..." are rendered in front
+// and layers named "...background..." or "...back..." behind units. All other layers are rendered in front of units if they are
+// above the environment layer.
+func ExtractRenderPasses(tilemap *TileMap) ([]RenderPass, error) {
+	environmentLayerIdx, err := tilemap.GetLayer("environment")
+	if err != nil {
+		return nil, err
+	}
+
+	passes := make([]RenderPass, len(tilemap.Layers))
+	for i, layer := range tilemap.Layers {
+		name := strings.ToLower(layer.Name)
+		switch value, ok := layer.Properties.Get("renderPass"); {
+		case ok:
+			if passes[i], err = ParseRenderPass(value); err != nil {
+				return nil, fmt.Errorf("Invalid layer %q: %v", layer.Name, err)
+			}
+		case strings.Contains(name, "foreground") || strings.Contains(name, "front"):
+			passes[i] = RenderPass_Foreground
+		case strings.Contains(name, "background") || strings.Contains(name, "back"):
+			passes[i] = RenderPass_Background
+		case i > environmentLayerIdx:
+			passes[i] = RenderPass_Foreground
+		default:
+			passes[i] = RenderPass_Background
+		}
+	}
+	if passes[environmentLayerIdx] != RenderPass_Background {
+		log.Warningf("The environment layer is rendered in front of units")
+	}
+	return passes, nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/op/go-logging"
+)
+
+// ConversionReport is the machine-readable summary of a conversion run (-report)
+type ConversionReport struct {
+	Maps []*MapReport `json:"maps"`
+}
+
+// MapReport contains the result of converting a single map
+type MapReport struct {
+	Map      string         `json:"map"`
+	Success  bool           `json:"success"`
+	Error    string         `json:"error,omitempty"`
+	Warnings []string       `json:"warnings"`
+	Errors   []string       `json:"errors"`
+	Counts   *MapCounts     `json:"counts,omitempty"` // nil if the conversion failed before the map was analysed
+	Outputs  []OutputReport `json:"outputs"`
+
+	start    time.Time
+	duration time.Duration // conversion time, for the JUnit report
+}
+
+// MapCounts are the number of elements that were extracted from a map
+type MapCounts struct {
+	Resources         int `json:"resources"`
+	Waterdrops        int `json:"waterdrops"`
+	Players           int `json:"players"`
+	Buildings         int `json:"buildings"`
+	Units             int `json:"units"`
+	Borders           int `json:"borders"`
+	ForegroundObjects int `json:"foregroundObjects"`
+	BackgroundObjects int `json:"backgroundObjects"`
+}
+
+// OutputReport describes a written output file
+type OutputReport struct {
+	File          string `json:"file"`
+	FormatVersion uint8  `json:"formatVersion"`
+	Size          int    `json:"size"`
+	SHA256        string `json:"sha256"`
+}
+
+// BeginMap adds a new map to the report. All warnings and errors that are logged until Finish is called are recorded.
+// Returns nil if the report is disabled (nil).
+func (report *ConversionReport) BeginMap(mapFile string) *MapReport {
+	if report == nil {
+		return nil
+	}
+	mapReport := &MapReport{Map: mapFile, Warnings: []string{}, Errors: []string{}, Outputs: []OutputReport{}, start: time.Now()}
+	report.Maps = append(report.Maps, mapReport)
+	logRecorder = mapReport.record
+	return mapReport
+}
+
+// Write stores the report as JSON at the given target (see WriteOutput)
+func (report *ConversionReport) Write(target string) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Failed to create report: %v", err)
+	}
+	if err := WriteOutput(target, append(data, '\n')); err != nil {
+		return fmt.Errorf("Failed to write report: %v", err)
+	}
+	return nil
+}
+
+func (report *MapReport) record(level logging.Level, message string, x, y int) {
+	if level <= logging.ERROR {
+		report.Errors = append(report.Errors, message)
+	} else {
+		report.Warnings = append(report.Warnings, message)
+	}
+}
+
+// SetCounts stores the number of extracted elements
+func (report *MapReport) SetCounts(tilemap *TileMap, resources []ResourcePoint, waterdropSources []WaterdropSource, players []Player, borders SortedBorderLines) {
+	if report == nil {
+		return
+	}
+	counts := &MapCounts{
+		Resources:  len(resources),
+		Waterdrops: len(waterdropSources),
+		Players:    len(players),
+		Borders: len(borders.Left) + len(borders.Right) + len(borders.Up) + len(borders.Down) +
+			len(borders.UpLeft) + len(borders.UpRight) + len(borders.DownLeft) + len(borders.DownRight),
+	}
+	for _, player := range players {
+		counts.Buildings += len(player.Buildings)
+		counts.Units += len(player.Units)
+	}
+	if tilemap.ForegroundObjectLayer != nil {
+		counts.ForegroundObjects = len(tilemap.ForegroundObjectLayer.Objects)
+	}
+	if tilemap.BackgroundObjectLayer != nil {
+		counts.BackgroundObjects = len(tilemap.BackgroundObjectLayer.Objects)
+	}
+	report.Counts = counts
+}
+
+// AddOutput records a written output file and its checksum
+func (report *MapReport) AddOutput(target string, version uint8, data []byte) {
+	if report == nil {
+		return
+	}
+	report.Outputs = append(report.Outputs, OutputReport{
+		File:          target,
+		FormatVersion: version,
+		Size:          len(data),
+		SHA256:        sha256Hex(data),
+	})
+}
+
+// Finish stops recording log messages and stores the result of the conversion
+func (report *MapReport) Finish(err error) {
+	if report == nil {
+		return
+	}
+	logRecorder = nil
+	report.duration = time.Since(report.start)
+	report.Success = err == nil
+	if err != nil {
+		report.Error = err.Error()
+		report.Errors = append(report.Errors, err.Error())
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"sync"
+)
+
+// Scratch buffers of the preprocessing passes (borders, regions, water volumes, decoration density).
+// On large maps, these temporary buffers are hundreds of MB per conversion. They are pooled, so that repeated
+// conversions (eg. in watch mode) reuse them instead of creating garbage. Buffers must be released once the pass is done
+// and must not be referenced afterwards. All get-functions return zeroed buffers.
+var (
+	int32Scratch      sync.Pool // *[]int32
+	intScratch        sync.Pool // *[]int
+	boolScratch       sync.Pool // *[]bool
+	tileScratch       sync.Pool // *[]Tile
+	borderLineScratch sync.Pool // *[]BorderLine
+)
+
+func getInt32Scratch(size int) []int32 {
+	if buffer, ok := int32Scratch.Get().(*[]int32); ok && cap(*buffer) >= size {
+		scratch := (*buffer)[:size]
+		for i := range scratch {
+			scratch[i] = 0
+		}
+		return scratch
+	}
+	return make([]int32, size)
+}
+
+func putInt32Scratch(scratch []int32) {
+	int32Scratch.Put(&scratch)
+}
+
+func getIntScratch(size int) []int {
+	if buffer, ok := intScratch.Get().(*[]int); ok && cap(*buffer) >= size {
+		scratch := (*buffer)[:size]
+		for i := range scratch {
+			scratch[i] = 0
+		}
+		return scratch
+	}
+	return make([]int, size)
+}
+
+func putIntScratch(scratch []int) {
+	intScratch.Put(&scratch)
+}
+
+func getBoolScratch(size int) []bool {
+	if buffer, ok := boolScratch.Get().(*[]bool); ok && cap(*buffer) >= size {
+		scratch := (*buffer)[:size]
+		for i := range scratch {
+			scratch[i] = false
+		}
+		return scratch
+	}
+	return make([]bool, size)
+}
+
+func putBoolScratch(scratch []bool) {
+	boolScratch.Put(&scratch)
+}
+
+func getTileScratch(size int) []Tile {
+	if buffer, ok := tileScratch.Get().(*[]Tile); ok && cap(*buffer) >= size {
+		scratch := (*buffer)[:size]
+		for i := range scratch {
+			scratch[i] = Tile{}
+		}
+		return scratch
+	}
+	return make([]Tile, size)
+}
+
+func putTileScratch(scratch []Tile) {
+	tileScratch.Put(&scratch)
+}
+
+// getBorderLineScratch returns an empty buffer with at least the given capacity
+func getBorderLineScratch(capacity int) []BorderLine {
+	if buffer, ok := borderLineScratch.Get().(*[]BorderLine); ok && cap(*buffer) >= capacity {
+		return (*buffer)[:0]
+	}
+	return make([]BorderLine, 0, capacity)
+}
+
+func putBorderLineScratch(scratch []BorderLine) {
+	borderLineScratch.Put(&scratch)
+}
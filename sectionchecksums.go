@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+)
+
+// SectionChecksum is an entry of the checksum table (format version 5+). The game's hot-reload compares the tables of two
+// versions of a map to find out which parts changed. Besides the optional sections, the table contains every tile layer
+// and the fixed parts in front of the sections (see Section_Layer to Section_Borders).
+type SectionChecksum struct {
+	ID       SectionID
+	Index    uint8  // layer index (in file order) for Section_Layer, 0 otherwise
+	Checksum uint32 // CRC-32 (IEEE) of the part, including its id, length and trailing magic bytes
+}
+
+// checksumRecorder buffers everything that is written after the header, so that the checksum table can be written in front of it.
+// A part starts with Begin and ends where the next part starts. A nil recorder (format version < 5) records nothing.
+type checksumRecorder struct {
+	content bytes.Buffer
+	writer  *bufio.Writer
+	parts   []SectionChecksum
+	starts  []int
+}
+
+func newChecksumRecorder() *checksumRecorder {
+	recorder := &checksumRecorder{}
+	recorder.writer = bufio.NewWriter(&recorder.content)
+	return recorder
+}
+
+// Begin starts a new part
+func (recorder *checksumRecorder) Begin(id SectionID, index int) {
+	if recorder == nil {
+		return
+	}
+	recorder.writer.Flush()
+	recorder.parts = append(recorder.parts, SectionChecksum{ID: id, Index: uint8(index)})
+	recorder.starts = append(recorder.starts, recorder.content.Len())
+}
+
+// Finish writes the checksum table, followed by the recorded content: [count (short), [id (uint8), index (uint8), checksum (uint32)]...]
+func (recorder *checksumRecorder) Finish(writer *bufio.Writer, order binary.ByteOrder, flags EncodingFlags) error {
+	if recorder == nil {
+		return nil
+	}
+	recorder.writer.Flush()
+	content := recorder.content.Bytes()
+	for i := range recorder.parts {
+		end := len(content)
+		if i+1 < len(recorder.starts) {
+			end = recorder.starts[i+1]
+		}
+		recorder.parts[i].Checksum = crc32.ChecksumIEEE(content[recorder.starts[i]:end])
+	}
+
+	if err := writeShort(writer, order, flags, len(recorder.parts)); err != nil {
+		return fmt.Errorf("Checksum table can't be encoded: %v", err)
+	}
+	for _, part := range recorder.parts {
+		writer.WriteByte(byte(part.ID))
+		writer.WriteByte(part.Index)
+		if err := binary.Write(writer, order, part.Checksum); err != nil {
+			return err
+		}
+	}
+	_, err := writer.Write(content)
+	return err
+}
+
+// checksumVerifier is the counterpart of checksumRecorder for decoding. It remembers where the parts start and
+// compares their checksums with the table once the whole file has been read.
+type checksumVerifier struct {
+	parts  []SectionChecksum
+	starts []int
+}
+
+// Begin starts a new part at the given offset
+func (verifier *checksumVerifier) Begin(id SectionID, index int, offset int) {
+	if verifier == nil {
+		return
+	}
+	verifier.parts = append(verifier.parts, SectionChecksum{ID: id, Index: uint8(index)})
+	verifier.starts = append(verifier.starts, offset)
+}
+
+// Verify compares the parts that were read with the checksum table. data is the whole file.
+func (verifier *checksumVerifier) Verify(data []byte, table []SectionChecksum) error {
+	if verifier == nil {
+		return nil
+	}
+	if len(verifier.parts) != len(table) {
+		return fmt.Errorf("The checksum table has %d entries, but the file has %d parts", len(table), len(verifier.parts))
+	}
+	for i, part := range verifier.parts {
+		end := len(data)
+		if i+1 < len(verifier.starts) {
+			end = verifier.starts[i+1]
+		}
+		entry := table[i]
+		if entry.ID != part.ID || entry.Index != part.Index {
+			return fmt.Errorf("Checksum table entry %d belongs to %v, but the part in the file is %v", i, entry.Name(), part.Name())
+		}
+		if checksum := crc32.ChecksumIEEE(data[verifier.starts[i]:end]); checksum != entry.Checksum {
+			return fmt.Errorf("Checksum mismatch of %v: stored 0x%08X, computed 0x%08X", part.Name(), entry.Checksum, checksum)
+		}
+	}
+	return nil
+}
+
+// Name returns the name of the part the checksum belongs to
+func (checksum SectionChecksum) Name() string {
+	if checksum.ID == Section_Layer {
+		return fmt.Sprintf("layer %d", checksum.Index)
+	}
+	return checksum.ID.String()
+}
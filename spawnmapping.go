@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"sort"
+)
+
+// PlayerSlots is the number of players the spawn tileset provides tiles for
+const PlayerSlots = 8
+
+var unitTypeNames = map[UnitType]string{
+	UnitType_Offense:      "offense",
+	UnitType_Defense:      "defense",
+	UnitType_LongRange:    "longrange",
+	UnitType_Special:      "special",
+	UnitType_Construction: "construction",
+}
+
+var buildingTypeNames = map[BuildingType]string{
+	BuildingType_Base:    "base",
+	BuildingType_Pump:    "pump",
+	BuildingType_Factory: "factory",
+	BuildingType_Turret:  "turret",
+	BuildingType_Bridge:  "bridge",
+}
+
+// SpawnMapping is a spawn tile mapping loaded from a mapping file (JSON). It replaces the built-in mapping of GetTileMapping.
+// All ids are tile indices within the spawn tileset (starting at 1).
+type SpawnMapping struct {
+	Resource  uint32               `json:"resource"`
+	Waterdrop uint32               `json:"waterdrop"`
+	Players   []PlayerSpawnMapping `json:"players"` // indexed by player slot
+	Buildings map[string]uint32    `json:"buildings"`
+
+	Footprints map[string]BuildingFootprint `json:"footprints"` // by building type. Building types without footprint use the default
+}
+
+// PlayerSpawnMapping contains the tiles of a single player slot
+type PlayerSpawnMapping struct {
+	Token uint32            `json:"token"`
+	Units map[string]uint32 `json:"units"`
+}
+
+// spawnMapping is the mapping file used for conversions. nil if the built-in mapping is used.
+var spawnMapping *SpawnMapping
+
+// LoadSpawnMapping reads a mapping file
+func LoadSpawnMapping(location string) (*SpawnMapping, error) {
+	data, err := ReadInput(location)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read mapping file '%v': %v", location, err)
+	}
+	var mapping SpawnMapping
+	if err := json.Unmarshal(data, &mapping); err != nil {
+		return nil, fmt.Errorf("Failed to read mapping file '%v': %v", location, err)
+	}
+	return &mapping, nil
+}
+
+// Lint checks the mapping against a spawn tileset with the given number of tiles and returns all problems found
+func (mapping *SpawnMapping) Lint(tileCount uint32) []string {
+	var problems []string
+	usedBy := make(map[uint32]string)
+	use := func(tile uint32, role string) {
+		switch {
+		case tile == 0:
+			problems = append(problems, fmt.Sprintf("%s: no tile assigned", role))
+		case tile > tileCount:
+			problems = append(problems, fmt.Sprintf("%s: tile %d does not exist in the spawn tileset (%d tiles)", role, tile, tileCount))
+		case usedBy[tile] != "":
+			problems = append(problems, fmt.Sprintf("%s: tile %d is already used by %s", role, tile, usedBy[tile]))
+		default:
+			usedBy[tile] = role
+		}
+	}
+
+	use(mapping.Resource, "resource")
+	use(mapping.Waterdrop, "waterdrop")
+
+	if len(mapping.Players) != PlayerSlots {
+		problems = append(problems, fmt.Sprintf("players: %d player slots are defined, but %d are required", len(mapping.Players), PlayerSlots))
+	}
+	for slot, player := range mapping.Players {
+		use(player.Token, fmt.Sprintf("player %d token", slot))
+		for _, unitType := range sortedUnitTypes() {
+			name := unitTypeNames[unitType]
+			if tile, ok := player.Units[name]; ok {
+				use(tile, fmt.Sprintf("player %d unit %q", slot, name))
+			} else {
+				problems = append(problems, fmt.Sprintf("player %d: missing unit %q", slot, name))
+			}
+		}
+		for _, name := range sortedKeys(player.Units) {
+			if _, ok := unitTypeByName(name); !ok {
+				problems = append(problems, fmt.Sprintf("player %d: unknown unit type %q", slot, name))
+			}
+		}
+	}
+
+	for _, name := range sortedKeys(mapping.Buildings) {
+		if _, ok := buildingTypeByName(name); !ok {
+			problems = append(problems, fmt.Sprintf("buildings: unknown building type %q", name))
+			continue
+		}
+		use(mapping.Buildings[name], fmt.Sprintf("building %q", name))
+	}
+	return append(problems, lintFootprints(mapping.Footprints, tileCount, usedBy)...)
+}
+
+// TileMapping returns the mapping in the form of GetTileMapping. The mapping must have been linted.
+func (mapping *SpawnMapping) TileMapping() (uint32, uint32, map[uint32]PlayerMapping, map[uint32]BuildingMapping, map[uint32]UnitMapping) {
+	playermapping := make(map[uint32]PlayerMapping)
+	buildingmapping := make(map[uint32]BuildingMapping)
+	unitmapping := make(map[uint32]UnitMapping)
+
+	for slot, player := range mapping.Players {
+		playermapping[player.Token] = PlayerMapping{slot}
+		for name, tile := range player.Units {
+			unitType, _ := unitTypeByName(name)
+			unitmapping[tile] = UnitMapping{slot, unitType}
+		}
+	}
+	for name, tile := range mapping.Buildings {
+		buildingType, _ := buildingTypeByName(name)
+		buildingmapping[tile] = BuildingMapping{buildingType}
+	}
+	return mapping.Resource, mapping.Waterdrop, playermapping, buildingmapping, unitmapping
+}
+
+func unitTypeByName(name string) (UnitType, bool) {
+	for unitType, n := range unitTypeNames {
+		if n == name {
+			return unitType, true
+		}
+	}
+	return 0, false
+}
+
+func buildingTypeByName(name string) (BuildingType, bool) {
+	for buildingType, n := range buildingTypeNames {
+		if n == name {
+			return buildingType, true
+		}
+	}
+	return 0, false
+}
+
+func sortedUnitTypes() []UnitType {
+	var types []UnitType
+	for unitType := range unitTypeNames {
+		types = append(types, unitType)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
+
+func sortedKeys(m map[string]uint32) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// RunLintMapping validates a mapping file against the spawn tileset
+func RunLintMapping(args []string) error {
+	flags := flag.NewFlagSet("lint-mapping", flag.ContinueOnError)
+	tilesetFile := flags.String("tileset", "", "Spawn tileset (.tsx) to validate against (default: the built-in layout)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("Usage: lint-mapping [-tileset <Spawn.tsx>] <mapping.json>")
+	}
+
+	mapping, err := LoadSpawnMapping(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	var tileCount uint32 = SpawnTilesetTileCount
+	if *tilesetFile != "" {
+		data, err := ReadInput(*tilesetFile)
+		if err != nil {
+			return fmt.Errorf("Failed to read tileset '%v': %v", *tilesetFile, err)
+		}
+		if data, err = NormalizeXML(data); err != nil {
+			return fmt.Errorf("Failed to read tileset '%v': %v", *tilesetFile, err)
+		}
+		var tileset TileSet
+		if err := xml.Unmarshal(data, &tileset); err != nil {
+			return fmt.Errorf("Failed to read tileset '%v': %v", *tilesetFile, err)
+		}
+		if err := tileset.computeTileCount(DecoderOptions{Legacy: true}); err != nil {
+			return err
+		}
+		tileCount = tileset.TileCount
+	}
+
+	problems := mapping.Lint(tileCount)
+	for _, problem := range problems {
+		log.Warning(problem)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("The mapping file '%v' has %d problem(s)", flags.Arg(0), len(problems))
+	}
+	log.Infof("The mapping file '%v' is valid", flags.Arg(0))
+	return nil
+}
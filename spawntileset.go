@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Layout of the spawn tileset. Existing maps rely on it, so it must not change.
+const (
+	SpawnTilesetName      = "Spawn"
+	SpawnTilesetColumns   = 20
+	SpawnTilesetTileCount = 300
+	SpawnTilesetTileSize  = 256
+)
+
+// SpawnTileIcons returns, for every tile of the spawn tileset that is used by GetTileMapping, the names of the icon
+// files that can be used for it (ordered by preference, without file extension).
+func SpawnTileIcons() map[uint32][]string {
+	resourceMapping, waterdropSpawnMapping, playerMapping, buildingMapping, unitMapping := GetTileMapping()
+
+	icons := make(map[uint32][]string)
+	icons[resourceMapping] = []string{"resource"}
+	icons[waterdropSpawnMapping] = []string{"waterdrop"}
+	for tile, m := range playerMapping {
+		icons[tile] = []string{fmt.Sprintf("player_%d", m.Player), "player"}
+	}
+	for tile, m := range unitMapping {
+		name := "unit_" + unitTypeNames[m.Type]
+		icons[tile] = []string{fmt.Sprintf("%s_%d", name, m.Player), name}
+	}
+	for tile, m := range buildingMapping {
+		icons[tile] = []string{"building_" + buildingTypeNames[m.Type]}
+	}
+	return icons
+}
+
+// GenerateSpawnTileset renders the spawn tileset image from the icons in iconDir.
+// Icons are png files named after their role (see SpawnTileIcons) and are scaled to the tile size.
+func GenerateSpawnTileset(iconDir string) (*image.NRGBA, error) {
+	rows := (SpawnTilesetTileCount + SpawnTilesetColumns - 1) / SpawnTilesetColumns
+	img := image.NewNRGBA(image.Rect(0, 0, SpawnTilesetColumns*SpawnTilesetTileSize, rows*SpawnTilesetTileSize))
+
+	icons := SpawnTileIcons()
+	tiles := make([]int, 0, len(icons))
+	for tile := range icons {
+		tiles = append(tiles, int(tile))
+	}
+	sort.Ints(tiles)
+
+	var missing []string
+	for _, tile := range tiles {
+		names := icons[uint32(tile)]
+		if tile < 1 || tile > SpawnTilesetTileCount {
+			return nil, fmt.Errorf("The spawn tile %d (%s) is outside of the spawn tileset", tile, names[0])
+		}
+
+		icon, err := loadIcon(iconDir, names)
+		if err != nil {
+			return nil, err
+		}
+		if icon == nil {
+			fallback := names[len(names)-1] + ".png"
+			if len(missing) == 0 || missing[len(missing)-1] != fallback {
+				missing = append(missing, fallback)
+			}
+			continue
+		}
+
+		x := (tile - 1) % SpawnTilesetColumns * SpawnTilesetTileSize
+		y := (tile - 1) / SpawnTilesetColumns * SpawnTilesetTileSize
+		drawScaled(img, image.Rect(x, y, x+SpawnTilesetTileSize, y+SpawnTilesetTileSize), icon)
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("Missing icons in '%s': %s", iconDir, strings.Join(missing, ", "))
+	}
+	return img, nil
+}
+
+// loadIcon loads the first existing icon. Returns nil if none of them exist.
+func loadIcon(iconDir string, names []string) (image.Image, error) {
+	for _, name := range names {
+		file, err := os.Open(filepath.Join(iconDir, name+".png"))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		icon, err := png.Decode(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read icon '%s.png': %v", name, err)
+		}
+		return icon, nil
+	}
+	return nil, nil
+}
+
+// drawScaled draws the source image into the given rectangle (nearest neighbor)
+func drawScaled(dst draw.Image, rect image.Rectangle, src image.Image) {
+	bounds := src.Bounds()
+	if bounds.Dx() == rect.Dx() && bounds.Dy() == rect.Dy() {
+		draw.Draw(dst, rect, src, bounds.Min, draw.Src)
+		return
+	}
+	for y := 0; y < rect.Dy(); y++ {
+		sy := bounds.Min.Y + y*bounds.Dy()/rect.Dy()
+		for x := 0; x < rect.Dx(); x++ {
+			sx := bounds.Min.X + x*bounds.Dx()/rect.Dx()
+			dst.Set(rect.Min.X+x, rect.Min.Y+y, src.At(sx, sy))
+		}
+	}
+}
+
+// spawnTilesetFile is the content of the generated .tsx file
+type spawnTilesetFile struct {
+	XMLName    xml.Name     `xml:"tileset"`
+	Name       string       `xml:"name,attr"`
+	TileWidth  int          `xml:"tilewidth,attr"`
+	TileHeight int          `xml:"tileheight,attr"`
+	TileCount  int          `xml:"tilecount,attr"`
+	Columns    int          `xml:"columns,attr"`
+	Image      TileSetImage `xml:"image"`
+}
+
+// RunGenerateSpawnTileset generates the spawn tileset image and its .tsx file
+func RunGenerateSpawnTileset(args []string) error {
+	flags := flag.NewFlagSet("gen-spawn-tileset", flag.ContinueOnError)
+	outputDir := flags.String("o", ".", "Output directory for SpawnLayer.png and Spawn.tsx")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("Usage: gen-spawn-tileset [-o <outputdir>] <icondir>")
+	}
+
+	img, err := GenerateSpawnTileset(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, img); err != nil {
+		return err
+	}
+	imageFile := filepath.Join(*outputDir, "SpawnLayer.png")
+	if err := WriteOutput(imageFile, encoded.Bytes()); err != nil {
+		return err
+	}
+
+	tsx, err := xml.MarshalIndent(spawnTilesetFile{
+		Name:       SpawnTilesetName,
+		TileWidth:  SpawnTilesetTileSize,
+		TileHeight: SpawnTilesetTileSize,
+		TileCount:  SpawnTilesetTileCount,
+		Columns:    SpawnTilesetColumns,
+		Image: TileSetImage{
+			Source: filepath.Base(imageFile),
+			Width:  img.Bounds().Dx(),
+			Height: img.Bounds().Dy(),
+		},
+	}, "", " ")
+	if err != nil {
+		return err
+	}
+	tsx = append([]byte(xml.Header), append(collapseEmptyElements(tsx), '\n')...)
+
+	tsxFile := filepath.Join(*outputDir, SpawnTilesetName+".tsx")
+	if err := WriteOutput(tsxFile, tsx); err != nil {
+		return err
+	}
+	log.Infof("Wrote '%s' and '%s' (mapping %s)", imageFile, tsxFile, mappingHash())
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Squad is a named group of units of a single player, which can be addressed by the campaign scripting.
+// Squads are rectangle objects with the type 'squad' inside the 'Markers' object layer. All units inside the rectangle
+// belong to the squad that is named by the property 'squad'. Multiple rectangles with the same name form a single squad.
+type Squad struct {
+	Name   string
+	Player int   // index into the encoded players
+	Units  []int // indices into the player's units
+}
+
+// ExtractSquads assigns units to squads
+func ExtractSquads(tilemap *TileMap, players []Player) ([]Squad, error) {
+	areas := make(map[string][]Rect)
+	for _, object := range tilemap.GetMarkers("squad") {
+		name, ok := object.Properties.Get("squad")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("Invalid squad %d (%q): The property 'squad' is missing", object.Id, object.Name)
+		}
+		rect, err := tilemap.GetMarkerRect(object)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid squad %q: %v", name, err)
+		}
+		areas[name] = append(areas[name], rect)
+	}
+
+	names := make([]string, 0, len(areas))
+	for name := range areas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	squads := make([]Squad, 0, len(names))
+	assigned := make(map[[2]int]string) // player and unit index to squad
+	for _, name := range names {
+		squad := Squad{Name: name, Player: -1}
+
+		for p, player := range players {
+			for u, unit := range player.Units {
+				inside := false
+				for _, rect := range areas[name] {
+					inside = inside || rect.ContainsTile(unit.SpawnX, unit.SpawnY)
+				}
+				if !inside {
+					continue
+				}
+				if squad.Player != -1 && squad.Player != p {
+					return nil, fmt.Errorf("Invalid squad %q: The squad contains units of multiple players (x=%d, y=%d)", name, unit.SpawnX, unit.SpawnY)
+				}
+				if other, ok := assigned[[2]int{p, u}]; ok {
+					return nil, fmt.Errorf("Invalid squad %q: The unit (x=%d, y=%d) is already part of the squad %q", name, unit.SpawnX, unit.SpawnY, other)
+				}
+				assigned[[2]int{p, u}] = name
+				squad.Player = p
+				squad.Units = append(squad.Units, u)
+			}
+		}
+
+		if len(squad.Units) == 0 {
+			return nil, fmt.Errorf("Invalid squad %q: The squad doesn't contain any units", name)
+		}
+		squads = append(squads, squad)
+	}
+	return squads, nil
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// MapStats contains detailed statistics about a map
+type MapStats struct {
+	Map         string                    `json:"map"`
+	Width       int                       `json:"width"`
+	Height      int                       `json:"height"`
+	Layers      []LayerStats              `json:"layers"`
+	TilesetUse  map[string]map[uint32]int `json:"tilesetUsage"` // tileset name -> tile id -> number of tiles (incl. objects)
+	Environment EnvironmentStats          `json:"environment"`
+	Resources   int                       `json:"resources"`
+	Waterdrops  int                       `json:"waterdrops"`
+	Players     []PlayerStats             `json:"players"`
+	Objects     map[string]int            `json:"objects"` // object layer name -> number of objects
+	Borders     map[string]BorderStats    `json:"borders"` // direction -> borders
+	BorderTotal BorderStats               `json:"borderTotal"`
+}
+
+// LayerStats contains the number of used tiles of a single tile layer
+type LayerStats struct {
+	Name  string `json:"name"`
+	Tiles int    `json:"tiles"` // non-empty tiles
+}
+
+// EnvironmentStats contains the number of tiles of the environment layer per tile type
+type EnvironmentStats struct {
+	Empty    int `json:"empty"`
+	Solid    int `json:"solid"`
+	Diagonal int `json:"diagonal"`
+}
+
+// PlayerStats contains the spawn inventory of a player
+type PlayerStats struct {
+	Slot      int            `json:"slot"`
+	Buildings map[string]int `json:"buildings"` // building type -> count
+	Units     map[string]int `json:"units"`     // unit type -> count
+}
+
+// BorderStats contains the number and total length of border lines
+type BorderStats struct {
+	Lines  int `json:"lines"`
+	Length int `json:"length"`
+}
+
+// ComputeMapStats loads the map and computes its statistics. Nothing is written.
+func ComputeMapStats(sourceFile string, options DecoderOptions) (MapStats, error) {
+	stats := MapStats{
+		Map:        sourceFile,
+		TilesetUse: make(map[string]map[uint32]int),
+		Objects:    make(map[string]int),
+		Borders:    make(map[string]BorderStats),
+	}
+
+	tilemap, err := LoadTilesFile(sourceFile, options)
+	if err != nil {
+		return stats, fmt.Errorf("Failed to load source file: %v", err)
+	}
+	if err := ValidateTileMap(&tilemap); err != nil {
+		return stats, err
+	}
+	stats.Width, stats.Height = tilemap.Width, tilemap.Height
+
+	useTile := func(tile Tile) {
+		if tile.TileSet == nil {
+			return
+		}
+		if stats.TilesetUse[tile.TileSet.Name] == nil {
+			stats.TilesetUse[tile.TileSet.Name] = make(map[uint32]int)
+		}
+		stats.TilesetUse[tile.TileSet.Name][tile.Index-1]++
+	}
+	for _, layer := range tilemap.Layers {
+		layerStats := LayerStats{Name: layer.Name}
+		for _, tile := range layer.Tiles {
+			if tile.IsCompletelyAccessible() {
+				continue
+			}
+			layerStats.Tiles++
+			useTile(tile)
+		}
+		stats.Layers = append(stats.Layers, layerStats)
+	}
+	for _, objectLayer := range tilemap.ObjectLayers {
+		stats.Objects[objectLayer.Name] = len(objectLayer.Objects)
+		for _, object := range objectLayer.Objects {
+			if object.Index > 0 {
+				useTile(Tile{Index: object.Index, TileSet: object.TileSet})
+			}
+		}
+	}
+
+	environmentLayerIdx, err := tilemap.GetLayer("environment")
+	if err != nil {
+		return stats, err
+	}
+	for _, tile := range tilemap.Layers[environmentLayerIdx].Tiles {
+		switch {
+		case tile.IsCompletelyAccessible():
+			stats.Environment.Empty++
+		case tile.IsDiagonal():
+			stats.Environment.Diagonal++
+		default:
+			stats.Environment.Solid++
+		}
+	}
+
+	resources, waterdropSources, players, err := ExtractSpawnInfo(&tilemap)
+	if err != nil {
+		return stats, err
+	}
+	stats.Resources, stats.Waterdrops = len(resources), len(waterdropSources)
+	for _, player := range players {
+		playerStats := PlayerStats{Slot: player.Slot, Buildings: make(map[string]int), Units: make(map[string]int)}
+		for _, building := range player.Buildings {
+			playerStats.Buildings[buildingTypeNames[building.Type]]++
+		}
+		for _, unit := range player.Units {
+			playerStats.Units[unitTypeNames[unit.Type]]++
+		}
+		stats.Players = append(stats.Players, playerStats)
+	}
+
+	borders, err := ComputeBorder(&tilemap)
+	if err != nil {
+		return stats, err
+	}
+	for _, direction := range []struct {
+		name  string
+		lines []BorderLine
+	}{
+		{"left", borders.Left}, {"right", borders.Right}, {"up", borders.Up}, {"down", borders.Down},
+		{"up-left", borders.UpLeft}, {"up-right", borders.UpRight}, {"down-left", borders.DownLeft}, {"down-right", borders.DownRight},
+	} {
+		borderStats := BorderStats{Lines: len(direction.lines)}
+		for _, line := range direction.lines {
+			borderStats.Length += line.Length
+		}
+		stats.Borders[direction.name] = borderStats
+		stats.BorderTotal.Lines += borderStats.Lines
+		stats.BorderTotal.Length += borderStats.Length
+	}
+	return stats, nil
+}
+
+// Print writes the statistics in a human-readable form to stdout
+func (stats *MapStats) Print() {
+	fmt.Printf("Map:          %s\n", stats.Map)
+	fmt.Printf("Size:         %dx%d\n", stats.Width, stats.Height)
+
+	fmt.Printf("\nLayers (non-empty tiles):\n")
+	for _, layer := range stats.Layers {
+		fmt.Printf("\t%-20s %6d\n", layer.Name, layer.Tiles)
+	}
+	fmt.Printf("\nEnvironment:  %d empty, %d solid, %d diagonal\n", stats.Environment.Empty, stats.Environment.Solid, stats.Environment.Diagonal)
+
+	fmt.Printf("\nTileset usage (tile id: count):\n")
+	tilesetNames := make([]string, 0, len(stats.TilesetUse))
+	for name := range stats.TilesetUse {
+		tilesetNames = append(tilesetNames, name)
+	}
+	sort.Strings(tilesetNames)
+	for _, name := range tilesetNames {
+		usage := stats.TilesetUse[name]
+		ids := make([]int, 0, len(usage))
+		for id := range usage {
+			ids = append(ids, int(id))
+		}
+		sort.Ints(ids)
+		fmt.Printf("\t%s:", name)
+		for _, id := range ids {
+			fmt.Printf(" %d:%d", id, usage[uint32(id)])
+		}
+		fmt.Printf("\n")
+	}
+
+	fmt.Printf("\nObjects:\n")
+	for _, name := range sortedCountKeys(stats.Objects) {
+		fmt.Printf("\t%-20s %6d\n", name, stats.Objects[name])
+	}
+
+	fmt.Printf("\nResource points:     %d\n", stats.Resources)
+	fmt.Printf("Water drop sources:  %d\n", stats.Waterdrops)
+	for _, player := range stats.Players {
+		fmt.Printf("Player %d:\n", player.Slot)
+		fmt.Printf("\tBuildings:")
+		for _, name := range sortedCountKeys(player.Buildings) {
+			fmt.Printf(" %s=%d", name, player.Buildings[name])
+		}
+		fmt.Printf("\n\tUnits:    ")
+		for _, name := range sortedCountKeys(player.Units) {
+			fmt.Printf(" %s=%d", name, player.Units[name])
+		}
+		fmt.Printf("\n")
+	}
+
+	fmt.Printf("\nBorders (lines / length):\n")
+	for _, name := range []string{"left", "right", "up", "down", "up-left", "up-right", "down-left", "down-right"} {
+		fmt.Printf("\t%-12s %6d / %d\n", name, stats.Borders[name].Lines, stats.Borders[name].Length)
+	}
+	fmt.Printf("\t%-12s %6d / %d\n", "total", stats.BorderTotal.Lines, stats.BorderTotal.Length)
+}
+
+func sortedCountKeys(m map[string]int) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// RunStats prints statistics about the given maps without converting them
+func RunStats(args []string) error {
+	flags := flag.NewFlagSet("stats", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "Print machine-readable json")
+	legacy := flags.Bool("legacy", false, "Accept maps created with Tiled 0.x and fill in missing information")
+	allowUnknownLayers := flags.Bool("allow-unknown-layers", false, "Skip layers that can't be converted (groups) with a warning instead of failing")
+	objectLayers := flags.String("object-layers", "", "Names of the object layers, comma separated: <role>=<layer name> (see the -object-layers option of the conversion)")
+	mappingFile := flags.String("mapping", "", "Use the spawn tile mapping of the given mapping file (JSON) instead of the built-in one")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return fmt.Errorf("Usage: stats [-json] [-legacy] [-allow-unknown-layers] [-object-layers <names>] [-mapping <mapping.json>] <inputfile.tmx | directory | pattern | URL>...")
+	}
+	objectLayerNames, err := ParseObjectLayerNames(*objectLayers)
+	if err != nil {
+		return err
+	}
+
+	if *mappingFile != "" {
+		mapping, err := LoadSpawnMapping(*mappingFile)
+		if err != nil {
+			return err
+		}
+		spawnMapping = mapping
+	}
+
+	inputs, err := ExpandInputs(flags.Args())
+	if err != nil {
+		return err
+	}
+	allStats := make([]MapStats, 0, len(inputs))
+	for _, input := range inputs {
+		stats, err := ComputeMapStats(input.Path, DecoderOptions{Legacy: *legacy, AllowUnknownLayers: *allowUnknownLayers, ObjectLayerNames: objectLayerNames})
+		if err != nil {
+			return fmt.Errorf("Failed to compute statistics of '%s': %v", input.Path, err)
+		}
+		allStats = append(allStats, stats)
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(allStats)
+	}
+	for i := range allStats {
+		if i > 0 {
+			fmt.Printf("\n=======================================\n")
+		}
+		allStats[i].Print()
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+// Minimap colors
+var (
+	minimapEmpty = Color{0x1E, 0x23, 0x2D, 0xFF}
+	minimapSolid = Color{0x6B, 0x5A, 0x46, 0xFF}
+	minimapWater = Color{0x2E, 0x6F, 0xB5, 0xFF}
+
+	spawnOverlayResource = Color{0xFF, 0xD7, 0x00, 0xFF}
+	// spawnOverlayPlayers are used for players without a color (see ExtractPlayerAppearance), indexed by player slot
+	spawnOverlayPlayers = [PlayerSlots]Color{
+		{0xE6, 0x19, 0x4B, 0xFF}, {0x3C, 0xB4, 0x4B, 0xFF}, {0x43, 0x63, 0xD8, 0xFF}, {0xF5, 0x82, 0x31, 0xFF},
+		{0x91, 0x1E, 0xB4, 0xFF}, {0x42, 0xD4, 0xF4, 0xFF}, {0xF0, 0x32, 0xE6, 0xFF}, {0xFF, 0xFF, 0xFF, 0xFF},
+	}
+)
+
+// Thumbnail is a small preview of the map, used by the lobby to list maps without loading them
+type Thumbnail struct {
+	Image    *image.RGBA // nil if no thumbnail is generated
+	Dominant Color       // the most common color of the thumbnail
+}
+
+// RenderMinimap renders the map with one pixel per tile. Solid terrain, water volumes (see ExtractWaterVolumes)
+// and empty space have different colors, diagonal tiles are half solid.
+func RenderMinimap(tilemap *TileMap) (*image.RGBA, error) {
+	environmentLayerIdx, err := tilemap.GetLayer("environment")
+	if err != nil {
+		return nil, err
+	}
+	layer := &tilemap.Layers[environmentLayerIdx]
+
+	minimap := image.NewRGBA(image.Rect(0, 0, tilemap.Width, tilemap.Height))
+	halfSolid := mixColors(minimapSolid, minimapEmpty)
+	for i, tile := range layer.Tiles {
+		c := minimapEmpty
+		if tile.IsCompletelySolid() {
+			c = minimapSolid
+		} else if tile.IsDiagonal() {
+			c = halfSolid
+		}
+		minimap.SetRGBA(i%tilemap.Width, i/tilemap.Width, color.RGBA{c.R, c.G, c.B, c.A})
+	}
+
+	for _, volume := range tilemap.Water {
+		for _, span := range volume.Spans {
+			for x := span.StartX; x < span.StartX+span.Length; x++ {
+				minimap.SetRGBA(x, span.StartY, color.RGBA{minimapWater.R, minimapWater.G, minimapWater.B, minimapWater.A})
+			}
+		}
+	}
+	return minimap, nil
+}
+
+func mixColors(a, b Color) Color {
+	return Color{uint8((int(a.R) + int(b.R)) / 2), uint8((int(a.G) + int(b.G)) / 2), uint8((int(a.B) + int(b.B)) / 2), uint8((int(a.A) + int(b.A)) / 2)}
+}
+
+// ComputeThumbnail downscales the minimap (box filter), so that its larger side has at most maxSize pixels.
+// Small maps are not scaled up.
+func ComputeThumbnail(minimap *image.RGBA, maxSize int) Thumbnail {
+	width, height := minimap.Bounds().Dx(), minimap.Bounds().Dy()
+	thumbWidth, thumbHeight := width, height
+	if larger := maxInt(width, height); larger > maxSize {
+		thumbWidth, thumbHeight = maxInt(1, width*maxSize/larger), maxInt(1, height*maxSize/larger)
+	}
+
+	thumbnail := image.NewRGBA(image.Rect(0, 0, thumbWidth, thumbHeight))
+	for ty := 0; ty < thumbHeight; ty++ {
+		for tx := 0; tx < thumbWidth; tx++ {
+			x0, x1 := tx*width/thumbWidth, (tx+1)*width/thumbWidth
+			y0, y1 := ty*height/thumbHeight, (ty+1)*height/thumbHeight
+			var r, g, b, a, n int
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					c := minimap.RGBAAt(x, y)
+					r, g, b, a, n = r+int(c.R), g+int(c.G), b+int(c.B), a+int(c.A), n+1
+				}
+			}
+			thumbnail.SetRGBA(tx, ty, color.RGBA{uint8(r / n), uint8(g / n), uint8(b / n), uint8(a / n)})
+		}
+	}
+	return Thumbnail{Image: thumbnail, Dominant: dominantColor(thumbnail)}
+}
+
+// dominantColor groups similar colors (4 bits per channel) and returns the average color of the largest group
+func dominantColor(img *image.RGBA) Color {
+	type bucket struct {
+		r, g, b, a, n int
+	}
+	buckets := make(map[uint16]*bucket)
+	var bestKey uint16
+	for y := 0; y < img.Bounds().Dy(); y++ {
+		for x := 0; x < img.Bounds().Dx(); x++ {
+			c := img.RGBAAt(x, y)
+			key := uint16(c.R>>4)<<12 | uint16(c.G>>4)<<8 | uint16(c.B>>4)<<4 | uint16(c.A>>4)
+			bu := buckets[key]
+			if bu == nil {
+				bu = &bucket{}
+				buckets[key] = bu
+			}
+			bu.r, bu.g, bu.b, bu.a, bu.n = bu.r+int(c.R), bu.g+int(c.G), bu.b+int(c.B), bu.a+int(c.A), bu.n+1
+
+			if best := buckets[bestKey]; best == nil || bu.n > best.n || (bu.n == best.n && key < bestKey) {
+				bestKey = key
+			}
+		}
+	}
+	best := buckets[bestKey]
+	if best == nil {
+		return Color{}
+	}
+	return Color{uint8(best.r / best.n), uint8(best.g / best.n), uint8(best.b / best.n), uint8(best.a / best.n)}
+}
+
+// EncodeThumbnailPNG returns the thumbnail as PNG file (used for sidecar files)
+func EncodeThumbnailPNG(thumbnail Thumbnail) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, thumbnail.Image); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// RenderSpawnOverlay renders a thumbnail for map selection screens (see ComputeThumbnail) and highlights the start positions
+// of the players and the resource points on top. Buildings are drawn as squares and units as dots in the player's color,
+// resource points as diamonds. The markers keep their size when the minimap is scaled down, so that they stay visible.
+func RenderSpawnOverlay(minimap *image.RGBA, maxSize int, resources []ResourcePoint, players []Player) *image.RGBA {
+	overlay := ComputeThumbnail(minimap, maxSize).Image
+	width, height := minimap.Bounds().Dx(), minimap.Bounds().Dy()
+	thumbWidth, thumbHeight := overlay.Bounds().Dx(), overlay.Bounds().Dy()
+	radius := maxInt(1, maxInt(thumbWidth, thumbHeight)/64)
+
+	mark := func(x, y, radius int, c Color, diamond bool) {
+		cx, cy := x*thumbWidth/width, y*thumbHeight/height
+		for dy := -radius; dy <= radius; dy++ {
+			for dx := -radius; dx <= radius; dx++ {
+				if diamond && absInt(dx)+absInt(dy) > radius {
+					continue
+				}
+				if px, py := cx+dx, cy+dy; px >= 0 && py >= 0 && px < thumbWidth && py < thumbHeight {
+					overlay.SetRGBA(px, py, color.RGBA{c.R, c.G, c.B, c.A})
+				}
+			}
+		}
+	}
+
+	for _, resource := range resources {
+		mark(resource.SpawnX, resource.SpawnY, radius, spawnOverlayResource, true)
+	}
+	for _, player := range players {
+		c := spawnOverlayPlayers[player.Slot%PlayerSlots]
+		if player.Color != nil {
+			c = *player.Color
+		}
+		for _, unit := range player.Units {
+			mark(unit.SpawnX, unit.SpawnY, radius/2, c, false)
+		}
+		for _, building := range player.Buildings {
+			mark(building.SpawnX, building.SpawnY, radius, c, false)
+		}
+	}
+	return overlay
+}
+
+// DefaultSpawnThumbnailSize is the size of the spawn overlay if it's selected with -outputs instead of -spawn-thumbnail
+const DefaultSpawnThumbnailSize = 256
+
+// EncodeSpawnOverlayPNG renders the spawn overlay (see RenderSpawnOverlay) as PNG file
+func EncodeSpawnOverlayPNG(tilemap *TileMap, maxSize int, resources []ResourcePoint, players []Player) ([]byte, error) {
+	minimap, err := RenderMinimap(tilemap)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, RenderSpawnOverlay(minimap, maxSize, resources, players)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
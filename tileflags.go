@@ -0,0 +1,65 @@
+package main
+
+import "fmt"
+
+// TileFlagProperties are the boolean tile properties of environment tiles that are passed to the game.
+// They are stored in the upper bits of the per-tile flags (the lower 3 bits contain the flipping information).
+var TileFlagProperties = []string{"slippery", "climbable", "no_build"}
+
+// FirstCustomTileFlagBit is the first bit of the per-tile flags that is used for custom tile flags
+const FirstCustomTileFlagBit = 3
+
+// TileFlags contains the custom flags of the environment layer
+type TileFlags struct {
+	Names []string // the used flags. Names[i] is stored in bit FirstCustomTileFlagBit+i
+	Bits  []uint8  // custom flags of each tile, not shifted yet
+}
+
+// ExtractTileFlags reads the custom flags (see TileFlagProperties) of all environment tiles.
+// Only flags that are used by the map get a bit assigned.
+func ExtractTileFlags(tilemap *TileMap) (TileFlags, error) {
+	var tileFlags TileFlags
+
+	environmentLayerIdx, err := tilemap.GetLayer("environment")
+	if err != nil {
+		return tileFlags, err
+	}
+	layer := &tilemap.Layers[environmentLayerIdx]
+
+	values := make([]uint8, len(layer.Tiles)) // bit i = TileFlagProperties[i]
+	var used uint8
+	for i, tile := range layer.Tiles {
+		if tile.TileSet == nil {
+			continue
+		}
+		properties := tile.TileSet.GetTileProperties(tile.Index)
+		for p, property := range TileFlagProperties {
+			set, err := properties.GetBool(property, false)
+			if err != nil {
+				return tileFlags, fmt.Errorf("Invalid tile %d of tileset '%s': %v", tile.Index-1, tile.TileSet.Name, err)
+			}
+			if set {
+				values[i] |= 1 << uint(p)
+				used |= 1 << uint(p)
+			}
+		}
+	}
+	if used == 0 {
+		return tileFlags, nil
+	}
+
+	tileFlags.Bits = make([]uint8, len(layer.Tiles))
+	for p, property := range TileFlagProperties {
+		if used&(1<<uint(p)) == 0 {
+			continue
+		}
+		bit := uint(len(tileFlags.Names))
+		tileFlags.Names = append(tileFlags.Names, property)
+		for i, value := range values {
+			if value&(1<<uint(p)) != 0 {
+				tileFlags.Bits[i] |= 1 << bit
+			}
+		}
+	}
+	return tileFlags, nil
+}
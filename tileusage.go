@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// TilesetUsage contains how often the tiles of a single tileset are used by one or more maps.
+// Tile ids start at 0, like in Tiled.
+type TilesetUsage struct {
+	Name       string         `json:"name"`
+	TileCount  uint32         `json:"tileCount"`
+	Used       map[uint32]int `json:"used"`       // tile id -> number of tiles and objects
+	Unused     []uint32       `json:"unused"`     // tile ids that are not used by any map
+	OutOfRange []uint32       `json:"outOfRange"` // used tile ids that are outside of the tileset (tile count)
+	Unmapped   []uint32       `json:"unmapped"`   // used tile ids of the spawn tileset without meaning in the spawn tile mapping (see GetTileMapping)
+}
+
+// ComputeTileUsage loads all maps and counts the used tiles of each tileset (incl. tile objects). The result is sorted by tileset name.
+func ComputeTileUsage(sourceFiles []string, options DecoderOptions) ([]TilesetUsage, error) {
+	usages := make(map[string]*TilesetUsage)
+	for _, sourceFile := range sourceFiles {
+		tilemap, err := LoadTilesFile(sourceFile, options)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load source file '%s': %v", sourceFile, err)
+		}
+
+		useTile := func(index uint32, tileset *TileSet) {
+			if index == 0 || tileset == nil {
+				return
+			}
+			usage := usages[tileset.Name]
+			if usage == nil {
+				usage = &TilesetUsage{Name: tileset.Name, Used: make(map[uint32]int)}
+				usages[tileset.Name] = usage
+			}
+			if tileset.TileCount > usage.TileCount {
+				usage.TileCount = tileset.TileCount
+			}
+			usage.Used[index-1]++
+		}
+		for _, tileset := range tilemap.Tilesets { // tilesets without any used tiles are listed too
+			if usages[tileset.Name] == nil {
+				usages[tileset.Name] = &TilesetUsage{Name: tileset.Name, TileCount: tileset.TileCount, Used: make(map[uint32]int)}
+			}
+		}
+		for _, layer := range tilemap.Layers {
+			for _, tile := range layer.Tiles {
+				useTile(tile.Index, tile.TileSet)
+			}
+		}
+		for _, objectLayer := range tilemap.ObjectLayers {
+			for _, object := range objectLayer.Objects {
+				useTile(object.Index, object.TileSet)
+			}
+		}
+	}
+
+	spawnTiles := SpawnTileIcons()
+	result := make([]TilesetUsage, 0, len(usages))
+	for _, usage := range usages {
+		for id := uint32(0); id < usage.TileCount; id++ {
+			if usage.Used[id] == 0 {
+				usage.Unused = append(usage.Unused, id)
+			}
+		}
+		for id := range usage.Used {
+			if _, mapped := spawnTiles[id+1]; id >= usage.TileCount {
+				usage.OutOfRange = append(usage.OutOfRange, id)
+			} else if strings.EqualFold(usage.Name, SpawnTilesetName) && !mapped {
+				usage.Unmapped = append(usage.Unmapped, id)
+			}
+		}
+		sort.Slice(usage.OutOfRange, func(i, j int) bool { return usage.OutOfRange[i] < usage.OutOfRange[j] })
+		sort.Slice(usage.Unmapped, func(i, j int) bool { return usage.Unmapped[i] < usage.Unmapped[j] })
+		result = append(result, *usage)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+// Print writes the usage in a human-readable form to stdout
+func (usage *TilesetUsage) Print() {
+	fmt.Printf("%s: %d of %d tiles used\n", usage.Name, len(usage.Used), usage.TileCount)
+
+	ids := make([]int, 0, len(usage.Used))
+	for id := range usage.Used {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+	fmt.Printf("\tUsed (tile id: count):")
+	for _, id := range ids {
+		fmt.Printf(" %d:%d", id, usage.Used[uint32(id)])
+	}
+	fmt.Printf("\n\tUnused:       %s\n", formatTileIdRanges(usage.Unused))
+	if len(usage.OutOfRange) > 0 {
+		fmt.Printf("\tOut of range: %s\n", formatTileIdRanges(usage.OutOfRange))
+	}
+	if len(usage.Unmapped) > 0 {
+		fmt.Printf("\tUnmapped:     %s (only used as part of larger spawn graphics)\n", formatTileIdRanges(usage.Unmapped))
+	}
+}
+
+// formatTileIdRanges joins sorted tile ids and combines consecutive ids to ranges ("0-4, 7, 9-10")
+func formatTileIdRanges(ids []uint32) string {
+	if len(ids) == 0 {
+		return "-"
+	}
+	var ranges []string
+	for start := 0; start < len(ids); {
+		end := start
+		for end+1 < len(ids) && ids[end+1] == ids[end]+1 {
+			end++
+		}
+		if start == end {
+			ranges = append(ranges, fmt.Sprintf("%d", ids[start]))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", ids[start], ids[end]))
+		}
+		start = end + 1
+	}
+	return strings.Join(ranges, ", ")
+}
+
+// RunTileUsage prints which tiles of each tileset are used by the given maps, so that unused tiles can be removed from the tileset textures
+func RunTileUsage(args []string) error {
+	flags := flag.NewFlagSet("tile-usage", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "Print machine-readable json")
+	legacy := flags.Bool("legacy", false, "Accept maps created with Tiled 0.x and fill in missing information")
+	allowUnknownLayers := flags.Bool("allow-unknown-layers", false, "Skip layers that can't be converted (groups) with a warning instead of failing")
+	objectLayers := flags.String("object-layers", "", "Names of the object layers, comma separated: <role>=<layer name> (see the -object-layers option of the conversion)")
+	mappingFile := flags.String("mapping", "", "Use the spawn tile mapping of the given mapping file (JSON) instead of the built-in one")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return fmt.Errorf("Usage: tile-usage [-json] [-legacy] [-allow-unknown-layers] [-object-layers <names>] [-mapping <mapping.json>] <inputfile.tmx | directory | pattern | URL>...")
+	}
+	objectLayerNames, err := ParseObjectLayerNames(*objectLayers)
+	if err != nil {
+		return err
+	}
+
+	if *mappingFile != "" {
+		mapping, err := LoadSpawnMapping(*mappingFile)
+		if err != nil {
+			return err
+		}
+		spawnMapping = mapping
+	}
+
+	inputs, err := ExpandInputs(flags.Args())
+	if err != nil {
+		return err
+	}
+	sourceFiles := make([]string, len(inputs))
+	for i, input := range inputs {
+		sourceFiles[i] = input.Path
+	}
+	usages, err := ComputeTileUsage(sourceFiles, DecoderOptions{Legacy: *legacy, AllowUnknownLayers: *allowUnknownLayers, ObjectLayerNames: objectLayerNames})
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(usages)
+	}
+	fmt.Printf("Tile usage of %d map(s):\n\n", len(inputs))
+	for i := range usages {
+		usages[i].Print()
+	}
+	for _, usage := range usages {
+		if len(usage.OutOfRange) > 0 {
+			log.Warningf("Tileset %q: %d used tile(s) are outside of the tileset (%d tiles)", usage.Name, len(usage.OutOfRange), usage.TileCount)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TMXRewriter rewrites a TMX document token by token. Only the parts that are changed are replaced, everything else
+// (formatting, comments, unknown elements and attributes) is copied byte by byte from the source document.
+type TMXRewriter struct {
+	source   []byte
+	decoder  *xml.Decoder
+	elements []string // stack of open elements
+	edits    []tmxEdit
+
+	token      xml.Token
+	start, end int // byte range of the current token
+}
+
+// tmxEdit replaces a byte range of the source document
+type tmxEdit struct {
+	start, end int
+	text       []byte
+}
+
+// NewTMXRewriter creates a rewriter for the given TMX document
+func NewTMXRewriter(source []byte) *TMXRewriter {
+	return &TMXRewriter{
+		source:  source,
+		decoder: xml.NewDecoder(bytes.NewReader(source)),
+	}
+}
+
+// Next returns the next token of the document, or io.EOF at the end
+func (r *TMXRewriter) Next() (xml.Token, error) {
+	if _, ok := r.token.(xml.EndElement); ok && len(r.elements) > 0 {
+		r.elements = r.elements[:len(r.elements)-1]
+	}
+	r.start = int(r.decoder.InputOffset())
+	token, err := r.decoder.RawToken()
+	if err != nil {
+		return nil, err
+	}
+	r.end = int(r.decoder.InputOffset())
+	if t, ok := token.(xml.StartElement); ok {
+		r.elements = append(r.elements, t.Name.Local)
+		token = t.Copy()
+	}
+	r.token = token
+	return token, nil
+}
+
+// Path returns the path of the current element, eg. "map/layer/data". Character data belongs to the enclosing element.
+func (r *TMXRewriter) Path() string {
+	return strings.Join(r.elements, "/")
+}
+
+// Line returns the line number of the current token
+func (r *TMXRewriter) Line() int {
+	return 1 + bytes.Count(r.source[:r.start], []byte("\n"))
+}
+
+// UpdateAttrs writes all attribute values of the current start element that were changed in the given copy
+func (r *TMXRewriter) UpdateAttrs(element xml.StartElement) error {
+	original, ok := r.token.(xml.StartElement)
+	if !ok {
+		return fmt.Errorf("Line %d: Attributes can only be changed on start elements", r.Line())
+	}
+	for _, attr := range element.Attr {
+		unchanged := false
+		for _, o := range original.Attr {
+			unchanged = unchanged || (o.Name == attr.Name && o.Value == attr.Value)
+		}
+		if unchanged {
+			continue
+		}
+		if err := r.SetAttr(attr.Name.Local, attr.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetAttr replaces the value of an existing attribute of the current start element. The quotes are kept.
+func (r *TMXRewriter) SetAttr(name, value string) error {
+	pattern := regexp.MustCompile(`\s(?:[\w.-]+:)?` + regexp.QuoteMeta(name) + `\s*=\s*("[^"]*"|'[^']*')`)
+	match := pattern.FindSubmatchIndex(r.source[r.start:r.end])
+	if match == nil {
+		return fmt.Errorf("Line %d: The attribute %q does not exist", r.Line(), name)
+	}
+	quote := r.source[r.start+match[2]]
+	escaped := tmxTextEscaper.Replace(value)
+	if quote == '"' {
+		escaped = strings.Replace(escaped, `"`, "&quot;", -1)
+	} else {
+		escaped = strings.Replace(escaped, "'", "&apos;", -1)
+	}
+	text := append(append([]byte{quote}, escaped...), quote)
+	r.edits = append(r.edits, tmxEdit{r.start + match[2], r.start + match[3], text})
+	return nil
+}
+
+// tmxTextEscaper escapes character data. Unlike xml.EscapeText, line breaks are kept.
+var tmxTextEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// ReplaceText replaces the current character data. The text is escaped.
+func (r *TMXRewriter) ReplaceText(text string) {
+	r.edits = append(r.edits, tmxEdit{r.start, r.end, []byte(tmxTextEscaper.Replace(text))})
+}
+
+// Remove removes the current start element, including all children and the indentation in front of it
+func (r *TMXRewriter) Remove() error {
+	start := r.start
+	if err := r.decoder.Skip(); err != nil {
+		return err
+	}
+	end := int(r.decoder.InputOffset())
+	r.elements = r.elements[:len(r.elements)-1]
+	r.token = nil
+
+	indent := start
+	for indent > 0 && (r.source[indent-1] == ' ' || r.source[indent-1] == '\t') {
+		indent--
+	}
+	if indent > 0 && r.source[indent-1] == '\n' {
+		start = indent - 1
+		if start > 0 && r.source[start-1] == '\r' {
+			start--
+		}
+	}
+	r.edits = append(r.edits, tmxEdit{start, end, nil})
+	return nil
+}
+
+// Bytes returns the rewritten document
+func (r *TMXRewriter) Bytes() []byte {
+	sort.SliceStable(r.edits, func(i, j int) bool { return r.edits[i].start < r.edits[j].start })
+	var output bytes.Buffer
+	pos := 0
+	for _, edit := range r.edits {
+		if edit.start < pos { // inside of a removed element
+			continue
+		}
+		output.Write(r.source[pos:edit.start])
+		output.Write(edit.text)
+		pos = edit.end
+	}
+	output.Write(r.source[pos:])
+	return output.Bytes()
+}
+
+// WriteTMXOutput writes a rewritten TMX document. If the target is an existing local file (eg. the source file itself),
+// a timestamped backup of it is created first ("map.tmx" -> "map.tmx.20060102-150405.bak").
+func WriteTMXOutput(target string, data []byte, backup bool) error {
+	if backup && target != "-" && !IsObjectStoreURL(target) {
+		previous, err := ioutil.ReadFile(LongPath(target))
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("Failed to create a backup of '%v': %v", target, err)
+		}
+		if err == nil {
+			backupFile := target + "." + time.Now().Format("20060102-150405") + ".bak"
+			log.Infof("Creating backup '%s'", backupFile)
+			if err := WriteOutput(backupFile, previous); err != nil {
+				return fmt.Errorf("Failed to create a backup of '%v': %v", target, err)
+			}
+		}
+	}
+	return WriteOutput(target, data)
+}
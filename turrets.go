@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	TurretClearance      float32 = 3 // tiles that need to be free in a direction the turret can shoot to. Rays are only cast this far
+	TurretArcStepDegrees         = 5
+)
+
+// ValidateTurrets checks that every turret faces away from solid walls and computes its firing arc.
+// A turret faces the direction of the building's up vector. The firing arc contains all directions
+// (relative to the facing direction, within [-90, 90] degrees) in which the turret can shoot at least
+// TurretClearance tiles before hitting solid terrain.
+func ValidateTurrets(tilemap *TileMap, players []Player) error {
+	environmentLayerIdx, err := tilemap.GetLayer("environment")
+	if err != nil {
+		return err
+	}
+	layer := &tilemap.Layers[environmentLayerIdx]
+
+	for p := range players {
+		for b := range players[p].Buildings {
+			building := &players[p].Buildings[b]
+			if building.Type != BuildingType_Turret {
+				continue
+			}
+
+			tile := Tile{Flags: building.Flags}
+			upX, upY := tile.GetUpVector()
+			rightX, rightY := tile.GetRightVector()
+
+			// The turret's barrel sits between the player token and the building-type tile
+			originX := float32(building.SpawnX) + 0.5 + float32(rightX)*0.5
+			originY := float32(building.SpawnY) + 0.5 + float32(rightY)*0.5
+			facing := math.Atan2(float64(upY), float64(upX))
+
+			isFree := func(degrees int) bool {
+				angle := facing + float64(degrees)/180*math.Pi
+				dirX, dirY := float32(math.Cos(angle)), float32(math.Sin(angle))
+				return castRay(layer, tilemap.Width, tilemap.Height, originX, originY, dirX, dirY, TurretClearance) >= TurretClearance
+			}
+
+			if !isFree(0) {
+				return fmt.Errorf("Invalid turret (player %d, x=%d, y=%d): The turret faces a solid wall. Rotate it so it faces away from the terrain", p, building.SpawnX, building.SpawnY)
+			}
+
+			// Find the contiguous arc around the facing direction
+			minAngle, maxAngle := 0, 0
+			for minAngle-TurretArcStepDegrees >= -90 && isFree(minAngle-TurretArcStepDegrees) {
+				minAngle -= TurretArcStepDegrees
+			}
+			for maxAngle+TurretArcStepDegrees <= 90 && isFree(maxAngle+TurretArcStepDegrees) {
+				maxAngle += TurretArcStepDegrees
+			}
+			if maxAngle-minAngle < 2*TurretArcStepDegrees {
+				logTileWarningf(building.SpawnX, building.SpawnY, "The turret (player %d, x=%d, y=%d) has a very narrow firing arc: [%d, %d] degrees", p, building.SpawnX, building.SpawnY, minAngle, maxAngle)
+			}
+			building.FiringArcMin = float32(minAngle)
+			building.FiringArcMax = float32(maxAngle)
+		}
+	}
+	return nil
+}
+
+// castRay walks from the origin into the given direction and returns the distance (in tiles) to the first solid terrain.
+// The search stops after maxDistance tiles.
+func castRay(layer *TileMapLayer, width, height int, originX, originY, dirX, dirY, maxDistance float32) float32 {
+	const stepSize float32 = 0.25
+
+	var distance float32
+	for distance = 0; distance < maxDistance; distance += stepSize {
+		if isSolidAt(layer, width, height, originX+dirX*distance, originY+dirY*distance) {
+			return distance
+		}
+	}
+	return maxDistance
+}
+
+// isSolidAt returns true if the given position (in tiles) is inside solid terrain. Diagonal tiles are only solid on one half.
+func isSolidAt(layer *TileMapLayer, width, height int, x, y float32) bool {
+	tileX, tileY := int(math.Floor(float64(x))), int(math.Floor(float64(y)))
+	tile, err := layer.GetTile(tileX, tileY, width, height)
+	if err != nil {
+		return true // Everything outside of the map is solid
+	}
+
+	fx, fy := x-float32(tileX), y-float32(tileY)
+	switch tile.GetType() {
+	case COMPLETELY_ACCESSIBLE:
+		return false
+	case COMPLETELY_SOLID:
+		return true
+	case SOLID_AT_UPPER_LEFT:
+		return fx+fy < 1
+	case SOLID_AT_UPPER_RIGHT:
+		return fx > fy
+	case SOLID_AT_LOWER_LEFT:
+		return fx < fy
+	case SOLID_AT_LOWER_RIGHT:
+		return fx+fy > 1
+	}
+	panic("Invalid tile type")
+}
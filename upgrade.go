@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"math"
+)
+
+// UpgradeMap rewrites a converted map in a newer format version, so that old maps don't need to be converted from their TMX source again.
+// Content that didn't exist in the old version is derived from the stored terrain where possible (bridge span lengths,
+// turret firing arcs, navigation regions and the thumbnail). Everything else gets the same content as a map without these features.
+// Sections of the old file are kept as they are, except for the metadata, which is replaced.
+func UpgradeMap(encoded *EncodedMap, order binary.ByteOrder, version uint8, thumbnailSize int) ([]byte, error) {
+	if !IsSupportedFormatVersion(int(version)) {
+		return nil, fmt.Errorf("Unsupported format version %d", version)
+	}
+	if version <= encoded.Version {
+		return nil, fmt.Errorf("The map already has format version %d and can't be upgraded to version %d", encoded.Version, version)
+	}
+
+	// The terrain is needed to derive missing content. Tiles of the environment layer are only solid, diagonal or empty.
+	environment := &encoded.Layers[encoded.EnvironmentLayer]
+	tilemap := TileMap{Width: encoded.Width, Height: encoded.Height, Layers: []TileMapLayer{{Name: "environment"}}}
+	tilemap.Layers[0].Tiles = make([]Tile, len(environment.Indices))
+	for i := range environment.Indices {
+		tilemap.Layers[0].Tiles[i] = Tile{Index: uint32(environment.Indices[i]), Flags: environment.Flags[i] & (1<<FirstCustomTileFlagBit - 1)}
+	}
+
+	players := make([]Player, len(encoded.Players))
+	for p, player := range encoded.Players {
+		players[p] = player
+		players[p].Buildings = append([]Building(nil), player.Buildings...)
+	}
+	if encoded.Version < 3 { // format version 2 doesn't store span lengths and firing arcs. It also doesn't have encoding flags (the origin is always top-left)
+		if err := ValidateBridges(&tilemap, players); err != nil {
+			return nil, fmt.Errorf("Failed to compute bridge span lengths: %v", err)
+		}
+		if err := ValidateTurrets(&tilemap, players); err != nil {
+			return nil, fmt.Errorf("Failed to compute turret firing arcs: %v", err)
+		}
+	}
+
+	var output bytes.Buffer
+	writer := bufio.NewWriter(&output)
+	flags := encoded.Flags
+
+	writer.WriteByte(byte(0xA5)) // magic byte
+	writer.WriteByte(version)    // magic byte used for versioning
+	writer.WriteByte(byte(flags))
+	if flags&EncodingFlag_TileFlags != 0 {
+		writer.WriteByte(byte(len(encoded.TileFlagNames)))
+		for _, name := range encoded.TileFlagNames {
+			if err := writeString(writer, name); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := writeShort(writer, order, flags, encoded.Width); err != nil {
+		return nil, err
+	}
+	if err := writeShort(writer, order, flags, encoded.Height); err != nil {
+		return nil, err
+	}
+	writer.WriteByte(byte(len(encoded.Layers)))
+	writer.WriteByte(byte(encoded.EnvironmentLayer))
+
+	var checksums *checksumRecorder
+	header := writer
+	if version >= 5 {
+		checksums = newChecksumRecorder()
+		writer = checksums.writer
+	}
+	for l, layer := range encoded.Layers {
+		checksums.Begin(Section_Layer, l)
+		writer.WriteByte(byte(layer.TileSetType))
+		for i := range layer.Indices {
+			writer.WriteByte(layer.Flags[i])
+			writer.WriteByte(layer.Indices[i])
+		}
+	}
+	writer.WriteByte(byte(0xAA)) // magic byte
+
+	checksums.Begin(Section_Objects, 0)
+	for _, objects := range [][]EncodedObject{encoded.BackgroundObjects, encoded.ForegroundObjects} {
+		if err := writeShort(writer, order, flags, len(objects)); err != nil {
+			return nil, err
+		}
+		for _, object := range objects {
+			writer.WriteByte(object.Index)
+			for _, value := range []float32{object.X, object.Y, object.Width, object.Height, object.Rotation} {
+				if err := writeDecodedFloat(writer, order, value); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	writer.WriteByte(byte(0x99)) // magic byte
+
+	checksums.Begin(Section_Resources, 0)
+	writer.WriteByte(byte(len(encoded.Resources)))
+	for _, resource := range encoded.Resources {
+		if err := encodeResourcePoint(writer, order, flags, &resource); err != nil {
+			return nil, err
+		}
+	}
+	writer.WriteByte(byte(0x5A)) // magic byte
+
+	checksums.Begin(Section_Waterdrops, 0)
+	writer.WriteByte(byte(len(encoded.WaterdropSources)))
+	for _, source := range encoded.WaterdropSources {
+		if err := encodeWaterdropSource(writer, order, flags, &source); err != nil {
+			return nil, err
+		}
+	}
+	writer.WriteByte(byte(0xFF)) // magic byte
+
+	checksums.Begin(Section_Players, 0)
+	writer.WriteByte(byte(len(players)))
+	for _, player := range players {
+		if err := encodePlayer(writer, order, version, flags, &player); err != nil {
+			return nil, err
+		}
+	}
+
+	writer.WriteByte(byte(0xA5)) // magic byte
+	checksums.Begin(Section_Borders, 0)
+	if err := encodeBorderSet(writer, order, flags, encoded.Borders); err != nil {
+		return nil, err
+	}
+
+	sections, err := upgradeSections(encoded, order, version, &tilemap, players, thumbnailSize)
+	if err != nil {
+		return nil, err
+	}
+	features, err := encodeSections(writer, order, version, sections, checksums)
+	if err != nil {
+		return nil, err
+	}
+	writer.WriteByte(byte(0x55)) // magic byte
+	if version >= 6 {
+		if err := encodeFeatureHeader(header, order, features); err != nil {
+			return nil, err
+		}
+	}
+	if err := checksums.Finish(header, order, flags); err != nil {
+		return nil, err
+	}
+	header.Flush()
+	return output.Bytes(), nil
+}
+
+// upgradeSections returns all sections of the given format version (in the same order as Encode).
+// Existing sections are copied, missing ones are created from the terrain or empty.
+func upgradeSections(encoded *EncodedMap, order binary.ByteOrder, version uint8, tilemap *TileMap, players []Player, thumbnailSize int) ([]Section, error) {
+	flags := encoded.Flags
+	existing := make(map[SectionID][]byte)
+	for _, section := range encoded.Sections {
+		existing[section.ID] = section.Content
+	}
+
+	defaults := []Section{
+		{Section_Hazards, func(w *bufio.Writer) error { return encodeHazards(w, order, nil) }},
+		{Section_Wind, func(w *bufio.Writer) error { return encodeWindField(w, order, nil) }},
+		{Section_Environment, func(w *bufio.Writer) error {
+			return encodeEnvironment(w, order, EnvironmentSettings{AmbientColor: Color{0xFF, 0xFF, 0xFF, 0xFF}, GravityMultiplier: 1})
+		}},
+		{Section_Checkpoints, func(w *bufio.Writer) error { return encodeCheckpoints(w, order, nil) }},
+		{Section_CameraPaths, func(w *bufio.Writer) error { return encodeCameraPaths(w, order, nil) }},
+		{Section_Victory, func(w *bufio.Writer) error {
+			return encodeVictoryConditions(w, order, VictoryConditions{Mode: VictoryMode_Annihilation})
+		}},
+		{Section_AIHints, func(w *bufio.Writer) error { return encodeAIHints(w, order, flags, nil) }},
+	}
+	if version >= 4 {
+		// Players and navigation use the origin of the file, the terrain is always stored top-left
+		topLeftPlayers := players
+		if flags&EncodingFlag_BottomLeft != 0 {
+			_, _, topLeftPlayers, _ = ToBottomLeftOrigin(tilemap.Height, nil, nil, players, SortedBorderLines{})
+		}
+		graph, err := ComputeConnectivityGraph(tilemap, topLeftPlayers)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to compute the navigation graph: %v", err)
+		}
+		if flags&EncodingFlag_BottomLeft != 0 {
+			graph = NavigationToBottomLeftOrigin(tilemap.Height, graph)
+		}
+		var thumbnail Thumbnail
+		if thumbnailSize > 0 {
+			minimap, err := RenderMinimap(tilemap)
+			if err != nil {
+				return nil, err
+			}
+			thumbnail = ComputeThumbnail(minimap, thumbnailSize)
+		}
+
+		// Layers above the environment layer (in front of it in file order) are rendered in front of units, like the game did before
+		renderPasses := make([]RenderPass, len(encoded.Layers))
+		for i := range encoded.Layers {
+			if i < encoded.EnvironmentLayer {
+				renderPasses[len(encoded.Layers)-1-i] = RenderPass_Foreground
+			}
+		}
+
+		defaults = append(defaults, []Section{
+			{Section_ObjectScale, func(w *bufio.Writer) error { return encodeDecodedObjectScales(w, order, flags, encoded) }},
+			{Section_Anchors, func(w *bufio.Writer) error { return encodeResourceAnchors(w, order, encoded.Resources) }},
+			{Section_Squads, func(w *bufio.Writer) error { return encodeSquads(w, order, flags, nil) }},
+			{Section_Inventories, func(w *bufio.Writer) error { return encodeBuildingInventories(w, order, flags, players) }},
+			{Section_Obstacles, func(w *bufio.Writer) error { return encodeObstacles(w, order, nil) }},
+			{Section_DynBorders, func(w *bufio.Writer) error { return encodeDynamicBorders(w, order, flags, nil) }},
+			{Section_FlyBorders, func(w *bufio.Writer) error { return encodeFlyingBorders(w, order, flags, nil) }},
+			{Section_Fluids, func(w *bufio.Writer) error { return encodeWaterVolumes(w, order, flags, nil) }},
+			{Section_Navigation, func(w *bufio.Writer) error { return encodeConnectivityGraph(w, order, flags, graph) }},
+			{Section_NoBuild, func(w *bufio.Writer) error { return encodeNoBuildZones(w, order, flags, nil) }},
+			{Section_Thumbnail, func(w *bufio.Writer) error { return encodeThumbnail(w, thumbnail) }},
+			{Section_RenderPass, func(w *bufio.Writer) error { return encodeRenderPasses(w, renderPasses) }},
+			{Section_ImageLayers, func(w *bufio.Writer) error { return encodeImageLayers(w, order, flags, nil) }},
+			{Section_Offsets, func(w *bufio.Writer) error {
+				return encodeLayerOffsets(w, order, make([]LayerOffset, len(encoded.Layers)))
+			}},
+		}...)
+	}
+
+	sections := make([]Section, 0, len(defaults)+1)
+	for _, section := range defaults {
+		if content, ok := existing[section.ID]; ok {
+			section.Encode = rawSection(content)
+		}
+		sections = append(sections, section)
+	}
+	if version >= 4 {
+		sections = append(sections, Section{Section_Metadata, func(w *bufio.Writer) error { return encodeMetadata(w, version) }})
+	}
+	return sections, nil
+}
+
+func rawSection(content []byte) func(w *bufio.Writer) error {
+	return func(w *bufio.Writer) error {
+		_, err := w.Write(content)
+		return err
+	}
+}
+
+// encodeDecodedObjectScales is the counterpart of encodeObjectScales for decoded objects.
+// Their size is stored relative to the tile size already, flips are removed.
+func encodeDecodedObjectScales(writer *bufio.Writer, order binary.ByteOrder, flags EncodingFlags, encoded *EncodedMap) error {
+	for _, objects := range [][]EncodedObject{encoded.BackgroundObjects, encoded.ForegroundObjects} {
+		if err := writeShort(writer, order, flags, len(objects)); err != nil {
+			return err
+		}
+		for _, object := range objects {
+			for _, value := range []float32{object.Width, object.Height} {
+				if err := writeDecodedFloat(writer, order, float32(math.Abs(float64(value)))); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// writeDecodedFloat writes a float that was read by readFloat. Unlike writeFloat, the value is rounded,
+// so that it's stored exactly as before.
+func writeDecodedFloat(writer *bufio.Writer, order binary.ByteOrder, value float32) error {
+	return binary.Write(writer, order, int32(math.Round(float64(value)*FixedPointScale)))
+}
+
+// RunUpgrade rewrites converted maps in a newer format version.
+// Format version 2 is the oldest readable version. Version 1 files are rejected: the converter already wrote version 2
+// when the format byte was introduced, and neither the encoder nor a loader or a sample file of version 1 survived,
+// so its layout can't be reconstructed.
+func RunUpgrade(args []string) error {
+	flags := flag.NewFlagSet("upgrade", flag.ContinueOnError)
+	byteOrder := flags.String("byte-order", "le", "Byte order of the file: le (little-endian) or be (big-endian)")
+	formatVersion := flags.Int("format-version", int(FormatVersion), "Format version to upgrade to")
+	thumbnailSize := flags.Int("thumbnail-size", 64, "Size (in pixels) of the larger side of the lobby thumbnail (0 = no thumbnail, max 255)")
+	outputTarget := flags.String("o", "", "Output file (default: overwrite the input file)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("Usage: upgrade [-byte-order le|be] [-format-version <version>] [-thumbnail-size <pixels>] [-o <output.tilemap>] <map.tilemap>")
+	}
+	if *thumbnailSize < 0 || *thumbnailSize > 0xFF {
+		return fmt.Errorf("Invalid thumbnail size %d. Allowed values: 0-255", *thumbnailSize)
+	}
+	order, err := ParseByteOrder(*byteOrder)
+	if err != nil {
+		return err
+	}
+
+	source := flags.Arg(0)
+	data, err := ReadInput(source)
+	if err != nil {
+		return fmt.Errorf("Failed to read map file: %v", err)
+	}
+	if len(data) >= 2 && data[0] == 0xA5 && data[1] == 0x01 {
+		return fmt.Errorf("'%s' has format version 1, whose layout is unknown (the oldest readable version is 2). Convert the map from its TMX source instead", source)
+	}
+	encoded, err := DecodeMap(data, order)
+	if err != nil {
+		return fmt.Errorf("Failed to decode '%s': %v", source, err)
+	}
+
+	output, err := UpgradeMap(encoded, order, uint8(*formatVersion), *thumbnailSize)
+	if err != nil {
+		return fmt.Errorf("Failed to upgrade '%s': %v", source, err)
+	}
+	target := *outputTarget
+	if target == "" {
+		target = source
+	}
+	log.Infof("Upgrading '%s' from format version %d to %d: '%s'", source, encoded.Version, *formatVersion, target)
+	return WriteOutput(target, output)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// VerifyOutputFile compares the conversion result with the existing (golden) file at the target location.
+// If they differ, the structural differences are logged (see DiffMaps) and a verification error is returned.
+func VerifyOutputFile(targetFile string, order binary.ByteOrder, output []byte) error {
+	golden, err := ReadInput(targetFile)
+	if err != nil {
+		return &ConversionError{Stage_Verification, fmt.Errorf("Failed to read the existing output file: %v", err)}
+	}
+
+	offset := firstDifference(golden, output)
+	if offset < 0 {
+		log.Infof("Output matches '%s'", targetFile)
+		return nil
+	}
+	log.Infof("Output differs from '%s' (%d -> %d bytes, first difference at offset %d)", targetFile, len(golden), len(output), offset)
+
+	old, err := DecodeMap(golden, order)
+	if err != nil {
+		log.Infof("\tThe existing file can't be decoded, no detailed comparison possible: %v", err)
+	} else if current, err := DecodeMap(output, order); err != nil {
+		log.Infof("\tThe conversion result can't be decoded, no detailed comparison possible: %v", err)
+	} else {
+		for _, diff := range DiffMaps(old, current) {
+			log.Infof("\t%s", diff)
+		}
+	}
+	return &ConversionError{Stage_Verification, fmt.Errorf("The output differs from '%s'", targetFile)}
+}
+
+// firstDifference returns the offset of the first byte that differs, or -1 if both are equal
+func firstDifference(a, b []byte) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	if len(a) != len(b) {
+		return minInt(len(a), len(b))
+	}
+	return -1
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// ConverterVersion is the semantic version of the converter
+const ConverterVersion = "1.1.0"
+
+// FormatVersion is the version of the binary output format (stored in the header)
+const FormatVersion uint8 = 0x06
+
+// SupportedFormatVersions lists all output format versions the converter can produce
+var SupportedFormatVersions = []int{0x02, 0x03, 0x04, 0x05, int(FormatVersion)}
+
+// IsSupportedFormatVersion returns true if the converter can produce the given output format version
+func IsSupportedFormatVersion(version int) bool {
+	for _, v := range SupportedFormatVersions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// SupportedTMXFeatures lists the Tiled features that are understood by the converter
+var SupportedTMXFeatures = []string{
+	"orthogonal",
+	"renderorder:right-down",
+	"layer-encoding:csv",
+	"layer-encoding:base64",
+	"layer-encoding:base64+zlib",
+	"layer-encoding:base64+gzip",
+	"layer-encoding:base64+zstd",
+	"layer-encoding:xml-tiles",
+	"external-tilesets",
+	"json-maps",
+	"objectgroup:BackgroundObjects",
+	"objectgroup:ForegroundObjects",
+	"objectgroup:Markers",
+	"image-layers",
+	"layer-offsets",
+	"properties",
+	"polyline-objects",
+	"flipped-tiles",
+	"input:http",
+	"input:s3",
+	"input:gs",
+}
+
+// VersionInfo describes the converter, used by build systems to enforce a minimum converter version
+type VersionInfo struct {
+	ConverterVersion string   `json:"converterVersion"`
+	FormatVersions   []int    `json:"formatVersions"`
+	TMXFeatures      []string `json:"tmxFeatures"`
+	MappingHash      string   `json:"mappingHash"` // changes whenever the spawn tile mapping changes
+	RulesetHash      string   `json:"rulesetHash"` // changes whenever validation limits change
+}
+
+// GetVersionInfo returns information about the converter and its mapping and rules
+func GetVersionInfo() VersionInfo {
+	return VersionInfo{
+		ConverterVersion: ConverterVersion,
+		FormatVersions:   SupportedFormatVersions,
+		TMXFeatures:      SupportedTMXFeatures,
+		MappingHash:      mappingHash(),
+		RulesetHash:      rulesetHash(),
+	}
+}
+
+// mappingHash returns a hash over the spawn tile mapping (see GetTileMapping)
+func mappingHash() string {
+	resourceMapping, waterdropSpawnMapping, playerMapping, buildingMapping, unitMapping := GetTileMapping()
+
+	var lines []string
+	lines = append(lines, fmt.Sprintf("resource:%d", resourceMapping))
+	lines = append(lines, fmt.Sprintf("waterdrop:%d", waterdropSpawnMapping))
+	for tile, m := range playerMapping {
+		lines = append(lines, fmt.Sprintf("player:%d:%d", tile, m.Player))
+	}
+	for tile, m := range buildingMapping {
+		lines = append(lines, fmt.Sprintf("building:%d:%d", tile, m.Type))
+	}
+	for tile, m := range unitMapping {
+		lines = append(lines, fmt.Sprintf("unit:%d:%d:%d", tile, m.Player, m.Type))
+	}
+	return hashLines(lines)
+}
+
+// rulesetHash returns a hash over the limits used for validating maps
+func rulesetHash() string {
+	return hashLines([]string{
+		"tilesize:256x256",
+		fmt.Sprintf("diagonal:%d", FIRST_DIAGONAL_TILE_TYPE),
+		fmt.Sprintf("bridgespan:%d", MaxBridgeSpan),
+		fmt.Sprintf("turret:%v:%d", TurretClearance, TurretArcStepDegrees),
+		"players:2-8",
+		"resources:1-255",
+	})
+}
+
+func hashLines(lines []string) string {
+	sort.Strings(lines)
+	var data []byte
+	for _, line := range lines {
+		data = append(data, line...)
+		data = append(data, '\n')
+	}
+	return sha256Hex(data)
+}
+
+// RunVersion prints the version information, either human-readable or as json
+func RunVersion(args []string) error {
+	flags := flag.NewFlagSet("version", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "Print machine-readable json")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	info := GetVersionInfo()
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(info)
+	}
+
+	fmt.Printf("TiledMapConverter %s\n", info.ConverterVersion)
+	fmt.Printf("Output format versions: %v\n", info.FormatVersions)
+	fmt.Printf("TMX features:           %v\n", info.TMXFeatures)
+	fmt.Printf("Mapping hash:           %s\n", info.MappingHash)
+	fmt.Printf("Ruleset hash:           %s\n", info.RulesetHash)
+	return nil
+}
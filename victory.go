@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+type VictoryMode uint8
+
+const (
+	VictoryMode_Annihilation  VictoryMode = 1
+	VictoryMode_KingOfTheHill VictoryMode = 2
+	VictoryMode_Economic      VictoryMode = 3
+)
+
+// VictoryConditions describe how a match on this map is won. They are read from the map properties:
+//
+// 'victory' is 'annihilation' (default), 'king-of-the-hill' or 'economic'.
+// 'timeLimit' is an optional time limit in seconds (0 = none).
+// King-of-the-hill maps need at least one rectangle marker with the type 'hill' and the property 'holdTime' (seconds).
+// Economic maps need the property 'resourceGoal'.
+type VictoryConditions struct {
+	Mode         VictoryMode
+	TimeLimit    float32
+	HoldTime     float32 // king-of-the-hill only
+	Hills        []Rect  // king-of-the-hill only
+	ResourceGoal int     // economic only
+}
+
+// ExtractVictoryConditions reads the victory conditions and validates that all required markers exist
+func ExtractVictoryConditions(tilemap *TileMap) (victory VictoryConditions, err error) {
+	props := tilemap.Properties
+
+	if victory.TimeLimit, err = props.GetFloat("timeLimit", 0); err != nil {
+		return victory, fmt.Errorf("Invalid victory conditions: %v", err)
+	}
+	if victory.TimeLimit < 0 {
+		return victory, fmt.Errorf("Invalid victory conditions: The time limit must not be negative")
+	}
+
+	hills := tilemap.GetMarkers("hill")
+
+	mode, ok := props.Get("victory")
+	if !ok {
+		mode = "annihilation"
+	}
+	switch strings.ToLower(mode) {
+	case "annihilation":
+		victory.Mode = VictoryMode_Annihilation
+
+	case "king-of-the-hill":
+		victory.Mode = VictoryMode_KingOfTheHill
+		if len(hills) == 0 {
+			return victory, fmt.Errorf("Invalid victory conditions: King-of-the-hill maps need at least one marker with the type 'hill'")
+		}
+		for _, object := range hills {
+			hill, err := tilemap.GetMarkerRect(object)
+			if err != nil {
+				return victory, fmt.Errorf("Invalid hill: %v", err)
+			}
+			victory.Hills = append(victory.Hills, hill)
+		}
+		if victory.HoldTime, err = props.GetFloat("holdTime", 0); err != nil {
+			return victory, fmt.Errorf("Invalid victory conditions: %v", err)
+		}
+		if victory.HoldTime <= 0 {
+			return victory, fmt.Errorf("Invalid victory conditions: King-of-the-hill maps need a positive 'holdTime' property")
+		}
+
+	case "economic":
+		victory.Mode = VictoryMode_Economic
+		if victory.ResourceGoal, err = props.GetInt("resourceGoal", 0); err != nil {
+			return victory, fmt.Errorf("Invalid victory conditions: %v", err)
+		}
+		if victory.ResourceGoal <= 0 {
+			return victory, fmt.Errorf("Invalid victory conditions: Economic maps need a positive 'resourceGoal' property")
+		}
+
+	default:
+		return victory, fmt.Errorf("Invalid victory conditions: The victory mode must be 'annihilation', 'king-of-the-hill' or 'economic', but is %q", mode)
+	}
+
+	if victory.Mode != VictoryMode_KingOfTheHill && len(hills) > 0 {
+		log.Warningf("The map contains %d hill markers, but is not a king-of-the-hill map", len(hills))
+	}
+	return victory, nil
+}
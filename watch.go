@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/op/go-logging"
+)
+
+// WatchInterval is the interval in which watched files are checked for changes
+const WatchInterval = 500 * time.Millisecond
+
+// WatchDebounce is how long a modified file must stay unchanged before it is converted.
+// Editors often save a file in several steps, which would otherwise trigger multiple conversions.
+const WatchDebounce = time.Second
+
+// fileState is used to detect modified files
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// watchedFile is the state of a single watched input
+type watchedFile struct {
+	state     fileState
+	changedAt time.Time // zero if the change was already handled
+	hash      [sha256.Size]byte
+	converted time.Time // last successful conversion, zero if there was none
+}
+
+// Watch converts all inputs and converts them again whenever they are modified (eg. saved by Tiled).
+// Directories and patterns are re-evaluated, so new maps are picked up as well. Runs until interrupted.
+// Conversions are not logged in detail. Instead, a single status line is printed for each change.
+// If a modified map can't be converted, the previous output files are kept.
+func Watch(args []string, options ConvertOptions) error {
+	for _, arg := range args {
+		if IsRemoteInput(arg) {
+			return fmt.Errorf("Remote inputs can't be watched: %s", arg)
+		}
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	log.Infof("Watching for changes. Press Ctrl+C to stop")
+
+	files := make(map[string]*watchedFile)
+	ticker := time.NewTicker(WatchInterval)
+	defer ticker.Stop()
+
+	for {
+		inputs, err := ExpandInputs(args)
+		if err != nil {
+			log.Warning(err)
+		}
+
+		now := time.Now()
+		for _, input := range inputs {
+			info, err := os.Stat(LongPath(input.Path))
+			if err != nil {
+				continue // the file is being replaced or was deleted
+			}
+			state := fileState{info.ModTime(), info.Size()}
+			file, ok := files[input.Path]
+			if !ok { // new files are converted immediately
+				file = &watchedFile{state: state}
+				files[input.Path] = file
+				watchConvert(input, file, options)
+				continue
+			}
+			if file.state != state {
+				file.state = state
+				file.changedAt = now
+				continue
+			}
+			if file.changedAt.IsZero() || now.Sub(file.changedAt) < WatchDebounce {
+				continue
+			}
+			file.changedAt = time.Time{}
+			watchConvert(input, file, options)
+		}
+
+		select {
+		case <-interrupt:
+			log.Info("Stopped watching")
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// watchConvert converts a watched map, unless its content didn't change since the last successful conversion, and prints the status line
+func watchConvert(input InputFile, file *watchedFile, options ConvertOptions) {
+	data, err := ioutil.ReadFile(LongPath(input.Path))
+	if err != nil {
+		log.Errorf("'%s': %v", input.Path, err)
+		return
+	}
+	hash := sha256.Sum256(data)
+	if hash == file.hash {
+		log.Infof("'%s' unchanged, skipped", input.Path)
+		return
+	}
+
+	warningsBefore := logWarningCount
+	previousLevel := SetConsoleLevel(logging.CRITICAL)
+	err = ConvertFile(input, options)
+	SetConsoleLevel(previousLevel)
+	warnings := logWarningCount - warningsBefore
+
+	switch {
+	case err == nil:
+		file.hash, file.converted = hash, time.Now()
+		log.Infof("'%s' converted (%d warnings)", input.Path, warnings)
+	case file.converted.IsZero():
+		log.Errorf("'%s' failed: %v", input.Path, err)
+	default:
+		log.Errorf("'%s' failed: %v. Keeping the output from %s", input.Path, err, file.converted.Format("15:04:05"))
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import "fmt"
+
+// WaterVolume is a contiguous body of water. Water is painted with tiles that have the boolean tile property 'water'
+// in any tile layer (usually a decoration layer). The tiles of the environment layer must not be completely solid there.
+type WaterVolume struct {
+	Spans   []BorderLine // horizontal runs of water tiles, sorted by y and x. StartY is the tile row
+	Surface []BorderLine // horizontal lines where the water touches air (pointing right). StartY is the grid line above the tiles
+	Tiles   int          // number of water tiles
+}
+
+// ExtractWaterVolumes finds all water tiles and groups them into contiguous volumes.
+// Two neighbouring water tiles belong to the same volume if there is no border between them.
+func ExtractWaterVolumes(tilemap *TileMap) ([]WaterVolume, error) {
+	environmentLayerIdx, err := tilemap.GetLayer("environment")
+	if err != nil {
+		return nil, err
+	}
+	environment := &tilemap.Layers[environmentLayerIdx]
+
+	isWater := getBoolScratch(tilemap.Width * tilemap.Height)
+	defer putBoolScratch(isWater)
+	waterCount := 0
+	for _, layer := range tilemap.Layers {
+		for i, tile := range layer.Tiles {
+			if tile.TileSet == nil || isWater[i] {
+				continue
+			}
+			water, err := tile.TileSet.GetTileProperties(tile.Index).GetBool("water", false)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid tile %d of tileset '%s': %v", tile.Index-1, tile.TileSet.Name, err)
+			}
+			if !water {
+				continue
+			}
+			if environment.Tiles[i].IsCompletelySolid() {
+				return nil, fmt.Errorf("Invalid water tile in layer '%s' (x=%d, y=%d): The tile is inside solid terrain", layer.Name, i%tilemap.Width, i/tilemap.Width)
+			}
+			isWater[i] = true
+			waterCount++
+		}
+	}
+	if waterCount == 0 {
+		return []WaterVolume{}, nil
+	}
+
+	// Everything except water is solid, so that regions only consist of connected water tiles
+	waterLayer := TileMapLayer{Tiles: getTileScratch(len(environment.Tiles))}
+	defer putTileScratch(waterLayer.Tiles)
+	for i, tile := range environment.Tiles {
+		if isWater[i] {
+			waterLayer.Tiles[i] = tile
+		} else {
+			waterLayer.Tiles[i] = Tile{Index: 1}
+		}
+	}
+	regions, err := ComputeRegions(tilemap.Width, tilemap.Height, &waterLayer)
+	if err != nil {
+		return nil, err
+	}
+
+	volumes := make([]WaterVolume, regions.Count)
+	for y := 0; y < tilemap.Height; y++ {
+		for x := 0; x < tilemap.Width; x++ {
+			region := regions.GetRegion(x, y)
+			if region == -1 {
+				continue
+			}
+			volume := &volumes[region]
+			volume.Tiles++
+			volume.Spans = extendLine(volume.Spans, x, y)
+
+			// The surface is where the tile above is neither water of the same volume nor solid terrain
+			above, err := environment.GetTile(x, y-1, tilemap.Width, tilemap.Height)
+			if err == nil && regions.GetRegion(x, y-1) != region && !above.IsCompletelySolid() {
+				volume.Surface = extendLine(volume.Surface, x, y)
+			}
+		}
+	}
+	return volumes, nil
+}
+
+// extendLine adds the tile to the last horizontal line if they are adjacent, or starts a new line otherwise
+func extendLine(lines []BorderLine, x, y int) []BorderLine {
+	if n := len(lines); n > 0 && lines[n-1].StartY == y && lines[n-1].StartX+lines[n-1].Length == x {
+		lines[n-1].Length++
+		return lines
+	}
+	return append(lines, BorderLine{StartX: x, StartY: y, Length: 1})
+}
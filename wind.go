@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// WindVector is the wind (or water current) acting on a single tile
+type WindVector struct {
+	X float32
+	Y float32
+}
+
+// WindField contains one wind vector per tile, stored row by row.
+// It is nil if the map doesn't contain any wind.
+type WindField []WindVector
+
+// ExtractWindField rasterizes all wind regions into a per-tile vector field.
+// Wind regions are rectangle objects with the type 'wind' inside the 'Markers' object layer.
+//
+//	'direction' is given in degrees (0 = right, 90 = down), 'strength' in tiles per second.
+//	If multiple regions overlap, their vectors are added.
+func ExtractWindField(tilemap *TileMap) (WindField, error) {
+	regions := tilemap.GetMarkers("wind")
+	if len(regions) == 0 {
+		return nil, nil
+	}
+
+	field := make(WindField, tilemap.Width*tilemap.Height)
+
+	for _, object := range regions {
+		area, err := tilemap.GetMarkerRect(object)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid wind region: %v", err)
+		}
+		direction, err := object.Properties.GetFloat("direction", 0)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid wind region %d (%q): %v", object.Id, object.Name, err)
+		}
+		strength, err := object.Properties.GetFloat("strength", 0)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid wind region %d (%q): %v", object.Id, object.Name, err)
+		}
+		if strength <= 0 {
+			return nil, fmt.Errorf("Invalid wind region %d (%q): The property 'strength' must be positive", object.Id, object.Name)
+		}
+
+		vecX := strength * float32(math.Cos(float64(direction)/180*math.Pi))
+		vecY := strength * float32(math.Sin(float64(direction)/180*math.Pi))
+
+		for y := 0; y < tilemap.Height; y++ {
+			for x := 0; x < tilemap.Width; x++ {
+				if area.ContainsTile(x, y) {
+					field[y*tilemap.Width+x].X += vecX
+					field[y*tilemap.Width+x].Y += vecY
+				}
+			}
+		}
+	}
+	return field, nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// windows1252 contains the characters of the code points 0x80-0x9F of Windows-1252. The rest is identical to ISO-8859-1.
+var windows1252 = [32]rune{
+	'€', 0x81, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0x8D, 'Ž', 0x8F,
+	0x90, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0x9D, 'ž', 'Ÿ',
+}
+
+// xmlDeclarationEncoding finds the encoding attribute of the XML declaration
+var xmlDeclarationEncoding = regexp.MustCompile(`^<\?xml[^>]*?\sencoding\s*=\s*("[^"]*"|'[^']*')`)
+
+// NormalizeXML converts an XML document (TMX, TSX) to UTF-8 before it's unmarshalled. Some editors on Windows save files
+// with a byte order mark, as UTF-16 or in a legacy encoding, which the xml package can't read.
+//   - UTF-8 byte order marks and whitespace in front of the XML declaration are removed
+//   - UTF-16 (LE and BE, with or without byte order mark) is converted to UTF-8
+//   - ISO-8859-1, Windows-1252 and US-ASCII (as declared in the XML declaration) are converted to UTF-8
+//   - CRLF and CR line breaks are converted to LF
+//
+// The encoding of the XML declaration is changed to UTF-8 accordingly.
+func NormalizeXML(data []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		data = data[3:]
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		data = decodeUTF16(data[2:], false)
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		data = decodeUTF16(data[2:], true)
+	case bytes.HasPrefix(data, []byte{'<', 0x00, '?', 0x00}):
+		data = decodeUTF16(data, false)
+	case bytes.HasPrefix(data, []byte{0x00, '<', 0x00, '?'}):
+		data = decodeUTF16(data, true)
+	}
+	data = bytes.TrimLeft(data, " \t\r\n")
+
+	if match := xmlDeclarationEncoding.FindSubmatchIndex(data); match != nil {
+		declared := string(data[match[2]+1 : match[3]-1])
+		switch strings.ToLower(strings.TrimSpace(declared)) {
+		case "utf-8", "utf8", "utf-16", "utf16", "utf-16le", "utf-16be", "us-ascii", "ascii":
+			// UTF-16 was already converted, ASCII is a subset of UTF-8
+		case "iso-8859-1", "iso8859-1", "latin1", "latin-1", "l1":
+			data = decodeSingleByte(data, false)
+		case "windows-1252", "cp1252", "cp-1252":
+			data = decodeSingleByte(data, true)
+		default:
+			return nil, fmt.Errorf("Unsupported encoding %q. Please save the file as UTF-8", declared)
+		}
+		// Offsets are still valid, the declaration itself only contains ASCII characters
+		quote := data[match[2]]
+		normalized := make([]byte, 0, len(data))
+		normalized = append(normalized, data[:match[2]]...)
+		normalized = append(normalized, quote)
+		normalized = append(normalized, "UTF-8"...)
+		normalized = append(normalized, quote)
+		data = append(normalized, data[match[3]:]...)
+	}
+	if !utf8.Valid(data) {
+		return nil, fmt.Errorf("The file is not valid UTF-8. Please save it as UTF-8 or declare its encoding in the XML declaration")
+	}
+
+	data = bytes.Replace(data, []byte("\r\n"), []byte("\n"), -1)
+	data = bytes.Replace(data, []byte("\r"), []byte("\n"), -1)
+	return data, nil
+}
+
+// decodeUTF16 converts UTF-16 (without byte order mark) to UTF-8
+func decodeUTF16(data []byte, bigEndian bool) []byte {
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		if bigEndian {
+			units[i] = uint16(data[2*i])<<8 | uint16(data[2*i+1])
+		} else {
+			units[i] = uint16(data[2*i+1])<<8 | uint16(data[2*i])
+		}
+	}
+	return []byte(string(utf16.Decode(units)))
+}
+
+// decodeSingleByte converts ISO-8859-1 or Windows-1252 to UTF-8
+func decodeSingleByte(data []byte, windows bool) []byte {
+	var utf8Data bytes.Buffer
+	utf8Data.Grow(len(data))
+	for _, b := range data {
+		if windows && b >= 0x80 && b < 0xA0 {
+			utf8Data.WriteRune(windows1252[b-0x80])
+		} else {
+			utf8Data.WriteRune(rune(b))
+		}
+	}
+	return utf8Data.Bytes()
+}